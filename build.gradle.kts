@@ -58,6 +58,8 @@ dependencies {
     implementation("com.github.ajalt.clikt:clikt:$cliktVersion")
     implementation("com.github.ajalt.mordant:mordant:2.7.1")
     implementation("org.eclipse.lsp4j:org.eclipse.lsp4j:0.23.1")
+    implementation("org.zeromq:jeromq:0.6.0")
+    implementation("org.tomlj:tomlj:1.1.1")
 }
 
 application {
@@ -20,14 +20,42 @@ package org.goodmath.simplex.parser;
 }
 
 model:
+    versionHeader?
     importLibrary*
     (def | product)+
 ;
 
 libraryModule:
+   versionHeader?
    def+
 ;
 
+// Selects the version of the language that a model or library was written for.
+// The header can only come first, so `simplex` isn't a keyword: the name is
+// checked when the header is read, and it can be used as a name anywhere else.
+versionHeader:
+   name=ID LIT_STRING
+;
+
+// A single expression, for tools that evaluate an expression in the
+// context of a model.
+standaloneExpr:
+   expr EOF
+;
+
+// A notebook cell: imports, followed by any mix of definitions and
+// expressions.
+cell:
+   importLibrary*
+   cellItem*
+   EOF
+;
+
+cellItem:
+  def #cellDef
+| expr #cellExpr
+;
+
 importLibrary:
   'import' path=LIT_STRING 'as' id=ID
 ;
@@ -37,30 +65,58 @@ def:
 | funDef #optFunDef
 | dataDef #optDataDef
 | methDef #optMethDef
+| namespaceDef #optNamespaceDef
+;
+
+namespaceDef:
+   'namespace' ID '{' def* '}'
 ;
 
 dataDef:
-   'data' ID '{' params '}'
+   annotation* 'data' ID '{' params '}'
 ;
 
 params:
    param (',' param)*
+// Simplex 0.1 parameters, like `radius <Float> height <Float>`.
+| legacyParam+
+;
+
+legacyParam:
+   ID '<' type '>'
+;
+
+annotation:
+   '@' ID ('(' annotationArg (',' annotationArg)* ')')?
+;
+
+annotationArg:
+   LIT_STRING #annotationStr
+| ID #annotationId
+| (LIT_FLOAT | LIT_INT) #annotationNum
 ;
 
 varDef:
-  'let' ID  (':' type)?  '=' expr
+  annotation* 'let' ID  (':' type)?  '=' expr
 ;
 
 funDef:
-
-   'fun' ID '(' params? ')' ':' type '{'
-    funDef*
+   annotation* 'fun' ID '(' params? ')' ':' type '{'
+    localDef*
     expr*
   '}'
  ;
 
+// Definitions local to a function. Local variables are defined
+// by `let` expressions in the function body.
+localDef:
+   funDef #localFunDef
+| dataDef #localDataDef
+| methDef #localMethDef
+;
+
  methDef:
-    'meth' target=type '->' ID '(' params? ')' ':' result=type '{'
+    annotation* 'meth' target=type '->' ID '(' params? ')' ':' result=type '{'
        expr+
     '}'
 ;
@@ -76,6 +132,7 @@ types:
 type:
   ID #optSimpleType
 | '[' type ']' #optVectorType
+| '{|' type '|}' #optSetType
 | '(' types? ')' ':' type # optFunType
 | target=type '->' '(' types? ')' ':' result=type #optMethodType
 ;
@@ -99,6 +156,7 @@ expr:
 | l=expr addOp r=expr #exprAdd
 | l=expr compareOp r=expr #exprCompare
 | l=expr logicOp r=expr #exprLogic
+| annotation+ expr #exprAnnotated
 ;
 
 complex:
@@ -114,6 +172,7 @@ primary:
   ID (':=' expr)? #optIdExpr
 | scope=ID '::' name=ID #optScopedId
 | '['  exprs   ']' #optVecExpr
+| '{|' exprs '|}' #optSetExpr
 | '#' ID '(' exprs ')' #optDataExpr
 | LIT_INT #optLitInt
 | LIT_FLOAT #optLitFloat
@@ -163,7 +222,7 @@ condClause:
 ;
 
 product:
-   'produce' '(' LIT_STRING ')' '{' expr+
+   annotation* 'produce' '(' LIT_STRING ')' '{' expr+
    '}'
 ;
 
@@ -1,6 +1,6 @@
 
 (defvar simplex-keywords nil "simplex keywords")
-(setq simplex-keywords '("var" "fun" "meth" "tup" "produce" "do" "end"))
+(setq simplex-keywords '("var" "fun" "meth" "namespace" "tup" "produce" "do" "end"))
 
 (defvar simplex-exprwords nil "simplex expression words")
 (setq simplex-exprwords '("for" "in" "let" "with" "update" "if" "then" "elif" "else"))
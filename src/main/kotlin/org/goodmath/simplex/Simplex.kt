@@ -16,21 +16,42 @@
 package org.goodmath.simplex
 
 import com.github.ajalt.clikt.core.CliktCommand
+import com.github.ajalt.clikt.core.NoOpCliktCommand
+import com.github.ajalt.clikt.core.subcommands
 import com.github.ajalt.clikt.parameters.arguments.argument
+import com.github.ajalt.clikt.parameters.arguments.multiple
 import com.github.ajalt.clikt.parameters.options.default
+import com.github.ajalt.clikt.parameters.options.flag
 import com.github.ajalt.clikt.parameters.options.option
+import com.github.ajalt.clikt.parameters.options.required
 import com.github.ajalt.clikt.parameters.options.split
+import com.github.ajalt.clikt.parameters.types.choice
+import com.github.ajalt.clikt.parameters.types.double
 import com.github.ajalt.clikt.parameters.types.int
 import com.github.ajalt.mordant.rendering.TextColors.*
 import kotlin.io.path.Path
+import kotlin.io.path.createDirectories
 import kotlin.io.path.exists
+import kotlin.io.path.readText
+import kotlin.io.path.writeText
 import kotlin.system.exitProcess
 import org.antlr.v4.runtime.CharStreams
+import org.goodmath.simplex.build.BuildConfig
+import org.goodmath.simplex.kernel.ConnectionInfo
+import org.goodmath.simplex.kernel.SimplexKernel
+import org.goodmath.simplex.lsp.SimplexLS
 import org.goodmath.simplex.parser.SimplexParseListener
+import org.goodmath.simplex.runtime.RootEnv
 import org.goodmath.simplex.runtime.SimplexError
+import org.goodmath.simplex.runtime.values.manifold.Quality
+import org.goodmath.simplex.runtime.values.manifold.Tolerance
+import org.goodmath.simplex.scad.ScadTranslator
 
-/** The simplex command line! */
-class Simplex : CliktCommand(help = "Evaluate a Simplex model") {
+/** The simplex command line! Each of the things that it can do is a subcommand. */
+class SimplexCommand : NoOpCliktCommand(name = "simplex", help = "Build and run Simplex models")
+
+/** Evaluate a model, writing the outputs of its products. */
+class Simplex : CliktCommand(name = "run", help = "Evaluate a Simplex model") {
     val input: String by
         argument(help = "The path to the input file. The pathname must end in .s3d")
     val prefix: String? by option("--prefix", help = "Prefix for all output files")
@@ -40,6 +61,13 @@ class Simplex : CliktCommand(help = "Evaluate a Simplex model") {
         option("--verbosity", help = "How chatty the execution of the model should be.")
             .int()
             .default(1)
+    val provenance: Boolean by
+        option("--provenance", help = "Write a file recording which source lines created each triangle")
+            .flag()
+    val warningsAsErrors: Boolean by
+        option("--warnings-as-errors", help = "Refuse to render a model that has warnings").flag()
+    val tolerance: Double? by
+        option("--tolerance", help = "The default tolerance for boolean operations on solids").double()
 
     override fun run() {
         if (!input.endsWith(".s3d")) {
@@ -63,8 +91,11 @@ class Simplex : CliktCommand(help = "Evaluate a Simplex model") {
             if (verbosity >= 1) {
                 echo(cyan("Loading model from $inputPath"))
             }
-            val result = SimplexParseListener().parse(input, stream, captiveEcho)
-            result.execute(products?.toSet(), pre, captiveEcho)
+            val parser = SimplexParseListener()
+            parser.importRoot = inputPath.toAbsolutePath().parent
+            val result = parser.parse(input, stream, captiveEcho)
+            Tolerance.default = tolerance ?: 0.0
+            result.execute(products?.toSet(), pre, captiveEcho, provenance, warningsAsErrors)
         } catch (e: SimplexError) {
             echo(e.message, err = true)
             if (verbosity >= 2) {
@@ -74,4 +105,206 @@ class Simplex : CliktCommand(help = "Evaluate a Simplex model") {
     }
 }
 
-fun main(args: Array<String>) = Simplex().main(args)
+/** Render an animation of a product, as a sequence of numbered frames. */
+class SimplexAnimate : CliktCommand(name = "animate", help = "Render an animation of a Simplex product") {
+    val input: String by
+        argument(help = "The path to the input file. The pathname must end in .s3d")
+    val product: String by option("--product", help = "The name of the product to animate").required()
+    val frames: Int by option("--frames", help = "The number of frames to render").int().default(30)
+    val format: String by
+        option("--format", help = "The format of the frames: stl meshes, or png images")
+            .choice("stl", "png")
+            .default("stl")
+    val width: Int by option("--width", help = "The width of png frames, in pixels").int().default(800)
+    val height: Int by option("--height", help = "The height of png frames, in pixels").int().default(600)
+    val prefix: String? by option("--prefix", help = "Prefix for all output files")
+    val verbosity: Int by
+        option("--verbosity", help = "How chatty the execution of the model should be.")
+            .int()
+            .default(1)
+    val warningsAsErrors: Boolean by
+        option("--warnings-as-errors", help = "Refuse to animate a model that has warnings").flag()
+    val tolerance: Double? by
+        option("--tolerance", help = "The default tolerance for boolean operations on solids").double()
+
+    override fun run() {
+        if (!input.endsWith(".s3d")) {
+            echo("input must be an s3d file", err = true)
+            exitProcess(1)
+        }
+        if (frames < 1) {
+            echo("there must be at least one frame", err = true)
+            exitProcess(1)
+        }
+        val pre = prefix ?: "${input.dropLast(4)}-out"
+        val captiveEcho: (level: Int, msg: Any?, err: Boolean) -> Unit = { level, msg, err ->
+            if (level <= verbosity) {
+                currentContext.terminal.println(msg, stderr = err)
+            }
+        }
+        try {
+            val parser = SimplexParseListener()
+            parser.importRoot = Path(input).toAbsolutePath().parent
+            val model = parser.parse(input, CharStreams.fromFileName(input), captiveEcho)
+            Tolerance.default = tolerance ?: 0.0
+            model.animate(product, frames, pre, format, width, height, captiveEcho, warningsAsErrors)
+        } catch (e: SimplexError) {
+            echo(e.message, err = true)
+            if (verbosity >= 2) {
+                e.printStackTrace()
+            }
+            exitProcess(1)
+        }
+    }
+}
+
+/**
+ * Build the models of a project, using the settings in the build section of the
+ * project's `simplex.toml`.
+ */
+class SimplexBuild : CliktCommand(name = "build", help = "Build the models of a project, as configured in simplex.toml") {
+    val models: List<String> by
+        argument(help = "The model files to build; by default, the models listed in simplex.toml").multiple()
+    val config: String? by
+        option("--config", help = "The build configuration; by default, the closest simplex.toml")
+    val profile: String? by option("--profile", help = "The build profile to use, like draft or release")
+    val products: List<String>? by
+        option("--products", help = "The names of product blocks to render").split(Regex(","))
+    val verbosity: Int by
+        option("--verbosity", help = "How chatty the execution of the model should be.")
+            .int()
+            .default(1)
+    val provenance: Boolean by
+        option("--provenance", help = "Write a file recording which source lines created each triangle")
+            .flag()
+    val warningsAsErrors: Boolean by
+        option("--warnings-as-errors", help = "Refuse to build models that have warnings").flag()
+    val tolerance: Double? by
+        option("--tolerance", help = "The default tolerance for boolean operations on solids").double()
+
+    override fun run() {
+        val captiveEcho: (level: Int, msg: Any?, err: Boolean) -> Unit = { level, msg, err ->
+            if (level <= verbosity) {
+                currentContext.terminal.println(msg, stderr = err)
+            }
+        }
+        val configPath = config?.let { Path(it) } ?: BuildConfig.find(Path(""))
+        if (configPath == null || !configPath.exists()) {
+            echo("no ${BuildConfig.FILE_NAME} found", err = true)
+            exitProcess(1)
+        }
+        var failures = 0
+        try {
+            val buildConfig = BuildConfig.load(configPath)
+            val profileName = profile ?: buildConfig.defaultProfile
+            val settings = buildConfig.settingsFor(profileName)
+            val variant = profileName ?: "default"
+            val outputDir = buildConfig.dir.resolve(settings.outputDir ?: BuildConfig.DEFAULT_OUTPUT_DIR)
+            val files = if (models.isEmpty()) buildConfig.modelFiles() else models.map { Path(it) }
+            if (files.isEmpty()) {
+                echo("no models to build", err = true)
+                exitProcess(1)
+            }
+            val modelNames = buildConfig.modelNames(files)
+            Quality.current = settings.quality ?: Quality.Normal
+            Tolerance.default = tolerance ?: settings.tolerance ?: 0.0
+            val wanted = (products ?: settings.products)?.toSet()
+            for (file in files) {
+                val modelName = modelNames.getValue(file)
+                try {
+                    captiveEcho(1, cyan("Building $file ($variant)"), false)
+                    RootEnv.reset()
+                    val parser = SimplexParseListener()
+                    parser.importRoot = file.toAbsolutePath().parent
+                    val model = parser.parse(file.toString(), CharStreams.fromPath(file), captiveEcho)
+                    if (wanted != null && model.products.none { it.name in wanted }) {
+                        captiveEcho(1, yellow("$file has none of the products ${wanted.joinToString(", ")}"), true)
+                        continue
+                    }
+                    model.render(
+                        wanted,
+                        captiveEcho,
+                        provenance,
+                        warningsAsErrors || settings.warningsAsErrors == true,
+                        { settings.formatsFor(it.name ?: "") },
+                    ) { product, ext ->
+                        val path = outputDir.resolve(settings.outputName(modelName, product.name ?: "", variant, ext))
+                        path.parent.createDirectories()
+                        path.toString()
+                    }
+                } catch (e: SimplexError) {
+                    echo(e.message, err = true)
+                    if (verbosity >= 2) {
+                        e.printStackTrace()
+                    }
+                    failures++
+                }
+            }
+        } catch (e: SimplexError) {
+            echo(e.message, err = true)
+            exitProcess(1)
+        }
+        if (failures > 0) {
+            echo("$failures models failed to build", err = true)
+            exitProcess(1)
+        }
+    }
+}
+
+/** Translate an OpenSCAD file into Simplex, reporting anything that couldn't be translated. */
+class SimplexImportScad : CliktCommand(name = "import-scad", help = "Translate an OpenSCAD file into Simplex") {
+    val input: String by argument(help = "The path of the OpenSCAD file")
+    val output: String by argument(help = "The path of the Simplex file to write")
+
+    override fun run() {
+        val inputPath = Path(input)
+        if (!inputPath.exists()) {
+            echo("input file $input doesn't exist", err = true)
+            exitProcess(1)
+        }
+        val (text, issues) =
+            try {
+                ScadTranslator.translate(input, inputPath.readText())
+            } catch (e: SimplexError) {
+                echo(e.message, err = true)
+                exitProcess(1)
+            }
+        Path(output).writeText(text)
+        for (issue in issues.sortedBy { it.line }) {
+            echo(yellow("$input:${issue.line}: ${issue.message}"), err = true)
+        }
+    }
+}
+
+/** Run the Simplex language server, speaking the language server protocol over stdin/stdout. */
+class SimplexLanguageServer : CliktCommand(name = "lsp", help = "Run the Simplex language server") {
+    override fun run() {
+        SimplexLS.launch(System.`in`, System.out)
+    }
+}
+
+/** Run a Jupyter kernel, using the sockets described by the connection file that Jupyter provides. */
+class SimplexKernelCommand : CliktCommand(name = "kernel", help = "Run a Jupyter kernel for Simplex") {
+    val connectionFile: String by argument(help = "The path of the Jupyter connection file")
+
+    override fun run() {
+        // Jupyter shows the kernel's standard output in its log, but notebook output
+        // goes through the kernel protocol.
+        RootEnv.echo = { _, msg, _ -> System.err.println(msg) }
+        SimplexKernel(ConnectionInfo.load(Path(connectionFile))).run()
+    }
+}
+
+/** The simplex command, with all of its subcommands. */
+fun simplexCommand(): CliktCommand =
+    SimplexCommand()
+        .subcommands(
+            Simplex(),
+            SimplexAnimate(),
+            SimplexBuild(),
+            SimplexImportScad(),
+            SimplexLanguageServer(),
+            SimplexKernelCommand(),
+        )
+
+fun main(args: Array<String>) = simplexCommand().main(args)
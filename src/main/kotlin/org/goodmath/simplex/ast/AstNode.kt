@@ -19,4 +19,18 @@ import org.goodmath.simplex.twist.Twistable
 
 data class Location(val file: String, val line: Int, val col: Int)
 
-abstract class AstNode(open val loc: Location) : Twistable
+abstract class AstNode(open val loc: Location) : Twistable {
+    /**
+     * The AST nodes directly contained in this node, for tools that need to walk the whole
+     * tree of a model.
+     */
+    open fun children(): List<AstNode> = emptyList()
+
+    /** Call a function on this node, and then on every node contained in it. */
+    fun walk(visit: (AstNode) -> Unit) {
+        visit(this)
+        for (child in children()) {
+            child.walk(visit)
+        }
+    }
+}
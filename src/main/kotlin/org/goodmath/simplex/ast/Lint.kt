@@ -0,0 +1,461 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.ast
+
+import org.goodmath.simplex.ast.def.DataDefinition
+import org.goodmath.simplex.ast.def.Definition
+import org.goodmath.simplex.ast.def.FunctionDefinition
+import org.goodmath.simplex.ast.def.InvokableDefinition
+import org.goodmath.simplex.ast.def.MethodDefinition
+import org.goodmath.simplex.ast.def.NamespaceDefinition
+import org.goodmath.simplex.ast.def.VariableDefinition
+import org.goodmath.simplex.ast.expr.AssignmentExpr
+import org.goodmath.simplex.ast.expr.BlockExpr
+import org.goodmath.simplex.ast.expr.CondExpr
+import org.goodmath.simplex.ast.expr.Expr
+import org.goodmath.simplex.ast.expr.FunCallExpr
+import org.goodmath.simplex.ast.expr.LambdaExpr
+import org.goodmath.simplex.ast.expr.LetExpr
+import org.goodmath.simplex.ast.expr.LiteralExpr
+import org.goodmath.simplex.ast.expr.LoopExpr
+import org.goodmath.simplex.ast.expr.MethodCallExpr
+import org.goodmath.simplex.ast.expr.Operator
+import org.goodmath.simplex.ast.expr.OperatorExpr
+import org.goodmath.simplex.ast.expr.ScopedRefExpr
+import org.goodmath.simplex.ast.expr.VarRefExpr
+import org.goodmath.simplex.ast.expr.WhileExpr
+import org.goodmath.simplex.ast.expr.WithExpr
+import org.goodmath.simplex.ast.types.Type
+import org.goodmath.simplex.ast.types.VectorType
+import org.goodmath.simplex.runtime.Env
+import org.goodmath.simplex.runtime.RootEnv
+import org.goodmath.simplex.runtime.values.AnyValueType
+import org.goodmath.simplex.runtime.values.manifold.SliceValueType
+import org.goodmath.simplex.runtime.values.manifold.SolidValueType
+
+/**
+ * The checks for problems in a model that aren't errors: code that's never used,
+ * names that hide other names, and so on. The checks run after a model has been
+ * validated, and add their findings to [RootEnv.warnings], along with the warnings
+ * found during validation, like uses of deprecated functions.
+ *
+ * Each warning has a category, and a definition, product or statement that's
+ * annotated with `@allow(category, ...)` doesn't get warnings in those categories,
+ * anywhere inside of it.
+ */
+object Lint {
+    const val UNUSED = "unused"
+    const val SHADOW = "shadow"
+    const val PRECISION = "precision"
+    const val UNREACHABLE = "unreachable"
+    const val NO_SOLID = "no_solid"
+    const val DEPRECATED = "deprecated"
+
+    /** The warning categories, which are the names that `@allow` accepts. */
+    val categories = setOf(UNUSED, SHADOW, PRECISION, UNREACHABLE, NO_SOLID, DEPRECATED)
+
+    /**
+     * Run the checks on a model that has been validated, and then drop the warnings
+     * that are suppressed by `@allow` annotations.
+     */
+    fun check(model: Model) {
+        checkProducts(model)
+        checkUnused(model)
+        checkShadowing(model)
+        val truncatedGlobals = truncatedVariables(model.defs.filterIsInstance<VariableDefinition>(), emptySet())
+        for (node in model.children()) {
+            val truncated = truncatedVariables(listOf(node), truncatedGlobals)
+            walk(node) { n ->
+                checkPrecision(n, truncated)
+                checkUnreachable(n)
+            }
+        }
+        suppress(model)
+    }
+
+    private fun walk(node: AstNode, visit: (AstNode) -> Unit) {
+        visit(node)
+        for (child in node.children()) {
+            walk(child, visit)
+        }
+    }
+
+    /** The names referenced anywhere in a list of nodes. Scoped names are written `scope::name`. */
+    private fun references(nodes: List<AstNode>): Set<String> {
+        val result = HashSet<String>()
+        for (node in nodes) {
+            walk(node) { n ->
+                when (n) {
+                    is VarRefExpr -> result.add(n.name)
+                    is AssignmentExpr -> result.add(n.target)
+                    is ScopedRefExpr -> result.add("${n.scope}::${n.name}")
+                }
+            }
+        }
+        return result
+    }
+
+    /** Names that start with an underscore are deliberately unused. */
+    private fun ignored(name: String): Boolean = name.startsWith("_")
+
+    private fun checkUnused(model: Model) {
+        val used = references(model.children())
+        for (def in model.defs) {
+            if (def is VariableDefinition && def.name !in used && !ignored(def.name)) {
+                RootEnv.warn(UNUSED, "Variable ${def.name} is never used", def.loc)
+            } else if (def is NamespaceDefinition) {
+                for (d in def.defs) {
+                    if (d is VariableDefinition && d.name !in used && "${def.name}::${d.name}" !in used &&
+                        !ignored(d.name)) {
+                        RootEnv.warn(UNUSED, "Variable ${def.name}::${d.name} is never used", d.loc)
+                    }
+                }
+            }
+        }
+        for (node in model.children()) {
+            walk(node) { n ->
+                when (n) {
+                    is InvokableDefinition -> {
+                        checkUnusedParams(n.params.map { Pair(it.name, it.loc) }, n.localDefs + n.body)
+                        checkUnusedLets(n.body, n.localDefs)
+                    }
+                    is LambdaExpr -> {
+                        checkUnusedParams(n.params.map { Pair(it.name, it.loc) }, n.body)
+                        checkUnusedLets(n.body)
+                    }
+                    is BlockExpr -> checkUnusedLets(n.body)
+                    is LoopExpr -> checkUnusedLets(n.body)
+                    is WhileExpr -> checkUnusedLets(n.body)
+                    is WithExpr -> checkUnusedLets(n.body)
+                }
+            }
+        }
+    }
+
+    private fun checkUnusedParams(params: List<Pair<String, Location>>, scope: List<AstNode>) {
+        val used = references(scope)
+        for ((name, loc) in params) {
+            if (name !in used && !ignored(name)) {
+                RootEnv.warn(UNUSED, "Parameter $name is never used", loc)
+            }
+        }
+    }
+
+    /**
+     * Check the `let`s in a body. The last expression of a body is its value, so
+     * a `let` there is always used; any other `let` is used if a later expression,
+     * or a local definition, refers to it.
+     */
+    private fun checkUnusedLets(body: List<Expr>, localDefs: List<Definition> = emptyList()) {
+        for ((i, expr) in body.withIndex()) {
+            if (expr is LetExpr && i < body.size - 1 && !ignored(expr.name)) {
+                if (expr.name !in references(body.drop(i + 1) + localDefs)) {
+                    RootEnv.warn(UNUSED, "Variable ${expr.name} is never used", expr.loc)
+                }
+            }
+        }
+    }
+
+    /**
+     * The names that are visible at each point of the walk in [checkShadowing], as a
+     * stack of scopes.
+     */
+    private class Scopes {
+        val scopes = ArrayList<MutableSet<String>>()
+
+        fun declare(name: String, loc: Location) {
+            if (!ignored(name) && scopes.dropLast(1).any { name in it }) {
+                RootEnv.warn(SHADOW, "$name hides another variable named $name", loc)
+            }
+            scopes.last().add(name)
+        }
+
+        fun inScope(names: Collection<String> = emptyList(), body: () -> Unit) {
+            scopes.add(names.toHashSet())
+            body()
+            scopes.removeAt(scopes.size - 1)
+        }
+    }
+
+    private fun checkShadowing(model: Model) {
+        val scopes = Scopes()
+        val topLevel = model.defs.filter { it is VariableDefinition || it is FunctionDefinition }.map { it.name }
+        scopes.inScope(topLevel) {
+            for (def in model.defs) {
+                shadowingIn(def, scopes)
+            }
+            for (product in model.products) {
+                scopes.inScope { product.body.forEach { shadowingIn(it, scopes) } }
+            }
+        }
+    }
+
+    private fun shadowingIn(node: AstNode, scopes: Scopes) {
+        when (node) {
+            is NamespaceDefinition -> {
+                val names = node.defs.filter { it is VariableDefinition || it is FunctionDefinition }.map { it.name }
+                scopes.inScope(names) { node.defs.forEach { shadowingIn(it, scopes) } }
+            }
+            is FunctionDefinition ->
+                scopes.inScope {
+                    node.params.forEach { scopes.declare(it.name, it.loc) }
+                    node.localDefs.filterIsInstance<FunctionDefinition>().forEach { scopes.declare(it.name, it.loc) }
+                    node.body.forEach { shadowingIn(it, scopes) }
+                    node.localDefs.forEach { shadowingIn(it, scopes) }
+                }
+            is MethodDefinition ->
+                scopes.inScope(listOf("self")) {
+                    node.params.forEach { scopes.declare(it.name, it.loc) }
+                    node.body.forEach { shadowingIn(it, scopes) }
+                }
+            is DataDefinition -> {}
+            is LetExpr -> {
+                shadowingIn(node.value, scopes)
+                scopes.declare(node.name, node.loc)
+            }
+            // Lambda parameters are usually short throwaway names, and they're
+            // written right where they're used, so reusing a name isn't reported.
+            is LambdaExpr ->
+                scopes.inScope(node.params.map { it.name }) { node.body.forEach { shadowingIn(it, scopes) } }
+            is LoopExpr -> {
+                shadowingIn(node.collExpr, scopes)
+                scopes.inScope {
+                    scopes.declare(node.idxVar, node.loc)
+                    node.body.forEach { shadowingIn(it, scopes) }
+                }
+            }
+            is WhileExpr -> {
+                shadowingIn(node.cond, scopes)
+                scopes.inScope { node.body.forEach { shadowingIn(it, scopes) } }
+            }
+            is WithExpr -> {
+                // The fields of the focus are deliberately brought into scope, so they
+                // aren't reported.
+                shadowingIn(node.focus, scopes)
+                scopes.inScope { node.body.forEach { shadowingIn(it, scopes) } }
+            }
+            is BlockExpr -> scopes.inScope { node.body.forEach { shadowingIn(it, scopes) } }
+            else -> node.children().forEach { shadowingIn(it, scopes) }
+        }
+    }
+
+    /**
+     * Was part of an Int expression's value already discarded: does it contain an
+     * integer division, or use an Int variable in [truncated], whose value did? Lambdas
+     * are skipped, since their bodies aren't part of the expression's value.
+     */
+    private fun truncates(node: AstNode, truncated: Set<String>): Boolean =
+        when (node) {
+            is LambdaExpr -> false
+            is OperatorExpr -> node.integerDivision || node.args.any { truncates(it, truncated) }
+            is VarRefExpr -> node.name in truncated
+            else -> node.children().any { truncates(it, truncated) }
+        }
+
+    /**
+     * The names of the Int variables defined in some nodes whose values were computed
+     * with an integer division, added to the ones in [outer]. Variables are matched by
+     * name, so a truncated variable that's hidden by another of the same name is still
+     * counted; the shadowing check reports that anyway.
+     */
+    private fun truncatedVariables(nodes: List<AstNode>, outer: Set<String>): Set<String> {
+        val result = HashSet(outer)
+        for (node in nodes) {
+            walk(node) { n ->
+                when (n) {
+                    is LetExpr ->
+                        if ((n.type ?: n.inferredType) == Type.IntType && truncates(n.value, result)) {
+                            result.add(n.name)
+                        }
+                    is VariableDefinition ->
+                        if ((n.type ?: n.inferredType) == Type.IntType && truncates(n.initialValue, result)) {
+                            result.add(n.name)
+                        }
+                }
+            }
+        }
+        return result
+    }
+
+    /**
+     * An Int literal whose magnitude is more than this can't be converted to a Float
+     * in a solid's mesh exactly, since meshes store their coordinates as 32-bit floats.
+     */
+    private const val EXACT_INT_LIMIT = 1 shl 24
+
+    /** An Int literal, possibly negated, that's too large to convert to a Float exactly. */
+    private fun largeLiteral(expr: Expr): Int? =
+        when {
+            expr is LiteralExpr<*> -> (expr.v as? Int)?.takeIf { it > EXACT_INT_LIMIT || it < -EXACT_INT_LIMIT }
+            expr is OperatorExpr && expr.op == Operator.Uminus -> largeLiteral(expr.args[0])?.let { -it }
+            else -> null
+        }
+
+    /**
+     * Converting an Int to a Float is usually harmless, but some conversions lose
+     * precision: when the Int was computed with an integer division, directly or through
+     * a variable, the remainder was already discarded, and a very large Int literal
+     * can't be represented exactly once it's part of a mesh.
+     */
+    private fun checkPrecision(node: AstNode, truncated: Set<String>) {
+        fun check(expected: Type?, actual: Type?, expr: Expr) {
+            if (expected != Type.FloatType || actual != Type.IntType) {
+                return
+            }
+            val literal = largeLiteral(expr)
+            if (literal != null) {
+                RootEnv.warn(
+                    PRECISION,
+                    "$literal is too large to be converted to Float exactly; " +
+                        "Floats in meshes only have 24 bits of precision",
+                    expr.loc,
+                )
+            } else if (expr is VarRefExpr && expr.name in truncated) {
+                RootEnv.warn(
+                    PRECISION,
+                    "${expr.name} was computed with an integer division, which discarded the remainder " +
+                        "before it's converted to Float here; use a Float operand, like 2.0, to keep it",
+                    expr.loc,
+                )
+            } else if (truncates(expr, truncated)) {
+                RootEnv.warn(
+                    PRECISION,
+                    "Integer division discards the remainder before the result is converted to Float; " +
+                        "use a Float operand, like 2.0, to keep it",
+                    expr.loc,
+                )
+            }
+        }
+        when (node) {
+            is FunCallExpr -> {
+                val params = node.paramTypes ?: return
+                val args = node.argTypes ?: return
+                for (i in node.argExprs.indices) {
+                    check(params.getOrNull(i), args.getOrNull(i), node.argExprs[i])
+                }
+            }
+            is MethodCallExpr -> {
+                val params = node.paramTypes ?: return
+                val args = node.argTypes ?: return
+                for (i in node.args.indices) {
+                    check(params.getOrNull(i), args.getOrNull(i), node.args[i])
+                }
+            }
+            is LetExpr -> check(node.type, node.inferredType, node.value)
+            is VariableDefinition -> check(node.type, node.inferredType, node.initialValue)
+        }
+    }
+
+    /** The value of a condition that's always the same, or null if it isn't constant. */
+    private fun constantCondition(e: Expr): Boolean? =
+        when {
+            e is VarRefExpr && e.name == "true" -> true
+            e is VarRefExpr && e.name == "false" -> false
+            e is OperatorExpr && e.op == Operator.Not -> constantCondition(e.args[0])?.not()
+            else -> null
+        }
+
+    private fun checkUnreachable(node: AstNode) {
+        if (node !is CondExpr) {
+            return
+        }
+        for ((i, cond) in node.conds.withIndex()) {
+            when (constantCondition(cond.cond)) {
+                false ->
+                    RootEnv.warn(
+                        UNREACHABLE,
+                        "This branch is never taken, because its condition is always false",
+                        cond.value.loc,
+                    )
+                true -> {
+                    for (later in node.conds.drop(i + 1)) {
+                        RootEnv.warn(
+                            UNREACHABLE,
+                            "This branch is never taken, because an earlier condition is always true",
+                            later.value.loc,
+                        )
+                    }
+                    RootEnv.warn(
+                        UNREACHABLE,
+                        "The else branch is never taken, because an earlier condition is always true",
+                        node.elseClause.loc,
+                    )
+                    return
+                }
+                null -> {}
+            }
+        }
+    }
+
+    /**
+     * Does a product result of a type get written to an output file: a mesh, an SVG
+     * of slices, a drawing, a tetrahedral mesh, or text? Values that can't be written
+     * as text are only dumped as twists, for debugging. Types that can't be resolved
+     * are given the benefit of the doubt.
+     */
+    private fun exportable(type: Type): Boolean {
+        if (type is VectorType && type.elementType == SliceValueType.asType) {
+            return true
+        }
+        val valueType = Type.valueTypes[type] ?: return true
+        return valueType == SolidValueType ||
+            valueType == SliceValueType ||
+            valueType == AnyValueType ||
+            valueType.supportsText
+    }
+
+    private fun checkProducts(model: Model) {
+        for (product in model.products) {
+            val types =
+                try {
+                    product.resultTypes(Env(emptyList(), RootEnv))
+                } catch (e: Exception) {
+                    // Errors in products are reported when they're checked or run.
+                    continue
+                }
+            if (types.none { exportable(it) }) {
+                RootEnv.warn(NO_SOLID, "Product ${product.name} doesn't produce anything to export", product.loc)
+            }
+        }
+    }
+
+    /** Remove the warnings that are suppressed by `@allow` annotations. */
+    private fun suppress(model: Model) {
+        val allowedAt = HashMap<Location, MutableSet<String>>()
+        fun record(node: AstNode, inherited: Set<String>) {
+            val annotations =
+                when (node) {
+                    is Definition -> node.annotations
+                    is Product -> node.annotations
+                    is Expr -> node.annotations
+                    else -> emptyList()
+                }
+            val allowed = inherited + annotations.filter { it.name == "allow" }.flatMap { it.args }
+            if (allowed.isNotEmpty()) {
+                allowedAt.getOrPut(node.loc) { HashSet() }.addAll(allowed)
+            }
+            for (child in node.children()) {
+                record(child, allowed)
+            }
+        }
+        for (node in model.children()) {
+            record(node, emptySet())
+        }
+        RootEnv.warnings.removeIf { w ->
+            w.location != null && allowedAt[w.location]?.contains(w.category) == true
+        }
+    }
+}
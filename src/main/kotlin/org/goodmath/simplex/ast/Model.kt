@@ -17,16 +17,32 @@ package org.goodmath.simplex.ast
 
 import com.github.ajalt.mordant.rendering.TextColors.*
 import kotlin.io.path.Path
+import kotlin.io.path.writeBytes
 import kotlin.io.path.writeText
+import org.goodmath.simplex.ast.def.Annotation
 import org.goodmath.simplex.ast.def.Definition
 import org.goodmath.simplex.ast.expr.Expr
+import org.goodmath.simplex.ast.types.Type
+import org.goodmath.simplex.parser.LanguageVersion
 import org.goodmath.simplex.runtime.Env
 import org.goodmath.simplex.runtime.RootEnv
+import org.goodmath.simplex.runtime.SimplexAnalysisError
 import org.goodmath.simplex.runtime.SimplexError
 import org.goodmath.simplex.runtime.SimplexEvaluationError
+import org.goodmath.simplex.runtime.SimplexWarning
+import org.goodmath.simplex.runtime.values.Value
+import org.goodmath.simplex.runtime.values.manifold.Drawing
+import org.goodmath.simplex.runtime.values.manifold.MeshData
+import org.goodmath.simplex.runtime.values.manifold.MeshRenderer
+import org.goodmath.simplex.runtime.values.manifold.Provenance
 import org.goodmath.simplex.runtime.values.manifold.SMaterial
+import org.goodmath.simplex.runtime.values.manifold.Slice
+import org.goodmath.simplex.runtime.values.manifold.SlicerVolume
 import org.goodmath.simplex.runtime.values.manifold.Solid
 import org.goodmath.simplex.runtime.values.manifold.SolidValueType
+import org.goodmath.simplex.runtime.values.manifold.TetMesh
+import org.goodmath.simplex.runtime.values.manifold.Tolerance
+import org.goodmath.simplex.runtime.values.primitives.VectorValue
 import org.goodmath.simplex.twist.Twist
 import org.goodmath.simplex.twist.plus
 
@@ -35,11 +51,24 @@ import org.goodmath.simplex.twist.plus
  *
  * @param defs the list of all top-level definitions in the model.
  * @param loc the location of the model declaration in the source file.
+ * @param languageVersion the version of the language that the model was written for.
  */
-class Model(val defs: List<Definition>, val products: List<Product>, loc: Location) : AstNode(loc) {
+class Model(
+    val defs: List<Definition>,
+    val products: List<Product>,
+    loc: Location,
+    val languageVersion: LanguageVersion = LanguageVersion.current,
+) : AstNode(loc) {
+    override fun children(): List<AstNode> = defs + products
+
     override fun twist(): Twist = Twist.obj("Model", Twist.array("defs", defs))
 
-    fun analyze() {
+    /**
+     * Check the model for errors, throwing an exception at the first one that's found.
+     *
+     * @return the warnings found while checking the model.
+     */
+    fun analyze(): List<SimplexWarning> {
         for (d in defs) {
             RootEnv.addDefinition(d)
         }
@@ -47,17 +76,117 @@ class Model(val defs: List<Definition>, val products: List<Product>, loc: Locati
         for (d in defs) {
             d.validate(RootEnv)
         }
+        Lint.check(this)
+        return RootEnv.warnings.toList()
+    }
+
+    /**
+     * Print the warnings found by [analyze]. If warnings are being treated as errors,
+     * they're printed as errors, and then the model is rejected.
+     */
+    private fun echoWarnings(
+        warnings: List<SimplexWarning>,
+        echo: (Int, Any?, Boolean) -> Unit,
+        warningsAsErrors: Boolean,
+    ) {
+        for (w in warnings) {
+            echo(0, if (warningsAsErrors) red(w.toString()) else yellow(w.toString()), true)
+        }
+        if (warningsAsErrors && warnings.isNotEmpty()) {
+            throw SimplexAnalysisError(
+                "Model has ${warnings.size} warnings, which are treated as errors",
+                loc = loc,
+            )
+        }
+    }
+
+    /**
+     * Analyze the model like [analyze], but instead of stopping at the first error,
+     * check each definition and product separately, and return all of the errors
+     * that were found. This is used by tools like the language server, which want
+     * to report as many problems as possible.
+     */
+    fun check(): List<SimplexError> {
+        val errors = ArrayList<SimplexError>()
+        fun record(node: AstNode, e: Exception) {
+            if (e is SimplexError) {
+                if (e.location == null) {
+                    e.location = node.loc
+                }
+                errors.add(e)
+            } else {
+                errors.add(SimplexAnalysisError("Internal error", cause = e, loc = node.loc))
+            }
+        }
+        for (d in defs) {
+            RootEnv.addDefinition(d)
+        }
+        try {
+            RootEnv.installStaticDefinitions()
+        } catch (e: Exception) {
+            record(this, e)
+        }
+        for (d in defs) {
+            try {
+                d.validate(RootEnv)
+            } catch (e: Exception) {
+                record(d, e)
+            }
+        }
+        for (p in products) {
+            try {
+                p.validate(RootEnv)
+            } catch (e: Exception) {
+                record(p, e)
+            }
+        }
+        try {
+            Lint.check(this)
+        } catch (e: Exception) {
+            record(this, e)
+        }
+        return errors
     }
 
+    /**
+     * Render the products of the model.
+     *
+     * @param renderNames the names of the products to render, or null for all of them.
+     * @param outputPrefix the prefix for the names of the output files.
+     * @param provenance if true, write a sidecar file next to each rendered mesh, recording
+     *    which source locations created its triangles.
+     * @param warningsAsErrors if true, refuse to render a model that has warnings.
+     */
     fun execute(
         renderNames: Set<String>?,
         outputPrefix: String,
         echo: (Int, Any?, Boolean) -> Unit,
+        provenance: Boolean = false,
+        warningsAsErrors: Boolean = false,
+    ) {
+        render(renderNames, echo, provenance, warningsAsErrors) { product, ext -> "$outputPrefix-${product.name}.$ext" }
+    }
+
+    /**
+     * Render the products of the model, like [execute], but with control over the
+     * formats of the meshes, and the names of the output files.
+     *
+     * @param formats the formats to write the solid of each product in.
+     * @param outputPath the path of the file for one of the outputs of a product, given
+     *    its extension, like "stl" or "drawing.svg".
+     */
+    fun render(
+        renderNames: Set<String>?,
+        echo: (Int, Any?, Boolean) -> Unit,
+        provenance: Boolean = false,
+        warningsAsErrors: Boolean = false,
+        formats: (Product) -> List<String> = { listOf("stl") },
+        outputPath: (Product, String) -> String,
     ) {
         val rootEnv = Env.createRootEnv()
         RootEnv.echo = echo
 
-        analyze()
+        echoWarnings(analyze(), echo, warningsAsErrors)
         val executionEnv = Env(defs, rootEnv)
         executionEnv.installDefinitionValues()
         val toRender =
@@ -68,7 +197,63 @@ class Model(val defs: List<Definition>, val products: List<Product>, loc: Locati
             }
         for (product in toRender) {
             echo(1, cyan("Rendering ${product.name}"), false)
-            product.execute(executionEnv, echo, outputPrefix)
+            product.execute(executionEnv, echo, { ext -> outputPath(product, ext) }, provenance, formats(product))
+        }
+    }
+
+    /**
+     * Render an animation of a product. The product is evaluated once for each frame,
+     * with the root variable `time` going from 0.0 at the first frame to 1.0 at the
+     * last. The top-level definitions are re-evaluated for each frame too, so they can
+     * also depend on the time.
+     *
+     * @param productName the name of the product to animate.
+     * @param frames the number of frames.
+     * @param outputPrefix the prefix for the frame files, which are named
+     *    `prefix-product-0000.ext`.
+     * @param format the format of the frames: "stl" for meshes, or "png" for images.
+     * @param width the width of PNG frames, in pixels.
+     * @param height the height of PNG frames, in pixels.
+     * @param warningsAsErrors if true, refuse to animate a model that has warnings.
+     */
+    fun animate(
+        productName: String,
+        frames: Int,
+        outputPrefix: String,
+        format: String,
+        width: Int,
+        height: Int,
+        echo: (Int, Any?, Boolean) -> Unit,
+        warningsAsErrors: Boolean = false,
+    ) {
+        val product =
+            products.firstOrNull { it.name == productName }
+                ?: throw SimplexEvaluationError("Model has no product named '$productName'")
+        Env.createRootEnv()
+        RootEnv.echo = echo
+        echoWarnings(analyze(), echo, warningsAsErrors)
+        // The view is framed on the first frame, and then kept for the rest, so that
+        // the frames line up.
+        var renderer: MeshRenderer? = null
+        for (frame in 0 until frames) {
+            RootEnv.time = if (frames > 1) frame.toDouble() / (frames - 1) else 0.0
+            val frameEnv = Env(defs, RootEnv)
+            frameEnv.installDefinitionValues()
+            val combined = product.combineSolids(product.evaluate(frameEnv))
+            if (combined == null) {
+                echo(0, red("Frame $frame of $productName didn't produce a solid"), true)
+                continue
+            }
+            val filename = "$outputPrefix-$productName-${"%04d".format(frame)}.$format"
+            echo(1, cyan("Rendering frame $frame (time = ${RootEnv.time}) to $filename"), false)
+            if (format == "png") {
+                val mesh = MeshData.of(combined)
+                val r = renderer ?: MeshRenderer.framing(mesh, width, height)
+                renderer = r
+                r.writePng(mesh, filename)
+            } else {
+                combined.export(filename, SMaterial.smoothGray)
+            }
         }
     }
 }
@@ -81,38 +266,170 @@ class Model(val defs: List<Definition>, val products: List<Product>, loc: Locati
  * @param loc the source location of the render block.
  */
 class Product(val name: String?, val body: List<Expr>, loc: Location) : AstNode(loc) {
+    /** The annotations written before the product. */
+    var annotations: List<Annotation> = emptyList()
+
+    /**
+     * The default tolerance for the boolean operations in the product, if it's annotated
+     * with `@tolerance`; otherwise null, and the model's default is used.
+     */
+    val tolerance: Double?
+        get() = annotations.firstOrNull { it.name == "tolerance" }?.args?.first()?.toDouble()
+
+    override fun children(): List<AstNode> = body
+
     override fun twist(): Twist =
         Twist.obj("Product", Twist.attr("name", name), Twist.array("body", body))
 
-    fun execute(env: Env, echo: (Int, Any?, Boolean) -> Unit, prefix: String) {
-        val prefixLastSegment = prefix.substring(prefix.lastIndexOf('/') + 1)
-        val results =
-            try {
-                body.map { it.evaluateIn(env) }
-            } catch (e: Exception) {
-                if (e is SimplexError) {
-                    if (e.location == null) {
-                        e.location = loc
-                    }
-                    throw e
-                } else {
-                    throw SimplexEvaluationError("Error evaluating model", cause = e, loc = loc)
+    /**
+     * Statically check the expressions in the product body. Product bodies aren't
+     * checked when a model is executed, but tools like the language server
+     * use this to report problems in them.
+     */
+    fun validate(env: Env) {
+        val productEnv = Env(emptyList(), env)
+        for (expr in body) {
+            expr.validate(productEnv)
+        }
+    }
+
+    /** Validate the product body, and return the types of the values that it produces. */
+    fun resultTypes(env: Env): List<Type> {
+        val productEnv = Env(emptyList(), env)
+        return body.map { expr ->
+            expr.validate(productEnv)
+            expr.resultType(productEnv)
+        }
+    }
+
+    /**
+     * Evaluate the expressions in the product body, returning their values. The
+     * product's tolerance is in effect while they're evaluated.
+     */
+    fun evaluate(env: Env): List<Value> {
+        return try {
+            Tolerance.withDefault(tolerance) { body.map { it.evaluateIn(env) } }
+        } catch (e: Exception) {
+            if (e is SimplexError) {
+                if (e.location == null) {
+                    e.location = loc
                 }
+                throw e
+            } else {
+                throw SimplexEvaluationError("Error evaluating model", cause = e, loc = loc)
             }
+        }
+    }
+
+    /**
+     * Combine all of the solids in the results of evaluating the product into a
+     * single body, or return null if there aren't any.
+     */
+    fun combineSolids(results: List<Value>): Solid? {
         val bodies = results.filter { it is Solid }.map { it as Solid }
-        if (bodies.isNotEmpty()) {
-            var combined = bodies.first()
-            for (body in bodies.drop(0)) {
-                combined = combined + body
+        if (bodies.isEmpty()) {
+            return null
+        }
+        var combined = bodies.first()
+        for (body in bodies.drop(0)) {
+            combined = combined + body
+        }
+        return combined
+    }
+
+    /**
+     * The slices in a product result: either a single slice, or a vector of them,
+     * like the nets returned by `Solid->unfold`.
+     */
+    private fun sliceProducts(v: Value): List<Slice> =
+        when {
+            v is Slice -> listOf(v)
+            v is VectorValue && v.elements.isNotEmpty() && v.elements.all { it is Slice } ->
+                v.elements.map { it as Slice }
+            else -> emptyList()
+        }
+
+    /**
+     * Evaluate the product, and write its results.
+     *
+     * @param outputPath the path of the file for one of the outputs of the product, given
+     *    its extension, like "stl" or "drawing.svg".
+     * @param formats the formats to write the combined solid in: mesh formats like "stl"
+     *    or "3mf", or "png" for a rendered image.
+     */
+    fun execute(
+        env: Env,
+        echo: (Int, Any?, Boolean) -> Unit,
+        outputPath: (String) -> String,
+        provenance: Boolean = false,
+        formats: List<String> = listOf("stl"),
+    ) {
+        fun fileName(ext: String): String = Path(outputPath(ext)).fileName.toString()
+        val results = evaluate(env)
+        val bodies = results.filter { it is Solid }.map { it as Solid }
+        val combined = combineSolids(results)
+        val volumes = results.filterIsInstance<SlicerVolume>()
+        if (combined != null) {
+            for (format in formats) {
+                // A product with slicer volumes is written as a slicer's 3MF file below.
+                if (format == "3mf" && volumes.isNotEmpty()) {
+                    continue
+                }
+                echo(1, cyan("Rendering 3d model of ${bodies.size} bodies to ${fileName(format)}"), false)
+                if (format == "png") {
+                    val mesh = MeshData.of(combined)
+                    MeshRenderer.framing(mesh, 800, 600).writePng(mesh, outputPath(format))
+                } else {
+                    combined.export(outputPath(format), SMaterial.smoothGray)
+                }
+            }
+            if (provenance) {
+                echo(1, cyan("Writing face provenance to ${fileName("provenance.json")}"), false)
+                Path(outputPath("provenance.json")).writeText(Provenance.toJson(combined).toString())
+            }
+        }
+        if (volumes.isNotEmpty()) {
+            if (combined == null) {
+                throw SimplexEvaluationError(
+                    "Product $name has slicer volumes, but no solid for them to modify",
+                    loc = loc,
+                )
             }
+            echo(1, cyan("Writing model with ${volumes.size} slicer volumes to ${fileName("3mf")}"), false)
+            SlicerVolume.export3mf(outputPath("3mf"), name ?: "model", combined, volumes)
+        }
+        val drawings = results.filterIsInstance<Drawing>()
+        for ((i, drawing) in drawings.withIndex()) {
+            val drawingName = if (i == 0) "drawing" else "drawing-${i + 1}"
+            echo(1, cyan("Drawing views to ${fileName("$drawingName.svg")} and .pdf"), false)
+            Path(outputPath("$drawingName.svg")).writeText(drawing.svg())
+            Path(outputPath("$drawingName.pdf")).writeBytes(drawing.pdf())
+        }
+        val tetMeshes = results.filterIsInstance<TetMesh>()
+        for ((i, tetMesh) in tetMeshes.withIndex()) {
+            val meshName = if (i == 0) "tets" else "tets-${i + 1}"
             echo(
                 1,
-                cyan("Rendering 3d model of ${bodies.size} bodies to $prefixLastSegment-$name.stl"),
+                cyan("Writing ${tetMesh.tetCount} tetrahedra to ${fileName("$meshName.msh")}, .vtu and .inp"),
                 false,
             )
-            combined.export("$prefix-$name.stl", SMaterial.smoothGray)
+            Path(outputPath("$meshName.msh")).writeText(tetMesh.toMsh())
+            Path(outputPath("$meshName.vtu")).writeText(tetMesh.toVtu())
+            Path(outputPath("$meshName.inp")).writeText(tetMesh.toInp(name ?: "model"))
         }
-        val others = results.filter { it.valueType != SolidValueType }
+        val slices = results.flatMap { sliceProducts(it) }
+        if (slices.isNotEmpty()) {
+            echo(1, cyan("Drawing ${slices.size} slices to ${fileName("svg")}"), false)
+            Path(outputPath("svg")).writeText(Slice.svgDocument(slices))
+        }
+        val others =
+            results.filter {
+                it.valueType != SolidValueType &&
+                    it !is SlicerVolume &&
+                    it !is Drawing &&
+                    it !is TetMesh &&
+                    sliceProducts(it).isEmpty()
+            }
         if (others.isNotEmpty()) {
             val text = StringBuilder()
             val twists = StringBuilder()
@@ -125,13 +442,13 @@ class Product(val name: String?, val body: List<Expr>, loc: Location) : AstNode(
             }
             val textOut = text.toString()
             if (textOut.isNotEmpty()) {
-                echo(1, cyan("Writing text products to $prefixLastSegment-$name.txt"), false)
-                Path("$prefix-$name.txt").writeText(textOut)
+                echo(1, cyan("Writing text products to ${fileName("txt")}"), false)
+                Path(outputPath("txt")).writeText(textOut)
             }
             val twistOut = twists.toString()
             if (twistOut.isNotEmpty()) {
-                echo(1, cyan("Writing twisted products to $prefixLastSegment-$name.twist"), false)
-                Path("$prefix-$name.twist").writeText(twistOut)
+                echo(1, cyan("Writing twisted products to ${fileName("twist")}"), false)
+                Path(outputPath("twist")).writeText(twistOut)
             }
         }
     }
@@ -0,0 +1,45 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.ast.def
+
+import org.goodmath.simplex.ast.AstNode
+import org.goodmath.simplex.ast.Location
+import org.goodmath.simplex.twist.Twist
+
+/**
+ * An annotation on a definition or a product, like `@deprecated("use rotate")` or
+ * `@allow(unused)`.
+ *
+ * @param name the name of the annotation.
+ * @param args the arguments of the annotation: the contents of string literals,
+ *    or the text of identifiers.
+ * @param loc the source location.
+ */
+class Annotation(val name: String, val args: List<String>, loc: Location) : AstNode(loc) {
+    override fun twist(): Twist =
+        Twist.obj("Annotation", Twist.attr("name", name), Twist.attr("args", args.joinToString(",")))
+
+    override fun toString(): String =
+        if (args.isEmpty()) "@$name" else "@$name(${args.joinToString(", ")})"
+
+    companion object {
+        /** The names of the annotations that Simplex understands. */
+        val known = setOf("deprecated", "allow", "tolerance")
+
+        /** The annotations that can only be used on products. */
+        val productOnly = setOf("tolerance")
+    }
+}
@@ -16,10 +16,13 @@
 package org.goodmath.simplex.ast.def
 
 import kotlin.collections.indexOfFirst
+import org.goodmath.simplex.ast.AstNode
 import org.goodmath.simplex.ast.Location
 import org.goodmath.simplex.ast.types.Type
 import org.goodmath.simplex.ast.types.TypedName
 import org.goodmath.simplex.runtime.Env
+import org.goodmath.simplex.runtime.RootEnv
+import org.goodmath.simplex.runtime.SimplexAnalysisError
 import org.goodmath.simplex.runtime.SimplexUndefinedError
 import org.goodmath.simplex.runtime.values.primitives.DataValueType
 import org.goodmath.simplex.twist.Twist
@@ -29,6 +32,8 @@ class DataDefinition(name: String, val fields: List<TypedName>, loc: Location) :
 
     val valueType = DataValueType(this)
 
+    override fun children(): List<AstNode> = fields
+
     override fun twist(): Twist =
         Twist.obj("DataDefinition", Twist.attr("name", name), Twist.array("fields", fields))
 
@@ -48,8 +53,34 @@ class DataDefinition(name: String, val fields: List<TypedName>, loc: Location) :
     }
 
     override fun installStatic(env: Env) {
-        val dataType = DataValueType(this)
-        val tt = Type.simple(name)
-        Type.registerValueType(tt, dataType)
+        // The names of data types are global, so a type defined in a namespace or a
+        // function can't reuse the name of another one.
+        val existing = RootEnv.dataTypes[name]
+        if (existing != null && existing !== this) {
+            throw SimplexAnalysisError(
+                "Data type $name is already defined at ${existing.loc.file}:${existing.loc.line}",
+                loc = loc,
+            )
+        }
+        RootEnv.dataTypes[name] = this
+        // Register the value type of this definition's values, replacing any left
+        // from an earlier analysis, so that user methods are added to the type that
+        // the data values actually have.
+        Type.valueTypes[Type.simple(name)] = valueType
+    }
+
+    companion object {
+        /**
+         * Find the definition of a data type by name. Data types are normally found
+         * in the scope, but the names of data types are global, so a type defined in
+         * a namespace or a function is also found through its registered value type.
+         */
+        fun lookup(env: Env, name: String): Definition {
+            return try {
+                env.getDef(name)
+            } catch (e: SimplexUndefinedError) {
+                (Type.valueTypes[Type.simple(name)] as? DataValueType)?.dataDef ?: throw e
+            }
+        }
     }
 }
@@ -26,6 +26,16 @@ import org.goodmath.simplex.runtime.Env
  * @param loc the source location
  */
 abstract class Definition(val name: String, loc: Location) : AstNode(loc) {
+    /** The annotations written before the definition. */
+    var annotations: List<Annotation> = emptyList()
+
+    /**
+     * If the definition is annotated `@deprecated`, the message to show where it's
+     * used; otherwise null.
+     */
+    val deprecation: String?
+        get() = annotations.firstOrNull { it.name == "deprecated" }?.let { it.args.firstOrNull() ?: "" }
+
     abstract fun installStatic(env: Env)
 
     abstract fun installValues(env: Env)
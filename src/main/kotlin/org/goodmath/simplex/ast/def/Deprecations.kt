@@ -0,0 +1,95 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.ast.def
+
+import org.goodmath.simplex.ast.Lint
+import org.goodmath.simplex.ast.Location
+import org.goodmath.simplex.ast.types.Type
+import org.goodmath.simplex.runtime.Env
+import org.goodmath.simplex.runtime.RootEnv
+import org.goodmath.simplex.runtime.values.primitives.PrimitiveFunctionValue
+import org.goodmath.simplex.runtime.values.primitives.PrimitiveMethod
+
+/**
+ * Checks for uses of deprecated functions and methods during analysis, and records a
+ * warning for each one. Functions and methods defined in a model are deprecated by
+ * annotating them with `@deprecated("message")`; primitives are deprecated by overriding
+ * their `deprecation`.
+ */
+object Deprecations {
+    /** Check a reference to a name, which might be a deprecated function. */
+    fun checkName(env: Env, name: String, loc: Location) {
+        val scope = declaringScope(env, name)
+        if (scope != null) {
+            val message =
+                scope.defs[name]?.deprecation
+                    ?: (scope.functions[name] ?: scope.vars[name] as? PrimitiveFunctionValue)?.deprecation
+            report(name, message, loc)
+        }
+    }
+
+    /**
+     * Check a call to a function by name, which might use a deprecated parameter list of
+     * a primitive function.
+     *
+     * @param params the types of the parameter list that the call uses.
+     */
+    fun checkOverload(env: Env, name: String, params: List<Type>, loc: Location) {
+        val scope = declaringScope(env, name) ?: return
+        if (!scope.defs.containsKey(name)) {
+            val f = scope.functions[name] ?: scope.vars[name] as? PrimitiveFunctionValue
+            report(name, f?.overloadDeprecation(params), loc)
+        }
+    }
+
+    // Find the scope that declares a name, so that a local variable doesn't get confused
+    // with a deprecated function of the same name in an outer scope.
+    private fun declaringScope(env: Env, name: String): Env? {
+        var scope: Env? = env
+        while (scope != null && !scope.declaredTypes.containsKey(name)) {
+            scope = scope.parentEnv
+        }
+        return scope
+    }
+
+    /** Check a reference to a name in a namespace or an imported library. */
+    fun checkScopedName(scope: String, name: String, loc: Location) {
+        val def = RootEnv.getScope(scope).defs[name]
+        report("$scope::$name", def?.deprecation, loc)
+    }
+
+    /** Check a call to a method on a value of a type. */
+    fun checkMethod(env: Env, targetType: Type, name: String, loc: Location) {
+        var scope: Env? = env
+        while (scope != null) {
+            val def = scope.defs["$targetType->$name"]
+            if (def != null) {
+                report(name, def.deprecation, loc)
+                return
+            }
+            scope = scope.parentEnv
+        }
+        val method = Type.valueTypes[targetType]?.methods?.get(name) as? PrimitiveMethod
+        report(name, method?.deprecation, loc)
+    }
+
+    private fun report(name: String, message: String?, loc: Location) {
+        if (message != null) {
+            val detail = if (message.isEmpty()) "$name is deprecated" else "$name is deprecated: $message"
+            RootEnv.warn(Lint.DEPRECATED, detail, loc)
+        }
+    }
+}
@@ -17,6 +17,7 @@ package org.goodmath.simplex.ast.def
 
 import kotlin.collections.last
 import kotlin.collections.map
+import org.goodmath.simplex.ast.AstNode
 import org.goodmath.simplex.ast.Location
 import org.goodmath.simplex.ast.expr.Expr
 import org.goodmath.simplex.ast.types.Type
@@ -32,20 +33,31 @@ sealed class InvokableDefinition(
     val params: List<TypedName>,
     val body: List<Expr>,
     loc: Location,
-    val localDefs: List<FunctionDefinition> = emptyList()
+    val localDefs: List<Definition> = emptyList()
 ) : Definition(name, loc) {
 
+    /**
+     * The type of the value of the body, as inferred during analysis. This is recorded
+     * for tools like the language server, which offer to fix a declared return type
+     * that doesn't match it.
+     */
+    var inferredReturnType: Type? = null
+
     fun validateParamsAndBody(localEnv: Env) {
         for (p in params) {
             localEnv.declareTypeOf(p.name, p.type)
         }
+        // Local definitions are checked before the body, so that they can only use
+        // the parameters, and not variables that the body defines with `let`: a local
+        // function can be called before the `let` that binds a variable it uses.
         for (l in localDefs) {
-            localEnv.declareTypeOf(l.name, l.type)
+            l.validate(localEnv)
         }
         for (b in body) {
             b.validate(localEnv)
         }
         val actualReturnType = body.last().resultType(localEnv)
+        inferredReturnType = actualReturnType
         if (!returnType.matchedBy(actualReturnType)) {
             throw SimplexTypeError(
                 body.last().toString(),
@@ -62,7 +74,8 @@ sealed class InvokableDefinition(
  *
  * @param name
  * @param params a list of the function's parameters, with optional types.
- * @param localDefs a list of local definitions declared within the function.
+ * @param localDefs a list of local definitions declared within the function: functions,
+ *    data types, and methods.
  * @param body the function body.
  * @param loc the source location.
  */
@@ -70,13 +83,21 @@ class FunctionDefinition(
     name: String,
     returnType: Type,
     params: List<TypedName>,
-    localDefs: List<FunctionDefinition>,
+    localDefs: List<Definition>,
     body: List<Expr>,
     loc: Location,
 ) : InvokableDefinition(name, returnType, params, body, loc, localDefs) {
 
     val type = Type.function(listOf(params.map { it.type }), returnType)
 
+    init {
+        for (m in localDefs.filterIsInstance<MethodDefinition>()) {
+            m.isLocal = true
+        }
+    }
+
+    override fun children(): List<AstNode> = params + localDefs + body
+
     override fun twist(): Twist =
         Twist.obj(
             "FunctionDefinition",
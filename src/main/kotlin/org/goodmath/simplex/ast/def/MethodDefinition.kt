@@ -17,11 +17,13 @@ package org.goodmath.simplex.ast.def
 
 import kotlin.collections.map
 import kotlin.collections.zip
+import org.goodmath.simplex.ast.AstNode
 import org.goodmath.simplex.ast.Location
 import org.goodmath.simplex.ast.expr.Expr
 import org.goodmath.simplex.ast.types.Type
 import org.goodmath.simplex.ast.types.TypedName
 import org.goodmath.simplex.runtime.Env
+import org.goodmath.simplex.runtime.RootEnv
 import org.goodmath.simplex.runtime.SimplexParameterCountError
 import org.goodmath.simplex.runtime.values.Value
 import org.goodmath.simplex.runtime.values.primitives.IntegerValue
@@ -36,9 +38,22 @@ class MethodDefinition(
     body: List<Expr>,
     loc: Location,
 ) : InvokableDefinition("${targetType}->${methodName}", resultType, params, body, loc) {
+    /**
+     * Is this method defined inside of a function? Local methods are only visible in
+     * the function's scope; other methods are registered with their target type.
+     */
+    var isLocal: Boolean = false
+
+    private val methodType
+        get() = Type.multiMethod(targetType, listOf(params.map { it.type }), returnType)
+
     override fun installValues(env: Env) {
-        val valueType = Type.getValueType(targetType)
-        valueType.addMethod(MethodValue(targetType, returnType, params, body, this, env))
+        val method = MethodValue(targetType, returnType, params, body, this, env)
+        if (isLocal) {
+            env.addLocalMethod(targetType, method)
+        } else {
+            Type.getValueType(targetType).addMethod(method)
+        }
     }
 
     override fun validate(env: Env) {
@@ -48,10 +63,16 @@ class MethodDefinition(
     }
 
     override fun installStatic(env: Env) {
-        targetType.registerMethod(name, Type.multiMethod(targetType,
-            listOf(params.map { it.type }), returnType))
+        if (isLocal) {
+            env.declareLocalMethod(targetType, methodName, methodType)
+        } else {
+            targetType.registerMethod(methodName, methodType)
+            RootEnv.recordUserMethod(targetType, methodName)
+        }
     }
 
+    override fun children(): List<AstNode> = params + body
+
     override fun twist(): Twist =
         Twist.obj(
             "MethodDefinition",
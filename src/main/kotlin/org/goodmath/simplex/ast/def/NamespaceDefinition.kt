@@ -0,0 +1,73 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.ast.def
+
+import org.goodmath.simplex.ast.AstNode
+import org.goodmath.simplex.ast.Location
+import org.goodmath.simplex.runtime.Env
+import org.goodmath.simplex.runtime.RootEnv
+import org.goodmath.simplex.runtime.SimplexAnalysisError
+import org.goodmath.simplex.twist.Twist
+
+/**
+ * A namespace: a group of definitions within a model, whose members are referenced
+ * from outside the namespace as `name::member`, the same way as the members of an
+ * imported library. Inside the namespace, its members can refer to each other by
+ * their plain names, and can see all of the model's top-level definitions.
+ *
+ * @param name the name of the namespace.
+ * @param defs the definitions in the namespace.
+ * @param loc the source location.
+ */
+class NamespaceDefinition(name: String, val defs: List<Definition>, loc: Location) :
+    Definition(name, loc) {
+
+    /** The scope used for analysis, created by [installStatic]. */
+    private var staticScope: Env? = null
+
+    override fun children(): List<AstNode> = defs
+
+    override fun twist(): Twist =
+        Twist.obj("NamespaceDefinition", Twist.attr("name", name), Twist.array("defs", defs))
+
+    override fun installStatic(env: Env) {
+        if (RootEnv.importedScopes.containsKey(name)) {
+            throw SimplexAnalysisError("Namespace $name has the same name as an imported library", loc = loc)
+        }
+        val nested = defs.firstOrNull { it is NamespaceDefinition }
+        if (nested != null) {
+            throw SimplexAnalysisError("Namespace ${nested.name} can't be nested inside namespace $name",
+                loc = nested.loc)
+        }
+        val scope = Env(defs, env)
+        RootEnv.addNamespace(name, scope)
+        scope.installStaticDefinitions()
+        staticScope = scope
+    }
+
+    override fun installValues(env: Env) {
+        val scope = Env(defs, env)
+        RootEnv.addNamespace(name, scope)
+        scope.installDefinitionValues()
+    }
+
+    override fun validate(env: Env) {
+        val scope = staticScope ?: throw SimplexAnalysisError("Namespace $name was not installed", loc = loc)
+        for (d in defs) {
+            d.validate(scope)
+        }
+    }
+}
@@ -15,6 +15,7 @@
  */
 package org.goodmath.simplex.ast.def
 
+import org.goodmath.simplex.ast.AstNode
 import org.goodmath.simplex.ast.Location
 import org.goodmath.simplex.ast.expr.Expr
 import org.goodmath.simplex.ast.types.Type
@@ -26,6 +27,8 @@ import org.goodmath.simplex.twist.Twist
 
 class VariableDefinition(name: String, val type: Type?, val initialValue: Expr, loc: Location) :
     Definition(name, loc) {
+    override fun children(): List<AstNode> = listOf(initialValue)
+
     override fun twist(): Twist =
         Twist.obj(
             "VariableDefinition",
@@ -34,8 +37,15 @@ class VariableDefinition(name: String, val type: Type?, val initialValue: Expr,
             Twist.value("value", initialValue),
         )
 
+    /**
+     * The type of the initial value, as inferred during analysis. This is recorded
+     * for tools like the language server, which offer to add missing type declarations.
+     */
+    var inferredType: Type? = null
+
     override fun installStatic(env: Env) {
-        val declareType = type ?: initialValue.resultType(env)
+        inferredType = initialValue.resultType(env)
+        val declareType = type ?: inferredType!!
         env.declareTypeOf(name, declareType)
     }
 
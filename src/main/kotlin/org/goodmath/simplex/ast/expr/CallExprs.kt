@@ -15,7 +15,9 @@
  */
 package org.goodmath.simplex.ast.expr
 
+import org.goodmath.simplex.ast.AstNode
 import org.goodmath.simplex.ast.Location
+import org.goodmath.simplex.ast.def.Deprecations
 import org.goodmath.simplex.ast.types.FunctionType
 import org.goodmath.simplex.ast.types.Type
 import org.goodmath.simplex.runtime.Env
@@ -27,10 +29,22 @@ import org.goodmath.simplex.runtime.SimplexParameterCountError
 import org.goodmath.simplex.runtime.SimplexUndefinedError
 import org.goodmath.simplex.runtime.SimplexUndefinedMethodError
 import org.goodmath.simplex.runtime.values.Value
+import org.goodmath.simplex.runtime.values.manifold.Provenance
 import org.goodmath.simplex.runtime.values.primitives.AbstractFunctionValue
 import org.goodmath.simplex.twist.Twist
 
 class FunCallExpr(val funExpr: Expr, val argExprs: List<Expr>, loc: Location) : Expr(loc) {
+    /**
+     * The parameter types that the arguments were matched against during validation,
+     * recorded for tools like the language server.
+     */
+    var paramTypes: List<Type>? = null
+
+    /** The static types of the arguments, as determined during validation. */
+    var argTypes: List<Type>? = null
+
+    override fun children(): List<AstNode> = listOf(funExpr) + argExprs
+
     override fun twist(): Twist =
         Twist.obj(
             "FunCallExpr",
@@ -47,7 +61,7 @@ class FunCallExpr(val funExpr: Expr, val argExprs: List<Expr>, loc: Location) :
             )
         }
         val args = argExprs.map { it.evaluateIn(env) }
-        return funVal.applyTo(args)
+        return Provenance.tag(funVal.applyTo(args), loc)
     }
 
     override fun resultType(env: Env): Type {
@@ -60,12 +74,20 @@ class FunCallExpr(val funExpr: Expr, val argExprs: List<Expr>, loc: Location) :
     }
 
     override fun validate(env: Env) {
+        for (arg in argExprs) {
+            arg.validate(env)
+        }
+        argTypes = argExprs.map { it.resultType(env) }
         val funType = funExpr.resultType(env)
         if (funType !is FunctionType) {
             throw SimplexAnalysisError("Function expression isn't a function", loc = loc)
         }
-        val expectedArgs =  funType.argLists.firstOrNull { it.size == argExprs.size }
-        if (expectedArgs == null) {
+        when (funExpr) {
+            is VarRefExpr -> Deprecations.checkName(env, funExpr.name, loc)
+            is ScopedRefExpr -> Deprecations.checkScopedName(funExpr.scope, funExpr.name, loc)
+        }
+        val candidates = funType.argLists.filter { it.size == argExprs.size }
+        if (candidates.isEmpty()) {
             throw SimplexParameterCountError(
                 "Function call",
                 funType.argLists.joinToString(" | ") { args -> args.toString() },
@@ -73,9 +95,11 @@ class FunCallExpr(val funExpr: Expr, val argExprs: List<Expr>, loc: Location) :
                 loc,
             )
         }
-        if (!expectedArgs.zip(argExprs).all { (type, expr) ->
-                    type.matchedBy(expr.resultType(env))
-                }) {
+        // Signatures with the same number of parameters are told apart by their types.
+        val expectedArgs = candidates.firstOrNull { params ->
+            params.zip(argTypes!!).all { (type, actual) -> type.matchedBy(actual) }
+        }
+        if (expectedArgs == null) {
             val expected = funType.argLists.joinToString(" | ") {
                 paramList -> "(${paramList.joinToString(", ") { it.toString() }})"
             }
@@ -84,32 +108,52 @@ class FunCallExpr(val funExpr: Expr, val argExprs: List<Expr>, loc: Location) :
             }})"
             throw SimplexAnalysisError("Function expected one of $expected as arguments, but received $actual", loc = loc)
         }
+        paramTypes = expectedArgs
+        if (funExpr is VarRefExpr) {
+            Deprecations.checkOverload(env, funExpr.name, expectedArgs, loc)
+        }
     }
 }
 
 class MethodCallExpr(val target: Expr, val name: String, val args: List<Expr>, loc: Location) :
     Expr(loc) {
+    /** The static types of the arguments, as determined during validation. */
+    var argTypes: List<Type>? = null
+
+    /** The static type of the target, as determined during validation. */
+    var targetType: Type? = null
+
+    /** The parameter types that the arguments were matched against during validation. */
+    var paramTypes: List<Type>? = null
+
     override fun evaluateIn(env: Env): Value {
         val targetValue = target.evaluateIn(env)
         val argValues = args.map { it.evaluateIn(env) }
-        val meth = targetValue.valueType.getMethod(name)
-        return meth.applyTo(targetValue, argValues, env)
+        val meth = env.getMethod(targetValue, name)
+        return Provenance.tag(meth.applyTo(targetValue, argValues, env), loc)
     }
 
     override fun resultType(env: Env): Type {
         val targetType = target.resultType(env)
-        return targetType.getMethod(name)?.returnType
+        return env.getMethodType(targetType, name)?.returnType
             ?: throw SimplexUndefinedMethodError(name,  targetType.toString(), loc = loc)
     }
 
     override fun validate(env: Env) {
+        target.validate(env)
+        for (arg in args) {
+            arg.validate(env)
+        }
+        argTypes = args.map { it.resultType(env) }
         val targetType = target.resultType(env)
+        this.targetType = targetType
         val methodType =
-            targetType.getMethod(name)
+            env.getMethodType(targetType, name)
                 ?: throw SimplexUndefinedMethodError(name, targetType.toString(), loc = loc)
+        Deprecations.checkMethod(env, targetType, name, loc)
 
-        val expectedArgs = methodType.argSets.firstOrNull { it.size == args.size }
-        if (expectedArgs == null) {
+        val candidates = methodType.argSets.filter { it.size == args.size }
+        if (candidates.isEmpty()) {
             throw SimplexParameterCountError("Method $name",
                 methodType.argSets.joinToString(" | ") { args ->
                     args.toString()
@@ -118,9 +162,10 @@ class MethodCallExpr(val target: Expr, val name: String, val args: List<Expr>, l
                 location = loc)
         }
 
-        if (!expectedArgs.zip(args).all { (expected, expr) ->
-                            expected.matchedBy(expr.resultType(env))
-                        }) {
+        val matched = candidates.firstOrNull { params ->
+            params.zip(argTypes!!).all { (expected, actual) -> expected.matchedBy(actual) }
+        }
+        if (matched == null) {
             throw SimplexInvalidMethodSignature(targetType.toString(),
                 name, methodType.argSets.joinToString(" | ") { argList ->
                     "(${argList.joinToString(", ") {  arg -> arg.toString()}})" },
@@ -128,9 +173,12 @@ class MethodCallExpr(val target: Expr, val name: String, val args: List<Expr>, l
                 loc=loc
             )
         }
+        paramTypes = matched
     }
 
 
+    override fun children(): List<AstNode> = listOf(target) + args
+
     override fun twist(): Twist =
         Twist.obj(
             "MethodExpr",
@@ -18,6 +18,7 @@ package org.goodmath.simplex.ast.expr
 import kotlin.collections.first
 import kotlin.collections.map
 import kotlin.collections.toMutableSet
+import org.goodmath.simplex.ast.AstNode
 import org.goodmath.simplex.ast.Location
 import org.goodmath.simplex.ast.types.Type
 import org.goodmath.simplex.runtime.Env
@@ -33,6 +34,9 @@ data class Condition(val cond: Expr, val value: Expr) : Twistable {
 
 class CondExpr(val conds: List<Condition>, val elseClause: Expr, loc: Location) : Expr(loc) {
 
+    override fun children(): List<AstNode> =
+        conds.flatMap { listOf(it.cond, it.value) } + elseClause
+
     override fun twist(): Twist =
         Twist.obj("IfExpr", Twist.array("cond_clauses", conds), Twist.value("else", elseClause))
 
@@ -59,7 +63,7 @@ class CondExpr(val conds: List<Condition>, val elseClause: Expr, loc: Location)
     override fun validate(env: Env) {
         for (cond in conds) {
             cond.cond.validate(env)
-            cond.cond.validate(env)
+            cond.value.validate(env)
         }
         elseClause.validate(env)
         val resultTypes = conds.map { it.value.resultType(env) }.toMutableSet()
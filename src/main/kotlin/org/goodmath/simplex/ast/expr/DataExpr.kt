@@ -19,6 +19,7 @@ import kotlin.collections.firstOrNull
 import kotlin.collections.forEach
 import kotlin.collections.map
 import kotlin.collections.zip
+import org.goodmath.simplex.ast.AstNode
 import org.goodmath.simplex.ast.Location
 import org.goodmath.simplex.ast.def.DataDefinition
 import org.goodmath.simplex.ast.types.SimpleType
@@ -34,11 +35,13 @@ import org.goodmath.simplex.runtime.values.primitives.DataValueType
 import org.goodmath.simplex.twist.Twist
 
 class DataExpr(val dataType: String, val args: List<Expr>, loc: Location) : Expr(loc) {
+    override fun children(): List<AstNode> = args
+
     override fun twist(): Twist =
         Twist.obj("DataExpr", Twist.attr("dataType", dataType), Twist.array("args", args))
 
     override fun evaluateIn(env: Env): Value {
-        val dataDef = env.getDef(dataType)
+        val dataDef = DataDefinition.lookup(env, dataType)
         if (dataDef !is DataDefinition) {
             throw SimplexEvaluationError(
                 "Cannot create a non-data type like $dataType with a data expression",
@@ -60,7 +63,7 @@ class DataExpr(val dataType: String, val args: List<Expr>, loc: Location) : Expr
     }
 
     override fun validate(env: Env) {
-        val dataDef = env.getDef(dataType)
+        val dataDef = DataDefinition.lookup(env, dataType)
         if (dataDef !is DataDefinition) {
             throw SimplexEvaluationError(
                 "Cannot create a non-data type like $dataType with a data expression",
@@ -84,6 +87,8 @@ class DataExpr(val dataType: String, val args: List<Expr>, loc: Location) : Expr
 }
 
 class FieldRefExpr(val dataExpr: Expr, val fieldName: String, loc: Location) : Expr(loc) {
+    override fun children(): List<AstNode> = listOf(dataExpr)
+
     override fun twist(): Twist =
         Twist.obj(
             "FieldRefExpr",
@@ -104,7 +109,7 @@ class FieldRefExpr(val dataExpr: Expr, val fieldName: String, loc: Location) : E
     override fun resultType(env: Env): Type {
         val dataTypeMaybe = dataExpr.resultType(env)
         if (dataTypeMaybe is SimpleType) {
-            val def = env.getDef(dataTypeMaybe.name)
+            val def = DataDefinition.lookup(env, dataTypeMaybe.name)
             if (def is DataDefinition) {
                 val field = def.fields.firstOrNull { it.name == fieldName }
                 if (field != null) {
@@ -128,7 +133,7 @@ class FieldRefExpr(val dataExpr: Expr, val fieldName: String, loc: Location) : E
                 loc = loc,
             )
         }
-        val dataTypeDef = env.getDef(dataType.name)
+        val dataTypeDef = DataDefinition.lookup(env, dataType.name)
         if (dataTypeDef !is DataDefinition) {
             throw SimplexAnalysisError(
                 "Field reference target must be a data type, not $dataTypeDef",
@@ -169,7 +174,7 @@ class DataFieldUpdateExpr(val dataExpr: Expr, val field: String, val value: Expr
                 loc = loc,
             )
         }
-        val def = env.getDef(targetType.name)
+        val def = DataDefinition.lookup(env, targetType.name)
         if (def !is DataDefinition) {
             throw SimplexAnalysisError(
                 "The type of the target of a data field update must be a data type, but no data type def found for $targetType",
@@ -191,6 +196,8 @@ class DataFieldUpdateExpr(val dataExpr: Expr, val field: String, val value: Expr
         }
     }
 
+    override fun children(): List<AstNode> = listOf(dataExpr, value)
+
     override fun twist(): Twist =
         Twist.obj(
             "DataFieldUpdateExpr",
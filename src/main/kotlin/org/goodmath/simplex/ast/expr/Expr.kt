@@ -22,7 +22,9 @@ import kotlin.collections.toSet
 import kotlin.toString
 import org.goodmath.simplex.ast.AstNode
 import org.goodmath.simplex.ast.Location
+import org.goodmath.simplex.ast.def.Annotation
 import org.goodmath.simplex.ast.def.DataDefinition
+import org.goodmath.simplex.ast.def.Deprecations
 import org.goodmath.simplex.ast.types.SimpleType
 import org.goodmath.simplex.ast.types.Type
 import org.goodmath.simplex.ast.types.TypedName
@@ -34,6 +36,7 @@ import org.goodmath.simplex.runtime.SimplexEvaluationError
 import org.goodmath.simplex.runtime.SimplexTypeError
 import org.goodmath.simplex.runtime.values.AnyValueType
 import org.goodmath.simplex.runtime.values.Value
+import org.goodmath.simplex.runtime.values.primitives.SetValue
 import org.goodmath.simplex.runtime.values.primitives.VectorValue
 import org.goodmath.simplex.runtime.values.primitives.BooleanValue
 import org.goodmath.simplex.runtime.values.primitives.BooleanValueType
@@ -48,6 +51,9 @@ import org.goodmath.simplex.runtime.values.primitives.DataValue
 import org.goodmath.simplex.twist.Twist
 
 abstract class Expr(loc: Location) : AstNode(loc) {
+    /** The `@allow` annotations written before the expression, like `@allow(precision) let x: Float = n / 2`. */
+    var annotations: List<Annotation> = emptyList()
+
     abstract fun evaluateIn(env: Env): Value
 
     abstract fun resultType(env: Env): Type
@@ -56,6 +62,8 @@ abstract class Expr(loc: Location) : AstNode(loc) {
 }
 
 class BlockExpr(val body: List<Expr>, loc: Location) : Expr(loc) {
+    override fun children(): List<AstNode> = body
+
     override fun twist(): Twist = Twist.obj("Block", Twist.array("body", body))
 
     override fun evaluateIn(env: Env): Value {
@@ -91,6 +99,13 @@ data class Binding(val name: String, val type: Type, val value: Expr, override v
 }
 
 class LetExpr(val name: String, val type: Type?, val value: Expr, loc: Location) : Expr(loc) {
+    /**
+     * The type of the bound value, as inferred during validation. This is recorded
+     * for tools like the language server, which offer to add missing type declarations.
+     */
+    var inferredType: Type? = null
+
+    override fun children(): List<AstNode> = listOf(value)
 
     override fun twist(): Twist =
         Twist.obj(
@@ -112,7 +127,8 @@ class LetExpr(val name: String, val type: Type?, val value: Expr, loc: Location)
 
     override fun validate(env: Env) {
         value.validate(env)
-        val declareType = type ?: value.resultType(env)
+        inferredType = value.resultType(env)
+        val declareType = type ?: inferredType!!
         env.declareTypeOf(name, declareType)
 
         if (type != null && !type.matchedBy(value.resultType(env))) {
@@ -180,6 +196,8 @@ class AssignmentExpr(val target: String, val expr: Expr, loc: Location) : Expr(l
         }
     }
 
+    override fun children(): List<AstNode> = listOf(expr)
+
     override fun twist(): Twist =
         Twist.obj("AssignmentExpr", Twist.attr("variable", target), Twist.value("value", expr))
 }
@@ -213,6 +231,7 @@ class VarRefExpr(val name: String, loc: Location) : Expr(loc) {
 
     override fun validate(env: Env) {
         env.getDeclaredTypeOf(name)
+        Deprecations.checkName(env, name, loc)
     }
 }
 
@@ -244,11 +263,14 @@ class ScopedRefExpr(val scope: String, val name: String, loc: Location) : Expr(l
     }
 
     override fun validate(env: Env) {
-        RootEnv.getDeclaredTypeOfScopedName(scope, name)
+        resultType(env)
+        Deprecations.checkScopedName(scope, name, loc)
     }
 }
 
 class VectorExpr(val elements: List<Expr>, loc: Location) : Expr(loc) {
+    override fun children(): List<AstNode> = elements
+
     override fun twist(): Twist = Twist.obj("Vector", Twist.array("elements", elements))
 
     override fun evaluateIn(env: Env): Value {
@@ -280,7 +302,43 @@ class VectorExpr(val elements: List<Expr>, loc: Location) : Expr(loc) {
     }
 }
 
+class SetExpr(val elements: List<Expr>, loc: Location) : Expr(loc) {
+    override fun children(): List<AstNode> = elements
+
+    override fun twist(): Twist = Twist.obj("Set", Twist.array("elements", elements))
+
+    override fun evaluateIn(env: Env): Value {
+        val elementValues = elements.map { it.evaluateIn(env) }
+        val elementTypes = elementValues.map { it.valueType }.toSet()
+        val elementType =
+            if (elementTypes.size > 1) {
+                AnyValueType
+            } else {
+                elementTypes.first()
+            }
+        return SetValue.of(elementType, elementValues, env)
+    }
+
+    override fun resultType(env: Env): Type {
+        val elementTypes = elements.map { it.resultType(env) }.toSet()
+        return if (elementTypes.size > 1) {
+            Type.set(Type.AnyType)
+        } else {
+            Type.set(elementTypes.first())
+        }
+    }
+
+    override fun validate(env: Env) {
+        resultType(env)
+        for (e in elements) {
+            e.validate(env)
+        }
+    }
+}
+
 class WithExpr(val focus: Expr, val body: List<Expr>, loc: Location) : Expr(loc) {
+    override fun children(): List<AstNode> = listOf(focus) + body
+
     override fun twist(): Twist =
         Twist.obj("WithExpr", Twist.value("focus", focus), Twist.array("body", body))
 
@@ -305,7 +363,7 @@ class WithExpr(val focus: Expr, val body: List<Expr>, loc: Location) : Expr(loc)
         // We know it's a simple type, because validation would have failed otherwise.
         val focusType = focus.resultType(env) as SimpleType
         // similarly, we know it's a data-def
-        val focusDef = env.getDef(focusType.name) as DataDefinition
+        val focusDef = DataDefinition.lookup(env, focusType.name) as DataDefinition
         val localEnv = Env(emptyList(), env)
         for (field in focusDef.fields) {
             localEnv.declareTypeOf(field.name, field.type)
@@ -322,7 +380,7 @@ class WithExpr(val focus: Expr, val body: List<Expr>, loc: Location) : Expr(loc)
                     loc = loc,
                 )
             }
-            val focusDef = env.getDef(focusType.name)
+            val focusDef = DataDefinition.lookup(env, focusType.name)
             if (focusDef !is DataDefinition) {
                 throw SimplexAnalysisError(
                     "With expression focus must be a data value type, not $focusDef",
@@ -377,6 +435,8 @@ class LambdaExpr(
         }
     }
 
+    override fun children(): List<AstNode> = params + body
+
     override fun twist(): Twist =
         Twist.obj(
             "LambdaExpr",
@@ -18,6 +18,7 @@ package org.goodmath.simplex.ast.expr
 import java.util.ArrayList
 import kotlin.collections.first
 import kotlin.collections.last
+import org.goodmath.simplex.ast.AstNode
 import org.goodmath.simplex.ast.Location
 import org.goodmath.simplex.ast.types.VectorType
 import org.goodmath.simplex.ast.types.Type
@@ -33,6 +34,8 @@ import org.goodmath.simplex.twist.Twist
 
 class LoopExpr(val idxVar: String, val collExpr: Expr, val body: List<Expr>, loc: Location) :
     Expr(loc) {
+    override fun children(): List<AstNode> = listOf(collExpr) + body
+
     override fun twist(): Twist =
         Twist.obj(
             "LoopExpr",
@@ -117,6 +120,8 @@ class WhileExpr(val cond: Expr, val body: List<Expr>, loc: Location) : Expr(loc)
         }
     }
 
+    override fun children(): List<AstNode> = listOf(cond) + body
+
     override fun twist(): Twist =
         Twist.obj("WhileStmt", Twist.value("condition", cond), Twist.array("body", body))
 }
@@ -19,6 +19,7 @@ import kotlin.collections.drop
 import kotlin.collections.forEach
 import kotlin.collections.zip
 import kotlin.let
+import org.goodmath.simplex.ast.AstNode
 import org.goodmath.simplex.ast.Location
 import org.goodmath.simplex.ast.types.Type
 import org.goodmath.simplex.runtime.Env
@@ -77,6 +78,14 @@ enum class Operator {
 }
 
 class OperatorExpr(val op: Operator, val args: List<Expr>, loc: Location) : Expr(loc) {
+    /**
+     * True if validation found that this is a division of integers, which discards
+     * the remainder. This is recorded for the warnings in [org.goodmath.simplex.ast.Lint].
+     */
+    var integerDivision: Boolean = false
+
+    override fun children(): List<AstNode> = args
+
     override fun twist(): Twist =
         Twist.obj("OperatorExpr", Twist.attr("op", op.toString()), Twist.array("args", args))
 
@@ -86,69 +95,39 @@ class OperatorExpr(val op: Operator, val args: List<Expr>, loc: Location) : Expr
             val methodName = op.toMethod()
             if (methodName != null) {
                 if (methodName == "neg") {
-                    return target.valueType.applyMethod(target, methodName, emptyList(), env)
+                    return env.applyMethod(target, methodName, emptyList())
 
                 }
-                return target.valueType.applyMethod(
-                    target,
-                    methodName,
-                    listOf(args[1].evaluateIn(env)),
-                    env,
-                )
+                return env.applyMethod(target, methodName, listOf(args[1].evaluateIn(env)))
             } else {
                 return when (op) {
                     Operator.Neq -> {
                         val truthy =
-                            target.valueType.applyMethod(
-                                target,
-                                "eq",
-                                listOf(args[1].evaluateIn(env)),
-                                env,
-                            ) as BooleanValue
+                            env.applyMethod(target, "eq", listOf(args[1].evaluateIn(env))) as BooleanValue
                         BooleanValue(!truthy.b)
                     }
 
                     Operator.Gt -> {
                         val c =
-                            target.valueType.applyMethod(
-                                target,
-                                "compare",
-                                listOf(args[1].evaluateIn(env)),
-                                env,
-                            )
+                            env.applyMethod(target, "compare", listOf(args[1].evaluateIn(env)))
                         BooleanValue((c as IntegerValue).i > 0)
                     }
 
                     Operator.Ge -> {
                         val c =
-                            target.valueType.applyMethod(
-                                target,
-                                "compare",
-                                listOf(args[1].evaluateIn(env)),
-                                env,
-                            )
+                            env.applyMethod(target, "compare", listOf(args[1].evaluateIn(env)))
                         BooleanValue((c as IntegerValue).i >= 0)
                     }
 
                     Operator.Lt -> {
                         val c =
-                            target.valueType.applyMethod(
-                                target,
-                                "compare",
-                                listOf(args[1].evaluateIn(env)),
-                                env,
-                            )
+                            env.applyMethod(target, "compare", listOf(args[1].evaluateIn(env)))
                         BooleanValue((c as IntegerValue).i < 0)
                     }
 
                     Operator.Le -> {
                         val c =
-                            target.valueType.applyMethod(
-                                target,
-                                "compare",
-                                listOf(args[1].evaluateIn(env)),
-                                env,
-                            )
+                            env.applyMethod(target, "compare", listOf(args[1].evaluateIn(env)))
                         BooleanValue((c as IntegerValue).i < 0)
                     }
 
@@ -196,6 +175,7 @@ class OperatorExpr(val op: Operator, val args: List<Expr>, loc: Location) : Expr
         for (arg in args) {
             arg.validate(env)
         }
+        integerDivision = op == Operator.Div && target == Type.IntType
         val methodName =
             op.toMethod()
                 ?: (when (op) {
@@ -218,7 +198,7 @@ class OperatorExpr(val op: Operator, val args: List<Expr>, loc: Location) : Expr
             }
         } else {
             val methodType =
-                target.getMethod(methodName)
+                env.getMethodType(target, methodName)
                     ?: throw SimplexUndefinedError(methodName, "method", loc = loc)
             val realArgs = args.drop(1)
             val methodArgSet = methodType.argSets.firstOrNull { args -> args.size == realArgs.size }
@@ -245,23 +225,23 @@ class OperatorExpr(val op: Operator, val args: List<Expr>, loc: Location) : Expr
     override fun resultType(env: Env): Type {
         val targetType = args[0].resultType(env)
         return when (op) {
-            Operator.Plus -> targetType.getMethod("plus")?.returnType
-            Operator.Minus -> targetType.getMethod("minus")?.returnType
-            Operator.Times -> targetType.getMethod("times")?.returnType
-            Operator.Div -> targetType.getMethod("div")?.returnType
-            Operator.Mod -> targetType.getMethod("mod")?.returnType
-            Operator.Pow -> targetType.getMethod("pow")?.returnType
+            Operator.Plus -> env.getMethodType(targetType, "plus")?.returnType
+            Operator.Minus -> env.getMethodType(targetType, "minus")?.returnType
+            Operator.Times -> env.getMethodType(targetType, "times")?.returnType
+            Operator.Div -> env.getMethodType(targetType, "div")?.returnType
+            Operator.Mod -> env.getMethodType(targetType, "mod")?.returnType
+            Operator.Pow -> env.getMethodType(targetType, "pow")?.returnType
             Operator.Eq -> BooleanValueType.asType
             Operator.Neq -> BooleanValueType.asType
-            Operator.Gt -> targetType.getMethod("compare")?.let { BooleanValueType.asType }
-            Operator.Ge -> targetType.getMethod("compare")?.let { BooleanValueType.asType }
-            Operator.Lt -> targetType.getMethod("compare")?.let { BooleanValueType.asType }
-            Operator.Le -> targetType.getMethod("compare")?.let { BooleanValueType.asType }
+            Operator.Gt -> env.getMethodType(targetType, "compare")?.let { BooleanValueType.asType }
+            Operator.Ge -> env.getMethodType(targetType, "compare")?.let { BooleanValueType.asType }
+            Operator.Lt -> env.getMethodType(targetType, "compare")?.let { BooleanValueType.asType }
+            Operator.Le -> env.getMethodType(targetType, "compare")?.let { BooleanValueType.asType }
             Operator.Not -> BooleanValueType.asType
             Operator.And -> BooleanValueType.asType
             Operator.Or -> BooleanValueType.asType
-            Operator.Subscript -> targetType.getMethod("sub")?.returnType
-            Operator.Uminus -> targetType.getMethod("neg")?.returnType
+            Operator.Subscript -> env.getMethodType(targetType, "sub")?.returnType
+            Operator.Uminus -> env.getMethodType(targetType, "neg")?.returnType
         } ?: throw SimplexUnsupportedOperation(targetType.toString(), op.toString(), loc = loc)
 
     }
@@ -17,16 +17,25 @@ package org.goodmath.simplex.ast.types
 
 import org.goodmath.simplex.runtime.RootEnv
 import org.goodmath.simplex.runtime.SimplexAnalysisError
+import org.goodmath.simplex.runtime.SimplexTypeError
 import org.goodmath.simplex.runtime.values.AnyValueType
 import org.goodmath.simplex.runtime.values.ValueType
+import org.goodmath.simplex.runtime.values.manifold.AssemblyValueType
 import org.goodmath.simplex.runtime.values.manifold.BoundingBoxValueType
 import org.goodmath.simplex.runtime.values.manifold.BoundingRectValueType
+import org.goodmath.simplex.runtime.values.manifold.CollisionValueType
 import org.goodmath.simplex.runtime.values.manifold.ColorValueType
+import org.goodmath.simplex.runtime.values.manifold.DimensionValueType
+import org.goodmath.simplex.runtime.values.manifold.DrawingValueType
+import org.goodmath.simplex.runtime.values.manifold.JointValueType
+import org.goodmath.simplex.runtime.values.manifold.PartValueType
 import org.goodmath.simplex.runtime.values.manifold.SMaterialValueType
 import org.goodmath.simplex.runtime.values.manifold.SMeshGLType
 import org.goodmath.simplex.runtime.values.manifold.SPolygonType
 import org.goodmath.simplex.runtime.values.manifold.SSmoothnessType
 import org.goodmath.simplex.runtime.values.manifold.SliceValueType
+import org.goodmath.simplex.runtime.values.manifold.SlicerVolumeValueType
+import org.goodmath.simplex.runtime.values.manifold.TetMeshValueType
 import org.goodmath.simplex.runtime.values.manifold.SolidValueType
 import org.goodmath.simplex.runtime.values.primitives.VectorValueType
 import org.goodmath.simplex.runtime.values.primitives.BooleanValueType
@@ -35,6 +44,7 @@ import org.goodmath.simplex.runtime.values.primitives.FunctionValueType
 import org.goodmath.simplex.runtime.values.primitives.IntegerValueType
 import org.goodmath.simplex.runtime.values.primitives.MethodValueType
 import org.goodmath.simplex.runtime.values.primitives.NoneValueType
+import org.goodmath.simplex.runtime.values.primitives.SetValueType
 import org.goodmath.simplex.runtime.values.primitives.StringValueType
 import org.goodmath.simplex.runtime.values.primitives.Vec2ValueType
 import org.goodmath.simplex.runtime.values.primitives.Vec3ValueType
@@ -72,6 +82,8 @@ abstract class Type : Twistable {
             SliceValueType,
             SMaterialValueType,
             SMeshGLType, SSmoothnessType,
+            PartValueType, JointValueType, AssemblyValueType, CollisionValueType,
+            SlicerVolumeValueType, DimensionValueType, DrawingValueType, TetMeshValueType,
             NoneValueType, AnyValueType
         )
 
@@ -88,6 +100,15 @@ abstract class Type : Twistable {
             return valueTypes[type] ?: throw SimplexAnalysisError("Unknown value type $type")
         }
 
+        /**
+         * Get the value type of a container's element type. A container can only be built
+         * from a type whose values are already registered.
+         */
+        private fun elementValueType(baseType: Type, container: String): ValueType {
+            return valueTypes[baseType]
+                ?: throw SimplexTypeError(baseType.toString(), "$container element type", "unregistered")
+        }
+
         fun all(): List<Type> {
             return types.values.toList()
         }
@@ -115,7 +136,18 @@ abstract class Type : Twistable {
                 VectorType(baseType)
             } as VectorType
             if (!valueTypes.containsKey(result)) {
-                registerValueType(result, VectorValueType(valueTypes[baseType]!!))
+                registerValueType(result, VectorValueType(elementValueType(baseType, "vector")))
+            }
+            return result
+        }
+
+        fun set(baseType: Type): SetType {
+            val name = "{|$baseType|}"
+            val result = Type.types.computeIfAbsent(name) { n ->
+                SetType(baseType)
+            } as SetType
+            if (!valueTypes.containsKey(result)) {
+                registerValueType(result, SetValueType.of(elementValueType(baseType, "set")))
             }
             return result
         }
@@ -219,6 +251,22 @@ class VectorType internal constructor(val elementType: Type) : Type() {
     }
 }
 
+class SetType internal constructor(val elementType: Type) : Type() {
+    override fun twist(): Twist = Twist.obj("SetType", Twist.value("elementType", elementType))
+
+    override fun toString(): String {
+        return "{|$elementType|}"
+    }
+
+    override fun matchedBy(t: Type): Boolean {
+        return if (t is SetType) {
+            elementType.matchedBy(t.elementType)
+        } else {
+            false
+        }
+    }
+}
+
 class FunctionType internal constructor(val argLists: List<List<Type>>, val returnType: Type) :
     Type() {
 
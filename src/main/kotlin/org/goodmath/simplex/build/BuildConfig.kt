@@ -0,0 +1,344 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.build
+
+import java.nio.file.FileSystems
+import java.nio.file.Files
+import java.nio.file.Path
+import kotlin.io.path.exists
+import kotlin.io.path.isRegularFile
+import kotlin.io.path.readText
+import org.goodmath.simplex.ast.Location
+import org.goodmath.simplex.runtime.SimplexConfigError
+import org.goodmath.simplex.runtime.values.manifold.Quality
+import org.tomlj.Toml
+import org.tomlj.TomlArray
+import org.tomlj.TomlTable
+
+/**
+ * Settings for building models, from the `[build]` section of `simplex.toml`, or
+ * from one of its profiles. A setting that's null wasn't specified.
+ *
+ * @param outputDir the directory that output files are written to, relative to the
+ *    directory containing `simplex.toml`.
+ * @param naming the template for the paths of output files, within the output directory.
+ * @param products the products to build, if the command line doesn't name any.
+ * @param quality how finely to approximate curved surfaces.
+ * @param formats the formats to write the solids of products in.
+ * @param productFormats formats for specific products, by product name, which
+ *    replace [formats] for those products.
+ * @param warningsAsErrors if true, refuse to build models that have warnings.
+ * @param tolerance the default tolerance for boolean operations on solids.
+ */
+data class BuildSettings(
+    val outputDir: String? = null,
+    val naming: String? = null,
+    val products: List<String>? = null,
+    val quality: Quality? = null,
+    val formats: List<String>? = null,
+    val productFormats: Map<String, List<String>> = emptyMap(),
+    val warningsAsErrors: Boolean? = null,
+    val tolerance: Double? = null,
+) {
+    /** These settings, with the settings that are specified in [other] replacing them. */
+    fun overriddenBy(other: BuildSettings): BuildSettings =
+        BuildSettings(
+            other.outputDir ?: outputDir,
+            other.naming ?: naming,
+            other.products ?: products,
+            other.quality ?: quality,
+            other.formats ?: formats,
+            productFormats + other.productFormats,
+            other.warningsAsErrors ?: warningsAsErrors,
+            other.tolerance ?: tolerance,
+        )
+
+    fun formatsFor(product: String): List<String> = productFormats[product] ?: formats ?: listOf("stl")
+
+    /**
+     * The path of an output file, relative to the output directory.
+     *
+     * @param model the name of the model, from [BuildConfig.modelName].
+     * @param product the name of the product.
+     * @param variant the name of the build profile.
+     * @param ext the extension of the output, like "stl" or "drawing.svg".
+     */
+    fun outputName(model: String, product: String, variant: String, ext: String): String =
+        (naming ?: BuildConfig.DEFAULT_NAMING)
+            .replace("{model}", model)
+            .replace("{product}", product)
+            .replace("{variant}", variant)
+            .replace("{ext}", ext)
+}
+
+/**
+ * A project's build configuration, read from the `[build]` section of its
+ * `simplex.toml`.
+ *
+ * @param dir the directory containing `simplex.toml`, which relative paths are
+ *    relative to.
+ * @param models glob patterns for the model files to build.
+ * @param settings the settings that apply to every build.
+ * @param profiles named sets of settings, which override [settings].
+ * @param defaultProfile the profile to use when none is chosen on the command line.
+ */
+class BuildConfig(
+    val dir: Path,
+    val models: List<String>,
+    val settings: BuildSettings,
+    val profiles: Map<String, BuildSettings>,
+    val defaultProfile: String?,
+) {
+    /** The settings for a build using a profile, or no profile if [profile] is null. */
+    fun settingsFor(profile: String?): BuildSettings {
+        if (profile == null) {
+            return settings
+        }
+        val overrides =
+            profiles[profile]
+                ?: throw SimplexConfigError(
+                    "Unknown build profile \"$profile\"; the profiles are " + profiles.keys.joinToString(", ")
+                )
+        return settings.overriddenBy(overrides)
+    }
+
+    /** The model files matched by [models], in a stable order. */
+    fun modelFiles(): List<Path> {
+        val matchers = models.map { FileSystems.getDefault().getPathMatcher("glob:$it") }
+        return Files.walk(dir).use { paths ->
+            paths
+                .filter { it.isRegularFile() && it.toString().endsWith(".s3d") }
+                .filter { p -> matchers.any { it.matches(dir.relativize(p)) } }
+                .sorted()
+                .toList()
+        }
+    }
+
+    /**
+     * The name that a model file's outputs are named by: its path relative to the
+     * directory of `simplex.toml`, without the `.s3d`, like `parts/hinge`. A file
+     * outside that directory is named by its file name alone.
+     */
+    fun modelName(file: Path): String {
+        val root = dir.toAbsolutePath().normalize()
+        val path = file.toAbsolutePath().normalize()
+        val relative = if (path.startsWith(root)) root.relativize(path) else path.fileName
+        return relative.joinToString("/").removeSuffix(".s3d")
+    }
+
+    /** The names of model files, failing if two of them would write the same output files. */
+    fun modelNames(files: List<Path>): Map<Path, String> {
+        val result = LinkedHashMap<Path, String>()
+        val byName = HashMap<String, Path>()
+        for (file in files) {
+            val name = modelName(file)
+            val other = byName.put(name, file)
+            if (other != null && other.toAbsolutePath().normalize() != file.toAbsolutePath().normalize()) {
+                throw SimplexConfigError("$other and $file would both write their outputs as model $name")
+            }
+            result[file] = name
+        }
+        return result
+    }
+
+    companion object {
+        const val FILE_NAME = "simplex.toml"
+        const val DEFAULT_OUTPUT_DIR = "build"
+        const val DEFAULT_NAMING = "{model}-{product}.{ext}"
+
+        /** The formats that a product's solid can be written in. */
+        val formats = setOf("stl", "obj", "ply", "glb", "3mf", "png")
+
+        private val placeholders = setOf("model", "product", "variant", "ext")
+
+        /** Find `simplex.toml` in a directory, or the closest of its parents that has one. */
+        fun find(start: Path): Path? {
+            var d: Path? = start.toAbsolutePath()
+            while (d != null) {
+                val candidate = d.resolve(FILE_NAME)
+                if (candidate.exists()) {
+                    return candidate
+                }
+                d = d.parent
+            }
+            return null
+        }
+
+        fun load(path: Path): BuildConfig =
+            parse(path.toString(), path.readText(), path.toAbsolutePath().parent)
+
+        fun parse(filename: String, text: String, dir: Path): BuildConfig {
+            val toml = Toml.parse(text)
+            val syntaxError = toml.errors().firstOrNull()
+            if (syntaxError != null) {
+                val position = syntaxError.position()
+                throw SimplexConfigError(
+                    syntaxError.message ?: "Invalid TOML",
+                    Location(filename, position?.line() ?: 1, position?.column() ?: 1),
+                )
+            }
+            val build =
+                toml.get(listOf("build")) as? TomlTable
+                    ?: throw SimplexConfigError("$filename has no [build] section", Location(filename, 1, 1))
+            val reader = Reader(filename)
+            reader.checkKeys(build, settingsKeys + setOf("models", "default_profile", "profiles"))
+            val profiles = LinkedHashMap<String, BuildSettings>()
+            val profileTables = reader.subtable(build, "profiles")
+            if (profileTables != null) {
+                for (name in profileTables.keySet()) {
+                    val profile =
+                        reader.subtable(profileTables, name)
+                            ?: throw reader.error("Profile $name must be a table", reader.line(profileTables, name))
+                    reader.checkKeys(profile, settingsKeys)
+                    profiles[name] = reader.settings(profile)
+                }
+            }
+            val defaultProfile = reader.string(build, "default_profile")
+            if (defaultProfile != null && defaultProfile !in profiles) {
+                throw reader.error("Unknown default profile \"$defaultProfile\"", reader.line(build, "default_profile"))
+            }
+            return BuildConfig(
+                dir,
+                reader.strings(build, "models") ?: listOf("*.s3d"),
+                reader.settings(build),
+                profiles,
+                defaultProfile,
+            )
+        }
+
+        private val settingsKeys =
+            setOf("output_dir", "naming", "products", "quality", "formats", "product", "warnings_as_errors", "tolerance")
+    }
+
+    /** Reads typed values from the tables of a configuration file, reporting errors with their lines. */
+    private class Reader(val filename: String) {
+        fun error(msg: String, line: Int): SimplexConfigError = SimplexConfigError(msg, Location(filename, line, 1))
+
+        /** The line that [key] is set on; a key that's quoted or dotted is looked up literally. */
+        fun line(table: TomlTable, key: String): Int = table.inputPositionOf(listOf(key))?.line() ?: 1
+
+        fun value(table: TomlTable, key: String): Any? = table.get(listOf(key))
+
+        fun checkKeys(table: TomlTable, allowed: Set<String>) {
+            for (key in table.keySet()) {
+                if (key !in allowed) {
+                    throw error("Unknown build setting $key", line(table, key))
+                }
+            }
+        }
+
+        fun subtable(table: TomlTable, key: String): TomlTable? =
+            when (val v = value(table, key)) {
+                null -> null
+                is TomlTable -> v
+                else -> throw error("$key must be a table", line(table, key))
+            }
+
+        fun string(table: TomlTable, key: String): String? =
+            when (val v = value(table, key)) {
+                null -> null
+                is String -> v
+                else -> throw error("$key must be a string", line(table, key))
+            }
+
+        fun strings(table: TomlTable, key: String): List<String>? =
+            when (val v = value(table, key)) {
+                null -> null
+                is TomlArray ->
+                    v.toList().map {
+                        it as? String ?: throw error("$key must be a list of strings", line(table, key))
+                    }
+                else -> throw error("$key must be a list of strings", line(table, key))
+            }
+
+        fun boolean(table: TomlTable, key: String): Boolean? =
+            when (val v = value(table, key)) {
+                null -> null
+                is Boolean -> v
+                else -> throw error("$key must be true or false", line(table, key))
+            }
+
+        fun positive(table: TomlTable, key: String): Double? {
+            val v =
+                when (val entry = value(table, key)) {
+                    null -> return null
+                    is Long -> entry.toDouble()
+                    is Double -> entry
+                    else -> throw error("$key must be a number", line(table, key))
+                }
+            if (v <= 0.0) {
+                throw error("$key must be positive", line(table, key))
+            }
+            return v
+        }
+
+        fun formats(table: TomlTable, key: String): List<String>? {
+            val result = strings(table, key) ?: return null
+            for (format in result) {
+                if (format !in BuildConfig.formats) {
+                    throw error(
+                        "Unknown format \"$format\"; expected one of ${BuildConfig.formats.joinToString(", ")}",
+                        line(table, key),
+                    )
+                }
+            }
+            return result
+        }
+
+        fun settings(table: TomlTable): BuildSettings {
+            val naming = string(table, "naming")
+            if (naming != null) {
+                val used = Regex("\\{([^}]*)}").findAll(naming).map { it.groupValues[1] }.toSet()
+                val unknown = used - placeholders
+                if (unknown.isNotEmpty()) {
+                    throw error("Unknown placeholder {${unknown.first()}} in naming", line(table, "naming"))
+                }
+                if ("product" !in used || "ext" !in used) {
+                    throw error("The naming template must include {product} and {ext}", line(table, "naming"))
+                }
+            }
+            val quality =
+                string(table, "quality")?.let { label ->
+                    Quality.entries.firstOrNull { it.label == label }
+                        ?: throw error(
+                            "Unknown quality \"$label\"; expected one of " +
+                                Quality.entries.joinToString(", ") { it.label },
+                            line(table, "quality"),
+                        )
+                }
+            val productFormats = LinkedHashMap<String, List<String>>()
+            val products = subtable(table, "product")
+            if (products != null) {
+                for (name in products.keySet()) {
+                    val product =
+                        subtable(products, name) ?: throw error("Product $name must be a table", line(products, name))
+                    checkKeys(product, setOf("formats"))
+                    formats(product, "formats")?.let { productFormats[name] = it }
+                }
+            }
+            return BuildSettings(
+                string(table, "output_dir"),
+                naming,
+                strings(table, "products"),
+                quality,
+                formats(table, "formats"),
+                productFormats,
+                boolean(table, "warnings_as_errors"),
+                positive(table, "tolerance"),
+            )
+        }
+    }
+}
@@ -0,0 +1,47 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.kernel
+
+import java.nio.file.Files
+import java.nio.file.Path
+import kotlinx.serialization.SerialName
+import kotlinx.serialization.Serializable
+import kotlinx.serialization.json.Json
+
+/**
+ * The contents of the connection file that Jupyter passes to a kernel when it
+ * starts it, describing the sockets that the kernel should listen on.
+ */
+@Serializable
+data class ConnectionInfo(
+    val transport: String = "tcp",
+    val ip: String = "127.0.0.1",
+    @SerialName("shell_port") val shellPort: Int,
+    @SerialName("iopub_port") val iopubPort: Int,
+    @SerialName("stdin_port") val stdinPort: Int,
+    @SerialName("control_port") val controlPort: Int,
+    @SerialName("hb_port") val hbPort: Int,
+    val key: String = "",
+    @SerialName("signature_scheme") val signatureScheme: String = "hmac-sha256",
+) {
+    fun address(port: Int): String = "$transport://$ip:$port"
+
+    companion object {
+        private val json = Json { ignoreUnknownKeys = true }
+
+        fun load(path: Path): ConnectionInfo = json.decodeFromString(Files.readString(path))
+    }
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.kernel
+
+import java.io.ByteArrayOutputStream
+import java.util.Base64
+import java.util.Locale
+import java.util.UUID
+import javax.imageio.ImageIO
+import org.goodmath.simplex.runtime.values.Value
+import org.goodmath.simplex.runtime.values.manifold.MeshData
+import org.goodmath.simplex.runtime.values.manifold.MeshRenderer
+import org.goodmath.simplex.runtime.values.manifold.Slice
+import org.goodmath.simplex.runtime.values.manifold.Solid
+
+/**
+ * Converts the value of a cell to the MIME bundle that a notebook displays. Every
+ * value has a plain text form; solids are also shown in an interactive 3D viewer,
+ * with a rendered PNG image for frontends that can't run it, and slices as SVG images.
+ */
+object DisplayData {
+    /** The version of three.js that the viewer loads. */
+    private const val THREE_URL = "https://cdn.jsdelivr.net/npm/three@0.160.0"
+
+    private const val WIDTH = 600
+    private const val HEIGHT = 400
+
+    fun of(value: Value): Map<String, String> {
+        val result = LinkedHashMap<String, String>()
+        result["text/plain"] = text(value)
+        when (value) {
+            is Solid -> {
+                val mesh = MeshData.of(value)
+                val png = png(mesh)
+                result["image/png"] = png
+                result["text/html"] = viewerHtml(mesh, png)
+            }
+            is Slice -> result["image/svg+xml"] = value.toSvg()
+        }
+        return result
+    }
+
+    fun text(value: Value): String =
+        if (value.valueType.supportsText) {
+            value.valueType.toText(value)
+        } else {
+            value.twist().consStr()
+        }
+
+    /** Render a mesh as a PNG image, encoded in base64. */
+    fun png(mesh: MeshData): String {
+        val bytes = ByteArrayOutputStream()
+        ImageIO.write(MeshRenderer.framing(mesh, WIDTH, HEIGHT).render(mesh), "png", bytes)
+        return Base64.getEncoder().encodeToString(bytes.toByteArray())
+    }
+
+    /**
+     * Generate an HTML fragment that displays a mesh with three.js, which the user
+     * can rotate and zoom with the mouse. Simplex models are Z-up, so the camera is
+     * too.
+     *
+     * The fragment isn't self-contained: three.js is loaded from a CDN. Until it's
+     * loaded, or if it can't be, because the notebook is offline or its scripts
+     * aren't trusted, the fragment shows a rendered image of the mesh instead.
+     *
+     * @param mesh the mesh to display.
+     * @param png the fallback image of the mesh, as a base64 encoded PNG.
+     */
+    fun viewerHtml(mesh: MeshData, png: String): String {
+        val id = "simplex-${UUID.randomUUID()}"
+        val positions = mesh.vertices.joinToString(",") { String.format(Locale.ROOT, "%.5g", it) }
+        val indices = mesh.triangles.joinToString(",")
+        return """
+            |<div id="$id" style="width: 100%; height: ${HEIGHT}px;">
+            |<img src="data:image/png;base64,$png" width="$WIDTH" height="$HEIGHT" alt="A rendered view of the solid">
+            |</div>
+            |<script type="module">
+            |import * as THREE from "$THREE_URL/+esm";
+            |import { OrbitControls } from "$THREE_URL/examples/jsm/controls/OrbitControls.js/+esm";
+            |const el = document.getElementById("$id");
+            |const width = el.clientWidth || $WIDTH;
+            |const height = el.clientHeight || $HEIGHT;
+            |const renderer = new THREE.WebGLRenderer({ antialias: true });
+            |renderer.setSize(width, height);
+            |el.replaceChildren(renderer.domElement);
+            |const scene = new THREE.Scene();
+            |scene.background = new THREE.Color(0xf4f4f4);
+            |const geometry = new THREE.BufferGeometry();
+            |geometry.setAttribute("position", new THREE.Float32BufferAttribute([$positions], 3));
+            |geometry.setIndex([$indices]);
+            |geometry.computeVertexNormals();
+            |geometry.computeBoundingSphere();
+            |const material = new THREE.MeshStandardMaterial({ color: 0x8899aa, flatShading: true });
+            |scene.add(new THREE.Mesh(geometry, material));
+            |scene.add(new THREE.AmbientLight(0xffffff, 0.6));
+            |const light = new THREE.DirectionalLight(0xffffff, 1.5);
+            |light.position.set(1, -1, 2);
+            |scene.add(light);
+            |const { center, radius } = geometry.boundingSphere;
+            |const r = Math.max(radius, 1e-3);
+            |const camera = new THREE.PerspectiveCamera(45, width / height, r / 100, r * 100);
+            |camera.up.set(0, 0, 1);
+            |camera.position.set(center.x + 2 * r, center.y - 2 * r, center.z + 1.5 * r);
+            |const controls = new OrbitControls(camera, renderer.domElement);
+            |controls.target.copy(center);
+            |controls.update();
+            |renderer.setAnimationLoop(() => renderer.render(scene, camera));
+            |</script>
+            |""".trimMargin()
+    }
+}
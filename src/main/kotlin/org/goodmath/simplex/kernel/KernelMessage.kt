@@ -0,0 +1,122 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.kernel
+
+import java.security.MessageDigest
+import java.time.Instant
+import java.util.UUID
+import javax.crypto.Mac
+import javax.crypto.spec.SecretKeySpec
+import kotlinx.serialization.json.Json
+import kotlinx.serialization.json.JsonObject
+import kotlinx.serialization.json.buildJsonObject
+import kotlinx.serialization.json.jsonObject
+import kotlinx.serialization.json.jsonPrimitive
+import kotlinx.serialization.json.put
+
+/**
+ * A message in the Jupyter messaging protocol.
+ *
+ * @param identities the routing prefix of the message, which a reply must repeat.
+ * @param header the message header, which includes its type.
+ * @param parentHeader the header of the message that this one responds to, if any.
+ * @param metadata the message metadata.
+ * @param content the body of the message, whose contents depend on its type.
+ */
+class KernelMessage(
+    val identities: List<ByteArray>,
+    val header: JsonObject,
+    val parentHeader: JsonObject,
+    val metadata: JsonObject,
+    val content: JsonObject,
+) {
+    val msgType: String
+        get() = header["msg_type"]?.jsonPrimitive?.content ?: ""
+
+    /** Convert the message to the frames that are sent over the wire. */
+    fun encode(signer: MessageSigner): List<ByteArray> {
+        val parts =
+            listOf(header, parentHeader, metadata, content).map {
+                it.toString().toByteArray(Charsets.UTF_8)
+            }
+        return identities + DELIMITER + signer.sign(parts).toByteArray(Charsets.UTF_8) + parts
+    }
+
+    companion object {
+        const val PROTOCOL_VERSION = "5.3"
+
+        private val DELIMITER = "<IDS|MSG>".toByteArray(Charsets.UTF_8)
+
+        /**
+         * Decode the frames of a message received over the wire, or return null if
+         * they aren't a correctly signed message.
+         */
+        fun decode(frames: List<ByteArray>, signer: MessageSigner): KernelMessage? {
+            val delim = frames.indexOfFirst { it.contentEquals(DELIMITER) }
+            if (delim < 0 || frames.size < delim + 6) {
+                return null
+            }
+            val signature = frames[delim + 1].toString(Charsets.UTF_8)
+            val parts = frames.subList(delim + 2, delim + 6)
+            if (!signer.verify(parts, signature)) {
+                return null
+            }
+            val objs = parts.map { Json.parseToJsonElement(it.toString(Charsets.UTF_8)).jsonObject }
+            return KernelMessage(frames.subList(0, delim), objs[0], objs[1], objs[2], objs[3])
+        }
+
+        fun header(msgType: String, session: String): JsonObject = buildJsonObject {
+            put("msg_id", UUID.randomUUID().toString())
+            put("session", session)
+            put("username", "simplex")
+            put("date", Instant.now().toString())
+            put("msg_type", msgType)
+            put("version", PROTOCOL_VERSION)
+        }
+    }
+}
+
+/**
+ * Signs and verifies messages using the key from the connection file. An empty
+ * key means that messages aren't signed.
+ */
+class MessageSigner(private val key: String, scheme: String) {
+    private val algorithm =
+        when (scheme) {
+            "hmac-sha256" -> "HmacSHA256"
+            "hmac-sha1" -> "HmacSHA1"
+            "hmac-md5" -> "HmacMD5"
+            else -> throw IllegalArgumentException("Unsupported signature scheme $scheme")
+        }
+
+    fun sign(parts: List<ByteArray>): String {
+        if (key.isEmpty()) {
+            return ""
+        }
+        val mac = Mac.getInstance(algorithm)
+        mac.init(SecretKeySpec(key.toByteArray(Charsets.UTF_8), algorithm))
+        for (p in parts) {
+            mac.update(p)
+        }
+        return mac.doFinal().joinToString("") { "%02x".format(it) }
+    }
+
+    fun verify(parts: List<ByteArray>, signature: String): Boolean =
+        key.isEmpty() || MessageDigest.isEqual(
+            sign(parts).toByteArray(Charsets.UTF_8),
+            signature.toByteArray(Charsets.UTF_8),
+        )
+}
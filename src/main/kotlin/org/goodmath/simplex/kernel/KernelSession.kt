@@ -0,0 +1,181 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.kernel
+
+import org.antlr.v4.runtime.CharStreams
+import org.goodmath.simplex.ast.def.DataDefinition
+import org.goodmath.simplex.ast.def.Definition
+import org.goodmath.simplex.ast.expr.Expr
+import org.goodmath.simplex.ast.types.Type
+import org.goodmath.simplex.parser.SimplexParseListener
+import org.goodmath.simplex.runtime.Env
+import org.goodmath.simplex.runtime.RootEnv
+import org.goodmath.simplex.runtime.values.Value
+
+/**
+ * The state of a notebook: everything defined by the cells that have been run so far.
+ *
+ * Each run of consecutive definitions in a cell creates a new scope, nested inside
+ * the scope of everything that ran before it. So a cell can redefine a name that an
+ * earlier cell defined, but functions that were defined before the redefinition
+ * keep using the original.
+ *
+ * The session uses the global root environment, so there can only be one at a time.
+ */
+class KernelSession {
+    private var env: Env
+
+    init {
+        RootEnv.reset()
+        env = Env.createRootEnv()
+    }
+
+    /**
+     * Run the code of a cell.
+     *
+     * @param code the text of the cell.
+     * @param cellName the name to use for the cell in source locations.
+     * @param output a function to call with each line that the code prints.
+     * @return the value of the last expression in the cell, or null if the cell
+     *    ends with a definition.
+     */
+    fun execute(code: String, cellName: String, output: (String) -> Unit): Value? {
+        val knownScopes = RootEnv.importedScopes.keys.toSet()
+        val savedEcho = RootEnv.echo
+        RootEnv.echo = { _, msg, _ -> output(msg.toString().replace(ansiEscape, "")) }
+        try {
+            val items =
+                SimplexParseListener().parseCell(cellName, CharStreams.fromString(code, cellName)) {
+                    _, msg, _ -> output(msg.toString())
+                }
+            for ((name, scope) in RootEnv.importedScopes) {
+                if (name !in knownScopes) {
+                    scope.installStaticDefinitions()
+                    scope.installDefinitionValues()
+                }
+            }
+            var result: Value? = null
+            var i = 0
+            while (i < items.size) {
+                val item = items[i]
+                if (item is Definition) {
+                    val defs = items.drop(i).takeWhile { it is Definition }.map { it as Definition }
+                    define(defs)
+                    i += defs.size
+                    result = null
+                } else {
+                    val expr = item as Expr
+                    val scope = Env(emptyList(), env)
+                    expr.validate(scope)
+                    result = expr.evaluateIn(scope)
+                    i++
+                }
+            }
+            return result
+        } finally {
+            RootEnv.echo = savedEcho
+        }
+    }
+
+    private fun define(defs: List<Definition>) {
+        // A data type defined by an earlier cell can be redefined, like any other name.
+        // The new definitions need to be registered to be validated, so the earlier ones
+        // are set aside, and only dropped once the new ones are known to be valid.
+        val dataDefs = defs.filterIsInstance<DataDefinition>()
+        val replaced = dataDefs.mapNotNull { RootEnv.dataTypes.remove(it.name) }
+        try {
+            val scope = Env(defs, env)
+            scope.installStaticDefinitions()
+            for (d in defs) {
+                d.validate(scope)
+            }
+            scope.installDefinitionValues()
+            env = scope
+        } catch (e: Exception) {
+            for (d in dataDefs) {
+                if (RootEnv.dataTypes[d.name] === d) {
+                    RootEnv.dataTypes.remove(d.name)
+                    Type.valueTypes.remove(Type.simple(d.name))
+                }
+            }
+            for (old in replaced) {
+                RootEnv.dataTypes[old.name] = old
+                Type.valueTypes[Type.simple(old.name)] = old.valueType
+            }
+            throw e
+        }
+    }
+
+    /**
+     * Whether a cell is complete: "complete", "incomplete" if it has unclosed
+     * brackets, strings, or comments, or "invalid" if it closes brackets that
+     * were never opened.
+     *
+     * @param indent the indentation to suggest for the next line of an incomplete cell.
+     */
+    data class Completeness(val status: String, val indent: String = "")
+
+    companion object {
+        private val ansiEscape = Regex("\u001B\\[[;\\d]*m")
+
+        fun isComplete(code: String): Completeness {
+            var depth = 0
+            var i = 0
+            while (i < code.length) {
+                val c = code[i]
+                when {
+                    c == '"' -> {
+                        i++
+                        while (i < code.length && code[i] != '"') {
+                            if (code[i] == '\\') {
+                                i++
+                            }
+                            i++
+                        }
+                        if (i >= code.length) {
+                            return Completeness("incomplete", "    ".repeat(depth))
+                        }
+                    }
+                    code.startsWith("//", i) -> {
+                        while (i < code.length && code[i] != '\n') {
+                            i++
+                        }
+                    }
+                    code.startsWith("/*", i) -> {
+                        val end = code.indexOf("*/", i + 2)
+                        if (end < 0) {
+                            return Completeness("incomplete", "    ".repeat(depth))
+                        }
+                        i = end + 1
+                    }
+                    c == '(' || c == '[' || c == '{' -> depth++
+                    c == ')' || c == ']' || c == '}' -> {
+                        depth--
+                        if (depth < 0) {
+                            return Completeness("invalid")
+                        }
+                    }
+                }
+                i++
+            }
+            return if (depth > 0) {
+                Completeness("incomplete", "    ".repeat(depth))
+            } else {
+                Completeness("complete")
+            }
+        }
+    }
+}
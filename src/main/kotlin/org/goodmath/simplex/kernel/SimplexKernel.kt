@@ -0,0 +1,255 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.kernel
+
+import java.util.UUID
+import kotlinx.serialization.json.JsonObject
+import kotlinx.serialization.json.add
+import kotlinx.serialization.json.booleanOrNull
+import kotlinx.serialization.json.buildJsonArray
+import kotlinx.serialization.json.buildJsonObject
+import kotlinx.serialization.json.contentOrNull
+import kotlinx.serialization.json.jsonPrimitive
+import kotlinx.serialization.json.put
+import kotlinx.serialization.json.putJsonArray
+import kotlinx.serialization.json.putJsonObject
+import org.goodmath.simplex.runtime.SimplexError
+import org.zeromq.SocketType
+import org.zeromq.ZContext
+import org.zeromq.ZMQ
+import org.zeromq.ZMQException
+import org.zeromq.ZMsg
+
+/**
+ * A Jupyter kernel for Simplex, which runs notebook cells in a persistent
+ * [KernelSession].
+ *
+ * The kernel speaks the Jupyter messaging protocol over the ZeroMQ sockets
+ * described by a connection file. Requests are handled one at a time, in the
+ * order they arrive.
+ */
+class SimplexKernel(private val connection: ConnectionInfo) {
+    private val context = ZContext()
+    private val signer = MessageSigner(connection.key, connection.signatureScheme)
+    private val sessionId = UUID.randomUUID().toString()
+    private val shell = context.createSocket(SocketType.ROUTER)
+    private val control = context.createSocket(SocketType.ROUTER)
+    private val stdin = context.createSocket(SocketType.ROUTER)
+    private val iopub = context.createSocket(SocketType.PUB)
+    private val heartbeat = context.createSocket(SocketType.REP)
+    private val session = KernelSession()
+    private var executionCount = 0
+    private var running = true
+
+    /** Run the kernel until a client asks it to shut down. */
+    fun run() {
+        shell.bind(connection.address(connection.shellPort))
+        control.bind(connection.address(connection.controlPort))
+        stdin.bind(connection.address(connection.stdinPort))
+        iopub.bind(connection.address(connection.iopubPort))
+        heartbeat.bind(connection.address(connection.hbPort))
+
+        val hbThread = Thread {
+            try {
+                while (!Thread.currentThread().isInterrupted) {
+                    val ping = heartbeat.recv(0) ?: break
+                    heartbeat.send(ping, 0)
+                }
+            } catch (e: ZMQException) {
+                // The context was closed when the kernel shut down.
+            }
+        }
+        hbThread.isDaemon = true
+        hbThread.start()
+
+        val poller = context.createPoller(2)
+        poller.register(shell, ZMQ.Poller.POLLIN)
+        poller.register(control, ZMQ.Poller.POLLIN)
+        publishStatus("starting", null)
+        while (running) {
+            if (poller.poll(500) <= 0) {
+                continue
+            }
+            if (poller.pollin(1)) {
+                receive(control)?.let { handle(control, it) }
+            }
+            if (running && poller.pollin(0)) {
+                receive(shell)?.let { handle(shell, it) }
+            }
+        }
+        context.close()
+    }
+
+    private fun receive(socket: ZMQ.Socket): KernelMessage? {
+        val frames = ZMsg.recvMsg(socket) ?: return null
+        val msg = KernelMessage.decode(frames.map { it.data }, signer)
+        if (msg == null) {
+            System.err.println("Discarding message with an invalid signature")
+        }
+        return msg
+    }
+
+    private fun send(socket: ZMQ.Socket, msg: KernelMessage) {
+        val frames = ZMsg()
+        for (f in msg.encode(signer)) {
+            frames.add(f)
+        }
+        frames.send(socket)
+    }
+
+    private fun reply(socket: ZMQ.Socket, parent: KernelMessage, msgType: String, content: JsonObject) {
+        send(
+            socket,
+            KernelMessage(
+                parent.identities,
+                KernelMessage.header(msgType, sessionId),
+                parent.header,
+                JsonObject(emptyMap()),
+                content,
+            ),
+        )
+    }
+
+    private fun publish(msgType: String, parent: KernelMessage?, content: JsonObject) {
+        send(
+            iopub,
+            KernelMessage(
+                listOf(msgType.toByteArray(Charsets.UTF_8)),
+                KernelMessage.header(msgType, sessionId),
+                parent?.header ?: JsonObject(emptyMap()),
+                JsonObject(emptyMap()),
+                content,
+            ),
+        )
+    }
+
+    private fun publishStatus(state: String, parent: KernelMessage?) {
+        publish("status", parent, buildJsonObject { put("execution_state", state) })
+    }
+
+    private fun handle(socket: ZMQ.Socket, msg: KernelMessage) {
+        publishStatus("busy", msg)
+        try {
+            when (msg.msgType) {
+                "kernel_info_request" -> reply(socket, msg, "kernel_info_reply", kernelInfo())
+                "execute_request" -> execute(socket, msg)
+                "is_complete_request" -> {
+                    val code = msg.content["code"]?.jsonPrimitive?.contentOrNull ?: ""
+                    val completeness = KernelSession.isComplete(code)
+                    reply(socket, msg, "is_complete_reply", buildJsonObject {
+                        put("status", completeness.status)
+                        if (completeness.status == "incomplete") {
+                            put("indent", completeness.indent)
+                        }
+                    })
+                }
+                "comm_info_request" ->
+                    reply(socket, msg, "comm_info_reply", buildJsonObject {
+                        put("status", "ok")
+                        putJsonObject("comms") {}
+                    })
+                "history_request" ->
+                    reply(socket, msg, "history_reply", buildJsonObject {
+                        put("status", "ok")
+                        putJsonArray("history") {}
+                    })
+                "shutdown_request" -> {
+                    val restart = msg.content["restart"]?.jsonPrimitive?.booleanOrNull ?: false
+                    reply(socket, msg, "shutdown_reply", buildJsonObject {
+                        put("status", "ok")
+                        put("restart", restart)
+                    })
+                    running = false
+                }
+                else -> System.err.println("Ignoring unsupported message type ${msg.msgType}")
+            }
+        } finally {
+            publishStatus("idle", msg)
+        }
+    }
+
+    private fun kernelInfo(): JsonObject = buildJsonObject {
+        put("status", "ok")
+        put("protocol_version", KernelMessage.PROTOCOL_VERSION)
+        put("implementation", "simplex")
+        put("implementation_version", VERSION)
+        putJsonObject("language_info") {
+            put("name", "simplex")
+            put("version", VERSION)
+            put("mimetype", "text/x-simplex")
+            put("file_extension", ".s3d")
+        }
+        put("banner", "Simplex $VERSION")
+    }
+
+    private fun execute(socket: ZMQ.Socket, msg: KernelMessage) {
+        val code = msg.content["code"]?.jsonPrimitive?.contentOrNull ?: ""
+        val silent = msg.content["silent"]?.jsonPrimitive?.booleanOrNull ?: false
+        if (!silent) {
+            executionCount++
+            publish("execute_input", msg, buildJsonObject {
+                put("code", code)
+                put("execution_count", executionCount)
+            })
+        }
+        try {
+            val value = session.execute(code, "In[$executionCount]") { line ->
+                if (!silent) {
+                    publish("stream", msg, buildJsonObject {
+                        put("name", "stdout")
+                        put("text", line + "\n")
+                    })
+                }
+            }
+            if (value != null && !silent) {
+                publish("execute_result", msg, buildJsonObject {
+                    put("execution_count", executionCount)
+                    putJsonObject("data") {
+                        for ((mime, data) in DisplayData.of(value)) {
+                            put(mime, data)
+                        }
+                    }
+                    putJsonObject("metadata") {}
+                })
+            }
+            reply(socket, msg, "execute_reply", buildJsonObject {
+                put("status", "ok")
+                put("execution_count", executionCount)
+                putJsonObject("user_expressions") {}
+                putJsonArray("payload") {}
+            })
+        } catch (e: Exception) {
+            val ename = if (e is SimplexError) e.kind.toString() else e.javaClass.simpleName
+            val evalue = e.message ?: e.toString()
+            val error = buildJsonObject {
+                put("ename", ename)
+                put("evalue", evalue)
+                put("traceback", buildJsonArray { add(evalue) })
+            }
+            if (!silent) {
+                publish("error", msg, error)
+            }
+            reply(socket, msg, "execute_reply", JsonObject(error + buildJsonObject {
+                put("status", "error")
+                put("execution_count", executionCount)
+            }))
+        }
+    }
+
+    companion object {
+        const val VERSION = "0.1"
+    }
+}
@@ -0,0 +1,241 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.lsp
+
+import java.net.URI
+import java.nio.file.Path
+import org.antlr.v4.runtime.CharStreams
+import org.eclipse.lsp4j.Diagnostic
+import org.eclipse.lsp4j.DiagnosticSeverity
+import org.eclipse.lsp4j.Position
+import org.eclipse.lsp4j.Range
+import org.goodmath.simplex.ast.Location
+import org.goodmath.simplex.ast.Model
+import org.goodmath.simplex.ast.def.Definition
+import org.goodmath.simplex.ast.def.FunctionDefinition
+import org.goodmath.simplex.ast.def.InvokableDefinition
+import org.goodmath.simplex.ast.def.MethodDefinition
+import org.goodmath.simplex.ast.def.NamespaceDefinition
+import org.goodmath.simplex.parser.SimplexErrorListener
+import org.goodmath.simplex.parser.SimplexParseListener
+import org.goodmath.simplex.runtime.Env
+import org.goodmath.simplex.runtime.RootEnv
+import org.goodmath.simplex.runtime.SimplexAnalysisError
+import org.goodmath.simplex.runtime.SimplexError
+import org.goodmath.simplex.runtime.SimplexWarning
+
+/**
+ * The result of parsing and analyzing the current text of an open document.
+ *
+ * Analysis uses the global root environment, so documents are analyzed one at
+ * a time; use [DocumentAnalysis.analyze] to create one.
+ *
+ * @param uri the URI of the document.
+ * @param text the full text of the document.
+ */
+class DocumentAnalysis private constructor(val uri: String, val text: String) {
+    val documentPath: Path? = pathOf(uri)
+
+    val filename: String = documentPath?.toString() ?: uri
+
+    /** The parsed model, or null if the document couldn't be parsed. */
+    var model: Model? = null
+        private set
+
+    val syntaxErrors = ArrayList<SimplexErrorListener.SyntaxError>()
+    val errors = ArrayList<SimplexError>()
+    val warnings = ArrayList<SimplexWarning>()
+
+    /** Diagnostics for things that aren't errors, but which have a suggested fix. */
+    val hints = ArrayList<Diagnostic>()
+
+    val quickFixes = ArrayList<QuickFix>()
+
+    /**
+     * The definitions of the libraries imported by the document, and of its namespaces,
+     * by scope name.
+     */
+    var libraries: Map<String, List<Definition>> = emptyMap()
+        private set
+
+    private val lineStarts: List<Int> =
+        listOf(0) + text.indices.filter { text[it] == '\n' }.map { it + 1 }
+
+    private fun run() {
+        RootEnv.reset()
+        val parser = SimplexParseListener()
+        parser.importRoot = documentPath?.parent
+        val m =
+            try {
+                parser.parse(filename, CharStreams.fromString(text, filename)) { _, _, _ -> }
+            } catch (e: SimplexError) {
+                syntaxErrors.addAll(parser.syntaxErrors)
+                if (parser.syntaxErrors.isEmpty()) {
+                    errors.add(e)
+                }
+                return
+            }
+        model = m
+        libraries = RootEnv.importedScopes.mapValues { (_, env) -> env.defs.values.toList() } +
+            m.defs.filterIsInstance<NamespaceDefinition>().associate { it.name to it.defs }
+        try {
+            Env.createRootEnv()
+            errors.addAll(m.check())
+            warnings.addAll(RootEnv.warnings.filter { it.location?.file == filename })
+            quickFixes.addAll(QuickFixes.find(this, m))
+        } catch (e: SimplexError) {
+            errors.add(e)
+        } catch (e: Exception) {
+            errors.add(SimplexAnalysisError("Internal error", cause = e))
+        }
+    }
+
+    /** Convert a zero-based line and character position to an offset in the text. */
+    fun offsetOf(line: Int, character: Int): Int {
+        if (line >= lineStarts.size) {
+            return text.length
+        }
+        return minOf(lineStarts[line] + character, text.length)
+    }
+
+    fun offsetOf(pos: Position): Int = offsetOf(pos.line, pos.character)
+
+    fun offsetOf(loc: Location): Int = offsetOf(loc.line - 1, loc.col - 1)
+
+    /** Convert an offset in the text to a zero-based LSP position. */
+    fun positionOf(offset: Int): Position {
+        val line = lineStarts.indexOfLast { it <= offset }
+        return Position(line, offset - lineStarts[line])
+    }
+
+    fun positionOf(loc: Location): Position = Position(loc.line - 1, loc.col - 1)
+
+    /** The position just past the end of the document. */
+    val endPosition: Position
+        get() = positionOf(text.length)
+
+    /**
+     * Get the range of the word starting at a source location - which, for most AST nodes,
+     * is the first token of the node. Locations in other files are mapped to the start of
+     * the document.
+     */
+    fun rangeAt(loc: Location?): Range {
+        if (loc == null || loc.file != filename) {
+            return Range(Position(0, 0), Position(0, 0))
+        }
+        val start = offsetOf(loc)
+        var end = start
+        while (end < text.length && (text[end].isLetterOrDigit() || text[end] == '_')) {
+            end++
+        }
+        if (end == start && end < text.length) {
+            end++
+        }
+        return Range(positionOf(start), positionOf(end))
+    }
+
+    /**
+     * Find the end of the bound name in a `let` binding that starts at a location, or
+     * null if there's no `let` at that location.
+     */
+    fun letNameEnd(loc: Location, name: String): Int? {
+        if (loc.file != filename) {
+            return null
+        }
+        val start = offsetOf(loc)
+        val m = Regex("let\\s+${Regex.escape(name)}\\b").find(text, start)
+        return if (m == null || m.range.first != start) {
+            null
+        } else {
+            m.range.last + 1
+        }
+    }
+
+    /**
+     * Find the offsets of the declared return type of a function or method, from the
+     * start of the type to just past its end, or null if the definition isn't in
+     * this document.
+     */
+    fun returnTypeRange(def: InvokableDefinition): IntRange? {
+        if (def.loc.file != filename) {
+            return null
+        }
+        val header =
+            when (def) {
+                is FunctionDefinition -> Regex("fun\\s+${Regex.escape(def.name)}\\s*\\(")
+                is MethodDefinition -> Regex("->\\s*${Regex.escape(def.methodName)}\\s*\\(")
+            }
+        val m = header.find(text, offsetOf(def.loc)) ?: return null
+        var depth = 0
+        var i = m.range.last
+        while (i < text.length) {
+            if (text[i] == '(') {
+                depth++
+            } else if (text[i] == ')') {
+                depth--
+                if (depth == 0) {
+                    break
+                }
+            }
+            i++
+        }
+        if (i >= text.length) {
+            return null
+        }
+        val colon = Regex("\\s*:\\s*").matchAt(text, i + 1) ?: return null
+        val start = colon.range.last + 1
+        // The body starts at the first brace that doesn't open a set type, like {|Int|}.
+        var end = start
+        while (end < text.length && !(text[end] == '{' && text.getOrNull(end + 1) != '|')) {
+            end++
+        }
+        while (end > start && text[end - 1].isWhitespace()) {
+            end--
+        }
+        return if (end > start) start until end else null
+    }
+
+    fun diagnosticFor(e: SimplexError): Diagnostic =
+        Diagnostic(rangeAt(e.location), "${e.kind} ${e.detail}", DiagnosticSeverity.Error, SOURCE)
+
+    val diagnostics: List<Diagnostic> by lazy {
+        syntaxErrors.map {
+            val pos = Position(it.line - 1, it.col - 1)
+            Diagnostic(Range(pos, pos), it.message, DiagnosticSeverity.Error, SOURCE)
+        } + errors.map { diagnosticFor(it) } +
+            warnings.map { Diagnostic(rangeAt(it.location), it.detail, DiagnosticSeverity.Warning, SOURCE) } +
+            hints
+    }
+
+    companion object {
+        const val SOURCE = "simplex"
+
+        /** Get the filesystem path of a document URI, if it has one. */
+        fun pathOf(uri: String): Path? =
+            try {
+                Path.of(URI(uri))
+            } catch (e: Exception) {
+                null
+            }
+
+        /** Parse and analyze a document. */
+        fun analyze(uri: String, text: String): DocumentAnalysis {
+            val result = DocumentAnalysis(uri, text)
+            synchronized(RootEnv) { result.run() }
+            return result
+        }
+    }
+}
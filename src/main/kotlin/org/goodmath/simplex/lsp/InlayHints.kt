@@ -0,0 +1,126 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.lsp
+
+import org.eclipse.lsp4j.InlayHint
+import org.eclipse.lsp4j.InlayHintKind
+import org.eclipse.lsp4j.Position
+import org.eclipse.lsp4j.Range
+import org.eclipse.lsp4j.jsonrpc.messages.Either
+import org.goodmath.simplex.ast.Location
+import org.goodmath.simplex.ast.def.VariableDefinition
+import org.goodmath.simplex.ast.expr.Expr
+import org.goodmath.simplex.ast.expr.FunCallExpr
+import org.goodmath.simplex.ast.expr.LetExpr
+import org.goodmath.simplex.ast.expr.MethodCallExpr
+import org.goodmath.simplex.ast.expr.ScopedRefExpr
+import org.goodmath.simplex.ast.expr.VarRefExpr
+import org.goodmath.simplex.ast.types.Type
+
+/**
+ * Computes inlay hints for an analyzed document: the inferred types of `let`
+ * bindings that don't declare one, and the names of the parameters that the
+ * arguments of a call are bound to.
+ */
+object InlayHints {
+    fun hints(analysis: DocumentAnalysis, range: Range): List<InlayHint> {
+        val model = analysis.model ?: return emptyList()
+        val result = ArrayList<InlayHint>()
+        model.walk { node ->
+            when (node) {
+                is LetExpr ->
+                    if (node.type == null) {
+                        typeHint(analysis, node.loc, node.name, node.inferredType)?.let { result.add(it) }
+                    }
+                is VariableDefinition ->
+                    if (node.type == null) {
+                        typeHint(analysis, node.loc, node.name, node.inferredType)?.let { result.add(it) }
+                    }
+                is FunCallExpr -> {
+                    val f = node.funExpr
+                    val signatures =
+                        when (f) {
+                            is VarRefExpr -> CallSignatures.functions(f.name, model, analysis.libraries)
+                            is ScopedRefExpr ->
+                                CallSignatures.functions(f.name, model, analysis.libraries, f.scope)
+                            else -> emptyList()
+                        }
+                    result.addAll(paramHints(analysis, node.argExprs, node.argTypes, signatures))
+                }
+                is MethodCallExpr ->
+                    node.targetType?.let { targetType ->
+                        val signatures = CallSignatures.methods(node.name, targetType, model)
+                        result.addAll(paramHints(analysis, node.args, node.argTypes, signatures))
+                    }
+                else -> {}
+            }
+        }
+        return result.filter { inRange(it.position, range) }
+    }
+
+    private fun typeHint(
+        analysis: DocumentAnalysis,
+        loc: Location,
+        name: String,
+        type: Type?,
+    ): InlayHint? {
+        if (type == null) {
+            return null
+        }
+        val nameEnd = analysis.letNameEnd(loc, name) ?: return null
+        val hint = InlayHint(analysis.positionOf(nameEnd), Either.forLeft(": $type"))
+        hint.kind = InlayHintKind.Type
+        return hint
+    }
+
+    private fun paramHints(
+        analysis: DocumentAnalysis,
+        args: List<Expr>,
+        argTypes: List<Type>?,
+        signatures: List<CallSignature>,
+    ): List<InlayHint> {
+        // Parameter lists with the same arity are told apart by the analyzed
+        // argument types, the same way that validation picks one. Without the
+        // types, the names would be a guess, so don't show any.
+        val candidates = signatures.flatMap { it.paramSets }.filter { it.size == args.size }
+        val params =
+            if (candidates.size == 1) {
+                candidates.first()
+            } else if (argTypes != null) {
+                candidates.firstOrNull { params ->
+                    params.zip(argTypes).all { (param, actual) -> param.type.matchedBy(actual) }
+                } ?: return emptyList()
+            } else {
+                return emptyList()
+            }
+        return args.zip(params).mapNotNull { (arg, param) ->
+            if (arg.loc.file != analysis.filename || (arg is VarRefExpr && arg.name == param.name)) {
+                null
+            } else {
+                val hint = InlayHint(analysis.positionOf(arg.loc), Either.forLeft("${param.name}:"))
+                hint.kind = InlayHintKind.Parameter
+                hint.paddingRight = true
+                hint
+            }
+        }
+    }
+
+    private fun inRange(pos: Position, range: Range): Boolean =
+        (pos.line > range.start.line ||
+            (pos.line == range.start.line && pos.character >= range.start.character)) &&
+            (pos.line < range.end.line ||
+                (pos.line == range.end.line && pos.character <= range.end.character))
+}
@@ -0,0 +1,266 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.lsp
+
+import java.nio.file.Files
+import java.nio.file.Path
+import org.antlr.v4.runtime.CharStreams
+import org.eclipse.lsp4j.Range
+import org.goodmath.simplex.ast.AstNode
+import org.goodmath.simplex.ast.Model
+import org.goodmath.simplex.ast.def.InvokableDefinition
+import org.goodmath.simplex.ast.def.MethodDefinition
+import org.goodmath.simplex.ast.def.NamespaceDefinition
+import org.goodmath.simplex.ast.types.Type
+import org.goodmath.simplex.parser.SimplexParseListener
+import org.goodmath.simplex.runtime.Env
+import org.goodmath.simplex.runtime.RootEnv
+import org.goodmath.simplex.runtime.SimplexEvaluationError
+import org.goodmath.simplex.runtime.values.Value
+import org.goodmath.simplex.runtime.values.ValueType
+import org.goodmath.simplex.runtime.values.manifold.MeshData
+import org.goodmath.simplex.runtime.values.manifold.SMaterial
+import org.goodmath.simplex.runtime.values.manifold.Solid
+import org.goodmath.simplex.runtime.values.primitives.AbstractMethod
+
+class RenderProductParams(var uri: String = "", var product: String = "", var format: String = "mesh")
+
+/**
+ * The result of rendering a product.
+ *
+ * @param product the name of the product.
+ * @param bodies the number of solids produced.
+ * @param mesh the combined mesh of the solids, if the requested format was "mesh".
+ * @param glbPath the path of a GLB file containing the mesh, if the requested format was "glb".
+ * @param text the text form of the other values produced.
+ * @param output anything that the model printed while it was evaluated.
+ * @param timings how long each phase took, in milliseconds.
+ */
+class RenderProductResult(
+    val product: String,
+    val bodies: Int,
+    val mesh: MeshData?,
+    val glbPath: String?,
+    val text: List<String>,
+    val output: List<String>,
+    val timings: Map<String, Long>,
+)
+
+class EvaluateExpressionParams(
+    var uri: String = "",
+    var expression: String = "",
+    var range: Range? = null,
+)
+
+/**
+ * The result of evaluating an expression.
+ *
+ * @param type the static type of the expression.
+ * @param text a printable form of the value.
+ * @param mesh the mesh of the value, if it's a solid.
+ * @param output anything that the model printed while it was evaluated.
+ * @param timings how long each phase took, in milliseconds.
+ */
+class EvaluateExpressionResult(
+    val type: String,
+    val text: String,
+    val mesh: MeshData?,
+    val output: List<String>,
+    val timings: Map<String, Long>,
+)
+
+/**
+ * A model that's been loaded into the language server for evaluation. Loading
+ * evaluates the model's top-level definitions once; after that, products and
+ * expressions can be evaluated repeatedly without paying that cost again, or the
+ * cost of starting a new JVM.
+ *
+ * The root environment is shared by everything in the server, so callers must
+ * hold the lock on [RootEnv] while using a session.
+ */
+class ModelSession private constructor(
+    val uri: String,
+    val text: String,
+    val model: Model,
+    private val scopes: Map<String, Env>,
+    private val modelDir: Path?,
+) {
+    private lateinit var executionEnv: Env
+
+    /**
+     * The model's methods and namespaces, as they were evaluated when the session was
+     * loaded. Resetting the root environment discards them, so they're put back each
+     * time the session is activated.
+     */
+    private val methods = ArrayList<Pair<ValueType, AbstractMethod>>()
+    private val namespaces = HashMap<String, Env>()
+
+    /** How long it took to load the session, by phase, in milliseconds. */
+    val loadTimings = LinkedHashMap<String, Long>()
+
+    /**
+     * Set up the root environment for this session's model. Other documents may
+     * have been analyzed since the session was loaded, replacing the model's
+     * definitions and libraries in the root environment.
+     */
+    private fun activate() {
+        RootEnv.reset()
+        RootEnv.modelDir = modelDir
+        RootEnv.importedScopes.putAll(scopes)
+        Env.createRootEnv()
+        model.analyze()
+        for ((valueType, method) in methods) {
+            valueType.addMethod(method)
+        }
+        RootEnv.namespaces.putAll(namespaces)
+    }
+
+    fun renderProduct(name: String, format: String): RenderProductResult {
+        val product =
+            model.products.firstOrNull { it.name == name }
+                ?: throw SimplexEvaluationError("Model has no product named '$name'")
+        val timings = LinkedHashMap<String, Long>()
+        val output = ArrayList<String>()
+        timed(timings, "activate") { activate() }
+        val results = timed(timings, "evaluate") { capturingOutput(output) { product.evaluate(executionEnv) } }
+        val combined = timed(timings, "combine") { product.combineSolids(results) }
+        var mesh: MeshData? = null
+        var glbPath: String? = null
+        if (combined != null) {
+            if (format == "glb") {
+                timed(timings, "export") {
+                    val path = Files.createTempFile("simplex-$name-", ".glb")
+                    combined.export(path.toString(), SMaterial.smoothGray)
+                    glbPath = path.toString()
+                }
+            } else {
+                mesh = timed(timings, "mesh") { MeshData.of(combined) }
+            }
+        }
+        val text = results.filter { it !is Solid }.map { describe(it) }
+        return RenderProductResult(name, results.count { it is Solid }, mesh, glbPath, text, output, timings)
+    }
+
+    /**
+     * Evaluate an expression in the scope of the model's top-level definitions.
+     */
+    fun evaluateExpression(source: String): EvaluateExpressionResult {
+        val timings = LinkedHashMap<String, Long>()
+        val output = ArrayList<String>()
+        timed(timings, "activate") { activate() }
+        val expr = timed(timings, "parse") {
+            SimplexParseListener().parseExpression("<expression>", CharStreams.fromString(source))
+        }
+        val type = timed(timings, "analyze") {
+            val staticEnv = Env(emptyList(), RootEnv)
+            expr.validate(staticEnv)
+            expr.resultType(staticEnv)
+        }
+        val value = timed(timings, "evaluate") {
+            capturingOutput(output) { expr.evaluateIn(Env(emptyList(), executionEnv)) }
+        }
+        val mesh = if (value is Solid) timed(timings, "mesh") { MeshData.of(value) } else null
+        return EvaluateExpressionResult(type.toString(), describe(value), mesh, output, timings)
+    }
+
+    /**
+     * Evaluate the expression in a range of the model's text. Only expressions outside of
+     * functions and methods can be evaluated: inside of one, the expression can refer to
+     * parameters and local variables, which only have values while it's running.
+     */
+    fun evaluateRange(range: Range): EvaluateExpressionResult {
+        val analysis = DocumentAnalysis.analyze(uri, text)
+        val start = analysis.offsetOf(range.start)
+        val end = analysis.offsetOf(range.end)
+        val enclosing = analysis.model?.let { enclosingInvokable(analysis, it, start) }
+        if (enclosing != null) {
+            val kind = if (enclosing is MethodDefinition) "method" else "function"
+            throw SimplexEvaluationError(
+                "The selection is inside of $kind ${enclosing.name}, and can only be evaluated " +
+                    "when it's called; select an expression outside of functions and methods"
+            )
+        }
+        return evaluateExpression(text.substring(start, end))
+    }
+
+    /**
+     * Find the function or method that contains an offset in the text. The top-level
+     * definitions, the members of namespaces, and the products follow each other in the
+     * text, so the one that contains the offset is the last one that starts before it.
+     */
+    private fun enclosingInvokable(analysis: DocumentAnalysis, model: Model, offset: Int): InvokableDefinition? {
+        val items: List<AstNode> =
+            model.defs.flatMap { if (it is NamespaceDefinition) listOf(it) + it.defs else listOf(it) } +
+                model.products
+        return items
+            .filter { it.loc.file == analysis.filename && analysis.offsetOf(it.loc) <= offset }
+            .maxByOrNull { analysis.offsetOf(it.loc) } as? InvokableDefinition
+    }
+
+    private fun describe(v: Value): String =
+        if (v.valueType.supportsText) {
+            v.valueType.toText(v)
+        } else {
+            v.twist().consStr()
+        }
+
+    private fun <T> capturingOutput(output: MutableList<String>, f: () -> T): T {
+        val savedEcho = RootEnv.echo
+        RootEnv.echo = { _, msg, _ -> output.add(msg.toString().replace(ansiEscape, "")) }
+        try {
+            return f()
+        } finally {
+            RootEnv.echo = savedEcho
+        }
+    }
+
+    companion object {
+        private val ansiEscape = Regex("\u001B\\[[;\\d]*m")
+
+        private fun <T> timed(timings: MutableMap<String, Long>, phase: String, f: () -> T): T {
+            val start = System.nanoTime()
+            val result = f()
+            timings[phase] = (System.nanoTime() - start) / 1_000_000
+            return result
+        }
+
+        /** Parse a model, and evaluate its top-level definitions. */
+        fun load(uri: String, text: String): ModelSession {
+            val timings = LinkedHashMap<String, Long>()
+            val path = DocumentAnalysis.pathOf(uri)
+            val filename = path?.toString() ?: uri
+            RootEnv.reset()
+            val model = timed(timings, "parse") {
+                val parser = SimplexParseListener()
+                parser.importRoot = path?.parent
+                parser.parse(filename, CharStreams.fromString(text, filename)) { _, _, _ -> }
+            }
+            val session = ModelSession(uri, text, model, HashMap(RootEnv.importedScopes), path?.parent)
+            timed(timings, "analyze") { session.activate() }
+            timed(timings, "definitions") {
+                session.executionEnv = Env(model.defs, RootEnv)
+                session.executionEnv.installDefinitionValues()
+            }
+            for ((type, name) in RootEnv.userMethods) {
+                val valueType = Type.valueTypes[type] ?: continue
+                valueType.methods[name]?.let { session.methods.add(Pair(valueType, it)) }
+            }
+            session.namespaces.putAll(RootEnv.namespaces)
+            session.loadTimings.putAll(timings)
+            return session
+        }
+    }
+}
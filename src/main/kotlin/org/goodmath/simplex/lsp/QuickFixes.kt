@@ -0,0 +1,368 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.lsp
+
+import kotlin.io.path.exists
+import org.eclipse.lsp4j.CodeAction
+import org.eclipse.lsp4j.CodeActionKind
+import org.eclipse.lsp4j.Diagnostic
+import org.eclipse.lsp4j.DiagnosticSeverity
+import org.eclipse.lsp4j.Position
+import org.eclipse.lsp4j.Range
+import org.eclipse.lsp4j.TextEdit
+import org.eclipse.lsp4j.WorkspaceEdit
+import org.goodmath.simplex.ast.Location
+import org.goodmath.simplex.ast.Model
+import org.goodmath.simplex.ast.def.FunctionDefinition
+import org.goodmath.simplex.ast.def.InvokableDefinition
+import org.goodmath.simplex.ast.def.VariableDefinition
+import org.goodmath.simplex.ast.expr.Expr
+import org.goodmath.simplex.ast.expr.FunCallExpr
+import org.goodmath.simplex.ast.expr.LetExpr
+import org.goodmath.simplex.ast.expr.LiteralExpr
+import org.goodmath.simplex.ast.expr.MethodCallExpr
+import org.goodmath.simplex.ast.expr.ScopedRefExpr
+import org.goodmath.simplex.ast.expr.VarRefExpr
+import org.goodmath.simplex.ast.types.Type
+import org.goodmath.simplex.runtime.RootEnv
+import org.goodmath.simplex.runtime.SimplexError
+import org.goodmath.simplex.runtime.SimplexTypeError
+import org.goodmath.simplex.runtime.SimplexUndefinedMethodError
+import org.goodmath.simplex.runtime.SimplexUndefinedScopeError
+import org.goodmath.simplex.runtime.SimplexUndefinedVariableError
+
+/**
+ * A fix that the language server can offer as a code action.
+ *
+ * @param title the title shown to the user.
+ * @param range the range of the document that the fix applies to; the fix is offered when
+ *    the range of a code action request overlaps it.
+ * @param edits the edits that implement the fix.
+ * @param diagnostic the diagnostic that the fix resolves, if any.
+ */
+data class QuickFix(
+    val title: String,
+    val range: Range,
+    val edits: List<TextEdit>,
+    val diagnostic: Diagnostic? = null,
+    val kind: String = CodeActionKind.QuickFix,
+) {
+    fun overlaps(other: Range): Boolean =
+        !(before(other.end, range.start) || before(range.end, other.start))
+
+    fun toCodeAction(uri: String): CodeAction {
+        val action = CodeAction(title)
+        action.kind = kind
+        action.edit = WorkspaceEdit(mapOf(uri to edits))
+        if (diagnostic != null) {
+            action.diagnostics = listOf(diagnostic)
+            action.isPreferred = true
+        }
+        return action
+    }
+
+    companion object {
+        private fun before(l: Position, r: Position): Boolean =
+            l.line < r.line || (l.line == r.line && l.character < r.character)
+    }
+}
+
+/**
+ * Finds the fixes that can be offered for an analyzed document. This must be run
+ * while the root environment still holds the document's definitions, since
+ * some fixes need to compute the static types of expressions.
+ */
+object QuickFixes {
+    fun find(analysis: DocumentAnalysis, model: Model): List<QuickFix> {
+        val result = ArrayList<QuickFix>()
+        val userFunctions =
+            model.defs.filterIsInstance<FunctionDefinition>().associateBy { it.name }
+        model.walk { node ->
+            when (node) {
+                is LetExpr ->
+                    if (node.type == null) {
+                        addTypeDeclaration(analysis, node.loc, node.name, node.inferredType)
+                            ?.let { result.add(it) }
+                    }
+                is VariableDefinition ->
+                    if (node.type == null) {
+                        addTypeDeclaration(analysis, node.loc, node.name, node.inferredType)
+                            ?.let { result.add(it) }
+                    }
+                is InvokableDefinition -> fixReturnType(analysis, node)?.let { result.add(it) }
+                is FunCallExpr -> result.addAll(convertIntArguments(analysis, node, userFunctions))
+                else -> {}
+            }
+        }
+        for (e in analysis.errors) {
+            val fix =
+                when (e) {
+                    is SimplexUndefinedVariableError -> createFunction(analysis, model, e)
+                    is SimplexUndefinedMethodError -> createMethod(analysis, model, e)
+                    is SimplexUndefinedScopeError -> addImport(analysis, e)
+                    else -> null
+                }
+            fix?.let { result.add(it) }
+        }
+        return result
+    }
+
+    /** Offer to add the inferred type to a `let` that doesn't declare one. */
+    private fun addTypeDeclaration(
+        analysis: DocumentAnalysis,
+        loc: Location,
+        name: String,
+        type: Type?,
+    ): QuickFix? {
+        if (type == null) {
+            return null
+        }
+        val typeStr = type.toString()
+        // Function types with more than one parameter list can't be written in source.
+        if (typeStr.contains("|")) {
+            return null
+        }
+        val nameEnd = analysis.letNameEnd(loc, name) ?: return null
+        val insertAt = analysis.positionOf(nameEnd)
+        return QuickFix(
+            "Declare type of '$name' as $typeStr",
+            Range(analysis.positionOf(loc), insertAt),
+            listOf(TextEdit(Range(insertAt, insertAt), ": $typeStr")),
+            kind = CodeActionKind.RefactorRewrite,
+        )
+    }
+
+    /**
+     * Offer to change the declared return type of a function or method to the type
+     * that the analyzer inferred for its body, when they don't match. Parameter types
+     * can't be inferred this way, because the grammar requires every parameter to
+     * declare one.
+     */
+    private fun fixReturnType(analysis: DocumentAnalysis, def: InvokableDefinition): QuickFix? {
+        val inferred = def.inferredReturnType ?: return null
+        if (def.returnType.matchedBy(inferred)) {
+            return null
+        }
+        val typeStr = inferred.toString()
+        if (typeStr.contains("|") && !typeStr.startsWith("{|")) {
+            return null
+        }
+        val offsets = analysis.returnTypeRange(def) ?: return null
+        val typeRange = Range(analysis.positionOf(offsets.first), analysis.positionOf(offsets.last + 1))
+        val error = analysis.errors.firstOrNull { it is SimplexTypeError && it.location == def.loc }
+        return QuickFix(
+            "Change return type of '${def.name}' to $typeStr",
+            Range(analysis.positionOf(def.loc), typeRange.end),
+            listOf(TextEdit(typeRange, typeStr)),
+            error?.let { analysis.diagnosticFor(it) },
+        )
+    }
+
+    /**
+     * An Int passed to a Float parameter is silently converted, which usually means
+     * that some integer arithmetic happened that the author didn't intend. Offer to make
+     * the conversion explicit.
+     */
+    private fun convertIntArguments(
+        analysis: DocumentAnalysis,
+        call: FunCallExpr,
+        userFunctions: Map<String, FunctionDefinition>,
+    ): List<QuickFix> {
+        val funExpr = call.funExpr as? VarRefExpr ?: return emptyList()
+        val def = userFunctions[funExpr.name] ?: return emptyList()
+        val paramTypes = call.paramTypes ?: return emptyList()
+        val argTypes = call.argTypes ?: return emptyList()
+        val result = ArrayList<QuickFix>()
+        for ((idx, arg) in call.argExprs.withIndex()) {
+            if (paramTypes[idx] != Type.FloatType || argTypes[idx] != Type.IntType) {
+                continue
+            }
+            if (arg.loc.file != analysis.filename) {
+                continue
+            }
+            val start = analysis.offsetOf(arg.loc)
+            val end = expressionEnd(analysis.text, start)
+            val argText = analysis.text.substring(start, end)
+            val replacement =
+                if (isPostfixTarget(arg)) {
+                    "$argText->float()"
+                } else {
+                    "($argText)->float()"
+                }
+            val range = Range(analysis.positionOf(start), analysis.positionOf(end))
+            val paramName = def.params.getOrNull(idx)?.name ?: "#${idx + 1}"
+            val diagnostic =
+                Diagnostic(
+                    range,
+                    "Int value passed to Float parameter '$paramName' of '${def.name}' is implicitly converted",
+                    DiagnosticSeverity.Information,
+                    DocumentAnalysis.SOURCE,
+                )
+            analysis.hints.add(diagnostic)
+            result.add(
+                QuickFix(
+                    "Convert argument to Float with ->float()",
+                    range,
+                    listOf(TextEdit(range, replacement)),
+                    diagnostic,
+                )
+            )
+        }
+        return result
+    }
+
+    /** Offer to create a stub function for a call to an undefined name. */
+    private fun createFunction(
+        analysis: DocumentAnalysis,
+        model: Model,
+        e: SimplexUndefinedVariableError,
+    ): QuickFix? {
+        val call = findNode<FunCallExpr>(model) { call ->
+            val f = call.funExpr
+            f is VarRefExpr && f.name == e.name && (f.loc == e.location || call.loc == e.location)
+        } ?: return null
+        val stub = "fun ${e.name}(${stubParams(call.argExprs, call.argTypes)}): None {\n    none\n}\n"
+        return appendStub(analysis, "Create function '${e.name}'", stub, e)
+    }
+
+    /** Offer to create a stub method for a call to an undefined method. */
+    private fun createMethod(
+        analysis: DocumentAnalysis,
+        model: Model,
+        e: SimplexUndefinedMethodError,
+    ): QuickFix? {
+        val call = findNode<MethodCallExpr>(model) { it.name == e.name && it.loc == e.location }
+            ?: return null
+        val stub = "meth ${e.ofType}->${e.name}(${stubParams(call.args, call.argTypes)}): None {\n    none\n}\n"
+        return appendStub(analysis, "Create method '${e.ofType}->${e.name}'", stub, e)
+    }
+
+    /** Offer to import a library for an unknown scope name. */
+    private fun addImport(analysis: DocumentAnalysis, e: SimplexUndefinedScopeError): QuickFix? {
+        val libFile = "${e.scope}.s3d"
+        val dir = analysis.documentPath?.parent
+        val exists = dir != null && dir.resolve(libFile).exists()
+        val lines = analysis.text.split("\n")
+        val lastImport = lines.indexOfLast { it.trimStart().startsWith("import ") }
+        val insertAt = Position(lastImport + 1, 0)
+        val importStmt = "import \"$libFile\" as ${e.scope}\n"
+        return QuickFix(
+            if (exists) {
+                "Import \"$libFile\" as ${e.scope}"
+            } else {
+                "Import \"$libFile\" as ${e.scope} (file not found)"
+            },
+            analysis.rangeAt(e.location),
+            listOf(TextEdit(Range(insertAt, insertAt), importStmt)),
+            analysis.diagnosticFor(e),
+        )
+    }
+
+    private fun appendStub(
+        analysis: DocumentAnalysis,
+        title: String,
+        stub: String,
+        e: SimplexError,
+    ): QuickFix {
+        val end = analysis.endPosition
+        val separator = if (analysis.text.endsWith("\n")) "\n" else "\n\n"
+        return QuickFix(
+            title,
+            analysis.rangeAt(e.location),
+            listOf(TextEdit(Range(end, end), separator + stub)),
+            analysis.diagnosticFor(e),
+        )
+    }
+
+    /**
+     * Build a parameter list for a stub from the arguments of a call. Arguments that
+     * are simple variable references lend their names to the parameters. The types
+     * are the argument types recorded during validation if there are any, or else
+     * whatever can be computed in the root scope.
+     */
+    private fun stubParams(args: List<Expr>, argTypes: List<Type>?): String {
+        val used = HashSet<String>()
+        return args.withIndex().joinToString(", ") { (idx, arg) ->
+            var name = (arg as? VarRefExpr)?.name ?: (arg as? ScopedRefExpr)?.name ?: "p${idx + 1}"
+            if (!used.add(name)) {
+                name = "${name}_${idx + 1}"
+                used.add(name)
+            }
+            val type =
+                try {
+                    (argTypes?.get(idx) ?: arg.resultType(RootEnv)).toString()
+                } catch (e: Exception) {
+                    "Any"
+                }
+            "$name: $type"
+        }
+    }
+
+    private inline fun <reified T> findNode(model: Model, crossinline pred: (T) -> Boolean): T? {
+        var found: T? = null
+        model.walk { node ->
+            if (found == null && node is T && pred(node)) {
+                found = node
+            }
+        }
+        return found
+    }
+
+    /** Expressions that can take a `->` method call without being parenthesized. */
+    private fun isPostfixTarget(e: Expr): Boolean =
+        e is VarRefExpr ||
+            e is ScopedRefExpr ||
+            e is LiteralExpr<*> ||
+            e is FunCallExpr ||
+            e is MethodCallExpr
+
+    /**
+     * Find the end of the expression starting at an offset in the text: the first
+     * comma or unbalanced closing bracket that isn't nested or inside a string.
+     */
+    fun expressionEnd(text: String, start: Int): Int {
+        var depth = 0
+        var i = start
+        while (i < text.length) {
+            val c = text[i]
+            when {
+                c == '"' -> {
+                    i++
+                    while (i < text.length && text[i] != '"') {
+                        if (text[i] == '\\') {
+                            i++
+                        }
+                        i++
+                    }
+                }
+                c == '(' || c == '[' || c == '{' -> depth++
+                c == ')' || c == ']' || c == '}' -> {
+                    if (depth == 0) {
+                        break
+                    }
+                    depth--
+                }
+                c == ',' && depth == 0 -> break
+            }
+            i++
+        }
+        var end = minOf(i, text.length)
+        while (end > start && text[end - 1].isWhitespace()) {
+            end--
+        }
+        return end
+    }
+}
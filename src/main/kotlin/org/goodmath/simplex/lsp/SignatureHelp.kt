@@ -0,0 +1,298 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.lsp
+
+import org.eclipse.lsp4j.ParameterInformation
+import org.eclipse.lsp4j.SignatureHelp
+import org.eclipse.lsp4j.SignatureInformation
+import org.eclipse.lsp4j.jsonrpc.messages.Either
+import org.eclipse.lsp4j.jsonrpc.messages.Tuple
+import org.goodmath.simplex.ast.Model
+import org.goodmath.simplex.ast.def.Definition
+import org.goodmath.simplex.ast.def.FunctionDefinition
+import org.goodmath.simplex.ast.def.MethodDefinition
+import org.goodmath.simplex.ast.expr.MethodCallExpr
+import org.goodmath.simplex.ast.types.Type
+import org.goodmath.simplex.runtime.Env
+import org.goodmath.simplex.runtime.values.Param
+
+/**
+ * The parameter lists of something that can be called, in a form that
+ * can be shown to the user.
+ *
+ * @param name the name of the callable; for methods, this includes the target type.
+ * @param paramSets the alternative parameter lists that the callable accepts.
+ * @param returnType the result type of a call.
+ */
+data class CallSignature(val name: String, val paramSets: List<List<Param>>, val returnType: Type) {
+    fun toSignatureInformation(activeParam: Int): List<SignatureInformation> =
+        paramSets.map { params ->
+            val label = StringBuilder("$name(")
+            val paramInfos =
+                params.mapIndexed { idx, p ->
+                    if (idx > 0) {
+                        label.append(", ")
+                    }
+                    val start = label.length
+                    label.append("${p.name}: ${p.type}")
+                    ParameterInformation().apply {
+                        this.label = Either.forRight(Tuple.two(start, label.length))
+                    }
+                }
+            label.append("): $returnType")
+            SignatureInformation(label.toString()).apply {
+                parameters = paramInfos
+                activeParameter = activeParam
+            }
+        }
+
+    companion object {
+        fun of(def: FunctionDefinition): CallSignature =
+            CallSignature(
+                def.name,
+                listOf(def.params.map { Param(it.name, it.type) }),
+                def.returnType,
+            )
+
+        fun of(def: MethodDefinition): CallSignature =
+            CallSignature(
+                def.name,
+                listOf(def.params.map { Param(it.name, it.type) }),
+                def.returnType,
+            )
+    }
+}
+
+/**
+ * Looks up the signatures of functions and methods by name, both for builtins
+ * and for the definitions in a model.
+ */
+object CallSignatures {
+    /** All of the functions that a model could call with a given name. */
+    fun functions(name: String, model: Model?, libraries: Map<String, List<Definition>>,
+                  scope: String? = null): List<CallSignature> {
+        if (scope != null) {
+            return libraries[scope]
+                ?.filterIsInstance<FunctionDefinition>()
+                ?.filter { it.name == name }
+                ?.map { CallSignature.of(it) } ?: emptyList()
+        }
+        val result = ArrayList<CallSignature>()
+        model?.walk { node ->
+            if (node is FunctionDefinition && node.name == name) {
+                result.add(CallSignature.of(node))
+            }
+        }
+        // Builtins can be shadowed by definitions in the model.
+        if (result.isEmpty()) {
+            val builtins =
+                Type.valueTypes.values.toList().flatMap { it.providesFunctions } + Env.rootFunctions
+            builtins
+                .filter { it.name == name }
+                .distinctBy { it.name }
+                .forEach {
+                    result.add(CallSignature(it.name, it.signature.params, it.signature.returnType))
+                }
+        }
+        return result
+    }
+
+    /**
+     * All of the methods that a model could call with a given name. If the type of the
+     * target is known, only that type's method is returned; otherwise, the method is
+     * returned for every type that has one.
+     */
+    fun methods(name: String, targetType: Type?, model: Model?): List<CallSignature> {
+        val result = ArrayList<CallSignature>()
+        model?.walk { node ->
+            if (node is MethodDefinition &&
+                    node.methodName == name &&
+                    (targetType == null || node.targetType == targetType)) {
+                result.add(CallSignature.of(node))
+            }
+        }
+        for (vt in Type.valueTypes.values.toList()) {
+            if (targetType != null && vt.asType != targetType) {
+                continue
+            }
+            for (m in vt.providesPrimitiveMethods) {
+                if (m.name == name) {
+                    result.add(CallSignature("${m.sig.self}->${m.name}", m.sig.paramSets, m.sig.returnType))
+                }
+            }
+        }
+        return result.distinctBy { it.name }
+    }
+
+    /**
+     * A call that encloses a position in the text.
+     *
+     * @param name the name of the function or method being called.
+     * @param scope the scope of a scoped function name like `lib::f`.
+     * @param isMethod true if this is a method call like `x->m(...)`.
+     * @param parenOffset the offset of the call's opening parenthesis.
+     * @param activeParam the index of the argument containing the position.
+     */
+    data class EnclosingCall(
+        val name: String,
+        val scope: String?,
+        val isMethod: Boolean,
+        val parenOffset: Int,
+        val activeParam: Int,
+    )
+
+    private val notCallees = setOf("if", "elif", "while", "fun", "lambda", "produce", "and", "or", "not")
+
+    /**
+     * Find the innermost call whose argument list contains an offset. This works
+     * from the text alone, so that it can be used while the user is in the middle of
+     * typing a call that doesn't parse yet.
+     */
+    fun findEnclosingCall(text: String, offset: Int): EnclosingCall? {
+        // A stack of the open brackets before the offset, and the number of
+        // top-level commas seen inside each of them.
+        val opens = ArrayList<Pair<Int, Char>>()
+        val commas = ArrayList<Int>()
+        var i = 0
+        val end = minOf(offset, text.length)
+        while (i < end) {
+            val c = text[i]
+            when {
+                c == '"' -> {
+                    i++
+                    while (i < end && text[i] != '"') {
+                        if (text[i] == '\\') {
+                            i++
+                        }
+                        i++
+                    }
+                }
+                text.startsWith("//", i) -> {
+                    while (i < end && text[i] != '\n') {
+                        i++
+                    }
+                }
+                text.startsWith("/*", i) -> {
+                    val close = text.indexOf("*/", i + 2)
+                    i = if (close < 0) end else close + 1
+                }
+                c == '(' || c == '[' || c == '{' -> {
+                    opens.add(Pair(i, c))
+                    commas.add(0)
+                }
+                c == ')' || c == ']' || c == '}' -> {
+                    if (opens.isNotEmpty()) {
+                        opens.removeLast()
+                        commas.removeLast()
+                    }
+                }
+                c == ',' && commas.isNotEmpty() -> commas[commas.size - 1]++
+            }
+            i++
+        }
+        for (idx in opens.indices.reversed()) {
+            val (parenOffset, c) = opens[idx]
+            if (c != '(') {
+                continue
+            }
+            var nameEnd = parenOffset
+            while (nameEnd > 0 && text[nameEnd - 1].isWhitespace()) {
+                nameEnd--
+            }
+            var nameStart = nameEnd
+            while (nameStart > 0 && (text[nameStart - 1].isLetterOrDigit() || text[nameStart - 1] == '_')) {
+                nameStart--
+            }
+            if (nameStart == nameEnd) {
+                // A parenthesized expression, not a call.
+                continue
+            }
+            val name = text.substring(nameStart, nameEnd)
+            if (name in notCallees || name[0].isDigit()) {
+                continue
+            }
+            val before = text.substring(0, nameStart).trimEnd()
+            val lineStart = text.lastIndexOf('\n', nameStart) + 1
+            val line = text.substring(lineStart, nameStart).trimStart()
+            if (before.endsWith("fun") || line.startsWith("meth ")) {
+                // The parameter list of a definition.
+                continue
+            }
+            return if (before.endsWith("->")) {
+                EnclosingCall(name, null, true, parenOffset, commas[idx])
+            } else if (before.endsWith("::")) {
+                val scope = before.dropLast(2).takeLastWhile { it.isLetterOrDigit() || it == '_' }
+                EnclosingCall(name, scope, false, parenOffset, commas[idx])
+            } else {
+                EnclosingCall(name, null, false, parenOffset, commas[idx])
+            }
+        }
+        return null
+    }
+
+    /**
+     * Compute signature help for a position in a document.
+     *
+     * @param text the current text of the document.
+     * @param offset the offset of the cursor.
+     * @param analysis the most recent analysis of the document that produced a model.
+     *    This may be out of date, since the current text might not parse.
+     */
+    fun signatureHelp(text: String, offset: Int, analysis: DocumentAnalysis?): SignatureHelp? {
+        val call = findEnclosingCall(text, offset) ?: return null
+        val model = analysis?.model
+        val signatures =
+            if (call.isMethod) {
+                methods(call.name, targetTypeOf(call, text, analysis), model)
+            } else {
+                functions(call.name, model, analysis?.libraries ?: emptyMap(), call.scope)
+            }
+        if (signatures.isEmpty()) {
+            return null
+        }
+        val infos = signatures.flatMap { it.toSignatureInformation(call.activeParam) }
+        val paramCounts = signatures.flatMap { sig -> sig.paramSets.map { it.size } }
+        // Pick the first signature that has room for the argument being typed.
+        val active = paramCounts.indexOfFirst { it > call.activeParam }.let { if (it < 0) 0 else it }
+        return SignatureHelp(infos, active, call.activeParam)
+    }
+
+    /**
+     * Use the last analysis of the document to find the type of the target of a
+     * method call, by looking for the nearest method call expression with the same
+     * name that starts before the parenthesis. This is only trusted if the text up to
+     * the parenthesis hasn't changed since the analysis.
+     */
+    private fun targetTypeOf(call: EnclosingCall, text: String, analysis: DocumentAnalysis?): Type? {
+        val model = analysis?.model ?: return null
+        if (analysis.text.length < call.parenOffset ||
+            analysis.text.substring(0, call.parenOffset) != text.substring(0, call.parenOffset)) {
+            return null
+        }
+        var best: MethodCallExpr? = null
+        var bestOffset = -1
+        model.walk { node ->
+            if (node is MethodCallExpr && node.name == call.name && node.loc.file == analysis.filename) {
+                val start = analysis.offsetOf(node.loc)
+                if (start < call.parenOffset && start > bestOffset) {
+                    best = node
+                    bestOffset = start
+                }
+            }
+        }
+        return best?.targetType
+    }
+}
@@ -1,18 +1,57 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
 package org.goodmath.simplex.lsp
 
+import java.util.concurrent.CompletableFuture
+import org.eclipse.lsp4j.CodeAction
+import org.eclipse.lsp4j.CodeActionParams
+import org.eclipse.lsp4j.Command
 import org.eclipse.lsp4j.DidChangeTextDocumentParams
 import org.eclipse.lsp4j.DidCloseTextDocumentParams
 import org.eclipse.lsp4j.DidOpenTextDocumentParams
 import org.eclipse.lsp4j.DidSaveTextDocumentParams
+import org.eclipse.lsp4j.InlayHint
+import org.eclipse.lsp4j.InlayHintParams
+import org.eclipse.lsp4j.PublishDiagnosticsParams
+import org.eclipse.lsp4j.SignatureHelp
+import org.eclipse.lsp4j.SignatureHelpParams
 import org.eclipse.lsp4j.TextDocumentItem
+import org.eclipse.lsp4j.jsonrpc.messages.Either
+import org.eclipse.lsp4j.services.LanguageClient
 import org.eclipse.lsp4j.services.TextDocumentService
 
 class SimplexDocumentService : TextDocumentService {
     val openDocuments = HashMap<String, TextDocumentItem>()
 
+    /** The most recent analysis of each open document. */
+    val analyses = HashMap<String, DocumentAnalysis>()
+
+    /**
+     * The most recent analysis of each open document that could be parsed. While
+     * the user is typing, the document often won't parse; features like signature
+     * help fall back on this.
+     */
+    val lastParsed = HashMap<String, DocumentAnalysis>()
+
+    var client: LanguageClient? = null
+
     override fun didOpen(openParams: DidOpenTextDocumentParams) {
-        if (openParams.textDocument.languageId == "Simplex") {
+        if (openParams.textDocument.languageId.equals("Simplex", ignoreCase = true)) {
             this.openDocuments[openParams.textDocument.uri] = openParams.textDocument
+            analyze(openParams.textDocument)
         }
     }
 
@@ -20,17 +59,66 @@ class SimplexDocumentService : TextDocumentService {
         val changedFile = change.textDocument.uri
         if (openDocuments.containsKey(changedFile)) {
             val doc = openDocuments.get(changedFile)!!
-            for (ch in change.contentChanges) {}
+            // The server asks for full document sync, so the last change
+            // always contains the entire text.
+            change.contentChanges.lastOrNull()?.let { doc.text = it.text }
+            doc.version = change.textDocument.version
+            analyze(doc)
         }
     }
 
     override fun didClose(closeParams: DidCloseTextDocumentParams) {
         if (openDocuments.containsKey(closeParams.textDocument.uri)) {
             openDocuments.remove(closeParams.textDocument.uri)
+            analyses.remove(closeParams.textDocument.uri)
+            lastParsed.remove(closeParams.textDocument.uri)
+            client?.publishDiagnostics(
+                PublishDiagnosticsParams(closeParams.textDocument.uri, emptyList())
+            )
         }
     }
 
-    override fun didSave(p0: DidSaveTextDocumentParams?) {
-        TODO("Not yet implemented")
+    override fun didSave(p0: DidSaveTextDocumentParams?) {}
+
+    override fun codeAction(
+        params: CodeActionParams
+    ): CompletableFuture<List<Either<Command, CodeAction>>> {
+        val uri = params.textDocument.uri
+        val analysis = analyses[uri]
+        val actions =
+            analysis
+                ?.quickFixes
+                ?.filter { it.overlaps(params.range) }
+                ?.map { Either.forRight<Command, CodeAction>(it.toCodeAction(uri)) }
+                ?: emptyList()
+        return CompletableFuture.completedFuture(actions)
+    }
+
+    override fun signatureHelp(params: SignatureHelpParams): CompletableFuture<SignatureHelp?> {
+        val uri = params.textDocument.uri
+        // Documents are re-analyzed on every change, so the latest analysis
+        // always has the current text.
+        val analysis = analyses[uri] ?: return CompletableFuture.completedFuture(null)
+        val offset = analysis.offsetOf(params.position)
+        return CompletableFuture.completedFuture(
+            CallSignatures.signatureHelp(analysis.text, offset, lastParsed[uri])
+        )
+    }
+
+    override fun inlayHint(params: InlayHintParams): CompletableFuture<List<InlayHint>> {
+        val analysis = analyses[params.textDocument.uri]
+        val hints = analysis?.let { InlayHints.hints(it, params.range) } ?: emptyList()
+        return CompletableFuture.completedFuture(hints)
+    }
+
+    private fun analyze(doc: TextDocumentItem) {
+        val analysis = DocumentAnalysis.analyze(doc.uri, doc.text)
+        analyses[doc.uri] = analysis
+        if (analysis.model != null) {
+            lastParsed[doc.uri] = analysis
+        }
+        client?.publishDiagnostics(
+            PublishDiagnosticsParams(doc.uri, analysis.diagnostics, doc.version)
+        )
     }
 }
@@ -1,30 +1,156 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
 package org.goodmath.simplex.lsp
 
+import java.io.InputStream
+import java.io.OutputStream
+import java.net.URI
+import java.nio.file.Files
+import java.nio.file.Path
 import java.util.concurrent.CompletableFuture
+import kotlin.system.exitProcess
+import org.eclipse.lsp4j.CodeActionKind
+import org.eclipse.lsp4j.CodeActionOptions
 import org.eclipse.lsp4j.InitializeParams
 import org.eclipse.lsp4j.InitializeResult
+import org.eclipse.lsp4j.ServerCapabilities
+import org.eclipse.lsp4j.ServerInfo
+import org.eclipse.lsp4j.SignatureHelpOptions
+import org.eclipse.lsp4j.TextDocumentSyncKind
+import org.eclipse.lsp4j.jsonrpc.ResponseErrorException
+import org.eclipse.lsp4j.jsonrpc.messages.ResponseError
+import org.eclipse.lsp4j.jsonrpc.messages.ResponseErrorCode
+import org.eclipse.lsp4j.jsonrpc.services.JsonRequest
+import org.eclipse.lsp4j.launch.LSPLauncher
+import org.eclipse.lsp4j.services.LanguageClient
+import org.eclipse.lsp4j.services.LanguageClientAware
 import org.eclipse.lsp4j.services.LanguageServer
 import org.eclipse.lsp4j.services.TextDocumentService
 import org.eclipse.lsp4j.services.WorkspaceService
+import org.goodmath.simplex.runtime.RootEnv
+import org.goodmath.simplex.runtime.SimplexError
 
-class SimplexLS : LanguageServer {
-    override fun initialize(p0: InitializeParams?): CompletableFuture<InitializeResult?>? {
-        TODO("Not yet implemented")
+/** The Simplex language server. */
+class SimplexLS : LanguageServer, LanguageClientAware {
+    private val documentService = SimplexDocumentService()
+    private val workspaceService = SimplexWorkspaceService()
+    private var shutdownRequested = false
+
+    /** Loaded models, by document URI. */
+    private val sessions = HashMap<String, ModelSession>()
+
+    override fun initialize(p0: InitializeParams?): CompletableFuture<InitializeResult> {
+        val capabilities = ServerCapabilities()
+        capabilities.setTextDocumentSync(TextDocumentSyncKind.Full)
+        capabilities.setCodeActionProvider(
+            CodeActionOptions(listOf(CodeActionKind.QuickFix, CodeActionKind.RefactorRewrite))
+        )
+        capabilities.signatureHelpProvider = SignatureHelpOptions(listOf("(", ","))
+        capabilities.setInlayHintProvider(true)
+        return CompletableFuture.completedFuture(
+            InitializeResult(capabilities, ServerInfo("simplex", "0.1"))
+        )
     }
 
-    override fun shutdown(): CompletableFuture<in Any>? {
-        TODO("Not yet implemented")
+    override fun shutdown(): CompletableFuture<Any> {
+        shutdownRequested = true
+        return CompletableFuture.completedFuture(null)
     }
 
     override fun exit() {
-        TODO("Not yet implemented")
+        exitProcess(if (shutdownRequested) 0 else 1)
     }
 
-    override fun getTextDocumentService(): TextDocumentService? {
-        TODO("Not yet implemented")
+    /**
+     * Evaluate a product of a model, returning its geometry either as mesh data,
+     * or as the path of a GLB file.
+     */
+    @JsonRequest("simplex/renderProduct")
+    fun renderProduct(params: RenderProductParams): CompletableFuture<RenderProductResult> =
+        CompletableFuture.supplyAsync {
+            withSession(params.uri) { it.renderProduct(params.product, params.format) }
+        }
+
+    /**
+     * Evaluate an expression in the context of a model's top-level definitions. The
+     * expression is either given as text, or as a range of the document outside of
+     * any function or method.
+     */
+    @JsonRequest("simplex/evaluateExpression")
+    fun evaluateExpression(
+        params: EvaluateExpressionParams
+    ): CompletableFuture<EvaluateExpressionResult> =
+        CompletableFuture.supplyAsync {
+            withSession(params.uri) { session ->
+                val range = params.range
+                if (range != null) {
+                    session.evaluateRange(range)
+                } else {
+                    session.evaluateExpression(params.expression)
+                }
+            }
+        }
+
+    /**
+     * Run an operation on the loaded model for a document, loading it first if
+     * the document has changed since it was last loaded.
+     */
+    private fun <T> withSession(uri: String, op: (ModelSession) -> T): T =
+        synchronized(RootEnv) {
+            try {
+                val text = documentService.openDocuments[uri]?.text
+                    ?: Files.readString(Path.of(URI(uri)))
+                var session = sessions[uri]
+                if (session == null || session.text != text) {
+                    session = ModelSession.load(uri, text)
+                    sessions[uri] = session
+                }
+                op(session)
+            } catch (e: SimplexError) {
+                throw ResponseErrorException(
+                    ResponseError(ResponseErrorCode.RequestFailed, e.message, null)
+                )
+            } catch (e: Exception) {
+                throw ResponseErrorException(
+                    ResponseError(ResponseErrorCode.InternalError, e.toString(), null)
+                )
+            }
+        }
+
+    override fun getTextDocumentService(): TextDocumentService = documentService
+
+    override fun getWorkspaceService(): WorkspaceService = workspaceService
+
+    override fun connect(client: LanguageClient) {
+        documentService.client = client
     }
 
-    override fun getWorkspaceService(): WorkspaceService? {
-        TODO("Not yet implemented")
+    companion object {
+        /**
+         * Run a language server that communicates over a pair of streams, returning
+         * when the connection is closed.
+         */
+        fun launch(input: InputStream, output: OutputStream) {
+            // Standard output carries the protocol, so anything that the interpreter
+            // wants to say has to go somewhere else.
+            RootEnv.echo = { _, msg, _ -> System.err.println(msg) }
+            val server = SimplexLS()
+            val launcher = LSPLauncher.createServerLauncher(server, input, output)
+            server.connect(launcher.remoteProxy)
+            launcher.startListening().get()
+        }
     }
 }
@@ -1,3 +1,18 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
 package org.goodmath.simplex.lsp
 
 import org.eclipse.lsp4j.DidChangeConfigurationParams
@@ -5,11 +20,7 @@ import org.eclipse.lsp4j.DidChangeWatchedFilesParams
 import org.eclipse.lsp4j.services.WorkspaceService
 
 class SimplexWorkspaceService : WorkspaceService {
-    override fun didChangeConfiguration(p0: DidChangeConfigurationParams?) {
-        TODO("Not yet implemented")
-    }
+    override fun didChangeConfiguration(p0: DidChangeConfigurationParams?) {}
 
-    override fun didChangeWatchedFiles(p0: DidChangeWatchedFilesParams?) {
-        TODO("Not yet implemented")
-    }
+    override fun didChangeWatchedFiles(p0: DidChangeWatchedFilesParams?) {}
 }
@@ -0,0 +1,58 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.parser
+
+import org.goodmath.simplex.ast.Location
+import org.goodmath.simplex.runtime.SimplexAnalysisError
+
+/**
+ * The versions of the Simplex language that a model can ask for with a
+ * `simplex "version"` header. A model without a header is read as the
+ * current version.
+ *
+ * Models that ask for an older version are read with the syntax and names
+ * of that version, so that they keep working as the language changes:
+ * - in 0.1, parameters were written `name <Type>`, without commas between them;
+ * - in 0.1, the type of solids was called `CSG`.
+ */
+enum class LanguageVersion(val text: String) {
+    V0_1("0.1"),
+    V0_2("0.2");
+
+    /** The name that a simple type had in this version, translated to the current name. */
+    fun translateTypeName(name: String): String =
+        if (this == V0_1 && name == "CSG") {
+            "Solid"
+        } else {
+            name
+        }
+
+    override fun toString(): String = text
+
+    companion object {
+        val current = V0_2
+
+        fun of(text: String, loc: Location): LanguageVersion {
+            return entries.firstOrNull { it.text == text }
+                ?: throw SimplexAnalysisError(
+                    "Unknown Simplex version \"$text\": this is Simplex $current, " +
+                        "which can read models written for " +
+                        entries.joinToString(", ") { "\"${it.text}\"" },
+                    loc = loc,
+                )
+        }
+    }
+}
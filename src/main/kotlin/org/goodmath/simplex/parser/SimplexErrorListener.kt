@@ -20,6 +20,9 @@ import org.antlr.v4.runtime.RecognitionException
 import org.antlr.v4.runtime.Recognizer
 
 class SimplexErrorListener : BaseErrorListener() {
+    /** A syntax error, with the (1-based) line and column where the parser detected it. */
+    data class SyntaxError(val line: Int, val col: Int, val message: String)
+
     override fun syntaxError(
         recognizer: Recognizer<*, *>?,
         offendingSymbol: Any?,
@@ -30,6 +33,7 @@ class SimplexErrorListener : BaseErrorListener() {
     ) {
         val error = "Line $line, col ${charPositionInLine+1}: $msg"
         errors.add(error)
+        syntaxErrors.add(SyntaxError(line, charPositionInLine + 1, msg ?: "syntax error"))
     }
 
     val errorCount: Int
@@ -38,4 +42,6 @@ class SimplexErrorListener : BaseErrorListener() {
     fun getLoggedErrors(): List<String> = errors
 
     private val errors = ArrayList<String>()
+
+    val syntaxErrors = ArrayList<SyntaxError>()
 }
@@ -24,14 +24,19 @@ import org.antlr.v4.runtime.tree.ParseTree
 import org.antlr.v4.runtime.tree.ParseTreeProperty
 import org.antlr.v4.runtime.tree.ParseTreeWalker
 import org.antlr.v4.runtime.tree.TerminalNode
+import org.goodmath.simplex.ast.AstNode
+import org.goodmath.simplex.ast.Lint
 import org.goodmath.simplex.ast.Location
 import org.goodmath.simplex.ast.Model
 import org.goodmath.simplex.ast.Product
+import org.goodmath.simplex.ast.def.Annotation
 import org.goodmath.simplex.ast.def.Definition
 import org.goodmath.simplex.ast.def.FunctionDefinition
 import org.goodmath.simplex.ast.def.MethodDefinition
+import org.goodmath.simplex.ast.def.NamespaceDefinition
 import org.goodmath.simplex.ast.def.DataDefinition
 import org.goodmath.simplex.ast.def.VariableDefinition
+import org.goodmath.simplex.ast.expr.SetExpr
 import org.goodmath.simplex.ast.expr.VectorExpr
 import org.goodmath.simplex.ast.expr.AssignmentExpr
 import org.goodmath.simplex.ast.expr.BlockExpr
@@ -55,9 +60,15 @@ import org.goodmath.simplex.ast.expr.WhileExpr
 import org.goodmath.simplex.ast.types.Type
 import org.goodmath.simplex.ast.types.TypedName
 import org.goodmath.simplex.runtime.RootEnv
+import org.goodmath.simplex.runtime.SimplexAnalysisError
 import org.goodmath.simplex.runtime.SimplexError
+import org.goodmath.simplex.runtime.values.manifold.OpenScad
+import org.goodmath.simplex.runtime.values.primitives.PrimitiveFunctionValue
 import java.io.FileReader
+import java.io.IOException
+import java.nio.file.NoSuchFileException
 import java.nio.file.Path
+import kotlin.io.path.exists
 
 @Suppress("UNCHECKED_CAST")
 class SimplexParseListener : SimplexListener {
@@ -65,6 +76,7 @@ class SimplexParseListener : SimplexListener {
 
     fun parse(filename: String, input: CharStream, echo: (Int, Any?, Boolean) -> Unit): Model {
         this.filename = filename
+        RootEnv.modelDir = importRoot
         val lexer = SimplexLexer(input)
         val tokenStream = CommonTokenStream(lexer)
         val walker = ParseTreeWalker()
@@ -75,35 +87,136 @@ class SimplexParseListener : SimplexListener {
         val tree = parser.model()
         val t = Type
         if (errorListener.errorCount > 0) {
+            syntaxErrors.addAll(errorListener.syntaxErrors)
             for (e in errorListener.getLoggedErrors()) {
                 echo(0, e, true)
             }
             throw SimplexError(SimplexError.Kind.Parser, "See error log above for details")
         }
         walker.walk(this, tree)
+        loadImports(echo)
+        return getValueFor(tree) as Model
+
+    }
+
+    private fun loadImports(echo: (Int, Any?, Boolean) -> Unit) {
         while (importSet.isNotEmpty()) {
             val lib = importSet.removeFirst()
             if (!RootEnv.importedScopes.containsKey(lib.name)) {
-                parseLibraryFile(lib.name, lib.path,
-                    echo)
+                try {
+                    parseLibraryFile(lib.name, lib.path,
+                        echo)
+                } catch (e: IOException) {
+                    throw SimplexAnalysisError("Could not read library '${lib.path}'",
+                        cause = e, loc = lib.loc)
+                }
             }
         }
-        return getValueFor(tree) as Model
+    }
 
+    /**
+     * Parse a single expression. This is used by tools that evaluate expressions in
+     * the context of a model that's already been loaded.
+     */
+    fun parseExpression(filename: String, input: CharStream): Expr {
+        this.filename = filename
+        val lexer = SimplexLexer(input)
+        val tokenStream = CommonTokenStream(lexer)
+        val walker = ParseTreeWalker()
+        val parser = SimplexParser(tokenStream)
+        parser.removeErrorListeners()
+        val errorListener = SimplexErrorListener()
+        parser.addErrorListener(errorListener)
+        val tree = parser.standaloneExpr()
+        if (errorListener.errorCount > 0) {
+            syntaxErrors.addAll(errorListener.syntaxErrors)
+            throw SimplexError(SimplexError.Kind.Parser,
+                errorListener.getLoggedErrors().joinToString("; "))
+        }
+        walker.walk(this, tree)
+        return getValueFor(tree) as Expr
+    }
+
+    /**
+     * Parse a notebook cell, returning its definitions and expressions in the order
+     * that they appear. Any libraries that the cell imports are loaded into the root
+     * environment.
+     */
+    fun parseCell(filename: String, input: CharStream, echo: (Int, Any?, Boolean) -> Unit): List<AstNode> {
+        this.filename = filename
+        val lexer = SimplexLexer(input)
+        val tokenStream = CommonTokenStream(lexer)
+        val walker = ParseTreeWalker()
+        val parser = SimplexParser(tokenStream)
+        parser.removeErrorListeners()
+        val errorListener = SimplexErrorListener()
+        parser.addErrorListener(errorListener)
+        val tree = parser.cell()
+        if (errorListener.errorCount > 0) {
+            syntaxErrors.addAll(errorListener.syntaxErrors)
+            throw SimplexError(SimplexError.Kind.Parser,
+                errorListener.getLoggedErrors().joinToString("; "))
+        }
+        walker.walk(this, tree)
+        loadImports(echo)
+        return getValueFor(tree) as List<AstNode>
     }
 
     data class LibraryImport(
         val name: String,
-        val path: Path
+        val path: Path,
+        val loc: Location
     )
 
     val importSet = ArrayList<LibraryImport>()
 
+    /**
+     * The syntax errors reported by the parser in the last call to [parse], for tools
+     * that want to report them individually rather than through the echo log.
+     */
+    val syntaxErrors = ArrayList<SimplexErrorListener.SyntaxError>()
+
+    /**
+     * If set, relative library paths in import statements, and the paths of files that
+     * the model reads, are resolved against this directory instead of the current
+     * working directory. It's normally the directory that contains the model.
+     */
+    var importRoot: Path? = null
+
+    /**
+     * The libraries that ship with Simplex, by file name, with the builtin functions
+     * that only they can call.
+     */
+    private val libraryBuiltins: Map<String, List<PrimitiveFunctionValue>> by lazy {
+        mapOf("openscad.s3d" to OpenScad.builtins)
+    }
+
+    /**
+     * The version of the language that the file being parsed was written for, as
+     * selected by its `simplex` header.
+     */
+    var languageVersion: LanguageVersion = LanguageVersion.current
+        private set
+
     fun parseLibraryFile(moduleName: String,
                          path: Path,
                          echo: (Int, Any?, Boolean) -> Unit) {
         System.err.println("Reading library '$path'")
-        val input = CharStreams.fromPath(path)
+        filename = path.toString()
+        var builtins = emptyList<PrimitiveFunctionValue>()
+        val input =
+            if (path.exists()) {
+                CharStreams.fromPath(path)
+            } else if (isBundledLibrary(path)) {
+                // Libraries that ship with Simplex, like openscad.s3d, are found on the classpath.
+                val resource =
+                    javaClass.getResourceAsStream("/lib/${path.fileName}")
+                        ?: throw NoSuchFileException(path.toString())
+                builtins = libraryBuiltins[path.fileName.toString()] ?: emptyList()
+                resource.use { CharStreams.fromStream(it) }
+            } else {
+                throw NoSuchFileException(path.toString())
+            }
         val libLexer = SimplexLexer(input)
         val tokenStream = CommonTokenStream(libLexer)
         val walker = ParseTreeWalker()
@@ -121,7 +234,18 @@ class SimplexParseListener : SimplexListener {
         }
         walker.walk(this, tree)
         val defs = getValueFor(tree) as List<Definition>
-        RootEnv.addImportedLibrary(moduleName, defs)
+        RootEnv.addImportedLibrary(moduleName, defs, builtins)
+    }
+
+    /**
+     * Does a library path import one of the libraries that ship with Simplex? Only an
+     * import that names a bundled library's file alone, like `import "openscad.s3d"`,
+     * does; a path to a missing file in some directory is reported as missing, even
+     * if its file name matches.
+     */
+    private fun isBundledLibrary(path: Path): Boolean {
+        val name = path.fileName?.toString() ?: return false
+        return name in libraryBuiltins && path == (importRoot?.resolve(name) ?: Path.of(name))
     }
 
     private var values: ParseTreeProperty<Any> = ParseTreeProperty()
@@ -138,15 +262,18 @@ class SimplexParseListener : SimplexListener {
         return Location(filename, ctx.start.line, ctx.start.charPositionInLine + 1)
     }
 
-    override fun enterModel(ctx: SimplexParser.ModelContext) {}
+    override fun enterModel(ctx: SimplexParser.ModelContext) {
+        languageVersion = LanguageVersion.current
+    }
 
     override fun exitModel(ctx: SimplexParser.ModelContext) {
         val defs = ctx.def().map { getValueFor(it) as Definition }
         val products = ctx.product().map { getValueFor(it) as Product }
-        setValueFor(ctx, Model(defs, products, loc(ctx)))
+        setValueFor(ctx, Model(defs, products, loc(ctx), languageVersion))
     }
 
     override fun enterLibraryModule(ctx: SimplexParser.LibraryModuleContext) {
+        languageVersion = LanguageVersion.current
     }
 
     override fun exitLibraryModule(ctx: SimplexParser.LibraryModuleContext) {
@@ -154,14 +281,53 @@ class SimplexParseListener : SimplexListener {
         setValueFor(ctx, defs)
     }
 
+    override fun enterVersionHeader(ctx: SimplexParser.VersionHeaderContext) {}
+
+    override fun exitVersionHeader(ctx: SimplexParser.VersionHeaderContext) {
+        if (ctx.name.text != "simplex") {
+            throw SimplexAnalysisError(
+                "A file can only start with a version header, like simplex \"${LanguageVersion.current}\"",
+                loc = loc(ctx),
+            )
+        }
+        val version = ctx.LIT_STRING().text.drop(1).dropLast(1)
+        languageVersion = LanguageVersion.of(version, loc(ctx))
+        setValueFor(ctx, languageVersion)
+    }
+
+    override fun enterStandaloneExpr(ctx: SimplexParser.StandaloneExprContext) {}
+
+    override fun exitStandaloneExpr(ctx: SimplexParser.StandaloneExprContext) {
+        setValueFor(ctx, getValueFor(ctx.expr()))
+    }
+
+    override fun enterCell(ctx: SimplexParser.CellContext) {}
+
+    override fun exitCell(ctx: SimplexParser.CellContext) {
+        setValueFor(ctx, ctx.cellItem().map { getValueFor(it) as AstNode })
+    }
+
+    override fun enterCellDef(ctx: SimplexParser.CellDefContext) {}
+
+    override fun exitCellDef(ctx: SimplexParser.CellDefContext) {
+        setValueFor(ctx, getValueFor(ctx.def()))
+    }
+
+    override fun enterCellExpr(ctx: SimplexParser.CellExprContext) {}
+
+    override fun exitCellExpr(ctx: SimplexParser.CellExprContext) {
+        setValueFor(ctx, getValueFor(ctx.expr()))
+    }
+
     override fun enterImportLibrary(ctx: SimplexParser.ImportLibraryContext) {
     }
 
     override fun exitImportLibrary(ctx: SimplexParser.ImportLibraryContext) {
         val libPathStr = ctx.path.text
-        val path = Path.of(libPathStr.substring(1, libPathStr.length - 1))
+        val libPath = Path.of(libPathStr.substring(1, libPathStr.length - 1))
+        val path = importRoot?.resolve(libPath) ?: libPath
         val id = ctx.id.text
-        importSet.add(LibraryImport(id, path))
+        importSet.add(LibraryImport(id, path, loc(ctx)))
     }
 
     override fun enterProduct(ctx: SimplexParser.ProductContext) {}
@@ -169,7 +335,9 @@ class SimplexParseListener : SimplexListener {
     override fun exitProduct(ctx: SimplexParser.ProductContext) {
         val name = ctx.LIT_STRING().text.drop(1).dropLast(1)
         val exprs = ctx.expr().map { getValueFor(it) as Expr }
-        setValueFor(ctx, Product(name, exprs, loc(ctx)))
+        val product = Product(name, exprs, loc(ctx))
+        product.annotations = annotations(ctx.annotation(), onProduct = true)
+        setValueFor(ctx, product)
     }
 
     override fun enterOptVarDef(ctx: SimplexParser.OptVarDefContext) {}
@@ -197,28 +365,117 @@ class SimplexParseListener : SimplexListener {
         setValueFor(ctx, getValueFor(ctx.methDef()))
     }
 
+    override fun enterOptNamespaceDef(ctx: SimplexParser.OptNamespaceDefContext) {}
+
+    override fun exitOptNamespaceDef(ctx: SimplexParser.OptNamespaceDefContext) {
+        setValueFor(ctx, getValueFor(ctx.namespaceDef()))
+    }
+
+    override fun enterNamespaceDef(ctx: SimplexParser.NamespaceDefContext) {}
+
+    override fun exitNamespaceDef(ctx: SimplexParser.NamespaceDefContext) {
+        val name = ctx.ID().text
+        val defs = ctx.def().map { getValueFor(it) as Definition }
+        setValueFor(ctx, NamespaceDefinition(name, defs, loc(ctx)))
+    }
+
+    override fun enterAnnotation(ctx: SimplexParser.AnnotationContext) {}
+
+    override fun exitAnnotation(ctx: SimplexParser.AnnotationContext) {
+        val name = ctx.ID().text
+        if (name !in Annotation.known) {
+            throw SimplexAnalysisError("Unknown annotation @$name", loc = loc(ctx))
+        }
+        val args = ctx.annotationArg().map { getValueFor(it) as String }
+        if (name == "allow") {
+            val unknown = args.filter { it !in Lint.categories }
+            if (args.isEmpty() || unknown.isNotEmpty()) {
+                throw SimplexAnalysisError(
+                    "@allow needs warning kinds from " + Lint.categories.joinToString(", ") +
+                        if (unknown.isEmpty()) "" else ", not " + unknown.joinToString(", "),
+                    loc = loc(ctx),
+                )
+            }
+        }
+        if (name == "tolerance" && (args.size != 1 || (args[0].toDoubleOrNull() ?: 0.0) <= 0.0)) {
+            throw SimplexAnalysisError("@tolerance needs one positive number", loc = loc(ctx))
+        }
+        setValueFor(ctx, Annotation(name, args, loc(ctx)))
+    }
+
+    override fun enterAnnotationStr(ctx: SimplexParser.AnnotationStrContext) {}
+
+    override fun exitAnnotationStr(ctx: SimplexParser.AnnotationStrContext) {
+        setValueFor(ctx, ctx.LIT_STRING().text.drop(1).dropLast(1))
+    }
+
+    override fun enterAnnotationId(ctx: SimplexParser.AnnotationIdContext) {}
+
+    override fun exitAnnotationId(ctx: SimplexParser.AnnotationIdContext) {
+        setValueFor(ctx, ctx.ID().text)
+    }
+
+    override fun enterAnnotationNum(ctx: SimplexParser.AnnotationNumContext) {}
+
+    override fun exitAnnotationNum(ctx: SimplexParser.AnnotationNumContext) {
+        setValueFor(ctx, ctx.text)
+    }
+
+    private fun annotations(
+        ctxs: List<SimplexParser.AnnotationContext>,
+        onProduct: Boolean = false,
+    ): List<Annotation> {
+        val result = ctxs.map { getValueFor(it) as Annotation }
+        if (!onProduct) {
+            result.firstOrNull { it.name in Annotation.productOnly }?.let {
+                throw SimplexAnalysisError("@${it.name} can only be used on products", loc = it.loc)
+            }
+        }
+        return result
+    }
+
     override fun enterDataDef(ctx: SimplexParser.DataDefContext) {}
 
     override fun exitDataDef(ctx: SimplexParser.DataDefContext) {
         val name = ctx.ID().text
         val fields = getValueFor(ctx.params()) as List<TypedName>
-        setValueFor(ctx, DataDefinition(name, fields, loc(ctx)))
+        val def = DataDefinition(name, fields, loc(ctx))
+        def.annotations = annotations(ctx.annotation())
+        setValueFor(ctx, def)
     }
 
     override fun enterParams(ctx: SimplexParser.ParamsContext) {}
 
     override fun exitParams(ctx: SimplexParser.ParamsContext) {
-        val params = ctx.param().map { getValueFor(it) as TypedName }
+        val params = ctx.param().map { getValueFor(it) as TypedName } +
+            ctx.legacyParam().map { getValueFor(it) as TypedName }
         setValueFor(ctx, params)
     }
 
+    override fun enterLegacyParam(ctx: SimplexParser.LegacyParamContext) {}
+
+    override fun exitLegacyParam(ctx: SimplexParser.LegacyParamContext) {
+        val name = ctx.ID().text
+        if (languageVersion != LanguageVersion.V0_1) {
+            throw SimplexAnalysisError(
+                "Parameter '${ctx.text}' is written in the syntax of Simplex 0.1. Write it as " +
+                    "'$name: ${ctx.type().text}', or start the file with 'simplex \"0.1\"'",
+                loc = loc(ctx),
+            )
+        }
+        val type = getValueFor(ctx.type()) as Type
+        setValueFor(ctx, TypedName(name, type, loc(ctx)))
+    }
+
     override fun enterVarDef(ctx: SimplexParser.VarDefContext) {}
 
     override fun exitVarDef(ctx: SimplexParser.VarDefContext) {
         val name = ctx.ID().text
         val type = ctx.type()?.let { getValueFor(it) as Type }
         val initValue = getValueFor(ctx.expr()) as Expr
-        setValueFor(ctx, VariableDefinition(name, type, initValue, loc(ctx)))
+        val def = VariableDefinition(name, type, initValue, loc(ctx))
+        def.annotations = annotations(ctx.annotation())
+        setValueFor(ctx, def)
     }
 
     override fun enterFunDef(ctx: SimplexParser.FunDefContext) {}
@@ -226,13 +483,30 @@ class SimplexParseListener : SimplexListener {
     override fun exitFunDef(ctx: SimplexParser.FunDefContext) {
         val name = ctx.ID().text
         val type = getValueFor(ctx.type()) as Type
-        val localDefs = ctx.funDef().map { getValueFor(it) as FunctionDefinition }
+        val localDefs = ctx.localDef().map { getValueFor(it) as Definition }
         val params = ctx.params()?.let { getValueFor(it) as List<TypedName> }
         val body = ctx.expr().map { getValueFor(it) as Expr }
-        setValueFor(
-            ctx,
-            FunctionDefinition(name, type, params ?: emptyList(), localDefs, body, loc(ctx)),
-        )
+        val def = FunctionDefinition(name, type, params ?: emptyList(), localDefs, body, loc(ctx))
+        def.annotations = annotations(ctx.annotation())
+        setValueFor(ctx, def)
+    }
+
+    override fun enterLocalFunDef(ctx: SimplexParser.LocalFunDefContext) {}
+
+    override fun exitLocalFunDef(ctx: SimplexParser.LocalFunDefContext) {
+        setValueFor(ctx, getValueFor(ctx.funDef()))
+    }
+
+    override fun enterLocalDataDef(ctx: SimplexParser.LocalDataDefContext) {}
+
+    override fun exitLocalDataDef(ctx: SimplexParser.LocalDataDefContext) {
+        setValueFor(ctx, getValueFor(ctx.dataDef()))
+    }
+
+    override fun enterLocalMethDef(ctx: SimplexParser.LocalMethDefContext) {}
+
+    override fun exitLocalMethDef(ctx: SimplexParser.LocalMethDefContext) {
+        setValueFor(ctx, getValueFor(ctx.methDef()))
     }
 
     override fun enterMethDef(ctx: SimplexParser.MethDefContext) {}
@@ -243,7 +517,9 @@ class SimplexParseListener : SimplexListener {
         val name = ctx.ID().text
         val params = ctx.params()?.let { getValueFor(it) as List<TypedName> } ?: emptyList()
         val body = ctx.expr().map { getValueFor(it) as Expr }
-        setValueFor(ctx, MethodDefinition(type, name, params, result, body, loc(ctx)))
+        val def = MethodDefinition(type, name, params, result, body, loc(ctx))
+        def.annotations = annotations(ctx.annotation())
+        setValueFor(ctx, def)
     }
 
     override fun enterParam(ctx: SimplexParser.ParamContext) {}
@@ -264,7 +540,7 @@ class SimplexParseListener : SimplexListener {
     override fun enterOptSimpleType(ctx: SimplexParser.OptSimpleTypeContext) {}
 
     override fun exitOptSimpleType(ctx: SimplexParser.OptSimpleTypeContext) {
-        val name = ctx.ID().text
+        val name = languageVersion.translateTypeName(ctx.ID().text)
         setValueFor(ctx, Type.simple(name))
     }
 
@@ -284,6 +560,13 @@ class SimplexParseListener : SimplexListener {
         setValueFor(ctx, Type.vector(elementType))
     }
 
+    override fun enterOptSetType(ctx: SimplexParser.OptSetTypeContext) {}
+
+    override fun exitOptSetType(ctx: SimplexParser.OptSetTypeContext) {
+        val elementType = getValueFor(ctx.type()) as Type
+        setValueFor(ctx, Type.set(elementType))
+    }
+
     override fun enterOptFunType(ctx: SimplexParser.OptFunTypeContext) {}
 
     override fun exitOptFunType(ctx: SimplexParser.OptFunTypeContext) {
@@ -374,6 +657,18 @@ class SimplexParseListener : SimplexListener {
         setValueFor(ctx, OperatorExpr(op, listOf(target), loc(ctx)))
     }
 
+    override fun enterExprAnnotated(ctx: SimplexParser.ExprAnnotatedContext) {}
+
+    override fun exitExprAnnotated(ctx: SimplexParser.ExprAnnotatedContext) {
+        val expr = getValueFor(ctx.expr()) as Expr
+        val annotations = annotations(ctx.annotation())
+        annotations.firstOrNull { it.name != "allow" }?.let {
+            throw SimplexAnalysisError("@${it.name} can't be used on an expression", loc = it.loc)
+        }
+        expr.annotations = annotations + expr.annotations
+        setValueFor(ctx, expr)
+    }
+
     override fun enterExprLogic(ctx: SimplexParser.ExprLogicContext) {}
 
     override fun exitExprLogic(ctx: SimplexParser.ExprLogicContext) {
@@ -494,6 +789,13 @@ class SimplexParseListener : SimplexListener {
         setValueFor(ctx, VectorExpr(es, loc(ctx)))
     }
 
+    override fun enterOptSetExpr(ctx: SimplexParser.OptSetExprContext) {}
+
+    override fun exitOptSetExpr(ctx: SimplexParser.OptSetExprContext) {
+        val es = getValueFor(ctx.exprs()) as List<Expr>
+        setValueFor(ctx, SetExpr(es, loc(ctx)))
+    }
+
     override fun enterOptDataExpr(ctx: SimplexParser.OptDataExprContext) {}
 
     override fun exitOptDataExpr(ctx: SimplexParser.OptDataExprContext) {
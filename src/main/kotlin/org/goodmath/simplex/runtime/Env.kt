@@ -17,7 +17,10 @@ package org.goodmath.simplex.runtime
 
 import com.github.ajalt.mordant.rendering.TextColors.*
 import java.util.UUID
+import org.goodmath.simplex.ast.Location
+import org.goodmath.simplex.ast.def.DataDefinition
 import org.goodmath.simplex.ast.def.Definition
+import org.goodmath.simplex.ast.types.MethodType
 import org.goodmath.simplex.ast.types.VectorType
 import org.goodmath.simplex.ast.types.Type
 import org.goodmath.simplex.parser.SimplexParseListener
@@ -25,6 +28,10 @@ import org.goodmath.simplex.runtime.values.AnyValueType
 import org.goodmath.simplex.runtime.values.FunctionSignature
 import org.goodmath.simplex.runtime.values.Param
 import org.goodmath.simplex.runtime.values.Value
+import org.goodmath.simplex.runtime.values.manifold.Provenance
+import org.goodmath.simplex.runtime.values.primitives.AbstractMethod
+import org.goodmath.simplex.runtime.values.primitives.FloatValue
+import org.goodmath.simplex.runtime.values.primitives.FloatValueType
 import org.goodmath.simplex.runtime.values.primitives.VectorValueType
 import org.goodmath.simplex.runtime.values.primitives.PrimitiveFunctionValue
 import org.goodmath.simplex.runtime.values.primitives.StringValue
@@ -74,6 +81,40 @@ open class Env(defList: List<Definition>, val parentEnv: Env?) : Twistable {
         } else parentEnv?.getValue(name) ?: throw SimplexUndefinedVariableError(name)
     }
 
+    /**
+     * The static types and the values of methods defined by local `meth` definitions in
+     * a function, which are only visible inside of the function. Methods defined anywhere
+     * else are registered with their target types.
+     */
+    private val localMethodTypes = HashMap<Pair<Type, String>, MethodType>()
+    private val localMethods = HashMap<Pair<Type, String>, AbstractMethod>()
+
+    fun declareLocalMethod(target: Type, name: String, type: MethodType) {
+        localMethodTypes[Pair(target, name)] = type
+    }
+
+    fun addLocalMethod(target: Type, method: AbstractMethod) {
+        localMethods[Pair(target, method.name)] = method
+    }
+
+    /**
+     * Get the static type of a method of a type, looking for local methods in the scope
+     * and its parents before the methods registered with the type.
+     */
+    fun getMethodType(target: Type, name: String): MethodType? =
+        localMethodTypes[Pair(target, name)] ?: parentEnv?.getMethodType(target, name) ?: target.getMethod(name)
+
+    private fun findLocalMethod(target: Type, name: String): AbstractMethod? =
+        localMethods[Pair(target, name)] ?: parentEnv?.findLocalMethod(target, name)
+
+    /** Get the method to call on a value, throwing an exception if there isn't one. */
+    fun getMethod(target: Value, name: String): AbstractMethod =
+        findLocalMethod(target.valueType.asType, name) ?: target.valueType.getMethod(name)
+
+    /** Call a method on a value, using the methods that are visible in the scope. */
+    fun applyMethod(target: Value, name: String, args: List<Value>): Value =
+        getMethod(target, name).applyTo(target, args, this)
+
     /** Get a definition declared within the scope. */
     fun getDef(name: String): Definition {
         return if (defs.containsKey(name)) {
@@ -169,6 +210,7 @@ open class Env(defList: List<Definition>, val parentEnv: Env?) : Twistable {
             RootEnv.installStaticDefinitions()
             RootEnv.installDefinitionValues()
             for (f in rootFunctions) {
+                RootEnv.declareTypeOf(f.name, f.signature.toStaticType())
                 RootEnv.addVariable(f.name, f)
             }
             for (e in RootEnv.importedScopes.values) {
@@ -185,14 +227,33 @@ object RootEnv : Env(emptyList(), null) {
 
     val importedScopes = HashMap<String, Env>()
 
+    /**
+     * Add the scope of an imported library.
+     *
+     * @param name the name that the library is imported as.
+     * @param defs the definitions in the library.
+     * @param builtins builtin functions that only the library can call, for the
+     *    libraries that ship with Simplex.
+     */
     fun addImportedLibrary(name: String,
-                           defs: List<Definition>) {
+                           defs: List<Definition>,
+                           builtins: List<PrimitiveFunctionValue> = emptyList()) {
         val env = Env(defs, this)
+        for (f in builtins) {
+            env.functions[f.name] = f
+        }
         importedScopes[name] = env
     }
 
+    /** The scopes of the namespaces declared in the model, which are used like imported scopes. */
+    val namespaces = HashMap<String, Env>()
+
+    fun addNamespace(name: String, env: Env) {
+        namespaces[name] = env
+    }
+
     fun getScope(name: String): Env {
-        return importedScopes[name] ?: throw SimplexAnalysisError("Accessed unknown scope $name")
+        return namespaces[name] ?: importedScopes[name] ?: throw SimplexUndefinedScopeError(name)
     }
 
     fun getDefOfScopedName(scope: String, name: String): Definition {
@@ -211,8 +272,99 @@ object RootEnv : Env(emptyList(), null) {
         defs[def.name] = def
     }
 
+    /**
+     * The data types defined by the model and its libraries, by name. The names of data
+     * types are global, even for types defined in namespaces and functions, so each name
+     * can only be defined once.
+     */
+    val dataTypes = HashMap<String, DataDefinition>()
+
+    /** The methods that the model has added to types, by target type and name. */
+    val userMethods = LinkedHashSet<Pair<Type, String>>()
+
+    fun recordUserMethod(target: Type, name: String) {
+        userMethods.add(Pair(target, name))
+    }
+
+    /**
+     * Remove the methods that the model added to types, restoring any builtin methods
+     * that they replaced.
+     */
+    private fun removeUserMethods() {
+        for ((target, name) in userMethods) {
+            val valueType = Type.valueTypes[target]
+            val builtin = valueType?.providesPrimitiveMethods?.firstOrNull { it.name == name }
+            if (builtin != null) {
+                target.registerMethod(name, builtin.sig.toStaticType())
+                valueType.addMethod(builtin)
+            } else {
+                target.methods.remove(name)
+                valueType?.methods?.remove(name)
+            }
+        }
+        userMethods.clear()
+    }
+
+    /** The warnings found while analyzing the model, in the order that they were found. */
+    val warnings = LinkedHashSet<SimplexWarning>()
+
+    /** Record a warning. A warning that's found more than once is only recorded once. */
+    fun warn(category: String, detail: String, loc: Location?) {
+        warnings.add(SimplexWarning(category, detail, loc))
+    }
+
+    /**
+     * The directory that contains the model's file. Relative paths of files that the
+     * model reads, like the images of `trace_image`, are resolved against it, or against
+     * the current directory if it's null.
+     */
+    var modelDir: Path? = null
+
+    /** The path of a file that the model reads, resolved against [modelDir]. */
+    fun resolvePath(path: String): Path = modelDir?.resolve(path) ?: Path.of(path)
+
+    /**
+     * Discard everything that was installed by a previously loaded model - its definitions,
+     * data types, methods, variables, namespaces, warnings and imported libraries - so that a new model can be
+     * analyzed in the same process. This is needed by long-running tools like the language
+     * server; after a reset, the root environment should be re-initialized with
+     * [Env.createRootEnv].
+     */
+    fun reset() {
+        defs.clear()
+        time = 0.0
+        vars.clear()
+        declaredTypes.clear()
+        functions.clear()
+        importedScopes.clear()
+        namespaces.clear()
+        warnings.clear()
+        modelDir = null
+        removeUserMethods()
+        for (name in dataTypes.keys) {
+            Type.valueTypes.remove(Type.simple(name))
+        }
+        dataTypes.clear()
+        Provenance.reset()
+    }
+
     override val id: String = "Root"
 
+    /**
+     * The value of the root variable `time`, which animated models use to compute their
+     * state. When a model is animated, it goes from 0.0 at the first frame to 1.0 at the
+     * last; otherwise, it's always 0.0.
+     *
+     * `time` isn't reserved: a model that defines its own top-level `time` replaces it.
+     */
+    var time: Double = 0.0
+        set(value) {
+            field = value
+            if (!defs.containsKey("time")) {
+                addVariable("time", FloatValue(value))
+            }
+        }
+
     var echo: (level: Int, output: Any?, err: Boolean) -> Unit = { l, o, e ->
         if (e) {
             System.err.println(o)
@@ -221,6 +373,21 @@ object RootEnv : Env(emptyList(), null) {
         }
     }
 
+    override fun installStaticDefinitions() {
+        for (t in Type.valueTypes.values.toList()) {
+            for ((name, v) in t.providesVariables) {
+                declareTypeOf(name, v.valueType.asType)
+            }
+        }
+        if (defs.containsKey("time")) {
+            // The model's own definition of time replaces the root variable.
+            declaredTypes.remove("time")
+        } else {
+            declareTypeOf("time", FloatValueType.asType)
+        }
+        super.installStaticDefinitions()
+    }
+
     override fun installDefinitionValues() {
         for (t in Type.valueTypes.values) {
             for (f in t.providesFunctions) {
@@ -230,6 +397,9 @@ object RootEnv : Env(emptyList(), null) {
                 this.addVariable(v.key, v.value)
             }
         }
+        if (!defs.containsKey("time")) {
+            addVariable("time", FloatValue(time))
+        }
         super.installDefinitionValues()
     }
 }
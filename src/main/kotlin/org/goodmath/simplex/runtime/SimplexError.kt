@@ -38,7 +38,8 @@ open class SimplexError(
         Evaluation,
         Internal,
         Parser,
-        Analysis;
+        Analysis,
+        Configuration;
 
         override fun toString(): String {
             return when (this) {
@@ -56,6 +57,7 @@ open class SimplexError(
                 Evaluation -> "Evaluation error"
                 Parser -> "Parsing errors"
                 Analysis -> "Analysis error"
+                Configuration -> "Build configuration error"
             }
         }
     }
@@ -118,12 +120,15 @@ class SimplexInvalidParameterError(
 open class SimplexUndefinedError(val name: String, val symbolKind: String, loc: Location? = null) :
     SimplexError(Kind.UndefinedSymbol, "symbol '$name' of kind $symbolKind", loc)
 
-class SimplexUndefinedMethodError(name: String, ofType: String, loc: Location?):
-        SimplexError(Kind.UndefinedMethod, "'$name' of type '$ofType'")
+class SimplexUndefinedMethodError(val name: String, val ofType: String, loc: Location?):
+        SimplexError(Kind.UndefinedMethod, "'$name' of type '$ofType'", loc)
 
-class SimplexUndefinedVariableError(name: String, loc: Location? = null):
+class SimplexUndefinedVariableError(val name: String, loc: Location? = null):
         SimplexError(Kind.UndefinedVariable, name, loc)
 
+class SimplexUndefinedScopeError(val scope: String, loc: Location? = null):
+        SimplexError(Kind.Analysis, "Accessed unknown scope $scope", loc)
+
 class SimplexUnsupportedOperation(val type: String, val op: String, loc: Location? = null) :
     SimplexError(Kind.UnsupportedOperation, "$op in type $type", location = loc)
 
@@ -143,3 +148,28 @@ class SimplexTypeError(value: String, expected: String, actual: String, location
 
 class SimplexAnalysisError(msg: String, cause: Throwable? = null, loc: Location? = null) :
     SimplexError(Kind.Analysis, msg, cause = cause, location = loc)
+
+/** An error in a project's `simplex.toml` build configuration. */
+class SimplexConfigError(msg: String, loc: Location? = null) :
+    SimplexError(Kind.Configuration, msg, location = loc)
+
+/**
+ * A problem found during analysis that doesn't stop the model from running, like the
+ * use of a deprecated function. Warnings are collected in [RootEnv.warnings].
+ *
+ * @param category the kind of warning, which is the name used to suppress it with
+ *    `@allow`; see [org.goodmath.simplex.ast.Lint.categories].
+ * @param detail a description of the problem.
+ * @param location where the problem was found.
+ */
+data class SimplexWarning(val category: String, val detail: String, val location: Location?) {
+    override fun toString(): String {
+        val prefix =
+            if (location != null) {
+                "At ${location.file}(${location.line}, ${location.col - 1}): "
+            } else {
+                ""
+            }
+        return "${prefix}Warning: $detail"
+    }
+}
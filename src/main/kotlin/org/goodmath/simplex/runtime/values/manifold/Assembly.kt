@@ -0,0 +1,387 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import org.goodmath.simplex.ast.types.Type
+import org.goodmath.simplex.runtime.Env
+import org.goodmath.simplex.runtime.SimplexEvaluationError
+import org.goodmath.simplex.runtime.values.FunctionSignature
+import org.goodmath.simplex.runtime.values.MethodSignature
+import org.goodmath.simplex.runtime.values.Param
+import org.goodmath.simplex.runtime.values.Value
+import org.goodmath.simplex.runtime.values.ValueType
+import org.goodmath.simplex.runtime.values.primitives.FloatValue
+import org.goodmath.simplex.runtime.values.primitives.FloatValueType
+import org.goodmath.simplex.runtime.values.primitives.IntegerValueType
+import org.goodmath.simplex.runtime.values.primitives.PrimitiveFunctionValue
+import org.goodmath.simplex.runtime.values.primitives.PrimitiveMethod
+import org.goodmath.simplex.runtime.values.primitives.StringValue
+import org.goodmath.simplex.runtime.values.primitives.StringValueType
+import org.goodmath.simplex.runtime.values.primitives.VectorValue
+import org.goodmath.simplex.runtime.values.primitives.VectorValueType
+import org.goodmath.simplex.twist.Twist
+
+/**
+ * A set of parts connected by joints. The joints must form a tree: each part can be
+ * the child of at most one joint, and no part can be attached to itself through a
+ * chain of joints. Parts that aren't the child of any joint stay where they are.
+ */
+class Assembly(val parts: List<Part>, val joints: List<Joint>) : Value {
+    override val valueType: ValueType = AssemblyValueType
+
+    private val jointIndexForChild = HashMap<String, Int>()
+
+    init {
+        val names = HashSet<String>()
+        for (p in parts) {
+            if (!names.add(p.name)) {
+                throw SimplexEvaluationError("Assembly has more than one part named ${p.name}")
+            }
+        }
+        for ((idx, j) in joints.withIndex()) {
+            for (p in listOf(j.parent, j.child)) {
+                if (p !in names) {
+                    throw SimplexEvaluationError("Joint ${j.name} refers to part $p, which isn't in the assembly")
+                }
+            }
+            if (jointIndexForChild.put(j.child, idx) != null) {
+                throw SimplexEvaluationError("Part ${j.child} is moved by more than one joint")
+            }
+        }
+        for (j in joints) {
+            var p: String? = j.parent
+            val seen = HashSet<String>()
+            while (p != null) {
+                if (p == j.child || !seen.add(p)) {
+                    throw SimplexEvaluationError("Joint ${j.name} attaches part ${j.child} to itself")
+                }
+                p = jointIndexForChild[p]?.let { joints[it].parent }
+            }
+        }
+    }
+
+    /** The names of the parts that a joint moves: its child, and everything attached to it. */
+    fun movedBy(joint: Joint): Set<String> {
+        val result = LinkedHashSet<String>()
+        val queue = ArrayDeque(listOf(joint.child))
+        while (queue.isNotEmpty()) {
+            val p = queue.removeFirst()
+            if (result.add(p)) {
+                queue.addAll(joints.filter { it.parent == p }.map { it.child })
+            }
+        }
+        return result
+    }
+
+    fun restValues(): List<Double> = joints.map { it.rest }
+
+    /**
+     * Compute where each part is with the joints set to a list of values, in the same
+     * order as the joints.
+     */
+    fun pose(values: List<Double>): Map<String, Solid> {
+        if (values.size != joints.size) {
+            throw SimplexEvaluationError("Assembly has ${joints.size} joints, but ${values.size} values were given")
+        }
+        for ((j, v) in joints.zip(values)) {
+            if (v < j.low || v > j.high) {
+                throw SimplexEvaluationError("Value $v is outside the range of joint ${j.name}, ${j.low} to ${j.high}")
+            }
+        }
+        val transforms = HashMap<String, RigidTransform>()
+        fun transformOf(part: String): RigidTransform {
+            transforms[part]?.let { return it }
+            val idx = jointIndexForChild[part]
+            val result =
+                if (idx == null) {
+                    RigidTransform.identity
+                } else {
+                    val joint = joints[idx]
+                    transformOf(joint.parent).compose(joint.motion(values[idx]))
+                }
+            transforms[part] = result
+            return result
+        }
+        return parts.associate { it.name to transformOf(it.name).apply(it.solid) }
+    }
+
+    /**
+     * Step each joint in turn through its range, with the other joints at rest, and
+     * find the parts that collide: parts that the joint moves which overlap parts that
+     * it doesn't move by more than a tolerance.
+     *
+     * @param steps the number of steps to divide each joint's range into; each joint is
+     *    checked at steps+1 values, including both ends of its range. A joint whose
+     *    range is a single value is only checked at that value.
+     * @param tolerance the volume of overlap that's allowed.
+     */
+    fun sweepCheck(steps: Int, tolerance: Double): List<Collision> {
+        if (steps < 1) {
+            throw SimplexEvaluationError("sweep_check needs at least one step, not $steps")
+        }
+        val result = ArrayList<Collision>()
+        val rest = restValues()
+        for ((idx, joint) in joints.withIndex()) {
+            val moving = movedBy(joint)
+            val jointSteps = if (joint.low == joint.high) 0 else steps
+            for (step in 0..jointSteps) {
+                val value =
+                    if (step == jointSteps) {
+                        joint.high
+                    } else {
+                        joint.low + (joint.high - joint.low) * step / steps
+                    }
+                val values = rest.toMutableList()
+                values[idx] = value
+                val posed = pose(values)
+                for (a in parts.map { it.name }.filter { it in moving }) {
+                    for (b in parts.map { it.name }.filter { it !in moving }) {
+                        val volume = overlap(posed[a]!!, posed[b]!!)
+                        if (volume > tolerance) {
+                            result.add(Collision(joint.name, value, a, b, volume))
+                        }
+                    }
+                }
+            }
+        }
+        return result
+    }
+
+    override fun twist(): Twist =
+        Twist.obj("Assembly", Twist.array("parts", parts), Twist.array("joints", joints))
+
+    companion object {
+        /** The volume of the intersection of two solids. */
+        fun overlap(a: Solid, b: Solid): Double {
+            val boxA = a.boundingBox()
+            val boxB = b.boundingBox()
+            if (boxA.high.x < boxB.low.x || boxB.high.x < boxA.low.x ||
+                boxA.high.y < boxB.low.y || boxB.high.y < boxA.low.y ||
+                boxA.high.z < boxB.low.z || boxB.high.z < boxA.low.z) {
+                return 0.0
+            }
+            return a.intersect(b).volume().d
+        }
+    }
+}
+
+/**
+ * A collision found by [Assembly.sweepCheck].
+ *
+ * @param joint the name of the joint being moved.
+ * @param value the value of the joint where the parts collide.
+ * @param moving the name of the part that the joint moved.
+ * @param other the name of the part that it collided with.
+ * @param volume the volume of the overlap between the parts.
+ */
+class Collision(
+    val joint: String,
+    val value: Double,
+    val moving: String,
+    val other: String,
+    val volume: Double,
+) : Value {
+    override val valueType: ValueType = CollisionValueType
+
+    override fun toString(): String =
+        "Collision between $moving and $other at $joint = $value (overlap volume $volume)"
+
+    override fun twist(): Twist =
+        Twist.obj(
+            "Collision",
+            Twist.attr("joint", joint),
+            Twist.attr("value", value.toString()),
+            Twist.attr("moving", moving),
+            Twist.attr("other", other),
+            Twist.attr("volume", volume.toString()),
+        )
+}
+
+object AssemblyValueType : ValueType() {
+    override val name: String = "Assembly"
+
+    override val asType: Type by lazy { Type.simple(name) }
+
+    override fun isTruthy(v: Value): Boolean = true
+
+    override val providesFunctions: List<PrimitiveFunctionValue> by lazy {
+        listOf(
+            object :
+                PrimitiveFunctionValue(
+                    "assembly",
+                    FunctionSignature.simple(
+                        listOf(
+                            Param("parts", VectorValueType.of(PartValueType).asType),
+                            Param("joints", VectorValueType.of(JointValueType).asType),
+                        ),
+                        asType,
+                    ),
+                ) {
+                override fun execute(args: List<Value>): Value {
+                    val parts = VectorValueType.of(PartValueType).assertIsVector(args[0])
+                        .map { PartValueType.assertIs(it) }
+                    val joints = VectorValueType.of(JointValueType).assertIsVector(args[1])
+                        .map { JointValueType.assertIs(it) }
+                    return Assembly(parts, joints)
+                }
+            },
+            object :
+                PrimitiveFunctionValue(
+                    "sweep_check",
+                    FunctionSignature.multi(
+                        listOf(
+                            listOf(
+                                Param("assembly", asType),
+                                Param("steps", IntegerValueType.asType),
+                            ),
+                            listOf(
+                                Param("assembly", asType),
+                                Param("steps", IntegerValueType.asType),
+                                Param("tolerance", FloatValueType.asType),
+                            ),
+                        ),
+                        VectorValueType.of(CollisionValueType).asType,
+                    ),
+                ) {
+                override fun execute(args: List<Value>): Value {
+                    val assembly = assertIs(args[0])
+                    val steps = assertIsInt(args[1])
+                    val tolerance = if (args.size > 2) assertIsFloat(args[2]) else DEFAULT_TOLERANCE
+                    return VectorValue(CollisionValueType, assembly.sweepCheck(steps, tolerance))
+                }
+            },
+        )
+    }
+
+    override val providesPrimitiveMethods: List<PrimitiveMethod> by lazy {
+        listOf(
+            object :
+                PrimitiveMethod(
+                    "pose",
+                    MethodSignature.simple(
+                        asType,
+                        listOf(Param("values", VectorValueType.of(FloatValueType).asType)),
+                        SolidValueType.asType,
+                    ),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    val self = assertIs(target)
+                    val values = VectorValueType.of(FloatValueType).assertIsVector(args[0])
+                        .map { assertIsFloat(it) }
+                    return Solid.union(self.pose(values).values.toList())
+                }
+            },
+            object :
+                PrimitiveMethod(
+                    "solid",
+                    MethodSignature.simple(asType, emptyList<Param>(), SolidValueType.asType),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    val self = assertIs(target)
+                    return Solid.union(self.pose(self.restValues()).values.toList())
+                }
+            },
+            object :
+                PrimitiveMethod(
+                    "parts",
+                    MethodSignature.simple(
+                        asType,
+                        emptyList<Param>(),
+                        VectorValueType.of(PartValueType).asType,
+                    ),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    return VectorValue(PartValueType, assertIs(target).parts)
+                }
+            },
+        )
+    }
+
+    override val providesVariables: Map<String, Value> = emptyMap()
+
+    override fun assertIs(v: Value): Assembly {
+        return v as? Assembly ?: throwTypeError(v)
+    }
+
+    /** The overlap volume below which sweep_check ignores a collision, in cubic model units. */
+    const val DEFAULT_TOLERANCE = 1e-6
+}
+
+object CollisionValueType : ValueType() {
+    override val name: String = "Collision"
+
+    override val asType: Type by lazy { Type.simple(name) }
+
+    override val supportsText: Boolean = true
+
+    override fun toText(v: Value): String = assertIs(v).toString()
+
+    override fun isTruthy(v: Value): Boolean = true
+
+    override val providesFunctions: List<PrimitiveFunctionValue> = emptyList()
+
+    override val providesPrimitiveMethods: List<PrimitiveMethod> by lazy {
+        listOf(
+            object :
+                PrimitiveMethod(
+                    "joint",
+                    MethodSignature.simple(asType, emptyList<Param>(), StringValueType.asType),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    return StringValue(assertIs(target).joint)
+                }
+            },
+            object :
+                PrimitiveMethod(
+                    "value",
+                    MethodSignature.simple(asType, emptyList<Param>(), FloatValueType.asType),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    return FloatValue(assertIs(target).value)
+                }
+            },
+            object :
+                PrimitiveMethod(
+                    "parts",
+                    MethodSignature.simple(
+                        asType,
+                        emptyList<Param>(),
+                        VectorValueType.of(StringValueType).asType,
+                    ),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    val self = assertIs(target)
+                    return VectorValue(StringValueType, listOf(StringValue(self.moving), StringValue(self.other)))
+                }
+            },
+            object :
+                PrimitiveMethod(
+                    "volume",
+                    MethodSignature.simple(asType, emptyList<Param>(), FloatValueType.asType),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    return FloatValue(assertIs(target).volume)
+                }
+            },
+        )
+    }
+
+    override val providesVariables: Map<String, Value> = emptyMap()
+
+    override fun assertIs(v: Value): Collision {
+        return v as? Collision ?: throwTypeError(v)
+    }
+}
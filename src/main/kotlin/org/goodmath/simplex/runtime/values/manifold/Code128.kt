@@ -0,0 +1,129 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import org.goodmath.simplex.runtime.SimplexEvaluationError
+
+/**
+ * A Code 128 barcode encoder. Text is encoded with code set B, switching to code
+ * set C, which packs two digits into each symbol, for runs of digits long enough to
+ * make the switch worthwhile.
+ */
+object Code128 {
+    /**
+     * The widths of the bars and spaces of each symbol, in modules, alternating
+     * bar and space.
+     */
+    private val PATTERNS =
+        listOf(
+            "212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312",
+            "132212", "221213", "221312", "231212", "112232", "122132", "122231", "113222",
+            "123122", "123221", "223211", "221132", "221231", "213212", "223112", "312131",
+            "311222", "321122", "321221", "312212", "322112", "322211", "212123", "212321",
+            "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+            "231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121",
+            "313121", "211331", "231131", "213113", "213311", "213131", "311123", "311321",
+            "331121", "312113", "312311", "332111", "314111", "221411", "431111", "111224",
+            "111422", "121124", "121421", "141122", "141221", "112214", "112412", "122114",
+            "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+            "111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112",
+            "421211", "212141", "214121", "412121", "111143", "111341", "131141", "114113",
+            "114311", "411113", "411311", "113141", "114131", "311141", "411131", "211412",
+            "211214", "211232", "2331112",
+        )
+
+    const val CODE_C = 99
+    const val CODE_B = 100
+    const val START_B = 104
+    const val START_C = 105
+    const val STOP = 106
+
+    /** The quiet zone that's needed on either side of the barcode, in modules. */
+    const val QUIET_ZONE = 10
+
+    /**
+     * Encode a string as a list of symbol values, starting with the start symbol.
+     * The checksum and the stop symbol aren't included.
+     */
+    fun encode(data: String): List<Int> {
+        if (data.isEmpty()) {
+            throw SimplexEvaluationError("Can't encode an empty string as a Code 128 barcode")
+        }
+        val values = ArrayList<Int>()
+        var codeC = false
+        var i = 0
+        while (i < data.length) {
+            var run = 0
+            while (i + run < data.length && data[i + run] in '0'..'9') {
+                run++
+            }
+            // Switching code sets costs a symbol, so it's only worth it for longer runs
+            // in the middle of the data.
+            val minRun = if (i == 0 || i + run == data.length) 4 else 6
+            if (run >= minRun) {
+                if (!codeC) {
+                    values.add(if (values.isEmpty()) START_C else CODE_C)
+                    codeC = true
+                }
+                repeat(run / 2) {
+                    values.add(data.substring(i, i + 2).toInt())
+                    i += 2
+                }
+            } else {
+                if (codeC || values.isEmpty()) {
+                    values.add(if (values.isEmpty()) START_B else CODE_B)
+                    codeC = false
+                }
+                val c = data[i]
+                if (c.code !in 32..126) {
+                    throw SimplexEvaluationError("Code 128 barcodes can only encode printable ASCII, not '$c'")
+                }
+                values.add(c.code - 32)
+                i++
+            }
+        }
+        return values
+    }
+
+    /** The checksum symbol for a list of symbol values that starts with a start symbol. */
+    fun checksum(values: List<Int>): Int =
+        (values.first() + values.withIndex().drop(1).sumOf { (idx, v) -> idx * v }) % 103
+
+    /**
+     * The widths of the bars and spaces of the complete barcode, in modules,
+     * alternating bar and space, and starting with a bar.
+     */
+    fun widths(data: String): List<Int> {
+        val values = encode(data)
+        return (values + checksum(values) + STOP).flatMap { v -> PATTERNS[v].map { it.digitToInt() } }
+    }
+
+    /**
+     * Convert a string to a barcode slice, with a rectangle for each bar. The bottom
+     * left corner of the first bar is at the origin. The quiet zone isn't included.
+     */
+    fun toSlice(data: String, height: Double, moduleWidth: Double): Slice {
+        val boxes = ArrayList<DoubleArray>()
+        var x = 0
+        for ((idx, width) in widths(data).withIndex()) {
+            if (idx % 2 == 0) {
+                boxes.add(doubleArrayOf(x * moduleWidth, 0.0, (x + width) * moduleWidth, height))
+            }
+            x += width
+        }
+        return Slice.fromBoxes(boxes)
+    }
+}
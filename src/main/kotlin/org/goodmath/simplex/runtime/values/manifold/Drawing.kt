@@ -0,0 +1,222 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import java.util.Locale
+import org.goodmath.simplex.ast.types.Type
+import org.goodmath.simplex.runtime.Env
+import org.goodmath.simplex.runtime.SimplexEvaluationError
+import org.goodmath.simplex.runtime.values.FunctionSignature
+import org.goodmath.simplex.runtime.values.MethodSignature
+import org.goodmath.simplex.runtime.values.Param
+import org.goodmath.simplex.runtime.values.Value
+import org.goodmath.simplex.runtime.values.ValueType
+import org.goodmath.simplex.runtime.values.primitives.FloatValueType
+import org.goodmath.simplex.runtime.values.primitives.PrimitiveFunctionValue
+import org.goodmath.simplex.runtime.values.primitives.PrimitiveMethod
+import org.goodmath.simplex.runtime.values.primitives.StringValueType
+import org.goodmath.simplex.runtime.values.primitives.Vec3
+import org.goodmath.simplex.runtime.values.primitives.Vec3ValueType
+import org.goodmath.simplex.runtime.values.primitives.VectorValueType
+import org.goodmath.simplex.twist.Twist
+
+/**
+ * A dimension annotation for a drawing: the distance between two points in the model,
+ * with a label.
+ */
+class Dimension(val a: Vec3, val b: Vec3, val label: String) : Value {
+    override val valueType: ValueType = DimensionValueType
+
+    override fun twist(): Twist =
+        Twist.obj(
+            "Dimension",
+            Twist.value("a", a),
+            Twist.value("b", b),
+            Twist.attr("label", label),
+        )
+}
+
+/**
+ * A plane section in a drawing: the cross-section of the solid in the plane of points
+ * `p` where `p . normal == offset`.
+ */
+data class Section(val name: String, val normal: Vec3, val offset: Double)
+
+/**
+ * A technical drawing of a solid: a set of named orthographic views, with dimension
+ * annotations, and any number of section views. A product that produces a drawing
+ * writes it as SVG and PDF.
+ */
+class Drawing(
+    val solid: Solid,
+    val views: List<String>,
+    val dimensions: List<Dimension>,
+    val sections: List<Section> = emptyList(),
+) : Value {
+    override val valueType: ValueType = DrawingValueType
+
+    init {
+        for (view in views) {
+            if (view !in DrawingRenderer.viewNames) {
+                throw SimplexEvaluationError(
+                    "Unknown drawing view \"$view\"; expected one of " +
+                        DrawingRenderer.viewNames.joinToString(", ") { "\"$it\"" }
+                )
+            }
+        }
+    }
+
+    override fun twist(): Twist =
+        Twist.obj(
+            "Drawing",
+            Twist.attr("views", views.joinToString(",")),
+            Twist.array("dimensions", dimensions),
+            Twist.attr("sections", sections.joinToString(",") { it.name }),
+            Twist.value("solid", solid),
+        )
+
+    /** Add a section view. Sections are named "A", "B", ... in the order they're added. */
+    fun section(normal: Vec3, offset: Double): Drawing {
+        val name = ('A' + sections.size).toString()
+        return Drawing(solid, views, dimensions, sections + Section(name, normal, offset))
+    }
+
+    fun svg(): String = DrawingRenderer(this).sheet().toSvg()
+
+    fun pdf(): ByteArray = DrawingRenderer(this).sheet().toPdf()
+}
+
+object DimensionValueType : ValueType() {
+    override val name: String = "Dimension"
+
+    override val asType: Type by lazy { Type.simple(name) }
+
+    override val supportsText: Boolean = true
+
+    override fun toText(v: Value): String = "Dimension(${assertIs(v).label})"
+
+    override fun isTruthy(v: Value): Boolean = true
+
+    override val providesFunctions: List<PrimitiveFunctionValue> by lazy {
+        listOf(
+            object :
+                PrimitiveFunctionValue(
+                    "dimension",
+                    FunctionSignature.multi(
+                        listOf(
+                            listOf(Param("a", Vec3ValueType.asType), Param("b", Vec3ValueType.asType)),
+                            listOf(
+                                Param("a", Vec3ValueType.asType),
+                                Param("b", Vec3ValueType.asType),
+                                Param("label", StringValueType.asType),
+                            ),
+                        ),
+                        asType,
+                    ),
+                ) {
+                override fun execute(args: List<Value>): Value {
+                    val a = Vec3ValueType.assertIs(args[0])
+                    val b = Vec3ValueType.assertIs(args[1])
+                    val label =
+                        if (args.size > 2) {
+                            assertIsString(args[2])
+                        } else {
+                            String.format(Locale.ROOT, "%.2f", (b - a).magnitude())
+                        }
+                    return Dimension(a, b, label)
+                }
+            }
+        )
+    }
+
+    override val providesPrimitiveMethods: List<PrimitiveMethod> = emptyList()
+
+    override val providesVariables: Map<String, Value> = emptyMap()
+
+    override fun assertIs(v: Value): Dimension {
+        return v as? Dimension ?: throwTypeError(v)
+    }
+}
+
+object DrawingValueType : ValueType() {
+    override val name: String = "Drawing"
+
+    override val asType: Type by lazy { Type.simple(name) }
+
+    override fun isTruthy(v: Value): Boolean = true
+
+    override val providesFunctions: List<PrimitiveFunctionValue> by lazy {
+        listOf(
+            object :
+                PrimitiveFunctionValue(
+                    "drawing",
+                    FunctionSignature.multi(
+                        listOf(
+                            listOf(
+                                Param("solid", SolidValueType.asType),
+                                Param("views", VectorValueType.of(StringValueType).asType),
+                            ),
+                            listOf(
+                                Param("solid", SolidValueType.asType),
+                                Param("views", VectorValueType.of(StringValueType).asType),
+                                Param("dimensions", VectorValueType.of(DimensionValueType).asType),
+                            ),
+                        ),
+                        asType,
+                    ),
+                ) {
+                override fun execute(args: List<Value>): Value {
+                    val solid = SolidValueType.assertIs(args[0])
+                    val views = VectorValueType.of(StringValueType).assertIsVector(args[1])
+                        .map { assertIsString(it) }
+                    val dimensions =
+                        if (args.size > 2) {
+                            VectorValueType.of(DimensionValueType).assertIsVector(args[2])
+                                .map { DimensionValueType.assertIs(it) }
+                        } else {
+                            emptyList()
+                        }
+                    return Drawing(solid, views, dimensions)
+                }
+            }
+        )
+    }
+
+    override val providesPrimitiveMethods: List<PrimitiveMethod> by lazy {
+        listOf(
+            object :
+                PrimitiveMethod(
+                    "section",
+                    MethodSignature.simple(
+                        asType,
+                        listOf(Param("normal", Vec3ValueType.asType), Param("offset", FloatValueType.asType)),
+                        asType,
+                    ),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    val self = assertIs(target)
+                    return self.section(Vec3ValueType.assertIs(args[0]), assertIsFloat(args[1]))
+                }
+            }
+        )
+    }
+
+    override val providesVariables: Map<String, Value> = emptyMap()
+
+    override fun assertIs(v: Value): Drawing {
+        return v as? Drawing ?: throwTypeError(v)
+    }
+}
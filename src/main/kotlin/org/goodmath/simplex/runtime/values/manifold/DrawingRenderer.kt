@@ -0,0 +1,612 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import java.io.ByteArrayOutputStream
+import java.util.Locale
+import kotlin.math.PI
+import kotlin.math.acos
+import kotlin.math.atan2
+import kotlin.math.ceil
+import kotlin.math.cos
+import kotlin.math.max
+import kotlin.math.min
+import kotlin.math.sqrt
+import org.goodmath.simplex.runtime.values.primitives.Vec2
+
+/**
+ * Lays out a technical drawing of a solid on a sheet.
+ *
+ * The orthographic views are placed in third-angle projection, with the top view
+ * above the front view and the right view to its right, so that points line up
+ * between views. The drawing is at 1:1 scale, in the units of the model, which
+ * the SVG and PDF writers treat as millimeters.
+ *
+ * Each view shows the crease and silhouette edges of the mesh. Edges, or the parts
+ * of edges, that are hidden behind the solid are drawn dashed.
+ */
+class DrawingRenderer(val drawing: Drawing) {
+    private val mesh = MeshData.of(drawing.solid)
+    private val normals = Array(mesh.triangleCount) { triangleNormal(it) }
+
+    /** The size of a unit of annotation, like a gap or an arrowhead, scaled to the model. */
+    private val unit: Double
+
+    init {
+        var size = 0.0
+        if (mesh.vertexCount > 0) {
+            for (axis in 0 until 3) {
+                val values = (0 until mesh.vertexCount).map { mesh.vertices[3 * it + axis] }
+                size = max(size, values.max() - values.min())
+            }
+        }
+        unit = max(size, 1e-3) / 50.0
+    }
+
+    /** The primitives of a drawing, in sheet coordinates, with y increasing downwards. */
+    sealed class Mark {
+        data class Line(val x1: Double, val y1: Double, val x2: Double, val y2: Double, val hidden: Boolean) :
+            Mark()
+
+        data class Area(val points: List<Pair<Double, Double>>) : Mark()
+
+        data class Label(val x: Double, val y: Double, val text: String, val size: Double) : Mark()
+    }
+
+    /**
+     * One view in the drawing, in its own coordinates.
+     *
+     * @param geometry the bounds of the solid in the view: min x, min y, max x, max y.
+     */
+    class View(val title: String, val marks: List<Mark>, val geometry: DoubleArray)
+
+    /** A laid out drawing, ready to write. */
+    class Sheet(val width: Double, val height: Double, val marks: List<Mark>, val stroke: Double) {
+        fun lines(hidden: Boolean): List<Mark.Line> =
+            marks.filterIsInstance<Mark.Line>().filter { it.hidden == hidden }
+
+        fun toSvg(): String {
+            val out = StringBuilder()
+            out.append(
+                "<svg xmlns=\"http://www.w3.org/2000/svg\" viewBox=\"0 0 $width $height\" " +
+                    "width=\"${width}mm\" height=\"${height}mm\">\n"
+            )
+            out.append("<rect x=\"0\" y=\"0\" width=\"$width\" height=\"$height\" fill=\"white\"/>\n")
+            for (mark in marks.filterIsInstance<Mark.Area>()) {
+                out.append(
+                    "<path d=\"M " + mark.points.joinToString(" L ") { "${it.first} ${it.second}" } +
+                        " Z\" fill=\"#d0d0d0\" stroke=\"black\" stroke-width=\"$stroke\"/>\n"
+                )
+            }
+            for (hidden in listOf(false, true)) {
+                val lines = lines(hidden)
+                if (lines.isEmpty()) {
+                    continue
+                }
+                val path = lines.joinToString(" ") { "M ${it.x1} ${it.y1} L ${it.x2} ${it.y2}" }
+                val dash = if (hidden) " stroke-dasharray=\"${stroke * 8} ${stroke * 4}\"" else ""
+                val lineWidth = if (hidden) stroke / 2 else stroke
+                out.append(
+                    "<path d=\"$path\" fill=\"none\" stroke=\"black\" stroke-width=\"$lineWidth\"$dash/>\n"
+                )
+            }
+            for (mark in marks.filterIsInstance<Mark.Label>()) {
+                out.append(
+                    "<text x=\"${mark.x}\" y=\"${mark.y}\" font-family=\"sans-serif\" " +
+                        "font-size=\"${mark.size}\" text-anchor=\"middle\">${escapeXml(mark.text)}</text>\n"
+                )
+            }
+            out.append("</svg>\n")
+            return out.toString()
+        }
+
+        /** Write the sheet as a single page PDF, with the page the size of the sheet. */
+        fun toPdf(): ByteArray {
+            val k = 72.0 / 25.4
+            fun px(x: Double) = String.format(Locale.ROOT, "%.3f", x * k)
+            fun py(y: Double) = String.format(Locale.ROOT, "%.3f", (height - y) * k)
+            val content = StringBuilder()
+            content.append("1 J 1 j\n")
+            for (mark in marks.filterIsInstance<Mark.Area>()) {
+                content.append("0.82 g ${px(stroke)} w\n")
+                val first = mark.points.first()
+                content.append("${px(first.first)} ${py(first.second)} m\n")
+                for (p in mark.points.drop(1)) {
+                    content.append("${px(p.first)} ${py(p.second)} l\n")
+                }
+                content.append("h B\n")
+            }
+            content.append("0 g\n")
+            for (hidden in listOf(false, true)) {
+                val lines = lines(hidden)
+                if (lines.isEmpty()) {
+                    continue
+                }
+                if (hidden) {
+                    content.append("${px(stroke / 2)} w [${px(stroke * 8)} ${px(stroke * 4)}] 0 d\n")
+                } else {
+                    content.append("${px(stroke)} w [] 0 d\n")
+                }
+                for (line in lines) {
+                    content.append("${px(line.x1)} ${py(line.y1)} m ${px(line.x2)} ${py(line.y2)} l S\n")
+                }
+            }
+            for (mark in marks.filterIsInstance<Mark.Label>()) {
+                // Helvetica glyphs average about half of the font size across.
+                val x = mark.x - mark.text.length * mark.size * 0.25
+                content.append(
+                    "BT /F1 ${px(mark.size)} Tf ${px(x)} ${py(mark.y)} Td (${escapePdf(mark.text)}) Tj ET\n"
+                )
+            }
+            val objects =
+                listOf(
+                    "<< /Type /Catalog /Pages 2 0 R >>",
+                    "<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+                    "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 ${px(width)} ${px(height)}] " +
+                        "/Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >>",
+                    "<< /Length ${content.length} >>\nstream\n$content\nendstream",
+                    "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+                )
+            val out = ByteArrayOutputStream()
+            fun write(s: String) = out.write(s.toByteArray(Charsets.ISO_8859_1))
+            write("%PDF-1.4\n")
+            val offsets = ArrayList<Int>()
+            for ((i, obj) in objects.withIndex()) {
+                offsets.add(out.size())
+                write("${i + 1} 0 obj\n$obj\nendobj\n")
+            }
+            val xref = out.size()
+            write("xref\n0 ${objects.size + 1}\n0000000000 65535 f \n")
+            for (offset in offsets) {
+                write(String.format(Locale.ROOT, "%010d 00000 n \n", offset))
+            }
+            write("trailer\n<< /Size ${objects.size + 1} /Root 1 0 R >>\nstartxref\n$xref\n%%EOF\n")
+            return out.toByteArray()
+        }
+    }
+
+    /** Render the views and sections of the drawing, and lay them out on a sheet. */
+    fun sheet(): Sheet {
+        val placed = ArrayList<Pair<View, Pair<Int, Int>>>()
+        for (name in drawing.views) {
+            placed.add(Pair(view(name), gridPositions.getValue(name)))
+        }
+        val sectionRow = (placed.maxOfOrNull { it.second.second } ?: -1) + 1
+        for ((i, section) in drawing.sections.withIndex()) {
+            placed.add(Pair(section(section), Pair(i, sectionRow)))
+        }
+        // Each view is centered on the center of its geometry, so that views in the
+        // same row or column line up; the cells are made big enough for the
+        // annotations on either side.
+        val halfWidths = HashMap<Int, Double>()
+        val halfHeights = HashMap<Int, Double>()
+        for ((view, pos) in placed) {
+            val (cx, cy) = center(view)
+            val b = bounds(view)
+            val hw = max(cx - b[0], b[2] - cx)
+            val hh = max(cy - b[1], b[3] - cy)
+            halfWidths[pos.first] = max(halfWidths[pos.first] ?: 0.0, hw)
+            halfHeights[pos.second] = max(halfHeights[pos.second] ?: 0.0, hh)
+        }
+        val margin = unit * 4
+        val columnX = HashMap<Int, Double>()
+        var x = margin
+        for (col in halfWidths.keys.sorted()) {
+            columnX[col] = x + halfWidths.getValue(col)
+            x += 2 * halfWidths.getValue(col) + margin
+        }
+        val rowY = HashMap<Int, Double>()
+        var y = margin
+        for (row in halfHeights.keys.sorted()) {
+            rowY[row] = y + halfHeights.getValue(row)
+            y += 2 * halfHeights.getValue(row) + margin
+        }
+        val marks = ArrayList<Mark>()
+        for ((view, pos) in placed) {
+            val (cx, cy) = center(view)
+            val dx = columnX.getValue(pos.first) - cx
+            val dy = rowY.getValue(pos.second) - cy
+            marks.addAll(view.marks.map { translate(it, dx, dy) })
+        }
+        return Sheet(x, y, marks, unit / 8)
+    }
+
+    /** Render a named orthographic view of the solid, with its dimensions. */
+    fun view(name: String): View {
+        val (forward, upHint) = directions.getValue(name)
+        val right = normalize(cross(forward, upHint))
+        val up = cross(right, forward)
+        val u = DoubleArray(mesh.vertexCount)
+        val v = DoubleArray(mesh.vertexCount)
+        val depth = DoubleArray(mesh.vertexCount)
+        for (i in 0 until mesh.vertexCount) {
+            val p = vertex(i)
+            u[i] = dot(p, right)
+            // Sheet coordinates go down the page.
+            v[i] = -dot(p, up)
+            depth[i] = dot(p, forward)
+        }
+        val geometry = boundsOf(u, v)
+        val occluders = Occluders(u, v, depth, forward, geometry)
+        val marks = ArrayList<Mark>()
+        for ((a, b) in featureEdges(forward)) {
+            val length = sqrt((u[b] - u[a]) * (u[b] - u[a]) + (v[b] - v[a]) * (v[b] - v[a]))
+            if (length < 1e-9) {
+                continue
+            }
+            val steps = ceil(length / (unit / 4)).toInt().coerceIn(1, 200)
+            var runStart = 0.0
+            var runHidden: Boolean? = null
+            for (s in 0 until steps) {
+                val t = (s + 0.5) / steps
+                val hidden =
+                    occluders.covers(
+                        u[a] + t * (u[b] - u[a]),
+                        v[a] + t * (v[b] - v[a]),
+                        depth[a] + t * (depth[b] - depth[a]),
+                    )
+                if (runHidden != null && hidden != runHidden) {
+                    val end = s.toDouble() / steps
+                    marks.add(segment(u, v, a, b, runStart, end, runHidden))
+                    runStart = end
+                }
+                runHidden = hidden
+            }
+            marks.add(segment(u, v, a, b, runStart, 1.0, runHidden!!))
+        }
+        if (name != "iso") {
+            var stack = 0
+            for (dim in drawing.dimensions) {
+                val a = doubleArrayOf(dim.a.x, dim.a.y, dim.a.z)
+                val b = doubleArrayOf(dim.b.x, dim.b.y, dim.b.z)
+                val pa = Pair(dot(a, right), -dot(a, up))
+                val pb = Pair(dot(b, right), -dot(b, up))
+                if (dimensionMarks(pa, pb, dim.label, geometry, stack, marks)) {
+                    stack++
+                }
+            }
+        }
+        marks.add(title(name.uppercase(), geometry, marks))
+        return View(name, marks, geometry)
+    }
+
+    /** Render a section view: the cross-section of the solid in the section's plane. */
+    fun section(section: Section): View {
+        val n = section.normal
+        val len = n.magnitude()
+        val theta = acos((n.z / len).coerceIn(-1.0, 1.0)) * 180.0 / PI
+        val phi = atan2(n.y, n.x) * 180.0 / PI
+        // Turn the solid so that the normal of the plane points up the z axis, and then
+        // the section is a slice at the offset.
+        val turned = drawing.solid.rotate(0.0, 0.0, -phi).rotate(0.0, -theta, 0.0)
+        val polys =
+            turned.slice(section.offset / len).map { poly ->
+                poly.map { Vec2.fromDoubleVec2(it) }.map { Pair(it.x, -it.y) }
+            }.filter { it.size > 2 }
+        val points = polys.flatten()
+        val geometry =
+            if (points.isEmpty()) {
+                doubleArrayOf(0.0, 0.0, 0.0, 0.0)
+            } else {
+                doubleArrayOf(
+                    points.minOf { it.first },
+                    points.minOf { it.second },
+                    points.maxOf { it.first },
+                    points.maxOf { it.second },
+                )
+            }
+        val marks = ArrayList<Mark>()
+        marks.addAll(polys.map { Mark.Area(it) })
+        marks.add(title("SECTION ${section.name}-${section.name}", geometry, marks))
+        return View("section ${section.name}", marks, geometry)
+    }
+
+    /**
+     * The edges that belong in a drawing: creases, where the faces on either side
+     * meet at an angle, and silhouettes, where the surface turns away from the viewer.
+     */
+    private fun featureEdges(forward: DoubleArray): List<Pair<Int, Int>> {
+        val faces = LinkedHashMap<Pair<Int, Int>, MutableList<Int>>()
+        for (t in 0 until mesh.triangleCount) {
+            for (e in 0 until 3) {
+                val a = mesh.triangles[3 * t + e]
+                val b = mesh.triangles[3 * t + (e + 1) % 3]
+                faces.getOrPut(Pair(min(a, b), max(a, b))) { ArrayList() }.add(t)
+            }
+        }
+        val creaseCos = cos(CREASE_ANGLE * PI / 180.0)
+        return faces.filter { (_, tris) ->
+            if (tris.size != 2) {
+                true
+            } else {
+                val n1 = normals[tris[0]]
+                val n2 = normals[tris[1]]
+                dot(n1, n2) < creaseCos || (dot(n1, forward) < 0.0) != (dot(n2, forward) < 0.0)
+            }
+        }.keys.toList()
+    }
+
+    /**
+     * The triangles that face the viewer, bucketed into a grid over the view so that
+     * finding the triangles over a point is quick.
+     */
+    private inner class Occluders(
+        val u: DoubleArray,
+        val v: DoubleArray,
+        val depth: DoubleArray,
+        forward: DoubleArray,
+        val bounds: DoubleArray,
+    ) {
+        private val cells = Array(GRID * GRID) { ArrayList<Int>() }
+        private val cellWidth = max(bounds[2] - bounds[0], 1e-9) / GRID
+        private val cellHeight = max(bounds[3] - bounds[1], 1e-9) / GRID
+        private val epsilon = unit * 1e-4
+
+        init {
+            for (t in 0 until mesh.triangleCount) {
+                if (dot(normals[t], forward) >= -1e-6) {
+                    continue
+                }
+                val vs = (0 until 3).map { mesh.triangles[3 * t + it] }
+                val c0 = cellX(vs.minOf { u[it] })
+                val c1 = cellX(vs.maxOf { u[it] })
+                val r0 = cellY(vs.minOf { v[it] })
+                val r1 = cellY(vs.maxOf { v[it] })
+                for (r in r0..r1) {
+                    for (c in c0..c1) {
+                        cells[r * GRID + c].add(t)
+                    }
+                }
+            }
+        }
+
+        private fun cellX(x: Double) = ((x - bounds[0]) / cellWidth).toInt().coerceIn(0, GRID - 1)
+
+        private fun cellY(y: Double) = ((y - bounds[1]) / cellHeight).toInt().coerceIn(0, GRID - 1)
+
+        /**
+         * Is a point hidden by a triangle in front of it? Only the strict inside of a
+         * triangle counts, so that edges aren't hidden by the faces that they bound.
+         */
+        fun covers(x: Double, y: Double, z: Double): Boolean {
+            for (t in cells[cellY(y) * GRID + cellX(x)]) {
+                val i0 = mesh.triangles[3 * t]
+                val i1 = mesh.triangles[3 * t + 1]
+                val i2 = mesh.triangles[3 * t + 2]
+                val area = (u[i1] - u[i0]) * (v[i2] - v[i0]) - (u[i2] - u[i0]) * (v[i1] - v[i0])
+                if (area * area < 1e-24) {
+                    continue
+                }
+                val w0 = ((u[i1] - x) * (v[i2] - y) - (u[i2] - x) * (v[i1] - y)) / area
+                val w1 = ((u[i2] - x) * (v[i0] - y) - (u[i0] - x) * (v[i2] - y)) / area
+                val w2 = 1.0 - w0 - w1
+                val inset = 1e-6
+                if (w0 <= inset || w1 <= inset || w2 <= inset) {
+                    continue
+                }
+                if (w0 * depth[i0] + w1 * depth[i1] + w2 * depth[i2] < z - epsilon) {
+                    return true
+                }
+            }
+            return false
+        }
+    }
+
+    /**
+     * Add the marks for a dimension to a view: extension lines from the points, and a
+     * dimension line with arrowheads and a label, placed outside of the solid. Returns
+     * false if the dimension can't be seen in the view, because the two points line up.
+     */
+    private fun dimensionMarks(
+        a: Pair<Double, Double>,
+        b: Pair<Double, Double>,
+        label: String,
+        geometry: DoubleArray,
+        stack: Int,
+        marks: MutableList<Mark>,
+    ): Boolean {
+        val dx = b.first - a.first
+        val dy = b.second - a.second
+        val length = sqrt(dx * dx + dy * dy)
+        if (length < unit * 1e-3) {
+            return false
+        }
+        val ux = dx / length
+        val uy = dy / length
+        // The normal points away from the middle of the view.
+        var nx = -uy
+        var ny = ux
+        val cx = (geometry[0] + geometry[2]) / 2
+        val cy = (geometry[1] + geometry[3]) / 2
+        if (nx * ((a.first + b.first) / 2 - cx) + ny * ((a.second + b.second) / 2 - cy) < 0) {
+            nx = -nx
+            ny = -ny
+        }
+        val corners =
+            listOf(
+                Pair(geometry[0], geometry[1]),
+                Pair(geometry[2], geometry[1]),
+                Pair(geometry[0], geometry[3]),
+                Pair(geometry[2], geometry[3]),
+            )
+        val reach = corners.maxOf { (it.first - a.first) * nx + (it.second - a.second) * ny }
+        val offset = max(reach, 0.0) + unit * (3 + 3 * stack)
+        val la = Pair(a.first + nx * offset, a.second + ny * offset)
+        val lb = Pair(b.first + nx * offset, b.second + ny * offset)
+        val overshoot = unit
+        for ((p, l) in listOf(Pair(a, la), Pair(b, lb))) {
+            marks.add(
+                Mark.Line(
+                    p.first + nx * unit,
+                    p.second + ny * unit,
+                    l.first + nx * overshoot,
+                    l.second + ny * overshoot,
+                    false,
+                )
+            )
+        }
+        marks.add(Mark.Line(la.first, la.second, lb.first, lb.second, false))
+        for ((p, dir) in listOf(Pair(la, 1.0), Pair(lb, -1.0))) {
+            val bx = p.first + ux * dir * unit * 1.5
+            val by = p.second + uy * dir * unit * 1.5
+            marks.add(Mark.Line(p.first, p.second, bx + nx * unit * 0.5, by + ny * unit * 0.5, false))
+            marks.add(Mark.Line(p.first, p.second, bx - nx * unit * 0.5, by - ny * unit * 0.5, false))
+        }
+        // Keep the label clear of the dimension line, on the outside.
+        val textSize = unit * 2
+        val tx = (la.first + lb.first) / 2 + nx * unit * 1.5
+        val ty = (la.second + lb.second) / 2 + ny * unit * 1.5 + (if (ny > 0) textSize else 0.0)
+        marks.add(Mark.Label(tx, ty, label, textSize))
+        return true
+    }
+
+    private fun title(text: String, geometry: DoubleArray, marks: List<Mark>): Mark.Label {
+        val bottom = max(geometry[3], marks.maxOfOrNull { markBounds(it)[3] } ?: geometry[3])
+        return Mark.Label((geometry[0] + geometry[2]) / 2, bottom + unit * 4, text, unit * 2.5)
+    }
+
+    private fun segment(
+        u: DoubleArray,
+        v: DoubleArray,
+        a: Int,
+        b: Int,
+        from: Double,
+        to: Double,
+        hidden: Boolean,
+    ): Mark.Line =
+        Mark.Line(
+            u[a] + from * (u[b] - u[a]),
+            v[a] + from * (v[b] - v[a]),
+            u[a] + to * (u[b] - u[a]),
+            v[a] + to * (v[b] - v[a]),
+            hidden,
+        )
+
+    private fun center(view: View): Pair<Double, Double> =
+        Pair((view.geometry[0] + view.geometry[2]) / 2, (view.geometry[1] + view.geometry[3]) / 2)
+
+    private fun bounds(view: View): DoubleArray {
+        val result = view.geometry.copyOf()
+        for (mark in view.marks) {
+            val b = markBounds(mark)
+            result[0] = min(result[0], b[0])
+            result[1] = min(result[1], b[1])
+            result[2] = max(result[2], b[2])
+            result[3] = max(result[3], b[3])
+        }
+        return result
+    }
+
+    private fun markBounds(mark: Mark): DoubleArray =
+        when (mark) {
+            is Mark.Line ->
+                doubleArrayOf(min(mark.x1, mark.x2), min(mark.y1, mark.y2), max(mark.x1, mark.x2), max(mark.y1, mark.y2))
+            is Mark.Area ->
+                doubleArrayOf(
+                    mark.points.minOf { it.first },
+                    mark.points.minOf { it.second },
+                    mark.points.maxOf { it.first },
+                    mark.points.maxOf { it.second },
+                )
+            is Mark.Label -> {
+                val halfWidth = mark.text.length * mark.size * 0.3
+                doubleArrayOf(mark.x - halfWidth, mark.y - mark.size, mark.x + halfWidth, mark.y)
+            }
+        }
+
+    private fun translate(mark: Mark, dx: Double, dy: Double): Mark =
+        when (mark) {
+            is Mark.Line -> Mark.Line(mark.x1 + dx, mark.y1 + dy, mark.x2 + dx, mark.y2 + dy, mark.hidden)
+            is Mark.Area -> Mark.Area(mark.points.map { Pair(it.first + dx, it.second + dy) })
+            is Mark.Label -> Mark.Label(mark.x + dx, mark.y + dy, mark.text, mark.size)
+        }
+
+    private fun boundsOf(u: DoubleArray, v: DoubleArray): DoubleArray =
+        if (u.isEmpty()) {
+            doubleArrayOf(0.0, 0.0, 0.0, 0.0)
+        } else {
+            doubleArrayOf(u.min(), v.min(), u.max(), v.max())
+        }
+
+    private fun vertex(i: Int): DoubleArray =
+        doubleArrayOf(mesh.vertices[3 * i], mesh.vertices[3 * i + 1], mesh.vertices[3 * i + 2])
+
+    private fun triangleNormal(t: Int): DoubleArray {
+        val a = vertex(mesh.triangles[3 * t])
+        val b = vertex(mesh.triangles[3 * t + 1])
+        val c = vertex(mesh.triangles[3 * t + 2])
+        return normalize(
+            cross(
+                doubleArrayOf(b[0] - a[0], b[1] - a[1], b[2] - a[2]),
+                doubleArrayOf(c[0] - a[0], c[1] - a[1], c[2] - a[2]),
+            )
+        )
+    }
+
+    companion object {
+        /** Faces that meet at more than this angle, in degrees, have a visible edge between them. */
+        const val CREASE_ANGLE = 30.0
+
+        private const val GRID = 64
+
+        /** The direction that each view looks in, and the direction that's up in it. */
+        private val directions =
+            mapOf(
+                "front" to Pair(doubleArrayOf(0.0, 1.0, 0.0), doubleArrayOf(0.0, 0.0, 1.0)),
+                "back" to Pair(doubleArrayOf(0.0, -1.0, 0.0), doubleArrayOf(0.0, 0.0, 1.0)),
+                "top" to Pair(doubleArrayOf(0.0, 0.0, -1.0), doubleArrayOf(0.0, 1.0, 0.0)),
+                "bottom" to Pair(doubleArrayOf(0.0, 0.0, 1.0), doubleArrayOf(0.0, -1.0, 0.0)),
+                "right" to Pair(doubleArrayOf(-1.0, 0.0, 0.0), doubleArrayOf(0.0, 0.0, 1.0)),
+                "left" to Pair(doubleArrayOf(1.0, 0.0, 0.0), doubleArrayOf(0.0, 0.0, 1.0)),
+                "iso" to Pair(normalize(doubleArrayOf(-1.0, 1.0, -1.0)), doubleArrayOf(0.0, 0.0, 1.0)),
+            )
+
+        /** Where each view goes in the grid of views: column, then row. */
+        private val gridPositions =
+            mapOf(
+                "left" to Pair(0, 1),
+                "front" to Pair(1, 1),
+                "right" to Pair(2, 1),
+                "back" to Pair(3, 1),
+                "top" to Pair(1, 0),
+                "bottom" to Pair(1, 2),
+                "iso" to Pair(2, 0),
+            )
+
+        val viewNames: List<String> = directions.keys.toList()
+
+        private fun escapeXml(s: String): String =
+            s.replace("&", "&amp;").replace("<", "&lt;").replace(">", "&gt;")
+
+        private fun escapePdf(s: String): String =
+            s.replace("\\", "\\\\").replace("(", "\\(").replace(")", "\\)")
+
+        private fun dot(a: DoubleArray, b: DoubleArray): Double =
+            a[0] * b[0] + a[1] * b[1] + a[2] * b[2]
+
+        private fun cross(a: DoubleArray, b: DoubleArray): DoubleArray =
+            doubleArrayOf(
+                a[1] * b[2] - a[2] * b[1],
+                a[2] * b[0] - a[0] * b[2],
+                a[0] * b[1] - a[1] * b[0],
+            )
+
+        private fun normalize(v: DoubleArray): DoubleArray {
+            val len = sqrt(dot(v, v))
+            return if (len == 0.0) v else doubleArrayOf(v[0] / len, v[1] / len, v[2] / len)
+        }
+    }
+}
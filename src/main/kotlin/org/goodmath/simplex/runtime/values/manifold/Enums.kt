@@ -15,8 +15,60 @@
  */
 package org.goodmath.simplex.runtime.values.manifold
 
+import org.goodmath.simplex.runtime.SimplexEvaluationError
+import org.goodmath.simplex.runtime.values.FunctionSignature
+import org.goodmath.simplex.runtime.values.Param
+import org.goodmath.simplex.runtime.values.Value
+import org.goodmath.simplex.runtime.values.primitives.StringValue
+import org.goodmath.simplex.runtime.values.primitives.StringValueType
+
 enum class ManifoldOpType(val opCode: Int) {
     Add(0),
     Subtract(1),
     Intersect(2),
 }
+
+/**
+ * Where a primitive is placed relative to the origin. Anchors refer to the bounding
+ * box of the primitive: for a slice, "bottom" and "top" are the bottom and top edges,
+ * with the slice centered left to right.
+ */
+enum class Anchor(val label: String) {
+    Center("center"),
+    Bottom("bottom"),
+    Top("top"),
+    MinCorner("min_corner");
+
+    companion object {
+        fun of(label: String): Anchor =
+            entries.firstOrNull { it.label == label }
+                ?: throw SimplexEvaluationError(
+                    "Unknown anchor \"$label\"; expected one of ${entries.joinToString(", ") { "\"${it.label}\"" }}"
+                )
+
+        /**
+         * Add a variant of each of a constructor's parameter lists that ends with an
+         * anchor name.
+         */
+        fun withAnchors(paramLists: List<List<Param>>): List<List<Param>> =
+            paramLists + paramLists.map { it + Param("anchor", StringValueType.asType) }
+
+        /**
+         * Split an optional anchor name off of the end of a constructor's arguments. The
+         * last argument is only an anchor if the constructor's signature has a parameter
+         * list of the same length that ends with an anchor, so a constructor's own string
+         * parameters are never mistaken for one. The anchor is null if there isn't one.
+         */
+        fun split(args: List<Value>, signature: FunctionSignature): Pair<List<Value>, Anchor?> {
+            val last = args.lastOrNull()
+            val anchored =
+                last is StringValue &&
+                    signature.params.any { it.size == args.size && it.last().name == "anchor" }
+            return if (anchored) {
+                Pair(args.dropLast(1), of((last as StringValue).s))
+            } else {
+                Pair(args, null)
+            }
+        }
+    }
+}
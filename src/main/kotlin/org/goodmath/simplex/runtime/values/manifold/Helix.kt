@@ -0,0 +1,142 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import kotlin.math.abs
+import kotlin.math.ceil
+import kotlin.math.cos
+import kotlin.math.sin
+import org.goodmath.simplex.runtime.SimplexEvaluationError
+import org.goodmath.simplex.runtime.values.primitives.Vec2
+import org.goodmath.simplex.runtime.values.primitives.Vec3
+
+/**
+ * Helices around the z axis, for springs, coils, and spiral ramps.
+ *
+ * Like [Slice.revolve], a helix starts on the +x axis, and a positive number of turns
+ * winds counterclockwise looking down from +z, which makes a right-handed helix
+ * when the pitch is positive. A negative number of turns winds clockwise.
+ *
+ * The radius changes linearly along the helix, from `radius` at the start to
+ * `radius + taper` at the end; a taper of 0 gives a cylindrical helix.
+ */
+object Helix {
+    const val DEFAULT_SEGMENTS_PER_TURN = 32
+
+    private fun check(radius: Double, turns: Double, taper: Double, segmentsPerTurn: Int) {
+        if (turns == 0.0) {
+            throw SimplexEvaluationError("A helix needs a non-zero number of turns")
+        }
+        if (radius < 0.0 || radius + taper < 0.0) {
+            throw SimplexEvaluationError(
+                "A helix's radius must stay positive, but it goes from $radius to ${radius + taper}"
+            )
+        }
+        if (segmentsPerTurn < 3) {
+            throw SimplexEvaluationError("A helix needs at least 3 segments per turn, not $segmentsPerTurn")
+        }
+    }
+
+    private fun steps(turns: Double, segmentsPerTurn: Int): Int =
+        maxOf(1, ceil(abs(turns) * segmentsPerTurn).toInt())
+
+    /**
+     * Place a point of a profile on the helix. The profile's x axis points away
+     * from the z axis, and its y axis points up.
+     *
+     * @param t how far along the helix the point is, from 0 at the start to 1 at the end.
+     */
+    private fun place(p: Vec2, t: Double, radius: Double, pitch: Double, turns: Double, taper: Double): Vec3 {
+        val angle = 2.0 * Math.PI * turns * t
+        val r = radius + taper * t + p.x
+        return Vec3(r * cos(angle), r * sin(angle), pitch * abs(turns) * t + p.y)
+    }
+
+    /** The points along the center line of a helix, including both ends. */
+    fun path(
+        radius: Double,
+        pitch: Double,
+        turns: Double,
+        taper: Double,
+        segmentsPerTurn: Int = DEFAULT_SEGMENTS_PER_TURN,
+    ): List<Vec3> {
+        check(radius, turns, taper, segmentsPerTurn)
+        val n = steps(turns, segmentsPerTurn)
+        return (0..n).map { i -> place(Vec2(0.0, 0.0), i.toDouble() / n, radius, pitch, turns, taper) }
+    }
+
+    /**
+     * Split a slice into convex pieces. The slice is cut into vertical strips at the
+     * x coordinate of each of its vertices; since no vertex lies inside a strip, each
+     * connected part of a strip is a trapezoid.
+     */
+    fun convexPieces(slice: Slice): List<List<Vec2>> {
+        val xs = slice.toPoints().map { it.x }.distinct().sorted()
+        if (xs.size < 2) {
+            return emptyList()
+        }
+        val low = slice.toPoints().minOf { it.y } - 1.0
+        val height = slice.toPoints().maxOf { it.y } - low + 1.0
+        return xs.zipWithNext().flatMap { (left, right) ->
+            val strip = slice.intersect(Slice.rectangle(right - left, height).translate(left, low))
+            strip.cross.decompose().map { part ->
+                part.toPolygons().flatMap { it.toList() }.map { Vec2.fromDoubleVec2(it) }
+            }
+        }.filter { it.size >= 3 }
+    }
+
+    /**
+     * Sweep a profile along a helix. The profile is in the plane that contains the z
+     * axis, with its x axis pointing away from the z axis; so a circle centered on the
+     * origin makes a round wire, like a spring's. The ends of the sweep are flat caps in
+     * that plane.
+     *
+     * Each step along the helix is the convex hull of a convex piece of the profile at
+     * either end of the step, so the surface is made of straight segments between the
+     * placed copies of the profile.
+     */
+    fun sweep(
+        profile: Slice,
+        radius: Double,
+        pitch: Double,
+        turns: Double,
+        taper: Double,
+        segmentsPerTurn: Int = DEFAULT_SEGMENTS_PER_TURN,
+    ): Solid {
+        check(radius, turns, taper, segmentsPerTurn)
+        val points = profile.toPoints()
+        if (points.isEmpty()) {
+            throw SimplexEvaluationError("Can't sweep an empty slice along a helix")
+        }
+        if (radius + minOf(0.0, taper) + points.minOf { it.x } <= 0.0) {
+            throw SimplexEvaluationError("The profile of a helix sweep crosses the z axis")
+        }
+        val n = steps(turns, segmentsPerTurn)
+        val pieces = convexPieces(profile)
+        val segments =
+            (0 until n).flatMap { i ->
+                val t0 = i.toDouble() / n
+                val t1 = (i + 1).toDouble() / n
+                pieces.map { piece ->
+                    Solid.hullPoints(
+                        piece.map { place(it, t0, radius, pitch, turns, taper) } +
+                            piece.map { place(it, t1, radius, pitch, turns, taper) }
+                    )
+                }
+            }
+        return Solid.union(segments)
+    }
+}
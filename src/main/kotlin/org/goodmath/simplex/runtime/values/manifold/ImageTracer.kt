@@ -0,0 +1,276 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import java.io.ByteArrayInputStream
+import java.io.IOException
+import java.io.InputStream
+import java.nio.file.Path
+import javax.imageio.ImageIO
+import kotlin.io.path.exists
+import kotlin.io.path.extension
+import kotlin.io.path.readBytes
+import manifold3d.manifold.CrossSection
+import manifold3d.pub.Polygons
+import manifold3d.pub.SimplePolygon
+import org.goodmath.simplex.runtime.SimplexEvaluationError
+import org.goodmath.simplex.runtime.values.primitives.Vec2
+import org.w3c.dom.Element
+import org.w3c.dom.Node
+
+/**
+ * A grayscale image.
+ *
+ * @param width the width in pixels.
+ * @param height the height in pixels.
+ * @param gray the brightness of each pixel, from 0.0 for black to 1.0 for white,
+ *    row by row starting from the top of the image.
+ * @param pixelSize the size of a pixel in millimetres.
+ */
+class Bitmap(val width: Int, val height: Int, val gray: DoubleArray, val pixelSize: Double) {
+    fun at(x: Int, y: Int): Double = gray[y * width + x]
+}
+
+/**
+ * Traces bitmap images into slices, so that logos and hand-drawn outlines can be
+ * extruded.
+ */
+object ImageTracer {
+    /** The pixel size to use when an image doesn't record its resolution: 96 DPI. */
+    const val DEFAULT_PIXEL_SIZE = 25.4 / 96.0
+
+    /**
+     * Read a PNG or PGM image. Other formats that the JDK can read work as well.
+     * Transparent pixels count as white.
+     */
+    fun read(path: Path): Bitmap {
+        if (!path.exists()) {
+            throw SimplexEvaluationError("Image file $path not found")
+        }
+        val bytes = path.readBytes()
+        return try {
+            if (path.extension.lowercase() == "pgm" || isPgm(bytes)) {
+                readPgm(ByteArrayInputStream(bytes))
+            } else {
+                readImage(bytes)
+            }
+        } catch (e: IOException) {
+            throw SimplexEvaluationError("Error reading image $path", cause = e)
+        }
+    }
+
+    private fun isPgm(bytes: ByteArray): Boolean =
+        bytes.size > 2 && bytes[0] == 'P'.code.toByte() &&
+            (bytes[1] == '2'.code.toByte() || bytes[1] == '5'.code.toByte())
+
+    private fun readImage(bytes: ByteArray): Bitmap {
+        val stream = ImageIO.createImageInputStream(ByteArrayInputStream(bytes))
+        val readers = ImageIO.getImageReaders(stream)
+        if (!readers.hasNext()) {
+            throw IOException("Unsupported image format")
+        }
+        val reader = readers.next()
+        try {
+            reader.input = stream
+            val image = reader.read(0)
+            val pixelSize =
+                pixelSizeOf(reader.getImageMetadata(0)?.getAsTree("javax_imageio_1.0"))
+                    ?: DEFAULT_PIXEL_SIZE
+            val gray = DoubleArray(image.width * image.height)
+            for (y in 0 until image.height) {
+                for (x in 0 until image.width) {
+                    val argb = image.getRGB(x, y)
+                    val alpha = ((argb shr 24) and 0xff) / 255.0
+                    val lum =
+                        (0.299 * ((argb shr 16) and 0xff) + 0.587 * ((argb shr 8) and 0xff) +
+                            0.114 * (argb and 0xff)) / 255.0
+                    gray[y * image.width + x] = 1.0 - alpha * (1.0 - lum)
+                }
+            }
+            return Bitmap(image.width, image.height, gray, pixelSize)
+        } finally {
+            reader.dispose()
+        }
+    }
+
+    /**
+     * Find the horizontal pixel size, in millimetres, in the standard image
+     * metadata tree. For a PNG, it's there if the image has a pHYs chunk.
+     */
+    private fun pixelSizeOf(node: Node?): Double? {
+        if (node == null) {
+            return null
+        }
+        if (node is Element && node.nodeName == "HorizontalPixelSize") {
+            return node.getAttribute("value").toDoubleOrNull()?.takeIf { it > 0.0 }
+        }
+        var child = node.firstChild
+        while (child != null) {
+            pixelSizeOf(child)?.let { return it }
+            child = child.nextSibling
+        }
+        return null
+    }
+
+    /** Read a binary (P5) or plain (P2) PGM image. */
+    fun readPgm(input: InputStream): Bitmap {
+        fun token(): String {
+            val result = StringBuilder()
+            while (true) {
+                val c = input.read()
+                when {
+                    c < 0 -> break
+                    c == '#'.code && result.isEmpty() -> {
+                        var d = input.read()
+                        while (d >= 0 && d != '\n'.code) {
+                            d = input.read()
+                        }
+                    }
+                    Character.isWhitespace(c) -> if (result.isNotEmpty()) break
+                    else -> result.append(c.toChar())
+                }
+            }
+            return result.toString()
+        }
+        val magic = token()
+        if (magic != "P5" && magic != "P2") {
+            throw IOException("Not a PGM image")
+        }
+        val width = token().toIntOrNull() ?: throw IOException("Invalid PGM width")
+        val height = token().toIntOrNull() ?: throw IOException("Invalid PGM height")
+        val maxVal = token().toIntOrNull() ?: throw IOException("Invalid PGM maximum value")
+        if (width <= 0 || height <= 0 || maxVal <= 0 || maxVal > 65535) {
+            throw IOException("Invalid PGM header")
+        }
+        val gray = DoubleArray(width * height)
+        for (i in gray.indices) {
+            val v =
+                if (magic == "P2") {
+                    token().toIntOrNull() ?: throw IOException("Invalid PGM pixel value")
+                } else if (maxVal < 256) {
+                    input.read()
+                } else {
+                    val hi = input.read()
+                    val lo = input.read()
+                    if (lo < 0) -1 else (hi shl 8) or lo
+                }
+            if (v < 0) {
+                throw IOException("PGM image is truncated")
+            }
+            gray[i] = v.toDouble() / maxVal
+        }
+        return Bitmap(width, height, gray, DEFAULT_PIXEL_SIZE)
+    }
+
+    /**
+     * Trace the outlines of the pixels that are darker than a threshold. Pixels are
+     * one unit square, with the origin at the bottom left corner of the image. Outer
+     * contours run counter-clockwise and holes run clockwise. Pixels that only touch
+     * at a corner are kept apart.
+     */
+    fun trace(bitmap: Bitmap, threshold: Double): List<List<Vec2>> {
+        val w = bitmap.width
+        val h = bitmap.height
+        // Rows count up from the bottom of the image, so that it stays the right way up.
+        fun inside(x: Int, row: Int): Boolean =
+            x in 0 until w && row in 0 until h && bitmap.at(x, h - 1 - row) < threshold
+
+        // Each boundary edge of the dark region, keyed by its starting corner, with
+        // the dark pixel on its left.
+        val outgoing = HashMap<Long, ArrayList<IntArray>>()
+        fun key(x: Int, y: Int): Long = x.toLong() * (h + 1) + y
+        fun addEdge(x: Int, y: Int, dx: Int, dy: Int) {
+            outgoing.getOrPut(key(x, y)) { ArrayList() }.add(intArrayOf(x, y, dx, dy))
+        }
+        for (row in 0 until h) {
+            for (x in 0 until w) {
+                if (!inside(x, row)) {
+                    continue
+                }
+                if (!inside(x, row - 1)) {
+                    addEdge(x, row, 1, 0)
+                }
+                if (!inside(x + 1, row)) {
+                    addEdge(x + 1, row, 0, 1)
+                }
+                if (!inside(x, row + 1)) {
+                    addEdge(x + 1, row + 1, -1, 0)
+                }
+                if (!inside(x - 1, row)) {
+                    addEdge(x, row + 1, 0, -1)
+                }
+            }
+        }
+
+        val used = HashSet<IntArray>()
+        val contours = ArrayList<List<Vec2>>()
+        for (edges in outgoing.values) {
+            for (start in edges) {
+                if (start in used) {
+                    continue
+                }
+                val corners = ArrayList<Vec2>()
+                var edge = start
+                do {
+                    used.add(edge)
+                    val (x, y, dx, dy) = edge
+                    val candidates = outgoing[key(x + dx, y + dy)]!!
+                    // At a corner where two dark pixels meet diagonally, turn left to
+                    // stay with the pixel on this side.
+                    val next =
+                        if (candidates.size == 1) {
+                            candidates[0]
+                        } else {
+                            candidates.first { it[2] == -dy && it[3] == dx }
+                        }
+                    if (next[2] != dx || next[3] != dy) {
+                        corners.add(Vec2((x + dx).toDouble(), (y + dy).toDouble()))
+                    }
+                    edge = next
+                } while (edge !== start)
+                contours.add(corners)
+            }
+        }
+        return contours
+    }
+
+    /**
+     * Trace an image file into a slice, scaled to millimetres.
+     *
+     * @param path the image file.
+     * @param threshold pixels with a brightness below this, from 0.0 to 1.0, are
+     *    inside the slice.
+     * @param epsilon if positive, the slice is simplified with this tolerance, in
+     *    millimetres, to smooth out the staircase along diagonal edges.
+     */
+    fun traceImage(path: Path, threshold: Double, epsilon: Double): Slice {
+        if (threshold < 0.0 || threshold > 1.0) {
+            throw SimplexEvaluationError("Image threshold must be between 0.0 and 1.0, not $threshold")
+        }
+        val bitmap = read(path)
+        val polys = Polygons()
+        for (contour in trace(bitmap, threshold)) {
+            val points = DoubleArray(contour.size * 2)
+            for ((idx, p) in contour.withIndex()) {
+                points[2 * idx] = p.x * bitmap.pixelSize
+                points[2 * idx + 1] = p.y * bitmap.pixelSize
+            }
+            polys.pushBack(SimplePolygon.FromArray(points))
+        }
+        val slice = Slice(CrossSection(polys, CrossSection.FillRule.Positive.ordinal))
+        return if (epsilon > 0.0) slice.simplify(epsilon) else slice
+    }
+}
@@ -0,0 +1,238 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import org.goodmath.simplex.ast.types.Type
+import org.goodmath.simplex.runtime.Env
+import org.goodmath.simplex.runtime.SimplexEvaluationError
+import org.goodmath.simplex.runtime.values.FunctionSignature
+import org.goodmath.simplex.runtime.values.MethodSignature
+import org.goodmath.simplex.runtime.values.Param
+import org.goodmath.simplex.runtime.values.Value
+import org.goodmath.simplex.runtime.values.ValueType
+import org.goodmath.simplex.runtime.values.primitives.FloatValue
+import org.goodmath.simplex.runtime.values.primitives.FloatValueType
+import org.goodmath.simplex.runtime.values.primitives.PrimitiveFunctionValue
+import org.goodmath.simplex.runtime.values.primitives.PrimitiveMethod
+import org.goodmath.simplex.runtime.values.primitives.StringValue
+import org.goodmath.simplex.runtime.values.primitives.StringValueType
+import org.goodmath.simplex.runtime.values.primitives.Vec3
+import org.goodmath.simplex.runtime.values.primitives.Vec3ValueType
+import org.goodmath.simplex.twist.Twist
+
+/**
+ * A joint between two parts, which lets the child part move relative to the parent
+ * through a range of values.
+ *
+ * The geometry of the joint is given in the coordinates of the assembly when every
+ * joint is at rest; if the parent part is itself moved by a joint, the child
+ * moves with it.
+ *
+ * @param name the name of the joint.
+ * @param parent the name of the parent part.
+ * @param child the name of the child part, which the joint moves.
+ * @param low the lowest value of the joint.
+ * @param high the highest value of the joint.
+ */
+sealed class Joint(
+    val name: String,
+    val parent: String,
+    val child: String,
+    val low: Double,
+    val high: Double,
+) : Value {
+    override val valueType: ValueType = JointValueType
+
+    /** The value of the joint at rest: zero, if it's in range, or else the nearest limit. */
+    val rest: Double
+        get() = 0.0.coerceIn(low, high)
+
+    /** The motion of the child part relative to the parent at a joint value. */
+    abstract fun motion(value: Double): RigidTransform
+
+    abstract val kind: String
+
+    override fun twist(): Twist =
+        Twist.obj(
+            "Joint",
+            Twist.attr("kind", kind),
+            Twist.attr("name", name),
+            Twist.attr("parent", parent),
+            Twist.attr("child", child),
+            Twist.attr("low", low.toString()),
+            Twist.attr("high", high.toString()),
+        )
+}
+
+/**
+ * A joint that rotates the child part about an axis. Its values are angles in degrees,
+ * following the right-hand rule around the axis.
+ */
+class RevoluteJoint(
+    name: String,
+    parent: String,
+    child: String,
+    val origin: Vec3,
+    val axis: Vec3,
+    low: Double,
+    high: Double,
+) : Joint(name, parent, child, low, high) {
+    override val kind: String = "revolute"
+
+    override fun motion(value: Double): RigidTransform = RigidTransform.rotation(origin, axis, value)
+}
+
+/** A joint that slides the child part along a direction. Its values are distances. */
+class PrismaticJoint(
+    name: String,
+    parent: String,
+    child: String,
+    val direction: Vec3,
+    low: Double,
+    high: Double,
+) : Joint(name, parent, child, low, high) {
+    override val kind: String = "prismatic"
+
+    private val unit = direction / direction.magnitude()
+
+    override fun motion(value: Double): RigidTransform = RigidTransform.translation(unit * value)
+}
+
+object JointValueType : ValueType() {
+    override val name: String = "Joint"
+
+    override val asType: Type by lazy { Type.simple(name) }
+
+    override val supportsText: Boolean = true
+
+    override fun toText(v: Value): String {
+        val j = assertIs(v)
+        return "${j.kind} joint ${j.name} (${j.parent} -> ${j.child}, ${j.low} to ${j.high})"
+    }
+
+    override fun isTruthy(v: Value): Boolean = true
+
+    private fun checkRange(name: String, low: Double, high: Double) {
+        if (low > high) {
+            throw SimplexEvaluationError("Joint $name has low limit $low greater than its high limit $high")
+        }
+    }
+
+    private fun checkDirection(name: String, param: String, v: Vec3) {
+        if (v.magnitude() == 0.0) {
+            throw SimplexEvaluationError("The $param of joint $name must not be a zero vector")
+        }
+    }
+
+    override val providesFunctions: List<PrimitiveFunctionValue> by lazy {
+        listOf(
+            object :
+                PrimitiveFunctionValue(
+                    "revolute",
+                    FunctionSignature.simple(
+                        listOf(
+                            Param("name", StringValueType.asType),
+                            Param("parent", PartValueType.asType),
+                            Param("child", PartValueType.asType),
+                            Param("origin", Vec3ValueType.asType),
+                            Param("axis", Vec3ValueType.asType),
+                            Param("low", FloatValueType.asType),
+                            Param("high", FloatValueType.asType),
+                        ),
+                        asType,
+                    ),
+                ) {
+                override fun execute(args: List<Value>): Value {
+                    val name = assertIsString(args[0])
+                    val parent = PartValueType.assertIs(args[1])
+                    val child = PartValueType.assertIs(args[2])
+                    val origin = Vec3ValueType.assertIs(args[3])
+                    val axis = Vec3ValueType.assertIs(args[4])
+                    val low = assertIsFloat(args[5])
+                    val high = assertIsFloat(args[6])
+                    checkDirection(name, "axis", axis)
+                    checkRange(name, low, high)
+                    return RevoluteJoint(name, parent.name, child.name, origin, axis, low, high)
+                }
+            },
+            object :
+                PrimitiveFunctionValue(
+                    "prismatic",
+                    FunctionSignature.simple(
+                        listOf(
+                            Param("name", StringValueType.asType),
+                            Param("parent", PartValueType.asType),
+                            Param("child", PartValueType.asType),
+                            Param("direction", Vec3ValueType.asType),
+                            Param("low", FloatValueType.asType),
+                            Param("high", FloatValueType.asType),
+                        ),
+                        asType,
+                    ),
+                ) {
+                override fun execute(args: List<Value>): Value {
+                    val name = assertIsString(args[0])
+                    val parent = PartValueType.assertIs(args[1])
+                    val child = PartValueType.assertIs(args[2])
+                    val direction = Vec3ValueType.assertIs(args[3])
+                    val low = assertIsFloat(args[4])
+                    val high = assertIsFloat(args[5])
+                    checkDirection(name, "direction", direction)
+                    checkRange(name, low, high)
+                    return PrismaticJoint(name, parent.name, child.name, direction, low, high)
+                }
+            },
+        )
+    }
+
+    override val providesPrimitiveMethods: List<PrimitiveMethod> by lazy {
+        listOf(
+            object :
+                PrimitiveMethod(
+                    "name",
+                    MethodSignature.simple(asType, emptyList<Param>(), StringValueType.asType),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    return StringValue(assertIs(target).name)
+                }
+            },
+            object :
+                PrimitiveMethod(
+                    "low",
+                    MethodSignature.simple(asType, emptyList<Param>(), FloatValueType.asType),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    return FloatValue(assertIs(target).low)
+                }
+            },
+            object :
+                PrimitiveMethod(
+                    "high",
+                    MethodSignature.simple(asType, emptyList<Param>(), FloatValueType.asType),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    return FloatValue(assertIs(target).high)
+                }
+            },
+        )
+    }
+
+    override val providesVariables: Map<String, Value> = emptyMap()
+
+    override fun assertIs(v: Value): Joint {
+        return v as? Joint ?: throwTypeError(v)
+    }
+}
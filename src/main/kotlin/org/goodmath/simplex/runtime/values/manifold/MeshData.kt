@@ -0,0 +1,67 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import manifold3d.manifold.MeshGL
+
+/**
+ * The triangles of a solid as plain arrays: the form that viewers and file
+ * writers want, as opposed to manifold's native mesh.
+ *
+ * @param vertices the coordinates of the vertices, as consecutive x, y, z triples.
+ * @param triangles the indices of the vertices of each triangle, as consecutive
+ *    triples in counter-clockwise order when viewed from outside the solid.
+ */
+class MeshData(val vertices: DoubleArray, val triangles: IntArray) {
+    val vertexCount: Int
+        get() = vertices.size / 3
+
+    val triangleCount: Int
+        get() = triangles.size / 3
+
+    fun vertex(i: Int): Vec3Coords =
+        Vec3Coords(vertices[3 * i], vertices[3 * i + 1], vertices[3 * i + 2])
+
+    /** A vertex position, without the overhead of a runtime Vec3 value. */
+    data class Vec3Coords(val x: Double, val y: Double, val z: Double)
+
+    companion object {
+        fun of(solid: Solid): MeshData = of(solid.manifold.mesh)
+
+        /**
+         * Extract the vertex positions and triangles from a manifold mesh. The mesh may
+         * carry extra per-vertex properties beyond the position; only the first three
+         * are used.
+         */
+        fun of(mesh: MeshGL): MeshData {
+            val numProp = mesh.numProp()
+            val props = mesh.vertProperties()
+            val numVert = mesh.NumVert()
+            val vertices = DoubleArray(numVert * 3)
+            for (v in 0 until numVert) {
+                for (c in 0 until 3) {
+                    vertices[3 * v + c] = props.get((v * numProp + c).toLong()).toDouble()
+                }
+            }
+            val tris = mesh.triVerts()
+            val triangles = IntArray(tris.size().toInt())
+            for (i in triangles.indices) {
+                triangles[i] = tris.get(i.toLong()).toInt()
+            }
+            return MeshData(vertices, triangles)
+        }
+    }
+}
@@ -0,0 +1,185 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import java.awt.image.BufferedImage
+import java.io.File
+import javax.imageio.ImageIO
+import kotlin.math.abs
+import kotlin.math.ceil
+import kotlin.math.floor
+import kotlin.math.max
+import kotlin.math.min
+import kotlin.math.sqrt
+
+/**
+ * A simple software renderer for meshes, which draws a shaded orthographic view
+ * from above and in front of the model, looking along (-1, 1, -1). It doesn't need
+ * a display or a GPU, so it works in headless environments like CI.
+ *
+ * The view is fixed when the renderer is created, so that a sequence of frames
+ * rendered with the same renderer line up with each other.
+ *
+ * @param width the width of the image, in pixels.
+ * @param height the height of the image, in pixels.
+ * @param center the point in the model that appears in the center of the image.
+ * @param radius the radius around the center that should fit in the image.
+ */
+class MeshRenderer(
+    val width: Int,
+    val height: Int,
+    val center: MeshData.Vec3Coords,
+    val radius: Double,
+) {
+    private val forward = normalize(doubleArrayOf(-1.0, 1.0, -1.0))
+    private val right = normalize(cross(forward, doubleArrayOf(0.0, 0.0, 1.0)))
+    private val up = cross(right, forward)
+    private val light = normalize(doubleArrayOf(-0.5, 1.0, -1.5))
+    private val scale = min(width, height) / (2.2 * max(radius, 1e-6))
+
+    fun render(mesh: MeshData): BufferedImage {
+        val image = BufferedImage(width, height, BufferedImage.TYPE_INT_RGB)
+        val depth = DoubleArray(width * height) { Double.POSITIVE_INFINITY }
+        for (i in 0 until width * height) {
+            image.setRGB(i % width, i / width, BACKGROUND)
+        }
+        val sx = DoubleArray(mesh.vertexCount)
+        val sy = DoubleArray(mesh.vertexCount)
+        val sz = DoubleArray(mesh.vertexCount)
+        for (v in 0 until mesh.vertexCount) {
+            val p = mesh.vertex(v)
+            val rel = doubleArrayOf(p.x - center.x, p.y - center.y, p.z - center.z)
+            sx[v] = width / 2.0 + dot(rel, right) * scale
+            sy[v] = height / 2.0 - dot(rel, up) * scale
+            sz[v] = dot(rel, forward)
+        }
+        for (t in 0 until mesh.triangleCount) {
+            val a = mesh.triangles[3 * t]
+            val b = mesh.triangles[3 * t + 1]
+            val c = mesh.triangles[3 * t + 2]
+            val pa = mesh.vertex(a)
+            val pb = mesh.vertex(b)
+            val pc = mesh.vertex(c)
+            val normal =
+                normalize(
+                    cross(
+                        doubleArrayOf(pb.x - pa.x, pb.y - pa.y, pb.z - pa.z),
+                        doubleArrayOf(pc.x - pa.x, pc.y - pa.y, pc.z - pa.z),
+                    )
+                )
+            // Skip triangles that face away from the camera.
+            if (dot(normal, forward) >= 0.0) {
+                continue
+            }
+            val brightness = 0.3 + 0.7 * max(0.0, -dot(normal, light))
+            fillTriangle(
+                image, depth,
+                sx[a], sy[a], sz[a], sx[b], sy[b], sz[b], sx[c], sy[c], sz[c],
+                shade(brightness),
+            )
+        }
+        return image
+    }
+
+    fun writePng(mesh: MeshData, path: String) {
+        ImageIO.write(render(mesh), "png", File(path))
+    }
+
+    private fun fillTriangle(
+        image: BufferedImage,
+        depth: DoubleArray,
+        x0: Double, y0: Double, z0: Double,
+        x1: Double, y1: Double, z1: Double,
+        x2: Double, y2: Double, z2: Double,
+        color: Int,
+    ) {
+        val area = (x1 - x0) * (y2 - y0) - (x2 - x0) * (y1 - y0)
+        if (abs(area) < 1e-12) {
+            return
+        }
+        val minX = max(0, floor(min(x0, min(x1, x2))).toInt())
+        val maxX = min(width - 1, ceil(max(x0, max(x1, x2))).toInt())
+        val minY = max(0, floor(min(y0, min(y1, y2))).toInt())
+        val maxY = min(height - 1, ceil(max(y0, max(y1, y2))).toInt())
+        for (py in minY..maxY) {
+            for (px in minX..maxX) {
+                val x = px + 0.5
+                val y = py + 0.5
+                val w0 = ((x1 - x) * (y2 - y) - (x2 - x) * (y1 - y)) / area
+                val w1 = ((x2 - x) * (y0 - y) - (x0 - x) * (y2 - y)) / area
+                val w2 = 1.0 - w0 - w1
+                if (w0 < 0.0 || w1 < 0.0 || w2 < 0.0) {
+                    continue
+                }
+                val z = w0 * z0 + w1 * z1 + w2 * z2
+                val idx = py * width + px
+                if (z < depth[idx]) {
+                    depth[idx] = z
+                    image.setRGB(px, py, color)
+                }
+            }
+        }
+    }
+
+    companion object {
+        const val BACKGROUND = 0xf4f4f4
+        private const val RED = 0x88
+        private const val GREEN = 0x99
+        private const val BLUE = 0xaa
+
+        /** Create a renderer whose view fits the whole of a mesh. */
+        fun framing(mesh: MeshData, width: Int, height: Int): MeshRenderer {
+            if (mesh.vertexCount == 0) {
+                return MeshRenderer(width, height, MeshData.Vec3Coords(0.0, 0.0, 0.0), 1.0)
+            }
+            val xs = (0 until mesh.vertexCount).map { mesh.vertex(it).x }
+            val ys = (0 until mesh.vertexCount).map { mesh.vertex(it).y }
+            val zs = (0 until mesh.vertexCount).map { mesh.vertex(it).z }
+            val center =
+                MeshData.Vec3Coords(
+                    (xs.min() + xs.max()) / 2.0,
+                    (ys.min() + ys.max()) / 2.0,
+                    (zs.min() + zs.max()) / 2.0,
+                )
+            val dx = xs.max() - xs.min()
+            val dy = ys.max() - ys.min()
+            val dz = zs.max() - zs.min()
+            return MeshRenderer(width, height, center, sqrt(dx * dx + dy * dy + dz * dz) / 2.0)
+        }
+
+        private fun shade(brightness: Double): Int {
+            val r = (RED * brightness).toInt().coerceIn(0, 255)
+            val g = (GREEN * brightness).toInt().coerceIn(0, 255)
+            val b = (BLUE * brightness).toInt().coerceIn(0, 255)
+            return (r shl 16) or (g shl 8) or b
+        }
+
+        private fun dot(a: DoubleArray, b: DoubleArray): Double =
+            a[0] * b[0] + a[1] * b[1] + a[2] * b[2]
+
+        private fun cross(a: DoubleArray, b: DoubleArray): DoubleArray =
+            doubleArrayOf(
+                a[1] * b[2] - a[2] * b[1],
+                a[2] * b[0] - a[0] * b[2],
+                a[0] * b[1] - a[1] * b[0],
+            )
+
+        private fun normalize(v: DoubleArray): DoubleArray {
+            val len = sqrt(dot(v, v))
+            return if (len == 0.0) v else doubleArrayOf(v[0] / len, v[1] / len, v[2] / len)
+        }
+    }
+}
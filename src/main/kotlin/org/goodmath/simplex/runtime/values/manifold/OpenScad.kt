@@ -0,0 +1,175 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import kotlin.math.abs
+import kotlin.math.ceil
+import kotlin.math.hypot
+import kotlin.math.max
+import kotlin.math.min
+import kotlin.math.sin
+import manifold3d.Manifold
+import manifold3d.manifold.CrossSection
+import manifold3d.manifold.CrossSection.FillRule
+import manifold3d.pub.SimplePolygon
+import org.goodmath.simplex.runtime.values.primitives.PrimitiveFunctionValue
+import org.goodmath.simplex.runtime.values.primitives.Vec2
+import org.goodmath.simplex.runtime.values.primitives.Vec3
+
+/**
+ * Primitives that build exactly the same meshes as OpenSCAD's: the same number of
+ * fragments, the same vertex positions, and the same placement. These back the
+ * compatibility library `openscad.s3d`.
+ *
+ * Where OpenSCAD uses `$fn`, these take an Int `fn`; if it's 0, the number of
+ * fragments is computed from OpenSCAD's default `$fa` and `$fs`.
+ */
+object OpenScad {
+    const val DEFAULT_FA = 12.0
+    const val DEFAULT_FS = 2.0
+
+    /**
+     * The builtin functions that `openscad.s3d` wraps, like `scad_sphere`. They're only
+     * installed in the scope of the library, so models have to call them through it.
+     */
+    val builtins: List<PrimitiveFunctionValue> by lazy {
+        SolidValueType.scadFunctions + SliceValueType.scadFunctions
+    }
+
+    /** OpenSCAD's smallest meaningful radius; anything smaller gets 3 fragments. */
+    private const val GRID_FINE = 0.00000095367431640625
+
+    /** The number of fragments in a circle of radius [r], using OpenSCAD's rule. */
+    fun fragments(r: Double, fn: Int, fs: Double = DEFAULT_FS, fa: Double = DEFAULT_FA): Int =
+        when {
+            r < GRID_FINE -> 3
+            fn > 0 -> max(fn, 3)
+            else -> ceil(max(min(360.0 / fa, r * 2 * Math.PI / fs), 5.0)).toInt()
+        }
+
+    /**
+     * The sine of an angle in degrees. Like OpenSCAD, this is exact for multiples of
+     * 30 degrees, so that axis-aligned vertices land exactly on the axes.
+     */
+    fun sinDegrees(degrees: Double): Double {
+        var d = degrees % 360.0
+        if (d < 0.0) {
+            d += 360.0
+        }
+        return when (d) {
+            0.0, 180.0 -> 0.0
+            30.0, 150.0 -> 0.5
+            90.0 -> 1.0
+            210.0, 330.0 -> -0.5
+            270.0 -> -1.0
+            else -> sin(Math.toRadians(d))
+        }
+    }
+
+    fun cosDegrees(degrees: Double): Double = sinDegrees(degrees + 90.0)
+
+    /** The vertices of a circle, counterclockwise from the +x axis. */
+    fun circlePoints(r: Double, fragments: Int): List<Vec2> =
+        (0 until fragments).map { i ->
+            val phi = 360.0 * i / fragments
+            Vec2(r * cosDegrees(phi), r * sinDegrees(phi))
+        }
+
+    /**
+     * The vertices of a sphere. OpenSCAD builds a sphere from rings of points; the
+     * rings are offset by half a step from the poles, so there's no vertex at either pole.
+     */
+    fun spherePoints(r: Double, fn: Int): List<Vec3> {
+        val n = fragments(r, fn)
+        val rings = (n + 1) / 2
+        return (0 until rings).flatMap { i ->
+            val phi = 180.0 * (i + 0.5) / rings
+            val z = r * cosDegrees(phi)
+            circlePoints(r * sinDegrees(phi), n).map { Vec3(it.x, it.y, z) }
+        }
+    }
+
+    /** The vertices of a cylinder or cone. A radius of 0 contributes a single point. */
+    fun cylinderPoints(h: Double, r1: Double, r2: Double, center: Boolean, fn: Int): List<Vec3> {
+        val n = fragments(max(r1, r2), fn)
+        val z1 = if (center) -h / 2.0 else 0.0
+        val z2 = if (center) h / 2.0 else h
+        fun ring(r: Double, z: Double): List<Vec3> =
+            if (r <= 0.0) {
+                listOf(Vec3(0.0, 0.0, z))
+            } else {
+                circlePoints(r, n).map { Vec3(it.x, it.y, z) }
+            }
+        return ring(r1, z1) + ring(r2, z2)
+    }
+
+    fun circle(r: Double, fn: Int): Slice {
+        val points = circlePoints(r, fragments(r, fn))
+        val coords = points.flatMap { listOf(it.x, it.y) }.toDoubleArray()
+        return Slice(CrossSection(SimplePolygon.FromArray(coords), FillRule.Positive.ordinal))
+    }
+
+    // Spheres and cylinders are convex, so their hulls are exactly the OpenSCAD meshes.
+    fun sphere(r: Double, fn: Int): Solid = Solid.hullPoints(spherePoints(r, fn))
+
+    fun cylinder(h: Double, r1: Double, r2: Double, center: Boolean, fn: Int): Solid =
+        Solid.hullPoints(cylinderPoints(h, r1, r2, center, fn))
+
+    /**
+     * Extrude a slice like OpenSCAD's `linear_extrude`. A positive twist turns the
+     * top clockwise, looking down from above. If [slices] is 0, the number of slices
+     * is computed from the twist and the size of the slice.
+     */
+    fun linearExtrude(
+        slice: Slice,
+        height: Double,
+        center: Boolean,
+        twist: Double,
+        slices: Int,
+        scale: Vec2,
+        fn: Int,
+    ): Solid {
+        val count =
+            when {
+                slices > 0 -> slices
+                twist == 0.0 -> 1
+                else -> {
+                    val r = slice.toPoints().maxOfOrNull { hypot(it.x, it.y) } ?: 0.0
+                    max(1, ceil(fragments(r, fn) * abs(twist) / 360.0).toInt())
+                }
+            }
+        val solid =
+            Solid(
+                Manifold.Extrude(
+                    slice.cross.toPolygons(),
+                    height.toFloat(),
+                    count - 1,
+                    (-twist).toFloat(),
+                    scale.toDoubleVec2(),
+                )
+            )
+        return if (center) solid.move(0.0, 0.0, -height / 2.0) else solid
+    }
+
+    /**
+     * Revolve a slice around the z axis like OpenSCAD's `rotate_extrude`. The number of
+     * fragments comes from the largest x coordinate of the slice.
+     */
+    fun rotateExtrude(slice: Slice, angle: Double, fn: Int): Solid {
+        val maxX = slice.toPoints().maxOfOrNull { it.x } ?: 0.0
+        return slice.revolve(fragments(maxX, fn), angle.toFloat())
+    }
+}
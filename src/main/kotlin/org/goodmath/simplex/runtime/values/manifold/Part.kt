@@ -0,0 +1,134 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import org.goodmath.simplex.ast.types.Type
+import org.goodmath.simplex.runtime.Env
+import org.goodmath.simplex.runtime.values.FunctionSignature
+import org.goodmath.simplex.runtime.values.MethodSignature
+import org.goodmath.simplex.runtime.values.Param
+import org.goodmath.simplex.runtime.values.Value
+import org.goodmath.simplex.runtime.values.ValueType
+import org.goodmath.simplex.runtime.values.primitives.PrimitiveFunctionValue
+import org.goodmath.simplex.runtime.values.primitives.PrimitiveMethod
+import org.goodmath.simplex.runtime.values.primitives.StringValue
+import org.goodmath.simplex.runtime.values.primitives.StringValueType
+import org.goodmath.simplex.runtime.values.primitives.Vec3ValueType
+import org.goodmath.simplex.twist.Twist
+
+/**
+ * A named solid, placed in the coordinate system of an assembly. Joints connect
+ * parts, and refer to them by name.
+ */
+class Part(val name: String, val solid: Solid) : Value {
+    override val valueType: ValueType = PartValueType
+
+    override fun twist(): Twist =
+        Twist.obj("Part", Twist.attr("name", name), Twist.value("solid", solid))
+}
+
+object PartValueType : ValueType() {
+    override val name: String = "Part"
+
+    override val asType: Type by lazy { Type.simple(name) }
+
+    override val supportsText: Boolean = true
+
+    override fun toText(v: Value): String = "Part(${assertIs(v).name})"
+
+    override fun isTruthy(v: Value): Boolean = true
+
+    override val providesFunctions: List<PrimitiveFunctionValue> by lazy {
+        listOf(
+            object :
+                PrimitiveFunctionValue(
+                    "part",
+                    FunctionSignature.simple(
+                        listOf(
+                            Param("name", StringValueType.asType),
+                            Param("solid", SolidValueType.asType),
+                        ),
+                        asType,
+                    ),
+                ) {
+                override fun execute(args: List<Value>): Value {
+                    val name = assertIsString(args[0])
+                    val solid = SolidValueType.assertIs(args[1])
+                    return Part(name, solid)
+                }
+            }
+        )
+    }
+
+    override val providesPrimitiveMethods: List<PrimitiveMethod> by lazy {
+        listOf(
+            object :
+                PrimitiveMethod(
+                    "name",
+                    MethodSignature.simple(asType, emptyList<Param>(), StringValueType.asType),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    return StringValue(assertIs(target).name)
+                }
+            },
+            object :
+                PrimitiveMethod(
+                    "solid",
+                    MethodSignature.simple(asType, emptyList<Param>(), SolidValueType.asType),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    return assertIs(target).solid
+                }
+            },
+            object :
+                PrimitiveMethod(
+                    "move",
+                    MethodSignature.simple(
+                        asType,
+                        listOf(Param("offset", Vec3ValueType.asType)),
+                        asType,
+                    ),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    val self = assertIs(target)
+                    val offset = Vec3ValueType.assertIs(args[0])
+                    return Part(self.name, self.solid.move(offset))
+                }
+            },
+            object :
+                PrimitiveMethod(
+                    "rotate",
+                    MethodSignature.simple(
+                        asType,
+                        listOf(Param("angles", Vec3ValueType.asType)),
+                        asType,
+                    ),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    val self = assertIs(target)
+                    val angles = Vec3ValueType.assertIs(args[0])
+                    return Part(self.name, self.solid.rotate(angles))
+                }
+            },
+        )
+    }
+
+    override val providesVariables: Map<String, Value> = emptyMap()
+
+    override fun assertIs(v: Value): Part {
+        return v as? Part ?: throwTypeError(v)
+    }
+}
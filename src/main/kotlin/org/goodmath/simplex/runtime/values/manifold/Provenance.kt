@@ -0,0 +1,120 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import kotlinx.serialization.json.JsonObject
+import kotlinx.serialization.json.addJsonObject
+import kotlinx.serialization.json.buildJsonObject
+import kotlinx.serialization.json.put
+import kotlinx.serialization.json.putJsonArray
+import org.goodmath.simplex.ast.Location
+import org.goodmath.simplex.runtime.values.Value
+
+/**
+ * Tracks where the faces of solids came from.
+ *
+ * Manifold gives each newly created mesh an original ID, and keeps track of which
+ * triangles came from which original meshes through transformations and boolean
+ * operations. Each time a call in a model creates a new solid, we record the
+ * location of the call against the solid's original ID; the triangles of any solid
+ * built from it can then be traced back to that call.
+ *
+ * Solids that are the result of a boolean operation aren't originals, so they aren't
+ * tagged; and a solid that's already tagged keeps its original location.
+ */
+object Provenance {
+    private val sources = HashMap<Int, Location>()
+
+    /**
+     * A run of consecutive triangles in a solid's mesh that came from one original mesh.
+     *
+     * @param first the index of the first triangle in the run.
+     * @param end the index just past the last triangle in the run.
+     * @param originalId the original ID of the mesh that the triangles came from.
+     * @param source the location of the call that created that mesh, if it's known.
+     */
+    data class Run(val first: Int, val end: Int, val originalId: Int, val source: Location?)
+
+    /** Record the location of the call that produced a value, if it's a new solid. */
+    fun tag(value: Value, loc: Location): Value {
+        if (value is Solid) {
+            val id = value.manifold.originalID()
+            if (id >= 0) {
+                synchronized(sources) { sources.putIfAbsent(id, loc) }
+            }
+        }
+        return value
+    }
+
+    fun sourceOf(originalId: Int): Location? = synchronized(sources) { sources[originalId] }
+
+    fun reset() {
+        synchronized(sources) { sources.clear() }
+    }
+
+    /** Get the runs of triangles in a solid's mesh, in order. */
+    fun runs(solid: Solid): List<Run> {
+        val mesh = solid.manifold.mesh
+        val runIndex = mesh.runIndex()
+        val runOriginalId = mesh.runOriginalID()
+        return (0 until runOriginalId.size().toInt()).map { r ->
+            val id = runOriginalId.get(r.toLong()).toInt()
+            Run(
+                (runIndex.get(r.toLong()) / 3).toInt(),
+                (runIndex.get(r.toLong() + 1) / 3).toInt(),
+                id,
+                sourceOf(id),
+            )
+        }
+    }
+
+    /**
+     * The indices of the triangles of a solid that were created by a call on a line of a
+     * source file. A model and the libraries that it imports each have their own line
+     * numbers, so the file has to match as well as the line.
+     */
+    fun facesFrom(solid: Solid, file: String, line: Int): List<Int> =
+        runs(solid)
+            .filter { it.source?.file == file && it.source.line == line }
+            .flatMap { it.first until it.end }
+
+    /** The indices of the triangles of a solid that came from another solid. */
+    fun facesFrom(solid: Solid, source: Solid): List<Int> {
+        val ids = runs(source).map { it.originalId }.toSet()
+        return runs(solid).filter { it.originalId in ids }.flatMap { it.first until it.end }
+    }
+
+    /**
+     * Describe where the triangles of a solid came from, as a JSON object with a list of
+     * runs of triangles. This is written next to a rendered model, so that preview tools
+     * can map a triangle back to the source line that created it.
+     */
+    fun toJson(solid: Solid): JsonObject = buildJsonObject {
+        putJsonArray("runs") {
+            for (run in runs(solid)) {
+                addJsonObject {
+                    put("first", run.first)
+                    put("end", run.end)
+                    if (run.source != null) {
+                        put("file", run.source.file)
+                        put("line", run.source.line)
+                        put("col", run.source.col)
+                    }
+                }
+            }
+        }
+    }
+}
@@ -0,0 +1,449 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import kotlin.math.abs
+import org.goodmath.simplex.runtime.SimplexEvaluationError
+
+/**
+ * A QR code symbol, as specified by ISO/IEC 18004. Use [QrCode.encode] to create one.
+ *
+ * @param version the symbol version, from 1 to 40, which determines its size.
+ * @param ecc the error correction level.
+ * @param mask the mask pattern that was applied to the data, from 0 to 7.
+ * @param modules the modules of the symbol, row by row from the top; true is dark.
+ */
+class QrCode private constructor(
+    val version: Int,
+    val ecc: Ecc,
+    val mask: Int,
+    private val modules: Array<BooleanArray>,
+) {
+    /** The error correction levels, with the bits that identify them in the format information. */
+    enum class Ecc(val formatBits: Int) {
+        L(1),
+        M(0),
+        Q(3),
+        H(2),
+    }
+
+    val size: Int
+        get() = modules.size
+
+    fun isDark(x: Int, y: Int): Boolean = modules[y][x]
+
+    /**
+     * Convert the symbol to a slice, with a square for each dark module. The bottom
+     * left corner of the symbol is at the origin. The quiet zone - the light border
+     * of four modules that a reader needs around the symbol - isn't included.
+     */
+    fun toSlice(moduleSize: Double): Slice {
+        val boxes = ArrayList<DoubleArray>()
+        for (y in 0 until size) {
+            val bottom = (size - 1 - y) * moduleSize
+            var x = 0
+            while (x < size) {
+                if (!modules[y][x]) {
+                    x++
+                    continue
+                }
+                val start = x
+                while (x < size && modules[y][x]) {
+                    x++
+                }
+                boxes.add(doubleArrayOf(start * moduleSize, bottom, x * moduleSize, bottom + moduleSize))
+            }
+        }
+        return Slice.fromBoxes(boxes)
+    }
+
+    /** Draws the function patterns and data of a symbol of one version. */
+    private class Builder(val version: Int, val ecc: Ecc) {
+        val size = version * 4 + 17
+        val modules = Array(size) { BooleanArray(size) }
+        val isFunction = Array(size) { BooleanArray(size) }
+
+        fun setFunction(x: Int, y: Int, dark: Boolean) {
+            modules[y][x] = dark
+            isFunction[y][x] = true
+        }
+
+        fun drawFunctionPatterns() {
+            for (i in 0 until size) {
+                setFunction(6, i, i % 2 == 0)
+                setFunction(i, 6, i % 2 == 0)
+            }
+            drawFinder(3, 3)
+            drawFinder(size - 4, 3)
+            drawFinder(3, size - 4)
+            val positions = alignmentPositions(version)
+            val last = positions.size - 1
+            for (i in positions.indices) {
+                for (j in positions.indices) {
+                    // The corners that would overlap the finder patterns are skipped.
+                    if ((i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0)) {
+                        continue
+                    }
+                    for (dy in -2..2) {
+                        for (dx in -2..2) {
+                            setFunction(positions[i] + dx, positions[j] + dy, maxOf(abs(dx), abs(dy)) != 1)
+                        }
+                    }
+                }
+            }
+            // Reserve the format information areas; the real bits are drawn once the
+            // mask is chosen.
+            drawFormatBits(0)
+            if (version >= 7) {
+                val bits = versionBits(version)
+                for (i in 0 until 18) {
+                    val dark = (bits shr i) and 1 != 0
+                    val a = size - 11 + i % 3
+                    val b = i / 3
+                    setFunction(a, b, dark)
+                    setFunction(b, a, dark)
+                }
+            }
+        }
+
+        private fun drawFinder(cx: Int, cy: Int) {
+            for (dy in -4..4) {
+                for (dx in -4..4) {
+                    val x = cx + dx
+                    val y = cy + dy
+                    if (x in 0 until size && y in 0 until size) {
+                        val dist = maxOf(abs(dx), abs(dy))
+                        setFunction(x, y, dist != 2 && dist != 4)
+                    }
+                }
+            }
+        }
+
+        fun drawFormatBits(mask: Int) {
+            val bits = formatBits(ecc, mask)
+            fun bit(i: Int): Boolean = (bits shr i) and 1 != 0
+            for (i in 0..5) {
+                setFunction(8, i, bit(i))
+            }
+            setFunction(8, 7, bit(6))
+            setFunction(8, 8, bit(7))
+            setFunction(7, 8, bit(8))
+            for (i in 9 until 15) {
+                setFunction(14 - i, 8, bit(i))
+            }
+            for (i in 0 until 8) {
+                setFunction(size - 1 - i, 8, bit(i))
+            }
+            for (i in 8 until 15) {
+                setFunction(8, size - 15 + i, bit(i))
+            }
+            setFunction(8, size - 8, true)
+        }
+
+        /** Place the codewords in the zigzag order, two columns at a time from the right. */
+        fun drawCodewords(data: IntArray) {
+            var i = 0
+            var right = size - 1
+            while (right >= 1) {
+                if (right == 6) {
+                    right = 5
+                }
+                for (vert in 0 until size) {
+                    for (j in 0 until 2) {
+                        val x = right - j
+                        val upward = ((right + 1) and 2) == 0
+                        val y = if (upward) size - 1 - vert else vert
+                        if (!isFunction[y][x] && i < data.size * 8) {
+                            modules[y][x] = (data[i shr 3] shr (7 - (i and 7))) and 1 != 0
+                            i++
+                        }
+                    }
+                }
+                right -= 2
+            }
+        }
+
+        /** Apply a mask pattern; applying the same mask again undoes it. */
+        fun applyMask(mask: Int) {
+            for (y in 0 until size) {
+                for (x in 0 until size) {
+                    val invert =
+                        when (mask) {
+                            0 -> (x + y) % 2 == 0
+                            1 -> y % 2 == 0
+                            2 -> x % 3 == 0
+                            3 -> (x + y) % 3 == 0
+                            4 -> (x / 3 + y / 2) % 2 == 0
+                            5 -> x * y % 2 + x * y % 3 == 0
+                            6 -> (x * y % 2 + x * y % 3) % 2 == 0
+                            else -> ((x + y) % 2 + x * y % 3) % 2 == 0
+                        }
+                    if (invert && !isFunction[y][x]) {
+                        modules[y][x] = !modules[y][x]
+                    }
+                }
+            }
+        }
+
+        /**
+         * Score the symbol using the penalty rules from the specification: lower is
+         * better, and the mask with the lowest score is used.
+         */
+        fun penalty(): Int {
+            var result = 0
+            val finderLike = listOf(
+                listOf(true, false, true, true, true, false, true, false, false, false, false),
+                listOf(false, false, false, false, true, false, true, true, true, false, true),
+            )
+            for (line in 0 until 2) {
+                for (a in 0 until size) {
+                    fun at(b: Int): Boolean = if (line == 0) modules[a][b] else modules[b][a]
+                    var run = 1
+                    for (b in 1 until size) {
+                        if (at(b) == at(b - 1)) {
+                            run++
+                            if (run == 5) {
+                                result += 3
+                            } else if (run > 5) {
+                                result++
+                            }
+                        } else {
+                            run = 1
+                        }
+                    }
+                    for (b in 0..size - 11) {
+                        if (finderLike.any { pattern -> pattern.indices.all { at(b + it) == pattern[it] } }) {
+                            result += 40
+                        }
+                    }
+                }
+            }
+            for (y in 0 until size - 1) {
+                for (x in 0 until size - 1) {
+                    val c = modules[y][x]
+                    if (c == modules[y][x + 1] && c == modules[y + 1][x] && c == modules[y + 1][x + 1]) {
+                        result += 3
+                    }
+                }
+            }
+            val dark = modules.sumOf { row -> row.count { it } }
+            val percent = dark * 100 / (size * size)
+            result += abs(percent - 50) / 5 * 10
+            return result
+        }
+    }
+
+    companion object {
+        private val ECC_CODEWORDS_PER_BLOCK =
+            arrayOf(
+                intArrayOf(-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28,
+                    28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30),
+                intArrayOf(-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26,
+                    26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28),
+                intArrayOf(-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30,
+                    28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30),
+                intArrayOf(-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28,
+                    30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30),
+            )
+
+        private val NUM_ERROR_CORRECTION_BLOCKS =
+            arrayOf(
+                intArrayOf(-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8,
+                    8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25),
+                intArrayOf(-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16,
+                    17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49),
+                intArrayOf(-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20,
+                    23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68),
+                intArrayOf(-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25,
+                    25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81),
+            )
+
+        /** Parse an error correction level name: "L", "M", "Q", or "H". */
+        fun eccOf(name: String): Ecc =
+            Ecc.entries.firstOrNull { it.name.equals(name, ignoreCase = true) }
+                ?: throw SimplexEvaluationError("Invalid QR error correction level '$name'; expected L, M, Q, or H")
+
+        /** Encode a string, as UTF-8 bytes, in the smallest symbol that will hold it. */
+        fun encode(data: String, ecc: Ecc): QrCode {
+            val bytes = data.toByteArray(Charsets.UTF_8)
+            val version =
+                (1..40).firstOrNull { v -> 4 + countBits(v) + bytes.size * 8 <= dataCodewords(v, ecc) * 8 }
+                    ?: throw SimplexEvaluationError("Data is too long for a QR code: ${bytes.size} bytes")
+
+            // Byte mode segment, terminator, and padding.
+            val bits = ArrayList<Boolean>()
+            fun append(value: Int, count: Int) {
+                for (i in count - 1 downTo 0) {
+                    bits.add((value shr i) and 1 != 0)
+                }
+            }
+            append(0x4, 4)
+            append(bytes.size, countBits(version))
+            for (b in bytes) {
+                append(b.toInt() and 0xff, 8)
+            }
+            val capacity = dataCodewords(version, ecc) * 8
+            append(0, minOf(4, capacity - bits.size))
+            append(0, (8 - bits.size % 8) % 8)
+            var pad = 0xec
+            while (bits.size < capacity) {
+                append(pad, 8)
+                pad = pad xor 0xec xor 0x11
+            }
+            val codewords = IntArray(bits.size / 8) { i ->
+                (0 until 8).fold(0) { acc, j -> (acc shl 1) or (if (bits[i * 8 + j]) 1 else 0) }
+            }
+
+            val builder = Builder(version, ecc)
+            builder.drawFunctionPatterns()
+            builder.drawCodewords(addEccAndInterleave(codewords, version, ecc))
+            var bestMask = 0
+            var bestPenalty = Int.MAX_VALUE
+            for (mask in 0 until 8) {
+                builder.applyMask(mask)
+                builder.drawFormatBits(mask)
+                val penalty = builder.penalty()
+                if (penalty < bestPenalty) {
+                    bestMask = mask
+                    bestPenalty = penalty
+                }
+                builder.applyMask(mask)
+            }
+            builder.applyMask(bestMask)
+            builder.drawFormatBits(bestMask)
+            return QrCode(version, ecc, bestMask, builder.modules)
+        }
+
+        /** The number of bits in the character count of a byte mode segment. */
+        private fun countBits(version: Int): Int = if (version < 10) 8 else 16
+
+        /** The number of modules available for data and error correction codewords. */
+        fun rawDataModules(version: Int): Int {
+            var result = (16 * version + 128) * version + 64
+            if (version >= 2) {
+                val numAlign = version / 7 + 2
+                result -= (25 * numAlign - 10) * numAlign - 55
+                if (version >= 7) {
+                    result -= 36
+                }
+            }
+            return result
+        }
+
+        fun dataCodewords(version: Int, ecc: Ecc): Int =
+            rawDataModules(version) / 8 -
+                ECC_CODEWORDS_PER_BLOCK[ecc.ordinal][version] * NUM_ERROR_CORRECTION_BLOCKS[ecc.ordinal][version]
+
+        /** The centres of the alignment patterns along each axis. */
+        fun alignmentPositions(version: Int): List<Int> {
+            if (version == 1) {
+                return emptyList()
+            }
+            val numAlign = version / 7 + 2
+            val step = (version * 8 + numAlign * 3 + 5) / (numAlign * 4 - 4) * 2
+            val result = ArrayList<Int>()
+            var pos = version * 4 + 10
+            while (result.size < numAlign - 1) {
+                result.add(0, pos)
+                pos -= step
+            }
+            result.add(0, 6)
+            return result
+        }
+
+        /** The 15-bit format information, with its BCH error correction and mask. */
+        fun formatBits(ecc: Ecc, mask: Int): Int {
+            val data = (ecc.formatBits shl 3) or mask
+            var rem = data
+            repeat(10) { rem = (rem shl 1) xor ((rem shr 9) * 0x537) }
+            return ((data shl 10) or rem) xor 0x5412
+        }
+
+        /** The 18-bit version information, with its BCH error correction. */
+        fun versionBits(version: Int): Int {
+            var rem = version
+            repeat(12) { rem = (rem shl 1) xor ((rem shr 11) * 0x1f25) }
+            return (version shl 12) or rem
+        }
+
+        /**
+         * Split the data into blocks, add the error correction codewords to each, and
+         * interleave the blocks.
+         */
+        private fun addEccAndInterleave(data: IntArray, version: Int, ecc: Ecc): IntArray {
+            val numBlocks = NUM_ERROR_CORRECTION_BLOCKS[ecc.ordinal][version]
+            val blockEccLen = ECC_CODEWORDS_PER_BLOCK[ecc.ordinal][version]
+            val rawCodewords = rawDataModules(version) / 8
+            val numShortBlocks = numBlocks - rawCodewords % numBlocks
+            val shortBlockLen = rawCodewords / numBlocks
+            val blocks = ArrayList<IntArray>()
+            var k = 0
+            for (i in 0 until numBlocks) {
+                val len = shortBlockLen - blockEccLen + if (i < numShortBlocks) 0 else 1
+                val dat = data.copyOfRange(k, k + len)
+                k += len
+                val eccWords = reedSolomonRemainder(dat, blockEccLen)
+                // Short blocks get a placeholder, so that all the blocks line up.
+                blocks.add(if (i < numShortBlocks) dat + 0 + eccWords else dat + eccWords)
+            }
+            val result = ArrayList<Int>()
+            for (i in blocks[0].indices) {
+                for ((j, block) in blocks.withIndex()) {
+                    if (i != shortBlockLen - blockEccLen || j >= numShortBlocks) {
+                        result.add(block[i])
+                    }
+                }
+            }
+            return result.toIntArray()
+        }
+
+        /** Multiply in GF(2^8), modulo the QR code polynomial x^8 + x^4 + x^3 + x^2 + 1. */
+        private fun multiply(x: Int, y: Int): Int {
+            var z = 0
+            for (i in 7 downTo 0) {
+                z = (z shl 1) xor ((z ushr 7) * 0x11d)
+                z = z xor (((y ushr i) and 1) * x)
+            }
+            return z
+        }
+
+        /** Compute the Reed-Solomon error correction codewords for a block of data. */
+        fun reedSolomonRemainder(data: IntArray, degree: Int): IntArray {
+            val divisor = IntArray(degree)
+            divisor[degree - 1] = 1
+            var root = 1
+            for (i in 0 until degree) {
+                for (j in 0 until degree) {
+                    divisor[j] = multiply(divisor[j], root)
+                    if (j + 1 < degree) {
+                        divisor[j] = divisor[j] xor divisor[j + 1]
+                    }
+                }
+                root = multiply(root, 0x02)
+            }
+            val result = IntArray(degree)
+            for (b in data) {
+                val factor = b xor result[0]
+                System.arraycopy(result, 1, result, 0, degree - 1)
+                result[degree - 1] = 0
+                for (i in 0 until degree) {
+                    result[i] = result[i] xor multiply(divisor[i], factor)
+                }
+            }
+            return result
+        }
+    }
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+/**
+ * How finely curved surfaces are approximated, when a model doesn't say how many
+ * segments to use for a circle, sphere or revolution. The normal quality leaves the
+ * choice to the geometry library, which picks a number of segments based on the size
+ * of the curve.
+ *
+ * @param label the name of the preset, as it's written in a build configuration.
+ * @param segments the number of segments for a full circle, or 0 for the library's default.
+ */
+enum class Quality(val label: String, val segments: Int) {
+    Draft("draft", 16),
+    Normal("normal", 0),
+    Fine("fine", 96);
+
+    companion object {
+        /** The quality used for the model that's being evaluated. */
+        var current: Quality = Normal
+
+        /**
+         * The number of segments to use for a curve: the number that the model asked
+         * for, or, if it didn't ask for any, the number for the current quality.
+         */
+        fun segments(requested: Int): Int = if (requested > 0) requested else current.segments
+    }
+}
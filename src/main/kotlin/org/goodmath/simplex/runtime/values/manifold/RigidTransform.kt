@@ -0,0 +1,119 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import kotlin.math.abs
+import kotlin.math.asin
+import kotlin.math.atan2
+import kotlin.math.cos
+import kotlin.math.sin
+import org.goodmath.simplex.runtime.values.primitives.Vec3
+
+/**
+ * A rotation followed by a translation, used to compute the positions of parts
+ * that are moved by joints.
+ *
+ * @param r the rotation matrix, in row-major order.
+ * @param t the translation.
+ */
+class RigidTransform(val r: DoubleArray, val t: Vec3) {
+    fun apply(p: Vec3): Vec3 =
+        Vec3(
+            r[0] * p.x + r[1] * p.y + r[2] * p.z + t.x,
+            r[3] * p.x + r[4] * p.y + r[5] * p.z + t.y,
+            r[6] * p.x + r[7] * p.y + r[8] * p.z + t.z,
+        )
+
+    /** The transform that applies [other] first, and then this one. */
+    fun compose(other: RigidTransform): RigidTransform {
+        val m = DoubleArray(9)
+        for (i in 0 until 3) {
+            for (j in 0 until 3) {
+                m[3 * i + j] = (0 until 3).sumOf { k -> r[3 * i + k] * other.r[3 * k + j] }
+            }
+        }
+        val rotated = RigidTransform(r, Vec3(0.0, 0.0, 0.0)).apply(other.t)
+        return RigidTransform(m, rotated + t)
+    }
+
+    fun isIdentity(): Boolean =
+        r.indices.all { abs(r[it] - IDENTITY_MATRIX[it]) < 1e-12 } && t.magnitude() < 1e-12
+
+    /**
+     * Decompose the rotation into the Euler angles, in degrees, that [Solid.rotate]
+     * takes: a rotation about the X axis, then Y, then Z.
+     */
+    fun eulerAngles(): Vec3 {
+        val sy = -r[6].coerceIn(-1.0, 1.0)
+        val y = asin(sy)
+        return if (abs(cos(y)) > 1e-9) {
+            Vec3(
+                Math.toDegrees(atan2(r[7], r[8])),
+                Math.toDegrees(y),
+                Math.toDegrees(atan2(r[3], r[0])),
+            )
+        } else {
+            // Gimbal lock: the X and Z rotations are about the same axis, so put it all in Z.
+            Vec3(0.0, Math.toDegrees(y), Math.toDegrees(atan2(-r[1], r[4])))
+        }
+    }
+
+    /** Apply the transform to a solid. */
+    fun apply(solid: Solid): Solid {
+        if (isIdentity()) {
+            return solid
+        }
+        return solid.rotate(eulerAngles()).move(t)
+    }
+
+    companion object {
+        private val IDENTITY_MATRIX = doubleArrayOf(1.0, 0.0, 0.0, 0.0, 1.0, 0.0, 0.0, 0.0, 1.0)
+
+        val identity = RigidTransform(IDENTITY_MATRIX, Vec3(0.0, 0.0, 0.0))
+
+        fun translation(v: Vec3): RigidTransform = RigidTransform(IDENTITY_MATRIX, v)
+
+        /** A rotation by an angle in degrees about an axis through the origin. */
+        fun rotation(axis: Vec3, degrees: Double): RigidTransform {
+            val len = axis.magnitude()
+            val x = axis.x / len
+            val y = axis.y / len
+            val z = axis.z / len
+            val a = Math.toRadians(degrees)
+            val c = cos(a)
+            val s = sin(a)
+            val k = 1.0 - c
+            return RigidTransform(
+                doubleArrayOf(
+                    c + x * x * k, x * y * k - z * s, x * z * k + y * s,
+                    y * x * k + z * s, c + y * y * k, y * z * k - x * s,
+                    z * x * k - y * s, z * y * k + x * s, c + z * z * k,
+                ),
+                Vec3(0.0, 0.0, 0.0),
+            )
+        }
+
+        /** A rotation by an angle in degrees about an axis through a point. */
+        fun rotation(origin: Vec3, axis: Vec3, degrees: Double): RigidTransform =
+            translation(origin).compose(rotation(axis, degrees)).compose(translation(-origin))
+
+        /** The rotation that [Solid.rotate] applies for a set of Euler angles in degrees. */
+        fun euler(angles: Vec3): RigidTransform =
+            rotation(Vec3(0.0, 0.0, 1.0), angles.z)
+                .compose(rotation(Vec3(0.0, 1.0, 0.0), angles.y))
+                .compose(rotation(Vec3(1.0, 0.0, 0.0), angles.x))
+    }
+}
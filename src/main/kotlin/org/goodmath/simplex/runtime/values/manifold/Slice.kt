@@ -15,6 +15,9 @@
  */
 package org.goodmath.simplex.runtime.values.manifold
 
+import kotlin.math.abs
+import kotlin.math.cos
+import kotlin.math.sin
 import manifold3d.Manifold
 import manifold3d.linalg.DoubleVec2
 import manifold3d.manifold.CrossSection
@@ -24,6 +27,8 @@ import manifold3d.pub.Polygons
 import manifold3d.pub.SimplePolygon
 import org.goodmath.simplex.ast.types.Type
 import org.goodmath.simplex.runtime.Env
+import org.goodmath.simplex.runtime.RootEnv
+import org.goodmath.simplex.runtime.SimplexEvaluationError
 import org.goodmath.simplex.runtime.values.FunctionSignature
 import org.goodmath.simplex.runtime.values.MethodSignature
 import org.goodmath.simplex.runtime.values.Param
@@ -42,10 +47,24 @@ import org.goodmath.simplex.runtime.values.primitives.PrimitiveMethod
 import org.goodmath.simplex.runtime.values.primitives.StringValueType
 import org.goodmath.simplex.runtime.values.primitives.Vec2
 import org.goodmath.simplex.runtime.values.primitives.Vec2ValueType
+import org.goodmath.simplex.runtime.values.primitives.Vec3
+import org.goodmath.simplex.runtime.values.primitives.Vec3ValueType
 import org.goodmath.simplex.twist.Twist
 
-/** The Simplex wrapper for the Manifold Polygons type. */
-class Slice(val cross: CrossSection) : Value {
+/** A line segment in the plane. */
+data class Segment(val from: Vec2, val to: Vec2) {
+    fun map(f: (Vec2) -> Vec2): Segment = Segment(f(from), f(to))
+}
+
+/**
+ * The Simplex wrapper for the Manifold Polygons type.
+ *
+ * @param cross the outline of the slice.
+ * @param folds fold lines drawn across the slice, like the ones in an unfolded net.
+ *    These are carried along by rigid transforms and scaling, but dropped by boolean
+ *    operations and anything else that reshapes the outline.
+ */
+class Slice(val cross: CrossSection, val folds: List<Segment> = emptyList()) : Value {
     constructor(polys: Polygons) : this(CrossSection(polys, FillRule.Positive.ordinal))
 
     override val valueType: ValueType = SliceValueType
@@ -66,17 +85,51 @@ class Slice(val cross: CrossSection) : Value {
 
     val bounds = BoundingRect(cross.bounds())
 
-    fun translate(x: Double, y: Double): Slice = Slice(cross.translate(x, y))
+    fun translate(x: Double, y: Double): Slice =
+        Slice(cross.translate(x, y), folds.map { s -> s.map { Vec2(it.x + x, it.y + y) } })
 
     fun translate(v: Vec2): Slice = translate(v.x, v.y)
 
-    fun rotate(angle: Double): Slice = Slice(cross.rotate(angle.toFloat()))
+    fun rotate(angle: Double): Slice {
+        val c = cos(Math.toRadians(angle))
+        val s = sin(Math.toRadians(angle))
+        return Slice(
+            cross.rotate(angle.toFloat()),
+            folds.map { seg -> seg.map { Vec2(c * it.x - s * it.y, s * it.x + c * it.y) } },
+        )
+    }
+
+    fun scale(x: Double, y: Double): Slice =
+        Slice(cross.scale(DoubleVec2(x, y)), folds.map { s -> s.map { Vec2(it.x * x, it.y * y) } })
 
-    fun scale(x: Double, y: Double): Slice = Slice(cross.scale(DoubleVec2(x, y)))
+    fun scale(v: Vec2): Slice = scale(v.x, v.y)
 
-    fun scale(v: Vec2): Slice = Slice(cross.scale(v.toDoubleVec2()))
+    fun mirror(norm: Vec2): Slice {
+        val n = norm / norm.magnitude()
+        return Slice(
+            cross.mirror(norm.toDoubleVec2()),
+            folds.map { s -> s.map { it - n * (2.0 * it.dot(n)) } },
+        )
+    }
 
-    fun mirror(norm: Vec2): Slice = Slice(cross.mirror(norm.toDoubleVec2()))
+    /** Move the slice so that the anchor point of its bounding rectangle is at the origin. */
+    fun anchor(anchor: Anchor): Slice {
+        val points = toPoints()
+        if (points.isEmpty()) {
+            return this
+        }
+        val minX = points.minOf { it.x }
+        val maxX = points.maxOf { it.x }
+        val minY = points.minOf { it.y }
+        val maxY = points.maxOf { it.y }
+        val cx = (minX + maxX) / 2.0
+        return when (anchor) {
+            Anchor.Center -> translate(-cx, -(minY + maxY) / 2.0)
+            Anchor.Bottom -> translate(-cx, -minY)
+            Anchor.Top -> translate(-cx, -maxY)
+            Anchor.MinCorner -> translate(-minX, -minY)
+        }
+    }
 
     fun simplify(epsilon: Double): Slice = Slice(cross.simplify(epsilon))
 
@@ -105,32 +158,133 @@ class Slice(val cross: CrossSection) : Value {
         )
     }
 
-    fun revolve(segments: Int, degrees: Float): Solid =
-        Solid(Manifold.Revolve(cross.toPolygons(), segments, degrees))
+    /**
+     * Revolve the slice around the y axis, which becomes the z axis of the solid. The
+     * sweep starts with the slice in the xz plane, and a positive angle sweeps
+     * counterclockwise looking down from +z; a negative one sweeps clockwise. Any angle
+     * of a full turn or more makes a closed ring.
+     */
+    fun revolve(segments: Int, degrees: Float): Solid {
+        if (degrees == 0.0f) {
+            throw SimplexEvaluationError("Can't revolve a slice through 0 degrees")
+        }
+        val sweep = Solid(Manifold.Revolve(cross.toPolygons(), Quality.segments(segments), minOf(abs(degrees), 360.0f)))
+        return if (degrees < 0.0f && degrees > -360.0f) {
+            sweep.mirror(Vec3(0.0, 1.0, 0.0))
+        } else {
+            sweep
+        }
+    }
 
     fun toPoints(): List<Vec2> {
         return cross.toPolygons().flatMap { it.toList() }.map { Vec2.fromDoubleVec2(it)}
     }
 
+    /**
+     * Render the slice as an SVG image. See [svgDocument].
+     *
+     * @param margin the space to leave around the slice, in model units.
+     */
+    fun toSvg(margin: Double = 1.0): String = svgDocument(listOf(this), margin)
+
     companion object {
+        /**
+         * Render a list of slices as a single SVG document, with one path for each
+         * contour. The outlines and the fold lines go in separate Inkscape layers
+         * named "cut" and "fold", so that a cutting machine can be told to cut one
+         * and score the other. SVG's y axis points down, so the y coordinates are
+         * negated to keep the slices the right way up.
+         *
+         * @param slices the slices to draw.
+         * @param margin the space to leave around the slices, in model units.
+         */
+        fun svgDocument(slices: List<Slice>, margin: Double = 1.0): String {
+            val polys = slices.flatMap { slice ->
+                slice.cross.toPolygons().map { poly -> poly.map { Vec2.fromDoubleVec2(it) } }
+            }.filter { it.isNotEmpty() }
+            val folds = slices.flatMap { it.folds }
+            val points = polys.flatten()
+            if (points.isEmpty()) {
+                return "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"0\" height=\"0\"/>"
+            }
+            val minX = points.minOf { it.x } - margin
+            val maxX = points.maxOf { it.x } + margin
+            val minY = points.minOf { -it.y } - margin
+            val maxY = points.maxOf { -it.y } + margin
+            val width = maxX - minX
+            val height = maxY - minY
+            val strokeWidth = maxOf(width, height) / 500.0
+            val cutPath = polys.joinToString(" ") { poly ->
+                "M " + poly.joinToString(" L ") { "${it.x} ${-it.y}" } + " Z"
+            }
+            val result = StringBuilder()
+            result.append(
+                "<svg xmlns=\"http://www.w3.org/2000/svg\" " +
+                    "xmlns:inkscape=\"http://www.inkscape.org/namespaces/inkscape\" " +
+                    "viewBox=\"$minX $minY $width $height\" " +
+                    "width=\"${width}mm\" height=\"${height}mm\">"
+            )
+            result.append("<g inkscape:groupmode=\"layer\" id=\"cut\" inkscape:label=\"cut\">")
+            result.append(
+                "<path d=\"$cutPath\" fill=\"#8899aa\" fill-rule=\"nonzero\" stroke=\"black\" " +
+                    "stroke-width=\"$strokeWidth\"/>"
+            )
+            result.append("</g>")
+            if (folds.isNotEmpty()) {
+                val foldPath = folds.joinToString(" ") {
+                    "M ${it.from.x} ${-it.from.y} L ${it.to.x} ${-it.to.y}"
+                }
+                result.append("<g inkscape:groupmode=\"layer\" id=\"fold\" inkscape:label=\"fold\">")
+                result.append(
+                    "<path d=\"$foldPath\" fill=\"none\" stroke=\"red\" " +
+                        "stroke-width=\"$strokeWidth\" stroke-dasharray=\"${strokeWidth * 4} ${strokeWidth * 2}\"/>"
+                )
+                result.append("</g>")
+            }
+            result.append("</svg>")
+            return result.toString()
+        }
+
         fun rectangle(x: Double, y: Double): Slice {
             return Slice(CrossSection.Square(x, y))
         }
 
         fun circle(x: Double, facets: Int): Slice =
-            Slice(CrossSection.Circle(x.toFloat(), facets))
+            Slice(CrossSection.Circle(x.toFloat(), Quality.segments(facets)))
 
         fun oval(x: Double, y: Double, facets: Int): Slice {
-            return Slice(CrossSection.Circle(x.toFloat(), facets).scale(
+            return Slice(CrossSection.Circle(x.toFloat(), Quality.segments(facets)).scale(
                 Vec2(1.0,  y/x).toDoubleVec2()))
         }
 
+        /** A regular polygon centered on the origin, with a vertex on the x axis. */
+        fun regularPolygon(sides: Int, radius: Double): Slice {
+            if (sides < 3) {
+                throw SimplexEvaluationError("A regular polygon needs at least 3 sides, not $sides")
+            }
+            return Slice(CrossSection.Circle(radius.toFloat(), sides))
+        }
+
         fun triangle(width: Double, height: Double): Slice {
             val points = listOf(-width/2.0, 0.0, width/2.0, 0.0,0.0, height)
             val pointArray = DoubleArray(6) { idx-> points[idx] }
             return Slice(CrossSection(SimplePolygon.FromArray(pointArray), 0))
         }
 
+        /**
+         * Create a slice from a list of axis-aligned boxes, each given as its left,
+         * bottom, right, and top coordinates. Boxes that touch are merged.
+         */
+        fun fromBoxes(boxes: List<DoubleArray>): Slice {
+            val polys = Polygons()
+            for ((left, bottom, right, top) in boxes) {
+                polys.pushBack(
+                    SimplePolygon.FromArray(doubleArrayOf(left, bottom, right, bottom, right, top, left, top))
+                )
+            }
+            return Slice(CrossSection(polys, FillRule.Positive.ordinal))
+        }
+
         fun fromPolygon(p: SPolygon): Slice {
             return Slice(CrossSection(p.poly, 0))
         }
@@ -171,14 +325,22 @@ object SliceValueType : ValueType() {
                 }
             },
             object: PrimitiveFunctionValue("triangle",
-                FunctionSignature.simple(listOf(
-                    Param("width", FloatValueType.asType),
-                    Param("height", FloatValueType.asType)),
+                FunctionSignature.multi(
+                    listOf(
+                        listOf(
+                            Param("width", FloatValueType.asType),
+                            Param("height", FloatValueType.asType)),
+                        listOf(
+                            Param("width", FloatValueType.asType),
+                            Param("height", FloatValueType.asType),
+                            Param("anchor", StringValueType.asType))),
                     asType)) {
                 override fun execute(args: List<Value>): Value {
-                    val width = assertIsFloat(args[0])
-                    val height = assertIsFloat(args[1])
-                    return Slice.triangle(width, height)
+                    val (params, anchor) = Anchor.split(args, signature)
+                    val width = assertIsFloat(params[0])
+                    val height = assertIsFloat(params[1])
+                    val result = Slice.triangle(width, height)
+                    return anchor?.let { result.anchor(it) } ?: result
                 }
 
             },
@@ -186,16 +348,22 @@ object SliceValueType : ValueType() {
                 FunctionSignature.multi(
                     listOf(
                         listOf(Param("radius", FloatValueType.asType)),
-                        listOf(Param("radius", FloatValueType.asType), Param("facets", IntegerValueType.asType))),
+                        listOf(Param("radius", FloatValueType.asType), Param("facets", IntegerValueType.asType)),
+                        listOf(Param("radius", FloatValueType.asType), Param("anchor", StringValueType.asType)),
+                        listOf(Param("radius", FloatValueType.asType),
+                            Param("facets", IntegerValueType.asType),
+                            Param("anchor", StringValueType.asType))),
                     asType)) {
                 override fun execute(args: List<Value>): Value {
-                    val radius = assertIsFloat(args[0])
-                    val facets = if (args.size > 1) {
-                        assertIsInt(args[1])
+                    val (params, anchor) = Anchor.split(args, signature)
+                    val radius = assertIsFloat(params[0])
+                    val facets = if (params.size > 1) {
+                        assertIsInt(params[1])
                     } else {
                         0
                     }
-                    return Slice.circle(radius, facets)
+                    val result = Slice.circle(radius, facets)
+                    return anchor?.let { result.anchor(it) } ?: result
                 }
             },
             object: PrimitiveFunctionValue("oval",
@@ -208,29 +376,150 @@ object SliceValueType : ValueType() {
                         listOf(
                             Param("x", FloatValueType.asType),
                             Param("y", FloatValueType.asType),
-                            Param("facets", IntegerValueType.asType))
+                            Param("facets", IntegerValueType.asType)),
+                        listOf(
+                            Param("x", FloatValueType.asType),
+                            Param("y", FloatValueType.asType),
+                            Param("anchor", StringValueType.asType)),
+                        listOf(
+                            Param("x", FloatValueType.asType),
+                            Param("y", FloatValueType.asType),
+                            Param("facets", IntegerValueType.asType),
+                            Param("anchor", StringValueType.asType)),
                         ),
                     asType)) {
                 override fun execute(args: List<Value>): Value {
-                    val x = assertIsFloat(args[0])
-                    val y = assertIsFloat(args[1])
-                    val facets = if (args.size > 2) {
-                        assertIsInt(args[2])
+                    val (params, anchor) = Anchor.split(args, signature)
+                    val x = assertIsFloat(params[0])
+                    val y = assertIsFloat(params[1])
+                    val facets = if (params.size > 2) {
+                        assertIsInt(params[2])
                     } else {
                         0
                     }
-                    return Slice.oval(x, y, facets)
+                    val result = Slice.oval(x, y, facets)
+                    return anchor?.let { result.anchor(it) } ?: result
+                }
+            },
+            object :
+                PrimitiveFunctionValue(
+                    "trace_image",
+                    FunctionSignature.simple(
+                        listOf(
+                            Param("path", StringValueType.asType),
+                            Param("threshold", FloatValueType.asType),
+                            Param("simplify_eps", FloatValueType.asType),
+                        ),
+                        asType,
+                    ),
+                ) {
+                override fun execute(args: List<Value>): Value {
+                    val path = assertIsString(args[0])
+                    val threshold = assertIsFloat(args[1])
+                    val epsilon = assertIsFloat(args[2])
+                    return ImageTracer.traceImage(RootEnv.resolvePath(path), threshold, epsilon)
+                }
+            },
+            object :
+                PrimitiveFunctionValue(
+                    "qr_code",
+                    FunctionSignature.simple(
+                        listOf(
+                            Param("data", StringValueType.asType),
+                            Param("module_size", FloatValueType.asType),
+                            Param("ecc", StringValueType.asType),
+                        ),
+                        asType,
+                    ),
+                ) {
+                override fun execute(args: List<Value>): Value {
+                    val data = assertIsString(args[0])
+                    val moduleSize = assertIsFloat(args[1])
+                    val ecc = QrCode.eccOf(assertIsString(args[2]))
+                    return QrCode.encode(data, ecc).toSlice(moduleSize)
+                }
+            },
+            object :
+                PrimitiveFunctionValue(
+                    "code128",
+                    FunctionSignature.multi(
+                        listOf(
+                            listOf(Param("data", StringValueType.asType), Param("height", FloatValueType.asType)),
+                            listOf(
+                                Param("data", StringValueType.asType),
+                                Param("height", FloatValueType.asType),
+                                Param("module_width", FloatValueType.asType),
+                            ),
+                        ),
+                        asType,
+                    ),
+                ) {
+                override fun execute(args: List<Value>): Value {
+                    val data = assertIsString(args[0])
+                    val height = assertIsFloat(args[1])
+                    val moduleWidth =
+                        if (args.size > 2) {
+                            assertIsFloat(args[2])
+                        } else {
+                            1.0
+                        }
+                    return Code128.toSlice(data, height, moduleWidth)
+                }
+            },
+            object: PrimitiveFunctionValue("helix_path",
+                FunctionSignature.multi(
+                    listOf(
+                        listOf(
+                            Param("radius", FloatValueType.asType),
+                            Param("pitch", FloatValueType.asType),
+                            Param("turns", FloatValueType.asType),
+                            Param("taper", FloatValueType.asType)),
+                        listOf(
+                            Param("radius", FloatValueType.asType),
+                            Param("pitch", FloatValueType.asType),
+                            Param("turns", FloatValueType.asType),
+                            Param("taper", FloatValueType.asType),
+                            Param("segments", IntegerValueType.asType))),
+                    Type.vector(Vec3ValueType.asType))) {
+                override fun execute(args: List<Value>): Value {
+                    val segments = if (args.size > 4) {
+                        assertIsInt(args[4])
+                    } else {
+                        Helix.DEFAULT_SEGMENTS_PER_TURN
+                    }
+                    val path = Helix.path(
+                        assertIsFloat(args[0]), assertIsFloat(args[1]),
+                        assertIsFloat(args[2]), assertIsFloat(args[3]), segments)
+                    return VectorValue(Vec3ValueType, path)
+                }
+            },
+            object: PrimitiveFunctionValue("regular_polygon",
+                FunctionSignature.multi(
+                    Anchor.withAnchors(
+                        listOf(
+                            listOf(Param("sides", IntegerValueType.asType), Param("radius", FloatValueType.asType)))),
+                    asType)) {
+                override fun execute(args: List<Value>): Value {
+                    val (params, anchor) = Anchor.split(args, signature)
+                    val result = Slice.regularPolygon(assertIsInt(params[0]), assertIsFloat(params[1]))
+                    return anchor?.let { result.anchor(it) } ?: result
                 }
             },
             object: PrimitiveFunctionValue("rectangle",
-                FunctionSignature.simple(
+                FunctionSignature.multi(
+                    listOf(
                         listOf(Param("x", FloatValueType.asType),
                             Param("y", FloatValueType.asType)),
+                        listOf(Param("x", FloatValueType.asType),
+                            Param("y", FloatValueType.asType),
+                            Param("anchor", StringValueType.asType))),
                     asType)) {
                 override fun execute(args: List<Value>): Value {
-                    val x = assertIsFloat(args[0])
-                    val y = assertIsFloat(args[1])
-                    return Slice.rectangle(x, y)
+                    val (params, anchor) = Anchor.split(args, signature)
+                    val x = assertIsFloat(params[0])
+                    val y = assertIsFloat(params[1])
+                    val result = Slice.rectangle(x, y)
+                    return anchor?.let { result.anchor(it) } ?: result
                 }
             },
             object :
@@ -293,6 +582,71 @@ object SliceValueType : ValueType() {
         )
     }
 
+    /**
+     * The primitives that back the OpenSCAD compatibility library. They aren't installed
+     * in the root environment; see [OpenScad.builtins].
+     */
+    val scadFunctions: List<PrimitiveFunctionValue> by lazy {
+        listOf(
+            object :
+                PrimitiveFunctionValue(
+                    "scad_circle",
+                    FunctionSignature.simple(
+                        listOf(Param("r", FloatValueType.asType), Param("fn", IntegerValueType.asType)),
+                        asType,
+                    ),
+                ) {
+                override fun execute(args: List<Value>): Value {
+                    return OpenScad.circle(assertIsFloat(args[0]), assertIsInt(args[1]))
+                }
+            },
+            object :
+                PrimitiveFunctionValue(
+                    "scad_linear_extrude",
+                    FunctionSignature.simple(
+                        listOf(
+                            Param("slice", asType),
+                            Param("height", FloatValueType.asType),
+                            Param("center", BooleanValueType.asType),
+                            Param("twist", FloatValueType.asType),
+                            Param("slices", IntegerValueType.asType),
+                            Param("scale", Vec2ValueType.asType),
+                            Param("fn", IntegerValueType.asType),
+                        ),
+                        SolidValueType.asType,
+                    ),
+                ) {
+                override fun execute(args: List<Value>): Value {
+                    return OpenScad.linearExtrude(
+                        SliceValueType.assertIs(args[0]),
+                        assertIsFloat(args[1]),
+                        assertIsBoolean(args[2]),
+                        assertIsFloat(args[3]),
+                        assertIsInt(args[4]),
+                        Vec2ValueType.assertIs(args[5]),
+                        assertIsInt(args[6]),
+                    )
+                }
+            },
+            object :
+                PrimitiveFunctionValue(
+                    "scad_rotate_extrude",
+                    FunctionSignature.simple(
+                        listOf(
+                            Param("slice", asType),
+                            Param("angle", FloatValueType.asType),
+                            Param("fn", IntegerValueType.asType),
+                        ),
+                        SolidValueType.asType,
+                    ),
+                ) {
+                override fun execute(args: List<Value>): Value {
+                    return OpenScad.rotateExtrude(SliceValueType.assertIs(args[0]), assertIsFloat(args[1]), assertIsInt(args[2]))
+                }
+            }
+        )
+    }
+
     override val providesPrimitiveMethods: List<PrimitiveMethod> by lazy {
         listOf(
             object :
@@ -570,15 +924,17 @@ object SliceValueType : ValueType() {
                         } else {
                             20
                         }
+                    // The scale is always the last argument; the twist comes before it
+                    // in the four-argument form.
                     val scaleTop =
                         if (args.size > 2) {
-                            Vec2ValueType.assertIs(args[2])
+                            Vec2ValueType.assertIs(args.last())
                         } else {
                             Vec2(1.0, 1.0)
                         }
                     val twist =
                         if (args.size > 3) {
-                            assertIsFloat(args[3])
+                            assertIsFloat(args[2])
                         } else {
                             0.0
                         }
@@ -592,6 +948,7 @@ object SliceValueType : ValueType() {
                         asType,
                         listOf(
                             listOf(Param("segments", IntegerValueType.asType)),
+                            listOf(Param("degrees", FloatValueType.asType)),
                             listOf(
                                 Param("segments", IntegerValueType.asType),
                                 Param("degrees", FloatValueType.asType),
@@ -602,6 +959,9 @@ object SliceValueType : ValueType() {
                 ) {
                 override fun execute(target: Value, args: List<Value>, env: Env): Value {
                     val self = assertIs(target)
+                    if (args.size == 1 && args[0] is FloatValue) {
+                        return self.revolve(0, assertIsFloat(args[0]).toFloat())
+                    }
                     val segments = assertIsInt(args[0])
                     val degrees =
                         if (args.size == 2) {
@@ -612,6 +972,47 @@ object SliceValueType : ValueType() {
                     return self.revolve(segments, degrees.toFloat())
                 }
             },
+            object :
+                PrimitiveMethod(
+                    "helix_sweep",
+                    MethodSignature.multi(
+                        asType,
+                        listOf(
+                            listOf(
+                                Param("radius", FloatValueType.asType),
+                                Param("pitch", FloatValueType.asType),
+                                Param("turns", FloatValueType.asType),
+                                Param("taper", FloatValueType.asType),
+                            ),
+                            listOf(
+                                Param("radius", FloatValueType.asType),
+                                Param("pitch", FloatValueType.asType),
+                                Param("turns", FloatValueType.asType),
+                                Param("taper", FloatValueType.asType),
+                                Param("segments", IntegerValueType.asType),
+                            ),
+                        ),
+                        SolidValueType.asType,
+                    ),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    val self = assertIs(target)
+                    val segments =
+                        if (args.size > 4) {
+                            assertIsInt(args[4])
+                        } else {
+                            Helix.DEFAULT_SEGMENTS_PER_TURN
+                        }
+                    return Helix.sweep(
+                        self,
+                        assertIsFloat(args[0]),
+                        assertIsFloat(args[1]),
+                        assertIsFloat(args[2]),
+                        assertIsFloat(args[3]),
+                        segments,
+                    )
+                }
+            },
         )
     }
 
@@ -0,0 +1,266 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import java.io.FileOutputStream
+import java.util.zip.ZipEntry
+import java.util.zip.ZipOutputStream
+import org.goodmath.simplex.ast.types.Type
+import org.goodmath.simplex.runtime.Env
+import org.goodmath.simplex.runtime.SimplexEvaluationError
+import org.goodmath.simplex.runtime.values.MethodSignature
+import org.goodmath.simplex.runtime.values.Param
+import org.goodmath.simplex.runtime.values.Value
+import org.goodmath.simplex.runtime.values.ValueType
+import org.goodmath.simplex.runtime.values.primitives.FloatValue
+import org.goodmath.simplex.runtime.values.primitives.FloatValueType
+import org.goodmath.simplex.runtime.values.primitives.IntegerValue
+import org.goodmath.simplex.runtime.values.primitives.IntegerValueType
+import org.goodmath.simplex.runtime.values.primitives.PrimitiveFunctionValue
+import org.goodmath.simplex.runtime.values.primitives.PrimitiveMethod
+import org.goodmath.simplex.runtime.values.primitives.StringValue
+import org.goodmath.simplex.runtime.values.primitives.StringValueType
+import org.goodmath.simplex.twist.Twist
+
+/**
+ * What a slicer should do with a volume that isn't printed itself. The prusa type
+ * is the name of the volume type in PrusaSlicer's 3MF config.
+ */
+enum class SlicerRole(val label: String, val prusaType: String) {
+    Modifier("modifier", "ModifierVolume"),
+    SupportBlocker("support_blocker", "SupportBlocker"),
+    SupportEnforcer("support_enforcer", "SupportEnforcer"),
+}
+
+/**
+ * A solid that's exported to a slicer as a modifier, a support blocker or a support
+ * enforcer, instead of as part of the printed model.
+ *
+ * @param role what the slicer should do with the volume.
+ * @param solid the region covered by the volume.
+ * @param settings the slicer settings for the region, as PrusaSlicer config keys and
+ *    values. Only modifiers have settings.
+ */
+class SlicerVolume(val role: SlicerRole, val solid: Solid, val settings: Map<String, String> = emptyMap()) :
+    Value {
+    override val valueType: ValueType = SlicerVolumeValueType
+
+    override fun twist(): Twist =
+        Twist.obj(
+            "SlicerVolume",
+            Twist.attr("role", role.label),
+            Twist.array("settings", settings.map { (k, v) -> Twist.attr(k, v) }),
+            Twist.value("solid", solid),
+        )
+
+    /**
+     * Add a setting. The common settings have short names, which are translated to
+     * PrusaSlicer's config keys; any other key is passed to the slicer as it is.
+     */
+    fun withSetting(key: String, value: Value): SlicerVolume {
+        if (role != SlicerRole.Modifier) {
+            throw SimplexEvaluationError("Only modifier volumes can have slicer settings, not ${role.label}s")
+        }
+        val text =
+            when (value) {
+                is IntegerValue -> value.i.toString()
+                is FloatValue -> value.d.toString()
+                is StringValue -> value.s
+                else -> throw SimplexEvaluationError("Slicer setting '$key' must be an Int, Float or String")
+            }
+        val (configKey, configValue) =
+            when (key) {
+                "infill" -> Pair("fill_density", "$text%")
+                "infill_pattern" -> Pair("fill_pattern", text)
+                "walls" -> Pair("perimeters", text)
+                "top_layers" -> Pair("top_solid_layers", text)
+                "bottom_layers" -> Pair("bottom_solid_layers", text)
+                else -> Pair(key, text)
+            }
+        return SlicerVolume(role, solid, settings + (configKey to configValue))
+    }
+
+    companion object {
+        /**
+         * Write a 3MF file containing a printed body and the slicer volumes that go with
+         * it, in the layout used by PrusaSlicer, which Bambu Studio and OrcaSlicer also read.
+         * All of the meshes are written as volumes of a single object, so that the
+         * slicer applies the modifiers to the body.
+         */
+        fun export3mf(path: String, name: String, body: Solid, volumes: List<SlicerVolume>) {
+            val meshes = listOf(MeshData.of(body)) + volumes.map { MeshData.of(it.solid) }
+            ZipOutputStream(FileOutputStream(path)).use { zip ->
+                fun entry(entryName: String, content: String) {
+                    zip.putNextEntry(ZipEntry(entryName))
+                    zip.write(content.toByteArray(Charsets.UTF_8))
+                    zip.closeEntry()
+                }
+                entry("[Content_Types].xml", CONTENT_TYPES)
+                entry("_rels/.rels", RELS)
+                entry("3D/3dmodel.model", modelXml(meshes))
+                entry("Metadata/Slic3r_PE_model.config", configXml(name, meshes, volumes))
+            }
+        }
+
+        /** The 3MF model: one object, whose mesh has the triangles of every volume in turn. */
+        fun modelXml(meshes: List<MeshData>): String {
+            val out = StringBuilder()
+            out.append("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+            out.append(
+                "<model unit=\"millimeter\" xml:lang=\"en-US\" " +
+                    "xmlns=\"http://schemas.microsoft.com/3dmanufacturing/core/2015/02\" " +
+                    "xmlns:slic3rpe=\"http://schemas.slic3r.org/3mf/2017/06\">\n"
+            )
+            out.append(" <metadata name=\"slic3rpe:Version3mf\">1</metadata>\n")
+            out.append(" <resources>\n  <object id=\"1\" type=\"model\">\n   <mesh>\n    <vertices>\n")
+            for (mesh in meshes) {
+                for (v in 0 until mesh.vertexCount) {
+                    val p = mesh.vertex(v)
+                    out.append("     <vertex x=\"${p.x}\" y=\"${p.y}\" z=\"${p.z}\"/>\n")
+                }
+            }
+            out.append("    </vertices>\n    <triangles>\n")
+            var offset = 0
+            for (mesh in meshes) {
+                for (t in 0 until mesh.triangleCount) {
+                    val v1 = mesh.triangles[3 * t] + offset
+                    val v2 = mesh.triangles[3 * t + 1] + offset
+                    val v3 = mesh.triangles[3 * t + 2] + offset
+                    out.append("     <triangle v1=\"$v1\" v2=\"$v2\" v3=\"$v3\"/>\n")
+                }
+                offset += mesh.vertexCount
+            }
+            out.append("    </triangles>\n   </mesh>\n  </object>\n </resources>\n")
+            out.append(" <build>\n  <item objectid=\"1\"/>\n </build>\n</model>\n")
+            return out.toString()
+        }
+
+        /**
+         * The PrusaSlicer config, which says which range of the object's triangles
+         * belongs to each volume, what type each volume is, and its settings.
+         */
+        fun configXml(name: String, meshes: List<MeshData>, volumes: List<SlicerVolume>): String {
+            val out = StringBuilder()
+            out.append("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<config>\n")
+            out.append(" <object id=\"1\" instances_count=\"1\">\n")
+            out.append("  <metadata type=\"object\" key=\"name\" value=\"${escape(name)}\"/>\n")
+            var first = 0
+            for ((i, mesh) in meshes.withIndex()) {
+                val last = first + mesh.triangleCount - 1
+                out.append("  <volume firstid=\"$first\" lastid=\"$last\">\n")
+                if (i == 0) {
+                    out.append("   <metadata type=\"volume\" key=\"name\" value=\"${escape(name)}\"/>\n")
+                    out.append("   <metadata type=\"volume\" key=\"volume_type\" value=\"ModelPart\"/>\n")
+                } else {
+                    val volume = volumes[i - 1]
+                    out.append("   <metadata type=\"volume\" key=\"name\" value=\"${volume.role.label}-$i\"/>\n")
+                    out.append("   <metadata type=\"volume\" key=\"volume_type\" value=\"${volume.role.prusaType}\"/>\n")
+                    if (volume.role == SlicerRole.Modifier) {
+                        out.append("   <metadata type=\"volume\" key=\"modifier\" value=\"1\"/>\n")
+                    }
+                    for ((k, v) in volume.settings) {
+                        out.append("   <metadata type=\"volume\" key=\"${escape(k)}\" value=\"${escape(v)}\"/>\n")
+                    }
+                }
+                out.append("  </volume>\n")
+                first = last + 1
+            }
+            out.append(" </object>\n</config>\n")
+            return out.toString()
+        }
+
+        private fun escape(s: String): String =
+            s.replace("&", "&amp;").replace("<", "&lt;").replace(">", "&gt;").replace("\"", "&quot;")
+
+        private const val CONTENT_TYPES =
+            "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n" +
+                "<Types xmlns=\"http://schemas.openxmlformats.org/package/2006/content-types\">\n" +
+                " <Default Extension=\"rels\" ContentType=\"application/vnd.openxmlformats-package.relationships+xml\"/>\n" +
+                " <Default Extension=\"model\" ContentType=\"application/vnd.ms-package.3dmanufacturing-3dmodel+xml\"/>\n" +
+                "</Types>\n"
+
+        private const val RELS =
+            "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n" +
+                "<Relationships xmlns=\"http://schemas.openxmlformats.org/package/2006/relationships\">\n" +
+                " <Relationship Target=\"/3D/3dmodel.model\" Id=\"rel0\" " +
+                "Type=\"http://schemas.microsoft.com/3dmanufacturing/2013/01/3dmodel\"/>\n" +
+                "</Relationships>\n"
+    }
+}
+
+object SlicerVolumeValueType : ValueType() {
+    override val name: String = "SlicerVolume"
+
+    override val asType: Type by lazy { Type.simple(name) }
+
+    override val supportsText: Boolean = true
+
+    override fun toText(v: Value): String {
+        val volume = assertIs(v)
+        val settings = volume.settings.entries.joinToString(", ") { "${it.key}=${it.value}" }
+        return "SlicerVolume(${volume.role.label}${if (settings.isEmpty()) "" else ", $settings"})"
+    }
+
+    override fun isTruthy(v: Value): Boolean = true
+
+    override val providesFunctions: List<PrimitiveFunctionValue> = emptyList()
+
+    override val providesPrimitiveMethods: List<PrimitiveMethod> by lazy {
+        listOf(
+            object :
+                PrimitiveMethod(
+                    "setting",
+                    MethodSignature.multi(
+                        asType,
+                        listOf(
+                            listOf(Param("key", StringValueType.asType), Param("value", IntegerValueType.asType)),
+                            listOf(Param("key", StringValueType.asType), Param("value", FloatValueType.asType)),
+                            listOf(Param("key", StringValueType.asType), Param("value", StringValueType.asType)),
+                        ),
+                        asType,
+                    ),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    return assertIs(target).withSetting(assertIsString(args[0]), args[1])
+                }
+            },
+            object :
+                PrimitiveMethod(
+                    "role",
+                    MethodSignature.simple(asType, emptyList<Param>(), StringValueType.asType),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    return StringValue(assertIs(target).role.label)
+                }
+            },
+            object :
+                PrimitiveMethod(
+                    "solid",
+                    MethodSignature.simple(asType, emptyList<Param>(), SolidValueType.asType),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    return assertIs(target).solid
+                }
+            },
+        )
+    }
+
+    override val providesVariables: Map<String, Value> = emptyMap()
+
+    override fun assertIs(v: Value): SlicerVolume {
+        return v as? SlicerVolume ?: throwTypeError(v)
+    }
+}
@@ -17,12 +17,17 @@ package org.goodmath.simplex.runtime.values.manifold
 
 import manifold3d.Manifold
 import manifold3d.ManifoldVector
+import manifold3d.linalg.DoubleVec3Vector
+import manifold3d.manifold.CrossSection
 import manifold3d.manifold.ExportOptions
 import manifold3d.manifold.MeshIO
 import manifold3d.pub.OpType
 import manifold3d.pub.Polygons
+import manifold3d.pub.SimplePolygon
 import org.goodmath.simplex.ast.types.Type
 import org.goodmath.simplex.runtime.Env
+import org.goodmath.simplex.runtime.RootEnv
+import org.goodmath.simplex.runtime.SimplexEvaluationError
 import org.goodmath.simplex.runtime.values.FunctionSignature
 import org.goodmath.simplex.runtime.values.MethodSignature
 import org.goodmath.simplex.runtime.values.Param
@@ -37,6 +42,8 @@ import org.goodmath.simplex.runtime.values.primitives.IntegerValue
 import org.goodmath.simplex.runtime.values.primitives.IntegerValueType
 import org.goodmath.simplex.runtime.values.primitives.PrimitiveFunctionValue
 import org.goodmath.simplex.runtime.values.primitives.PrimitiveMethod
+import org.goodmath.simplex.runtime.values.primitives.StringValueType
+import org.goodmath.simplex.runtime.values.primitives.Vec2
 import org.goodmath.simplex.runtime.values.primitives.Vec3
 import org.goodmath.simplex.runtime.values.primitives.Vec3ValueType
 import org.goodmath.simplex.twist.Twist
@@ -78,13 +85,57 @@ class Solid(val manifold: Manifold) : Value {
 
     fun mirror(norm: Vec3): Solid = Solid(manifold.mirror(norm.toDoubleVec3()))
 
+    /** Move the solid so that the anchor point of its bounding box is at the origin. */
+    fun anchor(anchor: Anchor): Solid {
+        val box = boundingBox()
+        val c = box.center
+        return when (anchor) {
+            Anchor.Center -> move(-c.x, -c.y, -c.z)
+            Anchor.Bottom -> move(-c.x, -c.y, -box.low.z)
+            Anchor.Top -> move(-c.x, -c.y, -box.high.z)
+            Anchor.MinCorner -> move(-box.low.x, -box.low.y, -box.low.z)
+        }
+    }
+
     fun refine(factor: Int): Solid = Solid(manifold.refine(factor))
 
-    operator fun plus(other: Solid): Solid = Solid(manifold.add(other.manifold))
+    operator fun plus(other: Solid): Solid =
+        Solid(Tolerance.apply(manifold).add(Tolerance.apply(other.manifold)))
+
+    operator fun minus(other: Solid): Solid =
+        Solid(Tolerance.apply(manifold).subtract(Tolerance.apply(other.manifold)))
+
+    fun intersect(other: Solid): Solid =
+        Solid(Tolerance.apply(manifold).intersect(Tolerance.apply(other.manifold)))
 
-    operator fun minus(other: Solid): Solid = Solid(manifold.subtract(other.manifold))
+    /** The size of the features that Manifold treats as noise in this solid. */
+    fun tolerance(): Double = manifold.getTolerance()
 
-    fun intersect(other: Solid): Solid = Solid(manifold.intersect(other.manifold))
+    /**
+     * This solid, with a new tolerance. Raising the tolerance simplifies the mesh,
+     * removing features smaller than the tolerance.
+     */
+    fun setTolerance(eps: Double): Solid = Solid(manifold.setTolerance(eps))
+
+    /**
+     * Remove the features of the mesh that are smaller than [eps], or than the
+     * solid's tolerance if [eps] is 0.0, without changing its tolerance.
+     */
+    fun simplify(eps: Double = 0.0): Solid = Solid(manifold.simplify(eps))
+
+    /**
+     * Count the triangles that are thinner than [eps], or than the solid's tolerance if
+     * [eps] is 0.0.
+     */
+    fun degenerateTriangles(eps: Double = 0.0): Int =
+        Tolerance.degenerateTriangles(MeshData.of(this), if (eps > 0.0) eps else tolerance())
+
+    /**
+     * Fill the solid with tetrahedra, none larger than [maxVolume], and with radius-edge
+     * ratios no worse than [quality] where the mesh can be refined.
+     */
+    fun tetrahedralize(maxVolume: Double, quality: Double = 2.0): TetMesh =
+        Tetrahedralizer(MeshData.of(this), maxVolume, quality).tetrahedralize()
 
     fun genus(): IntegerValue = IntegerValue(manifold.genus())
 
@@ -126,15 +177,61 @@ class Solid(val manifold: Manifold) : Value {
 
     fun project(): Slice = Slice(manifold.project())
 
+    /**
+     * Unfold the solid into flat nets, one slice for each net, with the fold lines
+     * recorded in the slices.
+     */
+    fun unfold(): List<Slice> =
+        Unfolder(MeshData.of(this)).unfold().map { net ->
+            val polys = Polygons()
+            for (poly in net.polygons) {
+                polys.pushBack(
+                    SimplePolygon.FromArray(poly.flatMap { listOf(it.x, it.y) }.toDoubleArray())
+                )
+            }
+            Slice(CrossSection(polys, CrossSection.FillRule.Positive.ordinal), net.folds)
+        }
+
     fun refineToLength(length: Double): Solid = Solid(manifold.refineToLength(length.toFloat()))
 
     fun hull(): Solid {
         return Solid(manifold.convexHull())
     }
 
+    /** Split the solid into its connected components. */
+    fun decompose(): List<Solid> = manifold.decompose().map { Solid(it) }
+
+    /**
+     * The number of connected components. This is counted the same way as [decompose]
+     * splits the solid, so solids that only touch are still separate components.
+     */
+    fun numComponents(): Int = decompose().size
+
     companion object {
         fun union(bodies: List<Solid>): Solid =
-            Solid(Manifold.BatchBoolean(SolidValueType.listToVec(bodies), OpType.Add))
+            Solid(
+                Manifold.BatchBoolean(
+                    ManifoldVector(bodies.map { Tolerance.apply(it.manifold) }.toTypedArray()),
+                    OpType.Add,
+                )
+            )
+
+        /**
+         * Combine solids into one without a boolean operation. This is much cheaper
+         * than a union, but it's only valid if the solids don't overlap.
+         */
+        fun compose(bodies: List<Solid>): Solid =
+            Solid(Manifold.Compose(SolidValueType.listToVec(bodies)))
+
+        fun hullAll(bodies: List<Solid>): Solid =
+            Solid(Manifold.ConvexHull(SolidValueType.listToVec(bodies)))
+
+        fun hullPoints(points: List<Vec3>): Solid {
+            if (points.size < 4) {
+                throw SimplexEvaluationError("hull_points needs at least four points, but got ${points.size}")
+            }
+            return Solid(Manifold.ConvexHull(DoubleVec3Vector(points.map { it.toDoubleVec3() }.toTypedArray())))
+        }
 
         fun cuboid(width: Double, height: Double, depth: Double,
                    center: Boolean): Solid =
@@ -143,17 +240,111 @@ class Solid(val manifold: Manifold) : Value {
         fun cuboid(v: Vec3, center: Boolean): Solid =
             Solid(Manifold.Cube(v.toDoubleVec3(), center))
 
+        /**
+         * A cylinder or cone around the z axis, standing on the origin. The `cylinder`
+         * function moves it to its anchor, which is its top by default.
+         */
         fun cylinder(height: Double, lowRadius: Double): Solid =
-            Solid(Manifold.Cylinder(height.toFloat(), lowRadius.toFloat(), lowRadius.toFloat(), 0)).move(0.0, 0.0, -height)
+            cylinder(height, lowRadius, lowRadius, 0)
 
         fun cylinder(height: Double, lowRadius: Double, highRadius: Double): Solid =
-            Solid(Manifold.Cylinder(height.toFloat(), lowRadius.toFloat(), highRadius.toFloat(), 0)).move(0.0, 0.0, -height)
+            cylinder(height, lowRadius, highRadius, 0)
 
         fun cylinder(height: Double, lowRadius: Double, highRadius: Double, facets: Int): Solid =
-            Solid(Manifold.Cylinder(height.toFloat(), lowRadius.toFloat(), highRadius.toFloat(), facets)).move(0.0, 0.0, -height)
+            Solid(Manifold.Cylinder(height.toFloat(), lowRadius.toFloat(), highRadius.toFloat(), Quality.segments(facets)))
+
+        /**
+         * A torus around the z axis, centered on the origin.
+         *
+         * @param majorRadius the distance from the z axis to the center of the tube.
+         * @param minorRadius the radius of the tube.
+         */
+        fun torus(majorRadius: Double, minorRadius: Double, segments: Int): Solid {
+            if (minorRadius >= majorRadius) {
+                throw SimplexEvaluationError(
+                    "A torus's tube radius ($minorRadius) must be smaller than its radius ($majorRadius)"
+                )
+            }
+            return Slice.circle(minorRadius, segments).translate(majorRadius, 0.0).revolve(segments, 360.0f)
+        }
+
+        /**
+         * A cylinder with hemispherical ends, centered on the origin along the z axis.
+         *
+         * @param height the overall height, including the ends.
+         */
+        fun capsule(height: Double, radius: Double, segments: Int): Solid {
+            if (height < 2.0 * radius) {
+                throw SimplexEvaluationError(
+                    "A capsule's height ($height) must be at least twice its radius ($radius)"
+                )
+            }
+            val ball = spheroid(radius, radius, radius, segments)
+            val offset = height / 2.0 - radius
+            return hullAll(listOf(ball.move(0.0, 0.0, -offset), ball.move(0.0, 0.0, offset)))
+        }
 
-        fun spheroid(x: Double, y: Double, z: Double, segments: Int): Solid =
-            Solid(Manifold.Sphere(x.toFloat(), segments).scale(1.0, y, z))
+        /** A regular prism standing on the origin, with a vertex on the x axis. */
+        fun prism(sides: Int, radius: Double, height: Double): Solid =
+            Slice.regularPolygon(sides, radius).extrude(height, 0, Vec2(1.0, 1.0), 0.0)
+
+        /** A pyramid over a base slice, with its apex at height [height] above the origin. */
+        fun pyramid(base: Slice, height: Double): Solid =
+            base.extrude(height, 0, Vec2(0.0, 0.0), 0.0)
+
+        /**
+         * A right-angled wedge with its minimum corner at the origin: a cuboid of the
+         * given size, cut diagonally from the top of its -x face to the bottom of its +x face.
+         */
+        fun wedge(x: Double, y: Double, z: Double): Solid =
+            hullPoints(
+                listOf(
+                    Vec3(0.0, 0.0, 0.0), Vec3(x, 0.0, 0.0), Vec3(0.0, 0.0, z),
+                    Vec3(0.0, y, 0.0), Vec3(x, y, 0.0), Vec3(0.0, y, z),
+                )
+            )
+
+        /**
+         * A cuboid with rounded edges and corners, centered on the origin. With a radius of 0,
+         * it's a plain cuboid.
+         */
+        fun roundedCuboid(size: Vec3, radius: Double, segments: Int): Solid {
+            if (radius < 0.0) {
+                throw SimplexEvaluationError("A rounded cuboid's radius ($radius) can't be negative")
+            }
+            if (2.0 * radius > minOf(size.x, size.y, size.z)) {
+                throw SimplexEvaluationError(
+                    "A rounded cuboid's radius ($radius) can be at most half of its smallest side"
+                )
+            }
+            if (radius == 0.0) {
+                return cuboid(size, true)
+            }
+            val ball = spheroid(radius, radius, radius, segments)
+            val dx = size.x / 2.0 - radius
+            val dy = size.y / 2.0 - radius
+            val dz = size.z / 2.0 - radius
+            val corners = listOf(-1.0, 1.0).flatMap { sx ->
+                listOf(-1.0, 1.0).flatMap { sy ->
+                    listOf(-1.0, 1.0).map { sz -> ball.move(sx * dx, sy * dy, sz * dz) }
+                }
+            }
+            return hullAll(corners)
+        }
+
+        /**
+         * An ovoid centered on the origin, with radius [x] along the x axis, [y] along the
+         * y axis and [z] along the z axis.
+         */
+        fun spheroid(x: Double, y: Double, z: Double, segments: Int): Solid {
+            if (x <= 0.0 && y <= 0.0 && z <= 0.0) {
+                throw SimplexEvaluationError("An ovoid needs a positive radius, but its radii are ($x, $y, $z)")
+            }
+            // Start from a sphere of the largest radius, so that the default number of
+            // segments is the one for the widest part of the ovoid.
+            val r = maxOf(x, y, z)
+            return Solid(Manifold.Sphere(r.toFloat(), Quality.segments(segments)).scale(x / r, y / r, z / r))
+        }
     }
 }
 
@@ -163,6 +354,20 @@ object SolidValueType : ValueType() {
         Type.simple(name)
     }
 
+    /**
+     * Report how many degenerate triangles an operation that changes tolerances removed.
+     * The counts are debugging output, so they're only shown at verbosity 2 and above.
+     */
+    private fun reportDegenerates(op: String, before: Solid, after: Solid, eps: Double) {
+        val threshold = if (eps > 0.0) eps else after.tolerance()
+        RootEnv.echo(
+            2,
+            "$op: ${before.degenerateTriangles(threshold)} degenerate triangles before, " +
+                "${after.degenerateTriangles(threshold)} after",
+            false,
+        )
+    }
+
     fun listToVec(solids: List<Solid>): ManifoldVector {
         return ManifoldVector(solids.map { it.manifold }.toTypedArray())
     }
@@ -183,30 +388,41 @@ object SolidValueType : ValueType() {
                             listOf(Param("x", FloatValueType.asType),
                                 Param("y", FloatValueType.asType),
                                 Param("z", FloatValueType.asType),
-                                Param("segments", IntegerValueType.asType))
+                                Param("segments", IntegerValueType.asType)),
+                            listOf(Param("radius", FloatValueType.asType), Param("anchor", StringValueType.asType)),
+                            listOf(Param("radius", FloatValueType.asType),
+                                Param("segments", IntegerValueType.asType),
+                                Param("anchor", StringValueType.asType)),
+                            listOf(Param("x", FloatValueType.asType),
+                                Param("y", FloatValueType.asType),
+                                Param("z", FloatValueType.asType),
+                                Param("segments", IntegerValueType.asType),
+                                Param("anchor", StringValueType.asType)),
                         ),
                         asType,
                     ),
                 ) {
                 override fun execute(args: List<Value>): Value {
-                    if (args.size == 1) {
-                        val radius = assertIsFloat(args[0])
-                        return Solid.spheroid(radius, radius, radius, 0)
-                    } else if (args.size == 2) {
-                        val radius = assertIsFloat(args[0])
-                        val segments = assertIsInt(args[1])
-                        return Solid.spheroid(radius, radius, radius, segments)
+                    val (params, anchor) = Anchor.split(args, signature)
+                    val result = if (params.size == 1) {
+                        val radius = assertIsFloat(params[0])
+                        Solid.spheroid(radius, radius, radius, 0)
+                    } else if (params.size == 2) {
+                        val radius = assertIsFloat(params[0])
+                        val segments = assertIsInt(params[1])
+                        Solid.spheroid(radius, radius, radius, segments)
                     } else {
-                        val x = assertIsFloat(args[0])
-                        val y = assertIsFloat(args[1])
-                        val z = assertIsFloat(args[2])
-                        val segments = if (args.size > 3) {
-                            assertIsInt(args[3])
+                        val x = assertIsFloat(params[0])
+                        val y = assertIsFloat(params[1])
+                        val z = assertIsFloat(params[2])
+                        val segments = if (params.size > 3) {
+                            assertIsInt(params[3])
                         } else {
                             0
                         }
-                        return Solid.spheroid(x, y, z, segments)
+                        Solid.spheroid(x, y, z, segments)
                     }
+                    return anchor?.let { result.anchor(it) } ?: result
                 }
             },
             object :
@@ -222,24 +438,41 @@ object SolidValueType : ValueType() {
                             listOf(Param("x", FloatValueType.asType),
                                 Param("y", FloatValueType.asType),
                                 Param("z", FloatValueType.asType),
-                                Param("centered", BooleanValueType.asType))),
+                                Param("centered", BooleanValueType.asType)),
+                            listOf(Param("v", Vec3ValueType.asType), Param("anchor", StringValueType.asType)),
+                            listOf(Param("x", FloatValueType.asType),
+                                Param("y", FloatValueType.asType),
+                                Param("z", FloatValueType.asType),
+                                Param("anchor", StringValueType.asType))),
                         asType,
                     ),
                 ) {
+                override fun overloadDeprecation(params: List<Type>): String? =
+                    if (params.last() == BooleanValueType.asType) {
+                        "use an anchor, \"center\" or \"min_corner\", instead of centered"
+                    } else {
+                        null
+                    }
+
                 override fun execute(args: List<Value>): Value {
-                    return if (args.size == 1) {
-                        Solid.cuboid(Vec3ValueType.assertIs(args[0]), true)
-                    } else if (args.size == 2) {
-                        Solid.cuboid(Vec3ValueType.assertIs(args[0]), assertIsBoolean(args[1]))
-                    } else if (args.size == 3) {
-                        Solid.cuboid(
-                            assertIsFloat(args[0]), assertIsFloat(args[1]),
-                            assertIsFloat(args[2]), true
-                        )
+                    val (params, anchor) = Anchor.split(args, signature)
+                    val size = if (params.size < 3) {
+                        Vec3ValueType.assertIs(params[0])
                     } else {
-                        Solid.cuboid(
-                            assertIsFloat(args[0]), assertIsFloat(args[1]),
-                            assertIsFloat(args[2]), assertIsBoolean(args[3]))
+                        Vec3(assertIsFloat(params[0]), assertIsFloat(params[1]), assertIsFloat(params[2]))
+                    }
+                    // The centered flag is deprecated, but still works.
+                    val center = if (params.size == 2 || params.size == 4) {
+                        assertIsBoolean(params.last())
+                    } else {
+                        true
+                    }
+                    // A cuboid's bounds are exact, so anchoring it doesn't move it by any rounding error.
+                    return when (anchor) {
+                        null -> Solid.cuboid(size, center)
+                        Anchor.Center -> Solid.cuboid(size, true)
+                        Anchor.MinCorner -> Solid.cuboid(size, false)
+                        else -> Solid.cuboid(size, true).anchor(anchor)
                     }
                 }
             },
@@ -259,35 +492,243 @@ object SolidValueType : ValueType() {
                                 Param("height", FloatValueType.asType),
                                 Param("radiusLow", FloatValueType.asType),
                                 Param("radiusHigh", FloatValueType.asType),
-                                Param("facets", IntegerValueType.asType))),
+                                Param("facets", IntegerValueType.asType)),
+                            listOf(
+                                Param("height", FloatValueType.asType),
+                                Param("radiusLow", FloatValueType.asType),
+                                Param("anchor", StringValueType.asType)),
+                            listOf(
+                                Param("height", FloatValueType.asType),
+                                Param("radiusLow", FloatValueType.asType),
+                                Param("radiusHigh", FloatValueType.asType),
+                                Param("anchor", StringValueType.asType)),
+                            listOf(
+                                Param("height", FloatValueType.asType),
+                                Param("radiusLow", FloatValueType.asType),
+                                Param("radiusHigh", FloatValueType.asType),
+                                Param("facets", IntegerValueType.asType),
+                                Param("anchor", StringValueType.asType))),
                         asType,
                     ),
                 ) {
                 override fun execute(args: List<Value>): Value {
-                    val height = assertIsFloat(args[0])
-                    val radiusLow = assertIsFloat(args[1])
-                    val radiusHigh = if (args.size > 2) {
-                        assertIsFloat(args[2])
+                    val (params, anchor) = Anchor.split(args, signature)
+                    val height = assertIsFloat(params[0])
+                    val radiusLow = assertIsFloat(params[1])
+                    val radiusHigh = if (params.size > 2) {
+                        assertIsFloat(params[2])
                     } else {
                         radiusLow
                     }
-                    val facets = if (args.size > 3) {
-                        assertIsInt(args[3])
+                    val facets = if (params.size > 3) {
+                        assertIsInt(params[3])
                     } else {
                         0
                     }
-                    return Solid.cylinder(height, radiusLow, radiusHigh, facets)
+                    val result = Solid.cylinder(height, radiusLow, radiusHigh, facets)
+                    // A cylinder's center, top and bottom are on its axis, so that one with an
+                    // odd number of facets isn't moved off of it to center its bounding box.
+                    return when (anchor ?: Anchor.Top) {
+                        Anchor.Bottom -> result
+                        Anchor.Center -> result.move(0.0, 0.0, -height / 2.0)
+                        Anchor.Top -> result.move(0.0, 0.0, -height)
+                        Anchor.MinCorner -> result.anchor(Anchor.MinCorner)
+                    }
                 }
             },
             object :
                 PrimitiveFunctionValue(
                     "tetrahedron",
-                    FunctionSignature.simple(listOf(Param("size", FloatValueType.asType)), asType),
+                    FunctionSignature.multi(
+                        listOf(
+                            listOf(Param("size", FloatValueType.asType)),
+                            listOf(Param("size", FloatValueType.asType), Param("anchor", StringValueType.asType)),
+                        ),
+                        asType,
+                    ),
                 ) {
                 override fun execute(args: List<Value>): Value {
+                    val (params, anchor) = Anchor.split(args, signature)
                     val tet = Manifold.Tetrahedron()
-                    val scale = assertIsFloat(args[0])
-                    return Solid(tet.scale(Vec3(scale, scale, scale).toDoubleVec3()))
+                    val scale = assertIsFloat(params[0])
+                    val result = Solid(tet.scale(Vec3(scale, scale, scale).toDoubleVec3()))
+                    return anchor?.let { result.anchor(it) } ?: result
+                }
+            },
+            object :
+                PrimitiveFunctionValue(
+                    "torus",
+                    FunctionSignature.multi(
+                        Anchor.withAnchors(
+                            listOf(
+                                listOf(Param("radius", FloatValueType.asType), Param("tube", FloatValueType.asType)),
+                                listOf(
+                                    Param("radius", FloatValueType.asType),
+                                    Param("tube", FloatValueType.asType),
+                                    Param("segments", IntegerValueType.asType)),
+                            )
+                        ),
+                        asType,
+                    ),
+                ) {
+                override fun execute(args: List<Value>): Value {
+                    val (params, anchor) = Anchor.split(args, signature)
+                    val segments = if (params.size > 2) {
+                        assertIsInt(params[2])
+                    } else {
+                        0
+                    }
+                    val result = Solid.torus(assertIsFloat(params[0]), assertIsFloat(params[1]), segments)
+                    return anchor?.let { result.anchor(it) } ?: result
+                }
+            },
+            object :
+                PrimitiveFunctionValue(
+                    "capsule",
+                    FunctionSignature.multi(
+                        Anchor.withAnchors(
+                            listOf(
+                                listOf(Param("height", FloatValueType.asType), Param("radius", FloatValueType.asType)),
+                                listOf(
+                                    Param("height", FloatValueType.asType),
+                                    Param("radius", FloatValueType.asType),
+                                    Param("segments", IntegerValueType.asType)),
+                            )
+                        ),
+                        asType,
+                    ),
+                ) {
+                override fun execute(args: List<Value>): Value {
+                    val (params, anchor) = Anchor.split(args, signature)
+                    val segments = if (params.size > 2) {
+                        assertIsInt(params[2])
+                    } else {
+                        0
+                    }
+                    val result = Solid.capsule(assertIsFloat(params[0]), assertIsFloat(params[1]), segments)
+                    return anchor?.let { result.anchor(it) } ?: result
+                }
+            },
+            object :
+                PrimitiveFunctionValue(
+                    "prism",
+                    FunctionSignature.multi(
+                        Anchor.withAnchors(
+                            listOf(
+                                listOf(
+                                    Param("sides", IntegerValueType.asType),
+                                    Param("radius", FloatValueType.asType),
+                                    Param("height", FloatValueType.asType)),
+                            )
+                        ),
+                        asType,
+                    ),
+                ) {
+                override fun execute(args: List<Value>): Value {
+                    val (params, anchor) = Anchor.split(args, signature)
+                    val result = Solid.prism(assertIsInt(params[0]), assertIsFloat(params[1]), assertIsFloat(params[2]))
+                    return anchor?.let { result.anchor(it) } ?: result
+                }
+            },
+            object :
+                PrimitiveFunctionValue(
+                    "pyramid",
+                    FunctionSignature.multi(
+                        Anchor.withAnchors(
+                            listOf(
+                                listOf(Param("base", SliceValueType.asType), Param("height", FloatValueType.asType)),
+                            )
+                        ),
+                        asType,
+                    ),
+                ) {
+                override fun execute(args: List<Value>): Value {
+                    val (params, anchor) = Anchor.split(args, signature)
+                    val result = Solid.pyramid(SliceValueType.assertIs(params[0]), assertIsFloat(params[1]))
+                    return anchor?.let { result.anchor(it) } ?: result
+                }
+            },
+            object :
+                PrimitiveFunctionValue(
+                    "wedge",
+                    FunctionSignature.multi(
+                        Anchor.withAnchors(
+                            listOf(
+                                listOf(
+                                    Param("x", FloatValueType.asType),
+                                    Param("y", FloatValueType.asType),
+                                    Param("z", FloatValueType.asType)),
+                            )
+                        ),
+                        asType,
+                    ),
+                ) {
+                override fun execute(args: List<Value>): Value {
+                    val (params, anchor) = Anchor.split(args, signature)
+                    val result = Solid.wedge(assertIsFloat(params[0]), assertIsFloat(params[1]), assertIsFloat(params[2]))
+                    return anchor?.let { result.anchor(it) } ?: result
+                }
+            },
+            object :
+                PrimitiveFunctionValue(
+                    "rounded_cuboid",
+                    FunctionSignature.multi(
+                        Anchor.withAnchors(
+                            listOf(
+                                listOf(Param("size", Vec3ValueType.asType), Param("radius", FloatValueType.asType)),
+                                listOf(
+                                    Param("size", Vec3ValueType.asType),
+                                    Param("radius", FloatValueType.asType),
+                                    Param("segments", IntegerValueType.asType)),
+                            )
+                        ),
+                        asType,
+                    ),
+                ) {
+                override fun execute(args: List<Value>): Value {
+                    val (params, anchor) = Anchor.split(args, signature)
+                    val segments = if (params.size > 2) {
+                        assertIsInt(params[2])
+                    } else {
+                        0
+                    }
+                    val result = Solid.roundedCuboid(Vec3ValueType.assertIs(params[0]), assertIsFloat(params[1]), segments)
+                    return anchor?.let { result.anchor(it) } ?: result
+                }
+            },
+            object :
+                PrimitiveFunctionValue(
+                    "compose",
+                    FunctionSignature.simple(listOf(Param("solids", Type.vector(asType))), asType),
+                ) {
+                override fun execute(args: List<Value>): Value {
+                    val solids =
+                        VectorValueType.of(this@SolidValueType).assertIs(args[0]).elements.map { assertIs(it) }
+                    return Solid.compose(solids)
+                }
+            },
+            object :
+                PrimitiveFunctionValue(
+                    "hull_all",
+                    FunctionSignature.simple(listOf(Param("solids", Type.vector(asType))), asType),
+                ) {
+                override fun execute(args: List<Value>): Value {
+                    val solids =
+                        VectorValueType.of(this@SolidValueType).assertIs(args[0]).elements.map { assertIs(it) }
+                    return Solid.hullAll(solids)
+                }
+            },
+            object :
+                PrimitiveFunctionValue(
+                    "hull_points",
+                    FunctionSignature.simple(listOf(Param("points", Type.vector(Vec3ValueType.asType))), asType),
+                ) {
+                override fun execute(args: List<Value>): Value {
+                    val points =
+                        VectorValueType.of(Vec3ValueType).assertIs(args[0]).elements.map {
+                            Vec3ValueType.assertIs(it)
+                        }
+                    return Solid.hullPoints(points)
                 }
             },
             object: PrimitiveFunctionValue(
@@ -297,7 +738,7 @@ object SolidValueType : ValueType() {
                                                 asType)
                 ) {
                 override fun execute(args: List<Value>): Value {
-                    val solids = ArrayList(VectorValueType.of(this@SolidValueType).assertIs(args[0]).elements.map { (it as Solid).manifold })
+                    val solids = ArrayList(VectorValueType.of(this@SolidValueType).assertIs(args[0]).elements.map { Tolerance.apply((it as Solid).manifold) })
                     val vec = ManifoldVector(solids)
                     return Solid(Manifold.BatchBoolean(vec, ManifoldOpType.Add.opCode))
                 }
@@ -305,6 +746,51 @@ object SolidValueType : ValueType() {
         )
     }
 
+    /**
+     * The primitives that back the OpenSCAD compatibility library. They aren't installed
+     * in the root environment; see [OpenScad.builtins].
+     */
+    val scadFunctions: List<PrimitiveFunctionValue> by lazy {
+        listOf(
+            object :
+                PrimitiveFunctionValue(
+                    "scad_sphere",
+                    FunctionSignature.simple(
+                        listOf(Param("r", FloatValueType.asType), Param("fn", IntegerValueType.asType)),
+                        asType,
+                    ),
+                ) {
+                override fun execute(args: List<Value>): Value {
+                    return OpenScad.sphere(assertIsFloat(args[0]), assertIsInt(args[1]))
+                }
+            },
+            object :
+                PrimitiveFunctionValue(
+                    "scad_cylinder",
+                    FunctionSignature.simple(
+                        listOf(
+                            Param("h", FloatValueType.asType),
+                            Param("r1", FloatValueType.asType),
+                            Param("r2", FloatValueType.asType),
+                            Param("center", BooleanValueType.asType),
+                            Param("fn", IntegerValueType.asType),
+                        ),
+                        asType,
+                    ),
+                ) {
+                override fun execute(args: List<Value>): Value {
+                    return OpenScad.cylinder(
+                        assertIsFloat(args[0]),
+                        assertIsFloat(args[1]),
+                        assertIsFloat(args[2]),
+                        assertIsBoolean(args[3]),
+                        assertIsInt(args[4]),
+                    )
+                }
+            }
+        )
+    }
+
     override val providesPrimitiveMethods: List<PrimitiveMethod> by lazy {
         listOf(
             object: PrimitiveMethod(
@@ -468,6 +954,27 @@ object SolidValueType : ValueType() {
                         }
                     }
                       },
+            object :
+                PrimitiveMethod(
+                    "rot",
+                    MethodSignature.simple(
+                        asType,
+                        listOf(
+                            Param("x", FloatValueType.asType),
+                            Param("y", FloatValueType.asType),
+                            Param("z", FloatValueType.asType),
+                        ),
+                        asType,
+                    ),
+                ) {
+                // The name of rotate in Simplex 0.1.
+                override val deprecation: String = "use rotate"
+
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    val self = assertIs(target)
+                    return self.rotate(assertIsFloat(args[0]), assertIsFloat(args[1]), assertIsFloat(args[2]))
+                }
+            },
             object: PrimitiveMethod(
                 "rotx",
                 MethodSignature.simple(asType, listOf(Param("angle", FloatValueType.asType)), asType)) {
@@ -506,6 +1013,81 @@ object SolidValueType : ValueType() {
                     return self.mirror(norm)
                 }
             },
+            object :
+                PrimitiveMethod(
+                    "tolerance",
+                    MethodSignature.simple(asType, emptyList<Param>(), FloatValueType.asType),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    return FloatValue(assertIs(target).tolerance())
+                }
+            },
+            object :
+                PrimitiveMethod(
+                    "set_tolerance",
+                    MethodSignature.simple(asType, listOf(Param("eps", FloatValueType.asType)), asType),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    val self = assertIs(target)
+                    val eps = assertIsFloat(args[0])
+                    val result = self.setTolerance(eps)
+                    reportDegenerates("set_tolerance($eps)", self, result, eps)
+                    return result
+                }
+            },
+            object :
+                PrimitiveMethod(
+                    "simplify",
+                    MethodSignature.multi(
+                        asType,
+                        listOf(emptyList<Param>(), listOf(Param("eps", FloatValueType.asType))),
+                        asType,
+                    ),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    val self = assertIs(target)
+                    val eps = if (args.isNotEmpty()) assertIsFloat(args[0]) else 0.0
+                    val result = self.simplify(eps)
+                    reportDegenerates("simplify(${if (eps > 0.0) eps else ""})", self, result, eps)
+                    return result
+                }
+            },
+            object :
+                PrimitiveMethod(
+                    "degenerate_triangles",
+                    MethodSignature.multi(
+                        asType,
+                        listOf(emptyList<Param>(), listOf(Param("eps", FloatValueType.asType))),
+                        IntegerValueType.asType,
+                    ),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    val eps = if (args.isNotEmpty()) assertIsFloat(args[0]) else 0.0
+                    return IntegerValue(assertIs(target).degenerateTriangles(eps))
+                }
+            },
+            object :
+                PrimitiveMethod(
+                    "tetrahedralize",
+                    MethodSignature.multi(
+                        asType,
+                        listOf(
+                            listOf(Param("max_volume", FloatValueType.asType)),
+                            listOf(Param("max_volume", FloatValueType.asType), Param("quality", FloatValueType.asType)),
+                        ),
+                        TetMeshValueType.asType,
+                    ),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    val self = assertIs(target)
+                    val maxVolume = assertIsFloat(args[0])
+                    return if (args.size > 1) {
+                        self.tetrahedralize(maxVolume, assertIsFloat(args[1]))
+                    } else {
+                        self.tetrahedralize(maxVolume)
+                    }
+                }
+            },
             object :
                 PrimitiveMethod(
                     "refine",
@@ -580,6 +1162,30 @@ object SolidValueType : ValueType() {
                     return self.volume()
                 }
             },
+            object :
+                PrimitiveMethod(
+                    "faces_from",
+                    MethodSignature.multi(
+                        asType,
+                        listOf(
+                            listOf(
+                                Param("file", StringValueType.asType),
+                                Param("line", IntegerValueType.asType)),
+                            listOf(Param("source", asType)),
+                        ),
+                        Type.vector(IntegerValueType.asType),
+                    ),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    val self = assertIs(target)
+                    val faces = if (args[0] is Solid) {
+                        Provenance.facesFrom(self, assertIs(args[0]))
+                    } else {
+                        Provenance.facesFrom(self, assertIsString(args[0]), assertIsInt(args[1]))
+                    }
+                    return VectorValue(IntegerValueType, faces.map { IntegerValue(it) })
+                }
+            },
             object :
                 PrimitiveMethod(
                     "split_by_plane",
@@ -610,6 +1216,26 @@ object SolidValueType : ValueType() {
                     return self.split(other)
                 }
             },
+            object :
+                PrimitiveMethod(
+                    "decompose",
+                    MethodSignature.simple(asType, emptyList<Param>(), Type.vector(asType)),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    val self = assertIs(target)
+                    return VectorValue(SolidValueType, self.decompose())
+                }
+            },
+            object :
+                PrimitiveMethod(
+                    "num_components",
+                    MethodSignature.simple(asType, emptyList<Param>(), IntegerValueType.asType),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    val self = assertIs(target)
+                    return IntegerValue(self.numComponents())
+                }
+            },
             object: PrimitiveMethod("hull",
                 MethodSignature.simple(asType,
                     emptyList<Param>(), asType)) {
@@ -714,6 +1340,20 @@ object SolidValueType : ValueType() {
                     return self.project()
                 }
             },
+            object :
+                PrimitiveMethod(
+                    "unfold",
+                    MethodSignature.simple(
+                        asType,
+                        emptyList<Param>(),
+                        Type.vector(SliceValueType.asType),
+                    ),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    val self = assertIs(target)
+                    return VectorValue(SliceValueType, self.unfold())
+                }
+            },
             object :
                 PrimitiveMethod(
                     "refine_to_length",
@@ -725,6 +1365,33 @@ object SolidValueType : ValueType() {
                     return self.refineToLength(length)
                 }
             },
+            object:
+                PrimitiveMethod(
+                    "as_modifier",
+                    MethodSignature.simple(asType, emptyList<Param>(), SlicerVolumeValueType.asType),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    return SlicerVolume(SlicerRole.Modifier, assertIs(target))
+                }
+            },
+            object:
+                PrimitiveMethod(
+                    "as_support_blocker",
+                    MethodSignature.simple(asType, emptyList<Param>(), SlicerVolumeValueType.asType),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    return SlicerVolume(SlicerRole.SupportBlocker, assertIs(target))
+                }
+            },
+            object:
+                PrimitiveMethod(
+                    "as_support_enforcer",
+                    MethodSignature.simple(asType, emptyList<Param>(), SlicerVolumeValueType.asType),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    return SlicerVolume(SlicerRole.SupportEnforcer, assertIs(target))
+                }
+            },
             object: PrimitiveMethod("set_material",
                 MethodSignature.simple(asType,
                     listOf(Param("material", SMaterialValueType.asType)),
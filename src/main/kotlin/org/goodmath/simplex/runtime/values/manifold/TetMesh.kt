@@ -0,0 +1,338 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import kotlin.math.min
+import kotlin.math.sqrt
+import org.goodmath.simplex.ast.types.Type
+import org.goodmath.simplex.runtime.Env
+import org.goodmath.simplex.runtime.values.MethodSignature
+import org.goodmath.simplex.runtime.values.Param
+import org.goodmath.simplex.runtime.values.Value
+import org.goodmath.simplex.runtime.values.ValueType
+import org.goodmath.simplex.runtime.values.primitives.FloatValue
+import org.goodmath.simplex.runtime.values.primitives.FloatValueType
+import org.goodmath.simplex.runtime.values.primitives.IntegerValue
+import org.goodmath.simplex.runtime.values.primitives.IntegerValueType
+import org.goodmath.simplex.runtime.values.primitives.PrimitiveFunctionValue
+import org.goodmath.simplex.runtime.values.primitives.PrimitiveMethod
+import org.goodmath.simplex.twist.Twist
+
+/**
+ * A tetrahedral volume mesh, for finite element analysis. A product that produces a
+ * tetrahedral mesh writes it in Gmsh, VTK and Abaqus formats.
+ *
+ * @param nodes the coordinates of the nodes, as consecutive x, y, z triples.
+ * @param tets the indices of the nodes of each tetrahedron, as consecutive groups of
+ *    four. The first three nodes of a tetrahedron are counter-clockwise when seen
+ *    from the fourth, which is the order that Gmsh, VTK and Abaqus all expect.
+ */
+class TetMesh(val nodes: DoubleArray, val tets: IntArray) : Value {
+    override val valueType: ValueType = TetMeshValueType
+
+    val nodeCount: Int
+        get() = nodes.size / 3
+
+    val tetCount: Int
+        get() = tets.size / 4
+
+    override fun twist(): Twist =
+        Twist.obj(
+            "TetMesh",
+            Twist.attr("nodes", nodeCount.toString()),
+            Twist.attr("tets", tetCount.toString()),
+        )
+
+    fun node(i: Int): MeshData.Vec3Coords =
+        MeshData.Vec3Coords(nodes[3 * i], nodes[3 * i + 1], nodes[3 * i + 2])
+
+    fun tetVolume(t: Int): Double =
+        signedVolume(nodes, tets[4 * t], tets[4 * t + 1], tets[4 * t + 2], tets[4 * t + 3])
+
+    fun volume(): Double = (0 until tetCount).sumOf { tetVolume(it) }
+
+    /**
+     * The radius of the circumsphere of a tetrahedron divided by its shortest edge: about
+     * 0.61 for a regular tetrahedron, and larger the worse the tetrahedron is shaped.
+     */
+    fun radiusEdgeRatio(t: Int): Double {
+        val v = IntArray(4) { tets[4 * t + it] }
+        val sphere = circumsphere(nodes, v[0], v[1], v[2], v[3]) ?: return Double.POSITIVE_INFINITY
+        var shortest = Double.POSITIVE_INFINITY
+        for (i in 0 until 4) {
+            for (j in i + 1 until 4) {
+                shortest = min(shortest, distanceSquared(nodes, v[i], v[j]))
+            }
+        }
+        return sqrt(sphere[3] / shortest)
+    }
+
+    /** The largest radius-edge ratio of any tetrahedron in the mesh. */
+    fun worstQuality(): Double = (0 until tetCount).maxOfOrNull { radiusEdgeRatio(it) } ?: 0.0
+
+    /**
+     * The faces on the boundary of the mesh, which belong to only one tetrahedron. Each
+     * face is encoded as the index of its tetrahedron times four, plus the index within
+     * the tetrahedron of the node opposite the face.
+     */
+    val boundary: IntArray by lazy {
+        val open = LinkedHashMap<List<Int>, Int>()
+        for (t in 0 until tetCount) {
+            for (k in 0 until 4) {
+                val key = (0 until 4).filter { it != k }.map { tets[4 * t + it] }.sorted()
+                if (open.remove(key) == null) {
+                    open[key] = 4 * t + k
+                }
+            }
+        }
+        open.values.toIntArray()
+    }
+
+    /** The nodes of a boundary face, counter-clockwise when seen from outside the mesh. */
+    fun faceNodes(face: Int): IntArray {
+        val t = face / 4
+        return OUTWARD_FACES[face % 4].map { tets[4 * t + it] }.toIntArray()
+    }
+
+    /**
+     * The mesh in Gmsh's version 2.2 ASCII format, which most FEA tools can read. The
+     * tetrahedra are in the physical group "volume", and the triangles of the boundary,
+     * which boundary conditions can be applied to, are in the group "boundary".
+     */
+    fun toMsh(): String {
+        val out = StringBuilder()
+        out.append("\$MeshFormat\n2.2 0 8\n\$EndMeshFormat\n")
+        out.append("\$PhysicalNames\n2\n2 1 \"boundary\"\n3 2 \"volume\"\n\$EndPhysicalNames\n")
+        out.append("\$Nodes\n$nodeCount\n")
+        for (i in 0 until nodeCount) {
+            val p = node(i)
+            out.append("${i + 1} ${p.x} ${p.y} ${p.z}\n")
+        }
+        out.append("\$EndNodes\n\$Elements\n${boundary.size + tetCount}\n")
+        var id = 1
+        for (face in boundary) {
+            val n = faceNodes(face)
+            out.append("${id++} 2 2 1 1 ${n[0] + 1} ${n[1] + 1} ${n[2] + 1}\n")
+        }
+        for (t in 0 until tetCount) {
+            val n = (0 until 4).joinToString(" ") { (tets[4 * t + it] + 1).toString() }
+            out.append("${id++} 4 2 2 1 $n\n")
+        }
+        out.append("\$EndElements\n")
+        return out.toString()
+    }
+
+    /** The mesh as a VTK XML unstructured grid, for ParaView and other VTK tools. */
+    fun toVtu(): String {
+        val out = StringBuilder()
+        out.append("<?xml version=\"1.0\"?>\n")
+        out.append("<VTKFile type=\"UnstructuredGrid\" version=\"0.1\" byte_order=\"LittleEndian\">\n")
+        out.append(" <UnstructuredGrid>\n")
+        out.append("  <Piece NumberOfPoints=\"$nodeCount\" NumberOfCells=\"$tetCount\">\n")
+        out.append("   <Points>\n    <DataArray type=\"Float64\" NumberOfComponents=\"3\" format=\"ascii\">\n")
+        for (i in 0 until nodeCount) {
+            val p = node(i)
+            out.append("     ${p.x} ${p.y} ${p.z}\n")
+        }
+        out.append("    </DataArray>\n   </Points>\n   <Cells>\n")
+        out.append("    <DataArray type=\"Int64\" Name=\"connectivity\" format=\"ascii\">\n")
+        for (t in 0 until tetCount) {
+            out.append("     ${(0 until 4).joinToString(" ") { tets[4 * t + it].toString() }}\n")
+        }
+        out.append("    </DataArray>\n    <DataArray type=\"Int64\" Name=\"offsets\" format=\"ascii\">\n")
+        out.append("     ${(1..tetCount).joinToString(" ") { (4 * it).toString() }}\n")
+        out.append("    </DataArray>\n    <DataArray type=\"UInt8\" Name=\"types\" format=\"ascii\">\n")
+        out.append("     ${(0 until tetCount).joinToString(" ") { VTK_TETRA.toString() }}\n")
+        out.append("    </DataArray>\n   </Cells>\n  </Piece>\n </UnstructuredGrid>\n</VTKFile>\n")
+        return out.toString()
+    }
+
+    /**
+     * The mesh as an Abaqus input file, with C3D4 elements in the element set VOLUME.
+     * The boundary is the node set BOUNDARY, and the element-based surface BOUNDARY, for
+     * applying boundary conditions and loads.
+     */
+    fun toInp(name: String): String {
+        val out = StringBuilder()
+        out.append("*HEADING\n$name: tetrahedral mesh from simplex\n")
+        out.append("*NODE\n")
+        for (i in 0 until nodeCount) {
+            val p = node(i)
+            out.append("${i + 1}, ${p.x}, ${p.y}, ${p.z}\n")
+        }
+        out.append("*ELEMENT, TYPE=C3D4, ELSET=VOLUME\n")
+        for (t in 0 until tetCount) {
+            val n = (0 until 4).joinToString(", ") { (tets[4 * t + it] + 1).toString() }
+            out.append("${t + 1}, $n\n")
+        }
+        out.append("*NSET, NSET=BOUNDARY\n")
+        val boundaryNodes = boundary.flatMap { faceNodes(it).toList() }.distinct().sorted()
+        // Abaqus allows at most 16 entries on a data line.
+        for (line in boundaryNodes.chunked(16)) {
+            out.append(line.joinToString(", ") { (it + 1).toString() } + "\n")
+        }
+        out.append("*SURFACE, NAME=BOUNDARY, TYPE=ELEMENT\n")
+        for (face in boundary) {
+            out.append("${face / 4 + 1}, S${ABAQUS_FACES[face % 4]}\n")
+        }
+        return out.toString()
+    }
+
+    companion object {
+        /** The VTK cell type of a linear tetrahedron. */
+        const val VTK_TETRA = 10
+
+        /**
+         * For each node of a tetrahedron, the other three nodes, in the order that makes
+         * the face opposite that node counter-clockwise when seen from outside.
+         */
+        private val OUTWARD_FACES = listOf(listOf(1, 2, 3), listOf(0, 3, 2), listOf(0, 1, 3), listOf(0, 2, 1))
+
+        /** For each node of a tetrahedron, the Abaqus number of the face opposite it. */
+        private val ABAQUS_FACES = intArrayOf(3, 4, 2, 1)
+
+        /**
+         * The signed volume of the tetrahedron with vertices [a], [b], [c] and [d] in an
+         * array of x, y, z triples: positive if the first three are counter-clockwise when
+         * seen from the fourth.
+         */
+        fun signedVolume(p: DoubleArray, a: Int, b: Int, c: Int, d: Int): Double {
+            val ax = p[3 * a]
+            val ay = p[3 * a + 1]
+            val az = p[3 * a + 2]
+            val bx = p[3 * b] - ax
+            val by = p[3 * b + 1] - ay
+            val bz = p[3 * b + 2] - az
+            val cx = p[3 * c] - ax
+            val cy = p[3 * c + 1] - ay
+            val cz = p[3 * c + 2] - az
+            val dx = p[3 * d] - ax
+            val dy = p[3 * d + 1] - ay
+            val dz = p[3 * d + 2] - az
+            return (bx * (cy * dz - cz * dy) + by * (cz * dx - cx * dz) + bz * (cx * dy - cy * dx)) / 6.0
+        }
+
+        /**
+         * The circumsphere of a tetrahedron, as its center's x, y and z, and its squared
+         * radius; or null if the tetrahedron is flat.
+         */
+        fun circumsphere(p: DoubleArray, a: Int, b: Int, c: Int, d: Int): DoubleArray? {
+            val ax = p[3 * a]
+            val ay = p[3 * a + 1]
+            val az = p[3 * a + 2]
+            val ux = p[3 * b] - ax
+            val uy = p[3 * b + 1] - ay
+            val uz = p[3 * b + 2] - az
+            val vx = p[3 * c] - ax
+            val vy = p[3 * c + 1] - ay
+            val vz = p[3 * c + 2] - az
+            val wx = p[3 * d] - ax
+            val wy = p[3 * d + 1] - ay
+            val wz = p[3 * d + 2] - az
+            val vwx = vy * wz - vz * wy
+            val vwy = vz * wx - vx * wz
+            val vwz = vx * wy - vy * wx
+            val det = 2.0 * (ux * vwx + uy * vwy + uz * vwz)
+            if (det == 0.0) {
+                return null
+            }
+            val wux = wy * uz - wz * uy
+            val wuy = wz * ux - wx * uz
+            val wuz = wx * uy - wy * ux
+            val uvx = uy * vz - uz * vy
+            val uvy = uz * vx - ux * vz
+            val uvz = ux * vy - uy * vx
+            val uu = ux * ux + uy * uy + uz * uz
+            val vv = vx * vx + vy * vy + vz * vz
+            val ww = wx * wx + wy * wy + wz * wz
+            val cx = (uu * vwx + vv * wux + ww * uvx) / det
+            val cy = (uu * vwy + vv * wuy + ww * uvy) / det
+            val cz = (uu * vwz + vv * wuz + ww * uvz) / det
+            return doubleArrayOf(ax + cx, ay + cy, az + cz, cx * cx + cy * cy + cz * cz)
+        }
+
+        fun distanceSquared(p: DoubleArray, a: Int, b: Int): Double {
+            val dx = p[3 * a] - p[3 * b]
+            val dy = p[3 * a + 1] - p[3 * b + 1]
+            val dz = p[3 * a + 2] - p[3 * b + 2]
+            return dx * dx + dy * dy + dz * dz
+        }
+    }
+}
+
+object TetMeshValueType : ValueType() {
+    override val name: String = "TetMesh"
+
+    override val asType: Type by lazy { Type.simple(name) }
+
+    override val supportsText: Boolean = true
+
+    override fun toText(v: Value): String {
+        val mesh = assertIs(v)
+        return "TetMesh(${mesh.nodeCount} nodes, ${mesh.tetCount} tetrahedra)"
+    }
+
+    override fun isTruthy(v: Value): Boolean = assertIs(v).tetCount > 0
+
+    override val providesFunctions: List<PrimitiveFunctionValue> = emptyList()
+
+    override val providesPrimitiveMethods: List<PrimitiveMethod> by lazy {
+        listOf(
+            object :
+                PrimitiveMethod(
+                    "num_nodes",
+                    MethodSignature.simple(asType, emptyList<Param>(), IntegerValueType.asType),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    return IntegerValue(assertIs(target).nodeCount)
+                }
+            },
+            object :
+                PrimitiveMethod(
+                    "num_tets",
+                    MethodSignature.simple(asType, emptyList<Param>(), IntegerValueType.asType),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    return IntegerValue(assertIs(target).tetCount)
+                }
+            },
+            object :
+                PrimitiveMethod(
+                    "volume",
+                    MethodSignature.simple(asType, emptyList<Param>(), FloatValueType.asType),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    return FloatValue(assertIs(target).volume())
+                }
+            },
+            object :
+                PrimitiveMethod(
+                    "worst_quality",
+                    MethodSignature.simple(asType, emptyList<Param>(), FloatValueType.asType),
+                ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    return FloatValue(assertIs(target).worstQuality())
+                }
+            },
+        )
+    }
+
+    override val providesVariables: Map<String, Value> = emptyMap()
+
+    override fun assertIs(v: Value): TetMesh {
+        return v as? TetMesh ?: throwTypeError(v)
+    }
+}
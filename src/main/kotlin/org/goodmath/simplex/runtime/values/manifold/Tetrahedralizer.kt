@@ -0,0 +1,810 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import java.util.Random
+import kotlin.math.cbrt
+import kotlin.math.ceil
+import kotlin.math.floor
+import kotlin.math.max
+import kotlin.math.min
+import kotlin.math.sqrt
+import org.goodmath.simplex.runtime.SimplexEvaluationError
+
+/**
+ * Fills a solid with tetrahedra, for finite element analysis.
+ *
+ * The mesh is a Delaunay tetrahedralization of points sampled from the solid, which
+ * conforms to its surface. Every vertex of the surface is a node, exactly where it is,
+ * and the surface triangles are split at the midpoints of their edges until they're
+ * smaller than the elements, so that the surface of the mesh is the surface of the
+ * solid. The interior is filled with a body-centered cubic lattice, which
+ * tetrahedralizes into well-shaped elements. Any surface triangle that isn't a face of
+ * the tetrahedralization is split further, until they all are; then the tetrahedra are
+ * inside the solid if getting to them from outside crosses the surface an odd number
+ * of times.
+ *
+ * Then the mesh is refined by inserting a point at the circumcenter of each element
+ * that's larger than [maxVolume] or worse shaped than [quality], until every element
+ * meets both bounds. An element at the boundary whose circumcenter is outside the
+ * solid can't be refined that way: its surface triangle is split instead, or if it has
+ * none, it's split at its centroid if it's too large, and left as it is if it's only
+ * badly shaped.
+ *
+ * @param mesh the surface of the solid: a closed manifold.
+ * @param maxVolume the largest volume of an element.
+ * @param quality the largest radius-edge ratio of an element: the radius of its
+ *    circumsphere divided by its shortest edge. A regular tetrahedron has a ratio of
+ *    about 0.61; the bound has to be at least 1.0 for refinement to finish.
+ */
+class Tetrahedralizer(val mesh: MeshData, val maxVolume: Double, val quality: Double = 2.0) {
+    // The edge length of the cubes of the interior lattice. The Delaunay tetrahedra of a
+    // body-centered cubic lattice each have a twelfth of the volume of a cube, so the
+    // lattice tetrahedra have half of the maximum volume.
+    private val spacing = cbrt(6.0 * maxVolume)
+
+    private val random = Random(1)
+    private val inside by lazy { InsideTest(mesh) }
+    private val lo = DoubleArray(3)
+    private val hi = DoubleArray(3)
+
+    // The points, as consecutive x, y, z triples. The first four are the corners of a
+    // tetrahedron around the whole solid, which the triangulation starts from.
+    private var coords = DoubleArray(3 * 1024)
+    private var pointCount = 0
+
+    // The tetrahedra, in slots that are reused when a tetrahedron is deleted. Each has
+    // four vertices, positively oriented, and four neighbors, where neighbor i is across
+    // the face opposite vertex i, or -1 outside the enclosing tetrahedron. The first
+    // vertex of a deleted tetrahedron is -1.
+    private var verts = IntArray(4 * 1024)
+    private var neighbors = IntArray(4 * 1024)
+    // The circumcenter and squared circumradius of each tetrahedron.
+    private var spheres = DoubleArray(4 * 1024)
+    // How many times each slot has been used, to tell whether a slot still holds the
+    // same tetrahedron.
+    private var generations = IntArray(1024)
+    // Whether each tetrahedron is inside the solid: 0 if it hasn't been classified yet,
+    // 1 if it is, and 2 if it isn't.
+    private var interior = ByteArray(1024)
+    private var marks = IntArray(1024)
+    private var slotCount = 0
+    private val freeSlots = ArrayList<Int>()
+    private var stamp = 0
+    private var lastTet = 0
+
+    private val cavity = ArrayList<Int>()
+    private val openFaces = HashMap<Long, Int>()
+
+    // The triangles of the surface, as the points at their corners, counter-clockwise
+    // from outside. They're split as points are added to the surface, in slots that
+    // are kept in place; the surface triangles on each edge and with each set of
+    // corners are indexed by their slots.
+    private val surface = ArrayList<IntArray>()
+    private val surfaceEdges = HashMap<Long, MutableList<Int>>()
+    private val surfaceFaces = HashMap<Long, Int>()
+
+    // The samples taken so far, bucketed in cubes, to keep new samples from crowding them.
+    private val sampleCell = LATTICE_CLEARANCE * spacing
+    private val samples = HashMap<Long, MutableList<Int>>()
+
+    fun tetrahedralize(): TetMesh {
+        if (maxVolume <= 0.0) {
+            throw SimplexEvaluationError("The maximum volume of a tetrahedron must be positive, not $maxVolume")
+        }
+        if (quality < 1.0) {
+            throw SimplexEvaluationError("The radius-edge ratio bound of a tetrahedral mesh must be at least 1.0, not $quality")
+        }
+        if (mesh.triangleCount == 0) {
+            throw SimplexEvaluationError("Can't tetrahedralize an empty solid")
+        }
+        val volume = meshVolume(mesh)
+        if (volume / (3.0 * maxVolume) > MAX_NODES) {
+            throw SimplexEvaluationError(
+                "A solid with a volume of $volume would need more than $MAX_NODES nodes " +
+                    "for tetrahedra with a volume of $maxVolume"
+            )
+        }
+        enclose()
+        sampleSurface()
+        fillInterior()
+        recoverSurface()
+        classify()
+        refine()
+        return collect()
+    }
+
+    /** Start the triangulation with a single tetrahedron, far larger than the solid. */
+    private fun enclose() {
+        lo.fill(Double.MAX_VALUE)
+        hi.fill(-Double.MAX_VALUE)
+        for (v in 0 until mesh.vertexCount) {
+            for (c in 0 until 3) {
+                lo[c] = min(lo[c], mesh.vertices[3 * v + c])
+                hi[c] = max(hi[c], mesh.vertices[3 * v + c])
+            }
+        }
+        val size = max(hi[0] - lo[0], max(hi[1] - lo[1], hi[2] - lo[2]))
+        val m = 10.0 * size + spacing
+        val cx = (lo[0] + hi[0]) / 2.0
+        val cy = (lo[1] + hi[1]) / 2.0
+        val cz = (lo[2] + hi[2]) / 2.0
+        addPoint(cx - m, cy - m, cz - m)
+        addPoint(cx + 6.0 * m, cy - m, cz - m)
+        addPoint(cx - m, cy + 6.0 * m, cz - m)
+        addPoint(cx - m, cy - m, cz + 6.0 * m)
+        val t = newTet()
+        for (i in 0 until 4) {
+            verts[4 * t + i] = i
+            neighbors[4 * t + i] = -1
+        }
+        computeSphere(t)
+        lastTet = t
+    }
+
+    /**
+     * Sample the surface: its vertices, exactly where they are, and the midpoints that
+     * the surface triangles are split at until none of them is larger than the elements.
+     * Splitting at the midpoints of edges keeps the samples on the surface, and keeps the
+     * surface triangles fitting together.
+     */
+    private fun sampleSurface() {
+        val points = HashMap<MeshData.Vec3Coords, Int>()
+        val index =
+            IntArray(mesh.vertexCount) { v ->
+                val p = mesh.vertex(v)
+                points.getOrPut(p) { insertOnSurface(p.x, p.y, p.z) }
+            }
+        for (t in 0 until mesh.triangleCount) {
+            val tri = IntArray(3) { index[mesh.triangles[3 * t + it]] }
+            if (tri[0] != tri[1] && tri[1] != tri[2] && tri[2] != tri[0]) {
+                addSurfaceTriangle(surface.size, tri)
+            }
+        }
+        val step = SURFACE_SPACING * spacing
+        var t = 0
+        while (t < surface.size) {
+            val (a, b) = longestEdge(surface[t])
+            if (TetMesh.distanceSquared(coords, a, b) > step * step) {
+                // The triangle in slot t is replaced by half of it, which is checked next.
+                splitSurfaceEdge(a, b)
+            } else {
+                t++
+            }
+        }
+    }
+
+    /**
+     * Fill the inside of the solid with a body-centered cubic lattice: the corners and
+     * centers of a grid of cubes. Lattice points close to the surface are left out, so
+     * that they don't make thin tetrahedra with the surface samples.
+     */
+    private fun fillInterior() {
+        val clearance = LATTICE_CLEARANCE * spacing
+        fun sample(x: Double, y: Double, z: Double) {
+            if (inside.contains(x, y, z) && !crowded(x, y, z, clearance) && insert(x, y, z)) {
+                record(pointCount - 1)
+            }
+        }
+        val counts = IntArray(3) { ceil((hi[it] - lo[it]) / spacing).toInt() }
+        for (i in 0 until counts[0]) {
+            for (j in 0 until counts[1]) {
+                for (k in 0 until counts[2]) {
+                    sample(lo[0] + (i + 0.5) * spacing, lo[1] + (j + 0.5) * spacing, lo[2] + (k + 0.5) * spacing)
+                    sample(lo[0] + (i + 1) * spacing, lo[1] + (j + 1) * spacing, lo[2] + (k + 1) * spacing)
+                }
+            }
+        }
+    }
+
+    /**
+     * Split the surface triangles that aren't faces of the tetrahedralization, until they
+     * all are. Splitting a triangle adds a point to the surface between the points that
+     * were in the way of its face.
+     */
+    private fun recoverSurface() {
+        repeat(MAX_ROUNDS) {
+            val faces = HashSet<Long>()
+            for (t in 0 until slotCount) {
+                if (verts[4 * t] >= 0) {
+                    for (i in 0 until 4) {
+                        faces.add(tetFaceKey(t, i))
+                    }
+                }
+            }
+            val missing = surface.filter { faceKey(it[0], it[1], it[2]) !in faces }
+            if (missing.isEmpty()) {
+                return
+            }
+            for (tri in missing) {
+                val (a, b) = longestEdge(tri)
+                splitSurfaceEdge(a, b)
+            }
+        }
+        throw SimplexEvaluationError("Couldn't fit the tetrahedral mesh to the surface of the solid")
+    }
+
+    /**
+     * Classify the tetrahedra as inside or outside of the solid, by walking from the
+     * ones that are connected to the enclosing tetrahedron, which are outside, and
+     * switching sides at each face that's on the surface.
+     */
+    private fun classify() {
+        val queue = ArrayDeque<Int>()
+        for (t in 0 until slotCount) {
+            interior[t] = 0
+            if (verts[4 * t] >= 0 && (0 until 4).any { verts[4 * t + it] < 4 }) {
+                interior[t] = 2
+                queue.add(t)
+            }
+        }
+        while (queue.isNotEmpty()) {
+            val t = queue.removeFirst()
+            for (i in 0 until 4) {
+                val n = neighbors[4 * t + i]
+                if (n < 0 || interior[n] != 0.toByte()) {
+                    continue
+                }
+                interior[n] =
+                    if (surfaceFaces.containsKey(tetFaceKey(t, i))) {
+                        (3 - interior[t]).toByte()
+                    } else {
+                        interior[t]
+                    }
+                queue.add(n)
+            }
+        }
+    }
+
+    /**
+     * Split the elements that are too large or badly shaped, in rounds: every element
+     * that needs to be split at the start of a round is split, unless an earlier split
+     * in the same round already replaced it. After each round, the surface is recovered
+     * again, since the new points can take the place of surface faces.
+     */
+    private fun refine() {
+        repeat(MAX_ROUNDS) {
+            val bad = ArrayList<Pair<Int, Int>>()
+            for (t in 0 until slotCount) {
+                if (isMeshTet(t) && (tetVolume(t) > maxVolume || radiusEdgeRatio(t) > quality)) {
+                    bad.add(Pair(t, generations[t]))
+                }
+            }
+            var inserted = 0
+            for ((t, generation) in bad) {
+                if (verts[4 * t] < 0 || generations[t] != generation) {
+                    continue
+                }
+                val s = 4 * t
+                val split =
+                    if (inside.contains(spheres[s], spheres[s + 1], spheres[s + 2])) {
+                        insert(spheres[s], spheres[s + 1], spheres[s + 2])
+                    } else {
+                        // Splitting a surface edge that's already shorter than the element's
+                        // edges wouldn't make it any better shaped.
+                        val edge = surfaceEdgeOf(t)
+                        if (edge != null && TetMesh.distanceSquared(coords, edge.first, edge.second) > shortestEdgeSquared(t)) {
+                            splitSurfaceEdge(edge.first, edge.second)
+                        } else if (tetVolume(t) > maxVolume) {
+                            val c = centroid(t)
+                            insert(c[0], c[1], c[2])
+                        } else {
+                            false
+                        }
+                    }
+                if (split) {
+                    inserted++
+                }
+            }
+            if (inserted == 0) {
+                return
+            }
+            recoverSurface()
+            classify()
+        }
+    }
+
+    /**
+     * The mesh: the tetrahedra that are inside the solid, without the flat ones that can
+     * be left where the surface samples are coplanar.
+     */
+    private fun collect(): TetMesh {
+        val kept = (0 until slotCount).filter { isMeshTet(it) && !isSliver(it) }
+        val index = IntArray(pointCount) { -1 }
+        var nodeCount = 0
+        val tets = IntArray(4 * kept.size)
+        for ((k, t) in kept.withIndex()) {
+            for (i in 0 until 4) {
+                val v = verts[4 * t + i]
+                if (index[v] < 0) {
+                    index[v] = nodeCount++
+                }
+                tets[4 * k + i] = index[v]
+            }
+        }
+        val nodes = DoubleArray(3 * nodeCount)
+        for (v in 0 until pointCount) {
+            if (index[v] >= 0) {
+                coords.copyInto(nodes, 3 * index[v], 3 * v, 3 * v + 3)
+            }
+        }
+        return TetMesh(nodes, tets)
+    }
+
+    /**
+     * Insert a point into the triangulation, Bowyer-Watson style: delete the tetrahedra
+     * whose circumspheres contain the point, and connect the point to the faces of the
+     * cavity that leaves.
+     *
+     * @return false if the point couldn't be inserted, which only happens when rounding
+     *    errors make the triangulation around it inconsistent.
+     */
+    private fun insert(x: Double, y: Double, z: Double): Boolean {
+        if (pointCount - 4 >= MAX_NODES) {
+            throw SimplexEvaluationError(
+                "The tetrahedral mesh would need more than $MAX_NODES nodes; " +
+                    "try a larger maximum volume or quality bound"
+            )
+        }
+        val p = addPoint(x, y, z)
+        var seed = locate(p)
+        if (seed < 0 || !inSphere(seed, p)) {
+            seed = (0 until slotCount).firstOrNull { verts[4 * it] >= 0 && inSphere(it, p) } ?: -1
+        }
+        if (seed < 0) {
+            pointCount--
+            return false
+        }
+        stamp++
+        cavity.clear()
+        marks[seed] = stamp
+        cavity.add(seed)
+        var k = 0
+        while (k < cavity.size) {
+            val t = cavity[k++]
+            for (i in 0 until 4) {
+                val n = neighbors[4 * t + i]
+                if (n >= 0 && marks[n] != stamp && inSphere(n, p)) {
+                    marks[n] = stamp
+                    cavity.add(n)
+                }
+            }
+        }
+        // With rounding errors, a face of the cavity might not be visible from the new
+        // point, which would make an inverted tetrahedron. Growing the cavity past that
+        // face fixes it.
+        k = 0
+        while (k < cavity.size) {
+            val t = cavity[k++]
+            for (i in 0 until 4) {
+                val n = neighbors[4 * t + i]
+                if ((n < 0 || marks[n] != stamp) && orientWith(t, i, p) <= 0.0) {
+                    if (n < 0) {
+                        pointCount--
+                        return false
+                    }
+                    marks[n] = stamp
+                    cavity.add(n)
+                }
+            }
+        }
+        openFaces.clear()
+        for (t in cavity) {
+            for (i in 0 until 4) {
+                val n = neighbors[4 * t + i]
+                if (n >= 0 && marks[n] == stamp) {
+                    continue
+                }
+                // The new tetrahedron has the cavity face, and the new point in place of
+                // the vertex opposite it, which keeps it positively oriented.
+                val nt = newTet()
+                for (j in 0 until 4) {
+                    verts[4 * nt + j] = verts[4 * t + j]
+                    neighbors[4 * nt + j] = -1
+                }
+                verts[4 * nt + i] = p
+                neighbors[4 * nt + i] = n
+                if (n >= 0) {
+                    for (j in 0 until 4) {
+                        if (neighbors[4 * n + j] == t) {
+                            neighbors[4 * n + j] = nt
+                        }
+                    }
+                }
+                // Each of its other faces is shared with another new tetrahedron, which
+                // has the same edge of the cavity.
+                for (j in 0 until 4) {
+                    if (j == i) {
+                        continue
+                    }
+                    val (a, b) = (0 until 4).filter { it != i && it != j }.map { verts[4 * nt + it] }
+                    val key = edgeKey(a, b)
+                    val other = openFaces.remove(key)
+                    if (other == null) {
+                        openFaces[key] = 4 * nt + j
+                    } else {
+                        neighbors[4 * nt + j] = other / 4
+                        neighbors[other] = nt
+                    }
+                }
+                computeSphere(nt)
+                lastTet = nt
+            }
+        }
+        for (t in cavity) {
+            verts[4 * t] = -1
+            freeSlots.add(t)
+        }
+        return true
+    }
+
+    /** Insert a point on the surface, which has to be in the mesh for it to fit the surface. */
+    private fun insertOnSurface(x: Double, y: Double, z: Double): Int {
+        if (!insert(x, y, z)) {
+            throw SimplexEvaluationError("Couldn't add the point ($x, $y, $z) on the surface of the solid to its tetrahedral mesh")
+        }
+        record(pointCount - 1)
+        return pointCount - 1
+    }
+
+    private fun addSurfaceTriangle(slot: Int, tri: IntArray) {
+        if (slot == surface.size) {
+            surface.add(tri)
+        } else {
+            surface[slot] = tri
+        }
+        for (i in 0 until 3) {
+            surfaceEdges.getOrPut(edgeKey(tri[i], tri[(i + 1) % 3])) { ArrayList() }.add(slot)
+        }
+        surfaceFaces[faceKey(tri[0], tri[1], tri[2])] = slot
+    }
+
+    private fun removeSurfaceTriangle(slot: Int) {
+        val tri = surface[slot]
+        for (i in 0 until 3) {
+            val key = edgeKey(tri[i], tri[(i + 1) % 3])
+            val onEdge = surfaceEdges[key] ?: continue
+            onEdge.remove(slot)
+            if (onEdge.isEmpty()) {
+                surfaceEdges.remove(key)
+            }
+        }
+        surfaceFaces.remove(faceKey(tri[0], tri[1], tri[2]))
+    }
+
+    /**
+     * Split the surface triangles on an edge at the edge's midpoint.
+     *
+     * @return false if the edge isn't on the surface anymore.
+     */
+    private fun splitSurfaceEdge(a: Int, b: Int): Boolean {
+        val key = edgeKey(a, b)
+        val onEdge = surfaceEdges[key]?.toList() ?: return false
+        val m =
+            insertOnSurface(
+                (coords[3 * a] + coords[3 * b]) / 2.0,
+                (coords[3 * a + 1] + coords[3 * b + 1]) / 2.0,
+                (coords[3 * a + 2] + coords[3 * b + 2]) / 2.0,
+            )
+        for (slot in onEdge) {
+            val tri = surface[slot]
+            val i = (0 until 3).first { edgeKey(tri[it], tri[(it + 1) % 3]) == key }
+            val p = tri[i]
+            val q = tri[(i + 1) % 3]
+            val r = tri[(i + 2) % 3]
+            removeSurfaceTriangle(slot)
+            addSurfaceTriangle(slot, intArrayOf(p, m, r))
+            addSurfaceTriangle(surface.size, intArrayOf(m, q, r))
+        }
+        return true
+    }
+
+    private fun longestEdge(tri: IntArray): Pair<Int, Int> {
+        val i =
+            (0 until 3).maxBy { TetMesh.distanceSquared(coords, tri[it], tri[(it + 1) % 3]) }
+        return Pair(tri[i], tri[(i + 1) % 3])
+    }
+
+    /** The longest edge of the surface triangles that are faces of tetrahedron [t], if it has any. */
+    private fun surfaceEdgeOf(t: Int): Pair<Int, Int>? =
+        (0 until 4)
+            .mapNotNull { surfaceFaces[tetFaceKey(t, it)] }
+            .map { longestEdge(surface[it]) }
+            .maxByOrNull { (a, b) -> TetMesh.distanceSquared(coords, a, b) }
+
+    private fun edgeKey(a: Int, b: Int): Long = (min(a, b).toLong() shl 32) or max(a, b).toLong()
+
+    private fun faceKey(a: Int, b: Int, c: Int): Long {
+        val (x, y, z) = listOf(a, b, c).sorted()
+        return (x.toLong() shl 42) or (y.toLong() shl 21) or z.toLong()
+    }
+
+    /** The key of the face of tetrahedron [t] opposite its vertex [i]. */
+    private fun tetFaceKey(t: Int, i: Int): Long {
+        val (a, b, c) = (0 until 4).filter { it != i }.map { verts[4 * t + it] }
+        return faceKey(a, b, c)
+    }
+
+    /**
+     * Find the tetrahedron that contains a point, by walking from the last tetrahedron
+     * that was made towards the point. The faces are tried in a random order, so that
+     * the walk can't go around in circles.
+     */
+    private fun locate(p: Int): Int {
+        var t = lastTet
+        var steps = 0
+        walk@ while (steps++ < slotCount + 100) {
+            val start = random.nextInt(4)
+            for (k in 0 until 4) {
+                val i = (start + k) % 4
+                if (orientWith(t, i, p) < 0.0) {
+                    t = neighbors[4 * t + i]
+                    if (t < 0) {
+                        return -1
+                    }
+                    continue@walk
+                }
+            }
+            return t
+        }
+        return -1
+    }
+
+    private fun addPoint(x: Double, y: Double, z: Double): Int {
+        if (3 * pointCount + 3 > coords.size) {
+            coords = coords.copyOf(2 * coords.size)
+        }
+        coords[3 * pointCount] = x
+        coords[3 * pointCount + 1] = y
+        coords[3 * pointCount + 2] = z
+        return pointCount++
+    }
+
+    private fun newTet(): Int {
+        val t =
+            if (freeSlots.isNotEmpty()) {
+                freeSlots.removeAt(freeSlots.size - 1)
+            } else {
+                if (slotCount == generations.size) {
+                    val size = 2 * slotCount
+                    verts = verts.copyOf(4 * size)
+                    neighbors = neighbors.copyOf(4 * size)
+                    spheres = spheres.copyOf(4 * size)
+                    generations = generations.copyOf(size)
+                    interior = interior.copyOf(size)
+                    marks = marks.copyOf(size)
+                }
+                slotCount++
+            }
+        generations[t]++
+        interior[t] = 0
+        return t
+    }
+
+    private fun computeSphere(t: Int) {
+        val sphere = TetMesh.circumsphere(coords, verts[4 * t], verts[4 * t + 1], verts[4 * t + 2], verts[4 * t + 3])
+        if (sphere != null) {
+            sphere.copyInto(spheres, 4 * t)
+        } else {
+            // A flat tetrahedron's circumsphere is infinite, so any point that's inserted
+            // near it replaces it.
+            centroid(t).copyInto(spheres, 4 * t)
+            spheres[4 * t + 3] = Double.POSITIVE_INFINITY
+        }
+    }
+
+    private fun inSphere(t: Int, p: Int): Boolean {
+        val dx = coords[3 * p] - spheres[4 * t]
+        val dy = coords[3 * p + 1] - spheres[4 * t + 1]
+        val dz = coords[3 * p + 2] - spheres[4 * t + 2]
+        return dx * dx + dy * dy + dz * dz < spheres[4 * t + 3]
+    }
+
+    /** The volume of tetrahedron [t] with its vertex [i] replaced by point [p]. */
+    private fun orientWith(t: Int, i: Int, p: Int): Double =
+        TetMesh.signedVolume(
+            coords,
+            if (i == 0) p else verts[4 * t],
+            if (i == 1) p else verts[4 * t + 1],
+            if (i == 2) p else verts[4 * t + 2],
+            if (i == 3) p else verts[4 * t + 3],
+        )
+
+    private fun tetVolume(t: Int): Double =
+        TetMesh.signedVolume(coords, verts[4 * t], verts[4 * t + 1], verts[4 * t + 2], verts[4 * t + 3])
+
+    private fun shortestEdgeSquared(t: Int): Double {
+        var shortest = Double.POSITIVE_INFINITY
+        for (i in 0 until 4) {
+            for (j in i + 1 until 4) {
+                shortest = min(shortest, TetMesh.distanceSquared(coords, verts[4 * t + i], verts[4 * t + j]))
+            }
+        }
+        return shortest
+    }
+
+    private fun radiusEdgeRatio(t: Int): Double = sqrt(spheres[4 * t + 3] / shortestEdgeSquared(t))
+
+    private fun centroid(t: Int): DoubleArray =
+        DoubleArray(3) { c -> (0 until 4).sumOf { coords[3 * verts[4 * t + it] + c] } / 4.0 }
+
+    /** Is a tetrahedron part of the mesh: not deleted, and classified as inside the solid? */
+    private fun isMeshTet(t: Int): Boolean = verts[4 * t] >= 0 && interior[t] == 1.toByte()
+
+    private fun isSliver(t: Int): Boolean {
+        var longest = 0.0
+        for (i in 0 until 4) {
+            for (j in i + 1 until 4) {
+                longest = max(longest, TetMesh.distanceSquared(coords, verts[4 * t + i], verts[4 * t + j]))
+            }
+        }
+        return tetVolume(t) < SLIVER * longest * sqrt(longest)
+    }
+
+    private fun cellKey(ix: Int, iy: Int, iz: Int): Long =
+        ((ix + CELL_OFFSET).toLong() shl 42) or ((iy + CELL_OFFSET).toLong() shl 21) or (iz + CELL_OFFSET).toLong()
+
+    private fun cellOf(v: Double, axis: Int): Int = floor((v - lo[axis]) / sampleCell).toInt()
+
+    private fun record(p: Int) {
+        val key = cellKey(cellOf(coords[3 * p], 0), cellOf(coords[3 * p + 1], 1), cellOf(coords[3 * p + 2], 2))
+        samples.getOrPut(key) { ArrayList() }.add(p)
+    }
+
+    /** Is there a sample closer than [clearance], which is at most the cell size, to a point? */
+    private fun crowded(x: Double, y: Double, z: Double, clearance: Double): Boolean {
+        val ix = cellOf(x, 0)
+        val iy = cellOf(y, 1)
+        val iz = cellOf(z, 2)
+        for (dx in -1..1) {
+            for (dy in -1..1) {
+                for (dz in -1..1) {
+                    val cell = samples[cellKey(ix + dx, iy + dy, iz + dz)] ?: continue
+                    for (q in cell) {
+                        val ex = coords[3 * q] - x
+                        val ey = coords[3 * q + 1] - y
+                        val ez = coords[3 * q + 2] - z
+                        if (ex * ex + ey * ey + ez * ez < clearance * clearance) {
+                            return true
+                        }
+                    }
+                }
+            }
+        }
+        return false
+    }
+
+    /**
+     * Tests whether points are inside a closed mesh, by counting the triangles crossed by
+     * a ray from the point in the +x direction. The triangles are bucketed by their
+     * extent in y and z, so that each test only looks at the triangles near its ray.
+     */
+    private class InsideTest(val mesh: MeshData) {
+        private val size = min(256, max(1, ceil(sqrt(mesh.triangleCount.toDouble())).toInt()))
+        private var minY = Double.MAX_VALUE
+        private var maxY = -Double.MAX_VALUE
+        private var minZ = Double.MAX_VALUE
+        private var maxZ = -Double.MAX_VALUE
+        private val cellY: Double
+        private val cellZ: Double
+        private val cells: Array<IntArray>
+
+        init {
+            for (v in 0 until mesh.vertexCount) {
+                minY = min(minY, mesh.vertices[3 * v + 1])
+                maxY = max(maxY, mesh.vertices[3 * v + 1])
+                minZ = min(minZ, mesh.vertices[3 * v + 2])
+                maxZ = max(maxZ, mesh.vertices[3 * v + 2])
+            }
+            cellY = if (maxY > minY) (maxY - minY) / size else 1.0
+            cellZ = if (maxZ > minZ) (maxZ - minZ) / size else 1.0
+            val buckets = Array(size * size) { ArrayList<Int>() }
+            for (t in 0 until mesh.triangleCount) {
+                val ys = (0 until 3).map { mesh.vertices[3 * mesh.triangles[3 * t + it] + 1] }
+                val zs = (0 until 3).map { mesh.vertices[3 * mesh.triangles[3 * t + it] + 2] }
+                for (i in cell(ys.min(), minY, cellY)..cell(ys.max(), minY, cellY)) {
+                    for (j in cell(zs.min(), minZ, cellZ)..cell(zs.max(), minZ, cellZ)) {
+                        buckets[i * size + j].add(t)
+                    }
+                }
+            }
+            cells = Array(buckets.size) { buckets[it].toIntArray() }
+        }
+
+        private fun cell(v: Double, lo: Double, width: Double): Int =
+            min(size - 1, max(0, floor((v - lo) / width).toInt()))
+
+        fun contains(x: Double, y: Double, z: Double): Boolean {
+            if (y < minY || y > maxY || z < minZ || z > maxZ) {
+                return false
+            }
+            var crossings = 0
+            for (t in cells[cell(y, minY, cellY) * size + cell(z, minZ, cellZ)]) {
+                val a = mesh.triangles[3 * t]
+                val b = mesh.triangles[3 * t + 1]
+                val c = mesh.triangles[3 * t + 2]
+                // The edge functions are the barycentric weights of the ray's point in the
+                // triangle, projected onto the yz plane.
+                val ea = edge(b, c, y, z)
+                val eb = edge(c, a, y, z)
+                val ec = edge(a, b, y, z)
+                if ((ea > 0.0 && eb > 0.0 && ec > 0.0) || (ea < 0.0 && eb < 0.0 && ec < 0.0)) {
+                    val v = mesh.vertices
+                    val hit = (ea * v[3 * a] + eb * v[3 * b] + ec * v[3 * c]) / (ea + eb + ec)
+                    if (hit > x) {
+                        crossings++
+                    }
+                }
+            }
+            return crossings % 2 == 1
+        }
+
+        /**
+         * Which side of the projected edge from [u] to [v] a point is on. Each edge is
+         * always measured in the same direction, and a point exactly on an edge counts
+         * as being on its left, so a ray through an edge that two triangles share is
+         * counted as crossing exactly one of them.
+         */
+        private fun edge(u: Int, v: Int, y: Double, z: Double): Double {
+            val vs = mesh.vertices
+            val swap =
+                when {
+                    vs[3 * u + 1] != vs[3 * v + 1] -> vs[3 * u + 1] > vs[3 * v + 1]
+                    vs[3 * u + 2] != vs[3 * v + 2] -> vs[3 * u + 2] > vs[3 * v + 2]
+                    else -> u > v
+                }
+            val from = if (swap) v else u
+            val to = if (swap) u else v
+            val fy = vs[3 * from + 1]
+            val fz = vs[3 * from + 2]
+            val side = (vs[3 * to + 1] - fy) * (z - fz) - (vs[3 * to + 2] - fz) * (y - fy)
+            val leftward = if (side == 0.0) Double.MIN_VALUE else side
+            return if (swap) -leftward else leftward
+        }
+    }
+
+    companion object {
+        /** The most nodes that a mesh can have. */
+        const val MAX_NODES = 500_000
+
+        // The surface samples are at most this far apart, as a fraction of the lattice spacing.
+        private const val SURFACE_SPACING = 0.7
+
+        // Lattice points closer than this to a surface sample are left out, as a fraction
+        // of the lattice spacing.
+        private const val LATTICE_CLEARANCE = 0.6
+
+        // Tetrahedra with less than this fraction of the volume of a cube on their
+        // longest edge are flat: their corners are coplanar, up to rounding.
+        private const val SLIVER = 1e-9
+
+        private const val MAX_ROUNDS = 50
+
+        private const val CELL_OFFSET = 1 shl 20
+
+        /** The volume enclosed by a closed mesh. */
+        fun meshVolume(mesh: MeshData): Double {
+            var volume = 0.0
+            for (t in 0 until mesh.triangleCount) {
+                val a = mesh.vertex(mesh.triangles[3 * t])
+                val b = mesh.vertex(mesh.triangles[3 * t + 1])
+                val c = mesh.vertex(mesh.triangles[3 * t + 2])
+                volume += a.x * (b.y * c.z - b.z * c.y) + a.y * (b.z * c.x - b.x * c.z) + a.z * (b.x * c.y - b.y * c.x)
+            }
+            return volume / 6.0
+        }
+    }
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import kotlin.math.sqrt
+import manifold3d.Manifold
+
+/**
+ * The default tolerance for boolean operations. Manifold treats features smaller than
+ * a solid's tolerance as noise, which it can simplify away; raising the tolerance of
+ * nearly coincident faces, like the ones that come from imported or scaled geometry,
+ * keeps booleans on them from failing or leaving slivers behind.
+ *
+ * The operands of every boolean operation are given at least the default tolerance.
+ * A tolerance of 0.0 leaves the tolerance of each solid to Manifold, which picks one
+ * based on the size of the solid.
+ */
+object Tolerance {
+    /**
+     * The default tolerance, which is set for a whole model from the command line or
+     * the build configuration, and can be changed for a product with `@tolerance`.
+     */
+    var default: Double = 0.0
+
+    /** Evaluate [body] with a different default tolerance, if [eps] isn't null. */
+    fun <T> withDefault(eps: Double?, body: () -> T): T {
+        if (eps == null) {
+            return body()
+        }
+        val saved = default
+        default = eps
+        try {
+            return body()
+        } finally {
+            default = saved
+        }
+    }
+
+    /** A manifold with at least the default tolerance, ready for a boolean operation. */
+    fun apply(m: Manifold): Manifold =
+        if (default > 0.0 && m.getTolerance() < default) {
+            m.setTolerance(default)
+        } else {
+            m
+        }
+
+    /**
+     * Count the degenerate triangles in a mesh: the triangles whose shortest height is
+     * less than [eps], which are slivers or have collapsed to lines or points.
+     */
+    fun degenerateTriangles(mesh: MeshData, eps: Double): Int {
+        var count = 0
+        for (t in 0 until mesh.triangleCount) {
+            val a = mesh.vertex(mesh.triangles[3 * t])
+            val b = mesh.vertex(mesh.triangles[3 * t + 1])
+            val c = mesh.vertex(mesh.triangles[3 * t + 2])
+            val abx = b.x - a.x
+            val aby = b.y - a.y
+            val abz = b.z - a.z
+            val acx = c.x - a.x
+            val acy = c.y - a.y
+            val acz = c.z - a.z
+            val cx = aby * acz - abz * acy
+            val cy = abz * acx - abx * acz
+            val cz = abx * acy - aby * acx
+            // Twice the area, divided by the longest side, is the shortest height.
+            val doubleArea = sqrt(cx * cx + cy * cy + cz * cz)
+            val longest =
+                maxOf(
+                    sqrt(abx * abx + aby * aby + abz * abz),
+                    sqrt(acx * acx + acy * acy + acz * acz),
+                    sqrt((c.x - b.x) * (c.x - b.x) + (c.y - b.y) * (c.y - b.y) + (c.z - b.z) * (c.z - b.z)),
+                )
+            if (longest == 0.0 || doubleArea / longest < eps) {
+                count++
+            }
+        }
+        return count
+    }
+}
@@ -0,0 +1,363 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import kotlin.math.atan2
+import kotlin.math.cos
+import kotlin.math.max
+import kotlin.math.min
+import kotlin.math.roundToLong
+import kotlin.math.sin
+import kotlin.math.sqrt
+import org.goodmath.simplex.runtime.values.primitives.Vec2
+
+/**
+ * Unfolds a polyhedral mesh into flat nets that can be printed, cut out, and folded
+ * back up.
+ *
+ * Coplanar triangles are merged into faces, and the faces are laid flat by walking a
+ * spanning tree of the face adjacency graph, hinging each face onto its parent along
+ * their shared edge. A face that would overlap the part of the net that's already been
+ * laid out is attached along a different edge if there is one, and otherwise starts a
+ * new net. Edges that are cut rather than folded get a glue tab on one side, if there's
+ * room for it.
+ *
+ * @param mesh the mesh to unfold. This should be a closed manifold, with its triangles
+ *    wound counter-clockwise when seen from outside.
+ * @param tabHeight the height of the glue tabs, as a fraction of the mean edge length.
+ *    A tab is never taller than a quarter of the length of its own edge.
+ */
+class Unfolder(val mesh: MeshData, val tabHeight: Double = 0.2) {
+    /**
+     * A flat net.
+     *
+     * @param faces the triangles of the faces of the net.
+     * @param tabs the glue tabs, each a quadrilateral.
+     * @param folds the lines to fold along: the hinges between faces, and the bases of
+     *    the tabs.
+     * @param faceCount the number of faces of the solid in the net.
+     */
+    class Net(
+        val faces: List<List<Vec2>>,
+        val tabs: List<List<Vec2>>,
+        val folds: List<Segment>,
+        val faceCount: Int,
+    ) {
+        val polygons: List<List<Vec2>>
+            get() = faces + tabs
+    }
+
+    /** A directed edge on the boundary of a face, and the face on its other side. */
+    private class Edge(val a: Int, val b: Int, val neighbor: Int)
+
+    private class Face(val triangles: List<IntArray>, val area: Double) {
+        val edges = ArrayList<Edge>()
+
+        /** The coordinates of the face's vertices in the plane of the face. */
+        val local = HashMap<Int, Vec2>()
+    }
+
+    private val points = ArrayList<DoubleArray>()
+    private val faces = ArrayList<Face>()
+    private var meanEdge = 1.0
+    private var epsilon = 1e-9
+
+    private fun sub(a: DoubleArray, b: DoubleArray): DoubleArray =
+        doubleArrayOf(a[0] - b[0], a[1] - b[1], a[2] - b[2])
+
+    private fun dot(a: DoubleArray, b: DoubleArray): Double = a[0] * b[0] + a[1] * b[1] + a[2] * b[2]
+
+    private fun cross(a: DoubleArray, b: DoubleArray): DoubleArray =
+        doubleArrayOf(a[1] * b[2] - a[2] * b[1], a[2] * b[0] - a[0] * b[2], a[0] * b[1] - a[1] * b[0])
+
+    private fun norm(a: DoubleArray): Double = sqrt(dot(a, a))
+
+    private fun edgeKey(a: Int, b: Int): Long = a.toLong() * points.size + b
+
+    /**
+     * Weld together vertices at the same position, merge coplanar triangles into
+     * faces, and find the boundary edges of each face.
+     */
+    private fun buildFaces() {
+        val min = DoubleArray(3) { Double.MAX_VALUE }
+        val max = DoubleArray(3) { -Double.MAX_VALUE }
+        for (i in 0 until mesh.vertexCount) {
+            for (c in 0 until 3) {
+                min[c] = min(min[c], mesh.vertices[3 * i + c])
+                max[c] = max(max[c], mesh.vertices[3 * i + c])
+            }
+        }
+        val size = max(norm(sub(max, min)), 1e-9)
+        val quantum = size * 1e-7
+        val welded = HashMap<List<Long>, Int>()
+        val index = IntArray(mesh.vertexCount) { i ->
+            val p = DoubleArray(3) { c -> mesh.vertices[3 * i + c] }
+            welded.getOrPut(p.map { (it / quantum).roundToLong() }) {
+                points.add(p)
+                points.size - 1
+            }
+        }
+
+        val triangles = ArrayList<IntArray>()
+        val normals = ArrayList<DoubleArray>()
+        val areas = ArrayList<Double>()
+        for (t in 0 until mesh.triangleCount) {
+            val tri = IntArray(3) { index[mesh.triangles[3 * t + it]] }
+            val n = cross(sub(points[tri[1]], points[tri[0]]), sub(points[tri[2]], points[tri[0]]))
+            val len = norm(n)
+            if (len <= quantum * quantum) {
+                continue
+            }
+            triangles.add(tri)
+            normals.add(doubleArrayOf(n[0] / len, n[1] / len, n[2] / len))
+            areas.add(len / 2.0)
+        }
+
+        val triangleOf = HashMap<Long, Int>()
+        var totalEdge = 0.0
+        for ((t, tri) in triangles.withIndex()) {
+            for (i in 0 until 3) {
+                val a = tri[i]
+                val b = tri[(i + 1) % 3]
+                triangleOf[edgeKey(a, b)] = t
+                totalEdge += norm(sub(points[b], points[a]))
+            }
+        }
+        meanEdge = if (triangles.isEmpty()) 1.0 else totalEdge / (3 * triangles.size)
+        epsilon = meanEdge * 1e-6
+
+        // Union-find over the triangles, joining neighbors that lie in the same plane.
+        val parent = IntArray(triangles.size) { it }
+        fun find(t: Int): Int {
+            var r = t
+            while (parent[r] != r) {
+                r = parent[r]
+            }
+            parent[t] = r
+            return r
+        }
+        for ((t, tri) in triangles.withIndex()) {
+            for (i in 0 until 3) {
+                val u = triangleOf[edgeKey(tri[(i + 1) % 3], tri[i])] ?: continue
+                if (dot(normals[t], normals[u]) > 1.0 - 1e-9) {
+                    parent[find(t)] = find(u)
+                }
+            }
+        }
+
+        val faceOfRoot = HashMap<Int, Int>()
+        val faceOf = IntArray(triangles.size)
+        val members = ArrayList<ArrayList<Int>>()
+        for (t in triangles.indices) {
+            val f = faceOfRoot.getOrPut(find(t)) {
+                members.add(ArrayList())
+                members.size - 1
+            }
+            faceOf[t] = f
+            members[f].add(t)
+        }
+        for (m in members) {
+            val face = Face(m.map { triangles[it] }, m.sumOf { areas[it] })
+            faces.add(face)
+        }
+        for ((f, face) in faces.withIndex()) {
+            for (t in members[f]) {
+                val tri = triangles[t]
+                for (i in 0 until 3) {
+                    val a = tri[i]
+                    val b = tri[(i + 1) % 3]
+                    val twin = triangleOf[edgeKey(b, a)]
+                    val neighbor = if (twin == null) -1 else faceOf[twin]
+                    if (neighbor != f) {
+                        face.edges.add(Edge(a, b, neighbor))
+                    }
+                }
+            }
+            // Lay out a frame in the plane of the face, with the normal as its z axis,
+            // so that the triangles stay counter-clockwise.
+            val n = normals[members[f].first()]
+            val first = face.edges.firstOrNull() ?: Edge(face.triangles[0][0], face.triangles[0][1], -1)
+            val origin = points[first.a]
+            val e = sub(points[first.b], origin)
+            val u = e.map { it / norm(e) }.toDoubleArray()
+            val v = cross(n, u)
+            for (tri in face.triangles) {
+                for (p in tri) {
+                    val d = sub(points[p], origin)
+                    face.local[p] = Vec2(dot(d, u), dot(d, v))
+                }
+            }
+        }
+    }
+
+    /**
+     * Move the points of a face so that the ends of the edge ([fromA], [fromB]) land
+     * on ([toA], [toB]).
+     */
+    private fun hinge(local: Map<Int, Vec2>, fromA: Vec2, fromB: Vec2, toA: Vec2, toB: Vec2): Map<Int, Vec2> {
+        val theta =
+            atan2(toB.y - toA.y, toB.x - toA.x) - atan2(fromB.y - fromA.y, fromB.x - fromA.x)
+        val c = cos(theta)
+        val s = sin(theta)
+        return local.mapValues { (_, p) ->
+            val dx = p.x - fromA.x
+            val dy = p.y - fromA.y
+            Vec2(toA.x + c * dx - s * dy, toA.y + s * dx + c * dy)
+        }
+    }
+
+    private fun trianglesOf(face: Face, coords: Map<Int, Vec2>): List<List<Vec2>> =
+        face.triangles.map { tri -> tri.map { coords[it]!! } }
+
+    /**
+     * Build a glue tab on the right-hand side of the edge from [a] to [b], which is
+     * the outside of a face wound counter-clockwise.
+     */
+    private fun tab(a: Vec2, b: Vec2): List<Vec2> {
+        val len = (b - a).magnitude()
+        val d = (b - a) / len
+        val out = Vec2(d.y, -d.x)
+        val h = min(tabHeight * meanEdge, len / 4.0)
+        return listOf(a, a + d * h + out * h, b - d * h + out * h, b)
+    }
+
+    fun unfold(): List<Net> {
+        buildFaces()
+        val placed = arrayOfNulls<Map<Int, Vec2>>(faces.size)
+        val netOf = IntArray(faces.size) { -1 }
+        val netMembers = ArrayList<ArrayList<Int>>()
+        val netFolds = ArrayList<ArrayList<Segment>>()
+        val placedTriangles = HashMap<Int, List<List<Vec2>>>()
+        val folded = HashSet<Long>()
+
+        for (root in faces.indices.sortedByDescending { faces[it].area }) {
+            if (netOf[root] >= 0) {
+                continue
+            }
+            val net = netMembers.size
+            val members = arrayListOf(root)
+            val folds = ArrayList<Segment>()
+            netMembers.add(members)
+            netFolds.add(folds)
+            placed[root] = faces[root].local
+            placedTriangles[root] = trianglesOf(faces[root], faces[root].local)
+            netOf[root] = net
+            val queue = ArrayDeque(listOf(root))
+            while (queue.isNotEmpty()) {
+                val f = queue.removeFirst()
+                for (edge in faces[f].edges) {
+                    val g = edge.neighbor
+                    if (g < 0 || netOf[g] >= 0) {
+                        continue
+                    }
+                    val toA = placed[f]!![edge.a]!!
+                    val toB = placed[f]!![edge.b]!!
+                    val local = faces[g].local
+                    val coords = hinge(local, local[edge.a]!!, local[edge.b]!!, toA, toB)
+                    val tris = trianglesOf(faces[g], coords)
+                    val collides = members.any { m ->
+                        placedTriangles[m]!!.any { p -> tris.any { q -> overlaps(p, q, epsilon) } }
+                    }
+                    if (collides) {
+                        continue
+                    }
+                    placed[g] = coords
+                    placedTriangles[g] = tris
+                    netOf[g] = net
+                    members.add(g)
+                    folds.add(Segment(toA, toB))
+                    folded.add(edgeKey(min(edge.a, edge.b), max(edge.a, edge.b)))
+                    queue.addLast(g)
+                }
+            }
+        }
+
+        // Every edge that wasn't folded gets cut, and needs a tab to glue it back
+        // together. Try one side of the edge, and then the other.
+        val netTabs = netMembers.map { ArrayList<List<Vec2>>() }
+        val done = HashSet<Long>(folded)
+        for ((f, face) in faces.withIndex()) {
+            for (edge in face.edges) {
+                val key = edgeKey(min(edge.a, edge.b), max(edge.a, edge.b))
+                if (edge.neighbor < 0 || !done.add(key)) {
+                    continue
+                }
+                for ((side, a, b) in listOf(Triple(f, edge.a, edge.b), Triple(edge.neighbor, edge.b, edge.a))) {
+                    val pa = placed[side]!![a]!!
+                    val pb = placed[side]!![b]!!
+                    val t = tab(pa, pb)
+                    val net = netOf[side]
+                    val collides =
+                        netMembers[net].any { m -> placedTriangles[m]!!.any { overlaps(it, t, epsilon) } } ||
+                            netTabs[net].any { overlaps(it, t, epsilon) }
+                    if (!collides) {
+                        netTabs[net].add(t)
+                        netFolds[net].add(Segment(pa, pb))
+                        break
+                    }
+                }
+            }
+        }
+
+        // Lay the nets out in a row, left to right.
+        val result = ArrayList<Net>()
+        var cursor = 0.0
+        for (net in netMembers.indices) {
+            val tris = netMembers[net].flatMap { placedTriangles[it]!! }
+            val all = (tris + netTabs[net]).flatten()
+            val dx = cursor - all.minOf { it.x }
+            val dy = -all.minOf { it.y }
+            cursor += all.maxOf { it.x } - all.minOf { it.x } + meanEdge / 2.0
+            val shift = { p: Vec2 -> Vec2(p.x + dx, p.y + dy) }
+            result.add(
+                Net(
+                    tris.map { it.map(shift) },
+                    netTabs[net].map { it.map(shift) },
+                    netFolds[net].map { it.map(shift) },
+                    netMembers[net].size,
+                )
+            )
+        }
+        return result
+    }
+
+    companion object {
+        /**
+         * Check whether two convex polygons overlap, using the separating axis test.
+         * Polygons that only touch along an edge or at a point, to within [epsilon],
+         * don't overlap.
+         */
+        fun overlaps(p: List<Vec2>, q: List<Vec2>, epsilon: Double): Boolean {
+            for (poly in listOf(p, q)) {
+                for (i in poly.indices) {
+                    val a = poly[i]
+                    val b = poly[(i + 1) % poly.size]
+                    val len = (b - a).magnitude()
+                    if (len == 0.0) {
+                        continue
+                    }
+                    val axis = Vec2((a.y - b.y) / len, (b.x - a.x) / len)
+                    val pp = p.map { it.dot(axis) }
+                    val qp = q.map { it.dot(axis) }
+                    if (pp.max() <= qp.min() + epsilon || qp.max() <= pp.min() + epsilon) {
+                        return false
+                    }
+                }
+            }
+            return true
+        }
+    }
+}
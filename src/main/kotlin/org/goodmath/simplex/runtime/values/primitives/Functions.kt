@@ -134,6 +134,15 @@ abstract class PrimitiveFunctionValue(val name: String, val signature: FunctionS
 
     val resultType: Type = signature.returnType
 
+    /** If the function is deprecated, the message to show where it's used; otherwise null. */
+    open val deprecation: String? = null
+
+    /**
+     * If some of the function's parameter lists are deprecated, the message to show where
+     * a call uses one of them, given the types of the parameters it uses; otherwise null.
+     */
+    open fun overloadDeprecation(params: List<Type>): String? = null
+
     abstract fun execute(args: List<Value>): Value
 
     override val valueType by lazy {
@@ -39,6 +39,9 @@ abstract class PrimitiveMethod(name: String, signature: MethodSignature) :
      */
     abstract fun execute(target: Value, args: List<Value>, env: Env): Value
 
+    /** If the method is deprecated, the message to show where it's used; otherwise null. */
+    open val deprecation: String? = null
+
     override fun twist(): Twist =
         Twist.obj("PrimitiveMethod", Twist.attr("name", name), Twist.attr("sig", sig.toString()))
 
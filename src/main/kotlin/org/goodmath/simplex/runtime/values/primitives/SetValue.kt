@@ -0,0 +1,233 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.primitives
+
+import org.goodmath.simplex.ast.types.Type
+import org.goodmath.simplex.runtime.Env
+import org.goodmath.simplex.runtime.SimplexEvaluationError
+import org.goodmath.simplex.runtime.SimplexTypeError
+import org.goodmath.simplex.runtime.values.MethodSignature
+import org.goodmath.simplex.runtime.values.Param
+import org.goodmath.simplex.runtime.values.Value
+import org.goodmath.simplex.runtime.values.ValueType
+import org.goodmath.simplex.twist.Twist
+
+/**
+ * The value type of sets. Sets don't rely on Kotlin equality: two elements are the
+ * same if the `eq` method of their value type says that they are, or, for types
+ * without `eq`, if their `compare` method returns 0. So user data types with their
+ * own `eq` methods work as set elements.
+ */
+class SetValueType(val elementType: ValueType) : ValueType() {
+    override fun twist(): Twist {
+        return Twist.obj("SetValueType", Twist.value("elementType", elementType))
+    }
+
+    override val name: String = "{|${elementType.name}|}"
+
+    override val asType: Type by lazy {
+        Type.set(elementType.asType)
+    }
+
+    fun assertIsSet(v: Value): List<Value> {
+        if (v is SetValue) {
+            return v.elements
+        } else {
+            throw SimplexTypeError(v.toString(), "Set", v.valueType.name)
+        }
+    }
+
+    override val supportsText: Boolean = elementType.supportsText
+
+    override fun toText(v: Value): String {
+        val set = assertIs(v).elements
+        val rendered =
+            set.joinToString(", ") {
+                if (it.valueType.supportsText) {
+                    it.valueType.toText(it)
+                } else {
+                    "<<${it.valueType.name}>>"
+                }
+            }
+        return "{|$rendered|}"
+    }
+
+    override fun isTruthy(v: Value): Boolean {
+        return assertIsSet(v).isNotEmpty()
+    }
+
+    override val providesFunctions: List<PrimitiveFunctionValue> = emptyList()
+
+    override val providesPrimitiveMethods: List<PrimitiveMethod> by lazy {
+        listOf(
+            object : PrimitiveMethod(
+                "add",
+                MethodSignature.simple(asType, listOf(Param("el", elementType.asType)), asType),
+            ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    val self = assertIsSet(target)
+                    return SetValue.of(elementType, self + args[0], env)
+                }
+            },
+            object : PrimitiveMethod(
+                "remove",
+                MethodSignature.simple(asType, listOf(Param("el", elementType.asType)), asType),
+            ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    val self = assertIsSet(target)
+                    return SetValue(elementType, self.filterNot { SetValue.same(it, args[0], env) })
+                }
+            },
+            object : PrimitiveMethod(
+                "contains",
+                MethodSignature.simple(
+                    asType,
+                    listOf(Param("el", elementType.asType)),
+                    BooleanValueType.asType,
+                ),
+            ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    val self = assertIsSet(target)
+                    return BooleanValue(SetValue.contains(self, args[0], env))
+                }
+            },
+            object : PrimitiveMethod(
+                "union",
+                MethodSignature.simple(asType, listOf(Param("other", asType)), asType),
+            ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    val self = assertIsSet(target)
+                    val other = assertIsSet(args[0])
+                    return SetValue.of(elementType, self + other, env)
+                }
+            },
+            object : PrimitiveMethod(
+                "intersect",
+                MethodSignature.simple(asType, listOf(Param("other", asType)), asType),
+            ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    val self = assertIsSet(target)
+                    val other = assertIsSet(args[0])
+                    return SetValue(elementType, self.filter { SetValue.contains(other, it, env) })
+                }
+            },
+            object : PrimitiveMethod(
+                "difference",
+                MethodSignature.simple(asType, listOf(Param("other", asType)), asType),
+            ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    val self = assertIsSet(target)
+                    val other = assertIsSet(args[0])
+                    return SetValue(elementType, self.filterNot { SetValue.contains(other, it, env) })
+                }
+            },
+            object : PrimitiveMethod(
+                "size",
+                MethodSignature.simple(asType, emptyList<Param>(), IntegerValueType.asType),
+            ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    return IntegerValue(assertIsSet(target).size)
+                }
+            },
+            object : PrimitiveMethod(
+                "to_vector",
+                MethodSignature.simple(
+                    asType,
+                    emptyList<Param>(),
+                    VectorValueType.of(elementType).asType,
+                ),
+            ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    return VectorValue(elementType, assertIsSet(target))
+                }
+            },
+            object : PrimitiveMethod(
+                "eq",
+                MethodSignature.simple(asType, listOf(Param("r", asType)), BooleanValueType.asType),
+            ) {
+                override fun execute(target: Value, args: List<Value>, env: Env): Value {
+                    val s1 = assertIsSet(target)
+                    val s2 = assertIsSet(args[0])
+                    return BooleanValue(
+                        s1.size == s2.size && s1.all { SetValue.contains(s2, it, env) }
+                    )
+                }
+            },
+        )
+    }
+
+    override val providesVariables: Map<String, Value> = emptyMap()
+
+    override fun assertIs(v: Value): SetValue {
+        if (v is SetValue) {
+            return v
+        } else {
+            throwTypeError(v)
+        }
+    }
+
+    companion object {
+        val setTypes = HashMap<ValueType, SetValueType>()
+
+        fun of(t: ValueType): SetValueType {
+            return setTypes.computeIfAbsent(t) { t -> SetValueType(t) }
+        }
+    }
+}
+
+/**
+ * A set of values. The elements are kept in the order that they were first added,
+ * with no duplicates; use [SetValue.of] to build a set from values that might
+ * contain duplicates.
+ */
+class SetValue(val elementType: ValueType, val elements: List<Value>) : Value {
+    override val valueType: ValueType = SetValueType.of(elementType)
+
+    override fun twist(): Twist = Twist.obj("SetValue", Twist.array("elements", elements))
+
+    companion object {
+        /** Build a set from a list of values, dropping any duplicates. */
+        fun of(elementType: ValueType, values: List<Value>, env: Env): SetValue {
+            val result = ArrayList<Value>()
+            for (v in values) {
+                if (!contains(result, v, env)) {
+                    result.add(v)
+                }
+            }
+            return SetValue(elementType, result)
+        }
+
+        fun contains(elements: List<Value>, v: Value, env: Env): Boolean =
+            elements.any { same(it, v, env) }
+
+        /** Are two values the same set element, according to their value type? */
+        fun same(l: Value, r: Value, env: Env): Boolean {
+            val type = l.valueType
+            // Look the methods up through the env, like a method call does, so that
+            // methods declared in the model are used as well as the built-in ones.
+            return if (env.getMethodType(type.asType, "eq") != null) {
+                val e = env.applyMethod(l, "eq", listOf(r))
+                e.valueType.isTruthy(e)
+            } else if (env.getMethodType(type.asType, "compare") != null) {
+                type.assertIsInt(env.applyMethod(l, "compare", listOf(r))) == 0
+            } else {
+                throw SimplexEvaluationError(
+                    "Values of type ${type.name} can't be set elements, because they can't be compared"
+                )
+            }
+        }
+    }
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.scad
+
+/** An argument in an OpenSCAD call, which may be named. */
+data class ScadArg(val name: String?, val value: ScadExpr)
+
+/** A parameter of an OpenSCAD module or function, with its default value if it has one. */
+data class ScadParam(val name: String, val default: ScadExpr?)
+
+/** OpenSCAD expressions. Every node records the line where it starts. */
+sealed class ScadExpr(val line: Int) {
+    class Num(val value: Double, line: Int) : ScadExpr(line)
+
+    class Str(val value: String, line: Int) : ScadExpr(line)
+
+    class Bool(val value: Boolean, line: Int) : ScadExpr(line)
+
+    class Undef(line: Int) : ScadExpr(line)
+
+    class Var(val name: String, line: Int) : ScadExpr(line)
+
+    class Vector(val elements: List<ScadExpr>, line: Int) : ScadExpr(line)
+
+    class Range(val start: ScadExpr, val step: ScadExpr?, val end: ScadExpr, line: Int) : ScadExpr(line)
+
+    class Index(val target: ScadExpr, val index: ScadExpr, line: Int) : ScadExpr(line)
+
+    class Member(val target: ScadExpr, val name: String, line: Int) : ScadExpr(line)
+
+    class Call(val name: String, val args: List<ScadArg>, line: Int) : ScadExpr(line)
+
+    class Unary(val op: String, val operand: ScadExpr, line: Int) : ScadExpr(line)
+
+    class Binary(val op: String, val left: ScadExpr, val right: ScadExpr, line: Int) : ScadExpr(line)
+
+    class Ternary(val cond: ScadExpr, val ifTrue: ScadExpr, val ifFalse: ScadExpr, line: Int) :
+        ScadExpr(line)
+
+    /**
+     * A construct that's parsed but not represented in detail, like a list
+     * comprehension or a function literal.
+     */
+    class Unsupported(val description: String, line: Int) : ScadExpr(line)
+}
+
+/** OpenSCAD statements. */
+sealed class ScadStmt(val line: Int) {
+    class Assign(val name: String, val value: ScadExpr, line: Int) : ScadStmt(line)
+
+    class ModuleDef(val name: String, val params: List<ScadParam>, val body: List<ScadStmt>, line: Int) :
+        ScadStmt(line)
+
+    class FunctionDef(val name: String, val params: List<ScadParam>, val body: ScadExpr, line: Int) :
+        ScadStmt(line)
+
+    /**
+     * A module instantiation, like `translate([1, 0, 0]) cube(2);`. Control
+     * structures that look like instantiations, like `for`, are parsed as these too.
+     *
+     * @param modifier the modifier character in front of the instantiation, if any:
+     *    `!`, `#`, `%`, or `*`.
+     */
+    class Instance(
+        val name: String,
+        val args: List<ScadArg>,
+        val children: List<ScadStmt>,
+        val modifier: Char?,
+        line: Int,
+    ) : ScadStmt(line)
+
+    class If(val cond: ScadExpr, val then: List<ScadStmt>, val otherwise: List<ScadStmt>?, line: Int) :
+        ScadStmt(line)
+
+    /** A `use` or `include` of another file. */
+    class Use(val keyword: String, val path: String, line: Int) : ScadStmt(line)
+}
@@ -0,0 +1,501 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.scad
+
+import org.goodmath.simplex.ast.Location
+import org.goodmath.simplex.runtime.SimplexError
+
+/**
+ * A recursive descent parser for OpenSCAD source. It handles the language as used
+ * in ordinary models: modules, functions, assignments, module instantiations with
+ * modifiers, `if`/`else`, `use`/`include`, and the full expression syntax. List
+ * comprehensions, function literals, and `let`/`assert`/`echo` expressions are
+ * skipped over and represented as [ScadExpr.Unsupported].
+ *
+ * @param filename the name of the file being parsed, for error messages.
+ * @param text the source text.
+ */
+class ScadParser(val filename: String, val text: String) {
+    private enum class Kind {
+        Num,
+        Str,
+        Id,
+        Op,
+        Path,
+        End,
+    }
+
+    private data class Token(val kind: Kind, val text: String, val line: Int, val col: Int)
+
+    private val tokens = ArrayList<Token>()
+    private var pos = 0
+
+    private fun error(msg: String, line: Int, col: Int): SimplexError =
+        SimplexError(SimplexError.Kind.Parser, msg, Location(filename, line, col + 1))
+
+    private fun tokenize() {
+        var i = 0
+        var line = 1
+        var lineStart = 0
+        val ops = listOf("<=", ">=", "==", "!=", "&&", "||") + "+-*/%^!<>?:=;,()[]{}.#".map { it.toString() }
+        while (i < text.length) {
+            val c = text[i]
+            val col = i - lineStart
+            when {
+                c == '\n' -> {
+                    i++
+                    line++
+                    lineStart = i
+                }
+                c.isWhitespace() -> i++
+                text.startsWith("//", i) -> {
+                    while (i < text.length && text[i] != '\n') {
+                        i++
+                    }
+                }
+                text.startsWith("/*", i) -> {
+                    val end = text.indexOf("*/", i + 2)
+                    if (end < 0) {
+                        throw error("Unterminated comment", line, col)
+                    }
+                    for (j in i until end) {
+                        if (text[j] == '\n') {
+                            line++
+                            lineStart = j + 1
+                        }
+                    }
+                    i = end + 2
+                }
+                c.isDigit() || (c == '.' && i + 1 < text.length && text[i + 1].isDigit()) -> {
+                    val m = NUMBER.matchAt(text, i)!!
+                    tokens.add(Token(Kind.Num, m.value, line, col))
+                    i += m.value.length
+                }
+                c.isLetter() || c == '_' || c == '$' -> {
+                    var j = i + 1
+                    while (j < text.length && (text[j].isLetterOrDigit() || text[j] == '_')) {
+                        j++
+                    }
+                    val word = text.substring(i, j)
+                    tokens.add(Token(Kind.Id, word, line, col))
+                    i = j
+                    if (word == "use" || word == "include") {
+                        while (i < text.length && (text[i] == ' ' || text[i] == '\t')) {
+                            i++
+                        }
+                        if (i < text.length && text[i] == '<') {
+                            val end = text.indexOf('>', i)
+                            if (end < 0) {
+                                throw error("Unterminated $word path", line, col)
+                            }
+                            tokens.add(Token(Kind.Path, text.substring(i + 1, end), line, i - lineStart))
+                            i = end + 1
+                        }
+                    }
+                }
+                c == '"' -> {
+                    val result = StringBuilder()
+                    var j = i + 1
+                    while (j < text.length && text[j] != '"') {
+                        if (text[j] == '\\' && j + 1 < text.length) {
+                            j++
+                            result.append(
+                                when (text[j]) {
+                                    'n' -> '\n'
+                                    't' -> '\t'
+                                    'r' -> '\r'
+                                    else -> text[j]
+                                }
+                            )
+                        } else {
+                            if (text[j] == '\n') {
+                                line++
+                                lineStart = j + 1
+                            }
+                            result.append(text[j])
+                        }
+                        j++
+                    }
+                    if (j >= text.length) {
+                        throw error("Unterminated string", line, col)
+                    }
+                    tokens.add(Token(Kind.Str, result.toString(), line, col))
+                    i = j + 1
+                }
+                else -> {
+                    val op = ops.firstOrNull { text.startsWith(it, i) } ?: throw error("Unexpected character '$c'", line, col)
+                    tokens.add(Token(Kind.Op, op, line, col))
+                    i += op.length
+                }
+            }
+        }
+        tokens.add(Token(Kind.End, "<end of file>", line, i - lineStart))
+    }
+
+    private val current: Token
+        get() = tokens[pos]
+
+    private fun isOp(op: String, offset: Int = 0): Boolean {
+        val t = tokens[minOf(pos + offset, tokens.size - 1)]
+        return t.kind == Kind.Op && t.text == op
+    }
+
+    private fun isId(word: String): Boolean = current.kind == Kind.Id && current.text == word
+
+    private fun advance(): Token = tokens[pos].also { if (pos < tokens.size - 1) pos++ }
+
+    private fun expectOp(op: String): Token {
+        if (!isOp(op)) {
+            throw error("Expected '$op', but found '${current.text}'", current.line, current.col)
+        }
+        return advance()
+    }
+
+    private fun expectId(): Token {
+        if (current.kind != Kind.Id) {
+            throw error("Expected a name, but found '${current.text}'", current.line, current.col)
+        }
+        return advance()
+    }
+
+    /** Parse the whole file into a list of statements. */
+    fun parse(): List<ScadStmt> {
+        tokenize()
+        val result = ArrayList<ScadStmt>()
+        while (current.kind != Kind.End) {
+            statement()?.let { result.add(it) }
+        }
+        return result
+    }
+
+    /** Parse a statement; an empty statement returns null. */
+    private fun statement(): ScadStmt? {
+        val start = current
+        return when {
+            isOp(";") -> {
+                advance()
+                null
+            }
+            isOp("{") -> {
+                // A bare block is equivalent to its contents; represent it as a union.
+                ScadStmt.Instance("union", emptyList(), block(), null, start.line)
+            }
+            isId("module") -> {
+                advance()
+                val name = expectId().text
+                val params = params()
+                val body = childStatements()
+                ScadStmt.ModuleDef(name, params, body, start.line)
+            }
+            isId("function") -> {
+                advance()
+                val name = expectId().text
+                val params = params()
+                expectOp("=")
+                val body = expr()
+                expectOp(";")
+                ScadStmt.FunctionDef(name, params, body, start.line)
+            }
+            (isId("use") || isId("include")) && tokens[pos + 1].kind == Kind.Path -> {
+                val keyword = advance().text
+                val path = advance().text
+                if (isOp(";")) {
+                    advance()
+                }
+                ScadStmt.Use(keyword, path, start.line)
+            }
+            isId("if") -> {
+                advance()
+                expectOp("(")
+                val cond = expr()
+                expectOp(")")
+                val then = childStatements()
+                val otherwise =
+                    if (isId("else")) {
+                        advance()
+                        childStatements()
+                    } else {
+                        null
+                    }
+                ScadStmt.If(cond, then, otherwise, start.line)
+            }
+            current.kind == Kind.Id && isOp("=", 1) -> {
+                val name = advance().text
+                advance()
+                val value = expr()
+                expectOp(";")
+                ScadStmt.Assign(name, value, start.line)
+            }
+            else -> instance()
+        }
+    }
+
+    private fun instance(): ScadStmt {
+        val start = current
+        var modifier: Char? = null
+        if (isOp("!") || isOp("#") || isOp("%") || isOp("*")) {
+            modifier = advance().text[0]
+        }
+        if (isId("if")) {
+            // A modifier on an if applies to the whole statement.
+            return statement()!!
+        }
+        val name = expectId().text
+        expectOp("(")
+        val args = args(")")
+        return ScadStmt.Instance(name, args, childStatements(), modifier, start.line)
+    }
+
+    /** The children of a module instantiation or control statement. */
+    private fun childStatements(): List<ScadStmt> =
+        when {
+            isOp(";") -> {
+                advance()
+                emptyList()
+            }
+            isOp("{") -> block()
+            else -> listOfNotNull(statement())
+        }
+
+    private fun block(): List<ScadStmt> {
+        expectOp("{")
+        val result = ArrayList<ScadStmt>()
+        while (!isOp("}")) {
+            if (current.kind == Kind.End) {
+                throw error("Unterminated block", current.line, current.col)
+            }
+            statement()?.let { result.add(it) }
+        }
+        advance()
+        return result
+    }
+
+    private fun params(): List<ScadParam> {
+        expectOp("(")
+        val result = ArrayList<ScadParam>()
+        while (!isOp(")")) {
+            val name = expectId().text
+            val default =
+                if (isOp("=")) {
+                    advance()
+                    expr()
+                } else {
+                    null
+                }
+            result.add(ScadParam(name, default))
+            if (!isOp(")")) {
+                expectOp(",")
+            }
+        }
+        advance()
+        return result
+    }
+
+    /** Parse call arguments up to a closing token, which is consumed. */
+    private fun args(close: String): List<ScadArg> {
+        val result = ArrayList<ScadArg>()
+        while (!isOp(close)) {
+            if (current.kind == Kind.Id && isOp("=", 1)) {
+                val name = advance().text
+                advance()
+                result.add(ScadArg(name, expr()))
+            } else {
+                result.add(ScadArg(null, expr()))
+            }
+            if (!isOp(close)) {
+                expectOp(",")
+            }
+        }
+        advance()
+        return result
+    }
+
+    fun expr(): ScadExpr {
+        val start = current
+        if (isId("let") || isId("assert") || isId("echo")) {
+            val word = advance().text
+            expectOp("(")
+            args(")")
+            expr()
+            return ScadExpr.Unsupported("'$word' expression", start.line)
+        }
+        if (isId("function") && isOp("(", 1)) {
+            advance()
+            params()
+            expr()
+            return ScadExpr.Unsupported("function literal", start.line)
+        }
+        val cond = binary(0)
+        if (isOp("?")) {
+            advance()
+            val ifTrue = expr()
+            expectOp(":")
+            val ifFalse = expr()
+            return ScadExpr.Ternary(cond, ifTrue, ifFalse, start.line)
+        }
+        return cond
+    }
+
+    private fun binary(level: Int): ScadExpr {
+        if (level == BINARY_OPS.size) {
+            return unary()
+        }
+        var left = binary(level + 1)
+        while (current.kind == Kind.Op && current.text in BINARY_OPS[level]) {
+            val op = advance()
+            // Exponentiation is right associative.
+            val right = if (op.text == "^") binary(level) else binary(level + 1)
+            left = ScadExpr.Binary(op.text, left, right, op.line)
+        }
+        return left
+    }
+
+    private fun unary(): ScadExpr {
+        if (isOp("-") || isOp("!") || isOp("+")) {
+            val op = advance()
+            val operand = unary()
+            return if (op.text == "+") operand else ScadExpr.Unary(op.text, operand, op.line)
+        }
+        return postfix()
+    }
+
+    private fun postfix(): ScadExpr {
+        var e = primary()
+        while (true) {
+            e =
+                when {
+                    isOp("[") -> {
+                        advance()
+                        val index = expr()
+                        expectOp("]")
+                        ScadExpr.Index(e, index, e.line)
+                    }
+                    isOp(".") -> {
+                        advance()
+                        ScadExpr.Member(e, expectId().text, e.line)
+                    }
+                    isOp("(") && e is ScadExpr.Var -> {
+                        advance()
+                        ScadExpr.Call(e.name, args(")"), e.line)
+                    }
+                    else -> return e
+                }
+        }
+    }
+
+    private fun primary(): ScadExpr {
+        val t = current
+        return when {
+            t.kind == Kind.Num -> {
+                advance()
+                ScadExpr.Num(t.text.toDouble(), t.line)
+            }
+            t.kind == Kind.Str -> {
+                advance()
+                ScadExpr.Str(t.text, t.line)
+            }
+            t.kind == Kind.Id -> {
+                advance()
+                when (t.text) {
+                    "true" -> ScadExpr.Bool(true, t.line)
+                    "false" -> ScadExpr.Bool(false, t.line)
+                    "undef" -> ScadExpr.Undef(t.line)
+                    else -> ScadExpr.Var(t.text, t.line)
+                }
+            }
+            isOp("(") -> {
+                advance()
+                val e = expr()
+                expectOp(")")
+                e
+            }
+            isOp("[") -> {
+                advance()
+                if (isId("for") || isId("each") || isId("if") || isId("let")) {
+                    skipTo("]")
+                    return ScadExpr.Unsupported("list comprehension", t.line)
+                }
+                if (isOp("]")) {
+                    advance()
+                    return ScadExpr.Vector(emptyList(), t.line)
+                }
+                val first = expr()
+                if (isOp(":")) {
+                    advance()
+                    val second = expr()
+                    return if (isOp(":")) {
+                        advance()
+                        val third = expr()
+                        expectOp("]")
+                        ScadExpr.Range(first, second, third, t.line)
+                    } else {
+                        expectOp("]")
+                        ScadExpr.Range(first, null, second, t.line)
+                    }
+                }
+                val elements = arrayListOf(first)
+                while (isOp(",")) {
+                    advance()
+                    if (isOp("]")) {
+                        break
+                    }
+                    elements.add(expr())
+                }
+                expectOp("]")
+                ScadExpr.Vector(elements, t.line)
+            }
+            else -> throw error("Unexpected '${t.text}' in expression", t.line, t.col)
+        }
+    }
+
+    /** Skip past balanced brackets up to and including a closing token. */
+    private fun skipTo(close: String) {
+        var depth = 0
+        while (current.kind != Kind.End) {
+            val t = advance()
+            if (t.kind == Kind.Op) {
+                when (t.text) {
+                    "(", "[", "{" -> depth++
+                    ")", "]", "}" -> {
+                        if (depth == 0 && t.text == close) {
+                            return
+                        }
+                        depth--
+                    }
+                }
+            }
+        }
+        throw error("Expected '$close' before the end of the file", current.line, current.col)
+    }
+
+    companion object {
+        private val NUMBER = Regex("[0-9]*\\.?[0-9]+([eE][+-]?[0-9]+)?|[0-9]+\\.")
+
+        /** Binary operators, from lowest to highest precedence. */
+        private val BINARY_OPS =
+            listOf(
+                setOf("||"),
+                setOf("&&"),
+                setOf("==", "!="),
+                setOf("<", "<=", ">", ">="),
+                setOf("+", "-"),
+                setOf("*", "/", "%"),
+                setOf("^"),
+            )
+
+        fun parse(filename: String, text: String): List<ScadStmt> = ScadParser(filename, text).parse()
+    }
+}
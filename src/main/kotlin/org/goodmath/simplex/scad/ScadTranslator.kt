@@ -0,0 +1,1091 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.scad
+
+/**
+ * Translates parsed OpenSCAD into Simplex source.
+ *
+ * Modules become functions that return a `Solid` (or a `Slice`, for modules that
+ * build 2D geometry); OpenSCAD functions become Simplex functions; transformations
+ * become method chains; and the boolean operations become `+`, `-`, and
+ * `->intersect`. Top-level geometry is collected into a single product named
+ * "main".
+ *
+ * OpenSCAD is dynamically typed, and Simplex isn't, so the translator infers types
+ * from default values and from how values are used. Everything numeric becomes a
+ * Float. Anything that can't be translated is recorded in [issues] with the line
+ * where it appears, and is marked in the output with an `untranslated` comment.
+ */
+class ScadTranslator {
+    data class Issue(val line: Int, val message: String) {
+        override fun toString(): String = "line $line: $message"
+    }
+
+    val issues = ArrayList<Issue>()
+
+    /**
+     * A translated piece of geometry.
+     *
+     * @param text the Simplex expression.
+     * @param flat true if the geometry is a Slice rather than a Solid.
+     * @param atomic true if the expression can be the target of a method call
+     *    without being parenthesized.
+     */
+    private data class Geometry(val text: String, val flat: Boolean, val atomic: Boolean = true) {
+        val target: String
+            get() = if (atomic) text else "($text)"
+    }
+
+    /**
+     * The translation of a block of statements: the nested definitions, the
+     * `let` bindings, and the geometry that the block produces.
+     */
+    private class Block(val defs: List<String>, val lets: List<String>, val geometry: Geometry?)
+
+    private val modules = HashMap<String, ScadStmt.ModuleDef>()
+    private val functions = HashMap<String, ScadStmt.FunctionDef>()
+    private val flatModules = HashMap<String, Boolean>()
+
+    /** Top-level variables with constant values, for evaluating ranges and conditions. */
+    private val constants = HashMap<String, Any>()
+
+    /** The types of the variables in scope. */
+    private var scope: Map<String, String> = emptyMap()
+
+    /** The value of a top-level `$fn` assignment, used as the default facet count. */
+    private var defaultFacets: Int? = null
+
+    private fun issue(line: Int, message: String) {
+        issues.add(Issue(line, message))
+    }
+
+    private fun untranslated(line: Int, description: String): String {
+        issue(line, "$description can't be translated")
+        return "0.0 /* untranslated: $description */"
+    }
+
+    /** Translate a parsed OpenSCAD file into the text of a Simplex model. */
+    fun translate(stmts: List<ScadStmt>, sourceName: String): String {
+        collectDefinitions(stmts)
+        val out = StringBuilder()
+        out.append("// Translated from $sourceName by simplex import-scad.\n")
+        val geometry = ArrayList<Geometry>()
+        for (stmt in stmts) {
+            when (stmt) {
+                is ScadStmt.Assign -> topLevelAssign(stmt)?.let { out.append("\n$it\n") }
+                is ScadStmt.ModuleDef -> out.append("\n${moduleDef(stmt, "")}")
+                is ScadStmt.FunctionDef -> out.append("\n${functionDef(stmt, "")}")
+                is ScadStmt.Use ->
+                    issue(
+                        stmt.line,
+                        "'${stmt.keyword} <${stmt.path}>' can't be translated; translate that file separately",
+                    )
+                else -> geometry(stmt)?.let { geometry.add(it) }
+            }
+        }
+        val main = union(geometry, stmts.firstOrNull()?.line ?: 1)
+        if (main != null) {
+            out.append("\nproduce(\"main\") {\n    ${main.text}\n}\n")
+        } else if (modules.isEmpty() && functions.isEmpty() && !out.contains("\nlet ")) {
+            issue(1, "the file doesn't contain any geometry or definitions")
+        }
+        return out.toString()
+    }
+
+    private fun collectDefinitions(stmts: List<ScadStmt>) {
+        for (stmt in stmts) {
+            when (stmt) {
+                is ScadStmt.ModuleDef -> {
+                    modules[stmt.name] = stmt
+                    collectDefinitions(stmt.body)
+                }
+                is ScadStmt.FunctionDef -> functions[stmt.name] = stmt
+                else -> {}
+            }
+        }
+    }
+
+    private fun topLevelAssign(stmt: ScadStmt.Assign): String? {
+        if (stmt.name.startsWith("$")) {
+            if (stmt.name == "\$fn") {
+                val fn = constant(stmt.value) as? Double
+                if (fn != null) {
+                    defaultFacets = fn.toInt()
+                    return null
+                }
+            }
+            issue(stmt.line, "special variable '${stmt.name}' is ignored")
+            return null
+        }
+        constant(stmt.value)?.let { constants[stmt.name] = it }
+        scope = scope + (stmt.name to typeOf(stmt.value))
+        return "let ${name(stmt.name)} = ${expr(stmt.value)}"
+    }
+
+    // ---------------------------------------------------------------------
+    // Definitions
+    // ---------------------------------------------------------------------
+
+    private fun paramType(param: ScadParam, body: List<ScadExpr>): String =
+        when {
+            param.default != null && param.default !is ScadExpr.Undef -> typeOf(param.default)
+            body.any { usesAsVector(param.name, it) } -> "[Float]"
+            else -> "Float"
+        }
+
+    private fun functionDef(def: ScadStmt.FunctionDef, indent: String): String {
+        val saved = scope
+        val params = def.params.map { it to paramType(it, listOf(def.body)) }
+        scope = scope + params.map { (p, type) -> p.name to type }
+        val result = "${indent}fun ${name(def.name)}(${paramList(params)}): ${typeOf(def.body)} {\n" +
+            "$indent    ${expr(def.body)}\n" +
+            "$indent}\n"
+        scope = saved
+        return result
+    }
+
+    private fun moduleDef(def: ScadStmt.ModuleDef, indent: String): String {
+        val saved = scope
+        val bodyExprs = ArrayList<ScadExpr>()
+        visit(def.body) { bodyExprs.add(it) }
+        val params = def.params.filter { !it.name.startsWith("$") }.map { it to paramType(it, bodyExprs) }
+        scope = scope + params.map { (p, type) -> p.name to type }
+        val flat = isFlat(def.name)
+        val block = block(def.body, def.line)
+        val out = StringBuilder()
+        out.append("${indent}fun ${name(def.name)}(${paramList(params)}): ${if (flat) "Slice" else "Solid"} {\n")
+        for (d in block.defs) {
+            out.append(d.trimEnd().prependIndent("$indent    ")).append("\n")
+        }
+        for (l in block.lets) {
+            out.append("$indent    $l\n")
+        }
+        if (block.geometry != null) {
+            out.append("$indent    ${block.geometry.text}\n")
+        } else {
+            issue(def.line, "module '${def.name}' doesn't produce any geometry")
+            out.append("$indent    /* untranslated: empty module */ ${empty(flat)}\n")
+        }
+        out.append("$indent}\n")
+        scope = saved
+        return out.toString()
+    }
+
+    private fun paramList(params: List<Pair<ScadParam, String>>): String =
+        params.joinToString(", ") { (p, type) -> "${name(p.name)}: $type" }
+
+    private fun empty(flat: Boolean): String = if (flat) "rectangle(0.0, 0.0)" else "cuboid(0.0, 0.0, 0.0)"
+
+    /**
+     * Translate a block of statements. Assignments become `let` bindings, nested
+     * definitions become nested functions, and the geometry is unioned.
+     */
+    private fun block(stmts: List<ScadStmt>, line: Int): Block {
+        val defs = ArrayList<String>()
+        val lets = ArrayList<String>()
+        val geometry = ArrayList<Geometry>()
+        for (stmt in stmts) {
+            when (stmt) {
+                is ScadStmt.Assign ->
+                    if (stmt.name.startsWith("$")) {
+                        issue(stmt.line, "special variable '${stmt.name}' is ignored")
+                    } else {
+                        scope = scope + (stmt.name to typeOf(stmt.value))
+                        lets.add("let ${name(stmt.name)} = ${expr(stmt.value)}")
+                    }
+                is ScadStmt.ModuleDef -> defs.add(moduleDef(stmt, ""))
+                is ScadStmt.FunctionDef -> defs.add(functionDef(stmt, ""))
+                is ScadStmt.Use -> issue(stmt.line, "'${stmt.keyword}' is only supported at the top level")
+                else -> geometry(stmt)?.let { geometry.add(it) }
+            }
+        }
+        return Block(defs, lets, union(geometry, line))
+    }
+
+    /**
+     * Translate the children of a statement into a single piece of geometry. If the
+     * children include assignments, the result is a block expression.
+     */
+    private fun children(stmts: List<ScadStmt>, line: Int): Geometry? {
+        val saved = scope
+        val block = block(stmts, line)
+        scope = saved
+        if (block.defs.isNotEmpty()) {
+            issue(line, "definitions nested inside geometry can't be translated")
+        }
+        val geometry = block.geometry ?: return null
+        return if (block.lets.isEmpty()) {
+            geometry
+        } else {
+            Geometry("{ ${block.lets.joinToString(" ")} ${geometry.text} }", geometry.flat, false)
+        }
+    }
+
+    // ---------------------------------------------------------------------
+    // Geometry
+    // ---------------------------------------------------------------------
+
+    private fun union(parts: List<Geometry>, line: Int): Geometry? {
+        if (parts.isEmpty()) {
+            return null
+        }
+        if (parts.size == 1) {
+            return parts[0]
+        }
+        checkDimensions(parts, line)
+        return Geometry(parts.joinToString(" + ") { it.target }, parts[0].flat, false)
+    }
+
+    private fun checkDimensions(parts: List<Geometry>, line: Int) {
+        if (parts.any { it.flat != parts[0].flat }) {
+            issue(line, "2D and 3D geometry are mixed in one operation")
+        }
+    }
+
+    private fun geometry(stmt: ScadStmt): Geometry? =
+        when (stmt) {
+            is ScadStmt.Instance -> instance(stmt)
+            is ScadStmt.If -> ifGeometry(stmt)
+            else -> null
+        }
+
+    private fun ifGeometry(stmt: ScadStmt.If): Geometry? {
+        val known = constant(stmt.cond) as? Boolean
+        if (known != null) {
+            return children(if (known) stmt.then else stmt.otherwise ?: emptyList(), stmt.line)
+        }
+        val then = children(stmt.then, stmt.line)
+        val otherwise = stmt.otherwise?.let { children(it, stmt.line) }
+        if (then == null || otherwise == null) {
+            issue(stmt.line, "an 'if' without geometry in both branches can't be translated")
+            return null
+        }
+        checkDimensions(listOf(then, otherwise), stmt.line)
+        return Geometry("if (${expr(stmt.cond)}) ${then.text} else ${otherwise.text}", then.flat, false)
+    }
+
+    private fun instance(stmt: ScadStmt.Instance): Geometry? {
+        when (stmt.modifier) {
+            '*' -> {
+                issue(stmt.line, "'${stmt.name}' is disabled with '*', and was left out")
+                return null
+            }
+            '%' -> {
+                issue(stmt.line, "background object '${stmt.name}' was left out")
+                return null
+            }
+            '!' -> issue(stmt.line, "the '!' modifier on '${stmt.name}' is ignored")
+        }
+        return when (stmt.name) {
+            "cube" -> cube(stmt)
+            "sphere" -> sphere(stmt)
+            "cylinder" -> cylinder(stmt)
+            "square" -> square(stmt)
+            "circle" -> circle(stmt)
+            "polygon" -> polygon(stmt)
+            "translate" -> translate(stmt)
+            "rotate" -> rotate(stmt)
+            "scale" -> scale(stmt)
+            "mirror" -> mirror(stmt)
+            "union", "group", "render" -> children(stmt.children, stmt.line)
+            "difference" -> difference(stmt)
+            "intersection" -> intersection(stmt)
+            "hull" -> hull(stmt)
+            "color" -> {
+                issue(stmt.line, "color is ignored")
+                children(stmt.children, stmt.line)
+            }
+            "linear_extrude" -> linearExtrude(stmt)
+            "rotate_extrude" -> rotateExtrude(stmt)
+            "for" -> forLoop(stmt)
+            "children" -> {
+                issue(stmt.line, "children() can't be translated")
+                null
+            }
+            "echo", "assert" -> {
+                issue(stmt.line, "'${stmt.name}' is ignored")
+                null
+            }
+            else -> moduleCall(stmt)
+        }
+    }
+
+    private fun moduleCall(stmt: ScadStmt.Instance): Geometry? {
+        val def = modules[stmt.name]
+        if (def == null) {
+            issue(stmt.line, "'${stmt.name}' can't be translated")
+            return null
+        }
+        if (stmt.children.isNotEmpty()) {
+            issue(stmt.line, "children passed to module '${stmt.name}' can't be translated")
+        }
+        return Geometry(
+            "${name(def.name)}(${callArgs(def.name, def.params, stmt.args, stmt.line)})",
+            isFlat(def.name),
+        )
+    }
+
+    /**
+     * Bind the arguments of a call to the parameters of a user-defined module or
+     * function, filling in defaults, and translate them.
+     */
+    private fun callArgs(callee: String, params: List<ScadParam>, args: List<ScadArg>, line: Int): String {
+        val real = params.filter { !it.name.startsWith("$") }
+        val bound = bind(callee, args, real.map { it.name }, line)
+        return real.joinToString(", ") { p ->
+            val value = bound[p.name] ?: p.default
+            if (value == null) {
+                untranslated(line, "missing argument '${p.name}' of '$callee'")
+            } else {
+                expr(value)
+            }
+        }
+    }
+
+    /**
+     * Match the arguments of a call to parameter names: positional arguments bind in
+     * order, and named arguments bind by name. Arguments that don't match any
+     * parameter are reported.
+     */
+    private fun bind(callee: String, args: List<ScadArg>, names: List<String>, line: Int): Map<String, ScadExpr> {
+        val result = HashMap<String, ScadExpr>()
+        var position = 0
+        for (arg in args) {
+            if (arg.name == null) {
+                if (position < names.size) {
+                    result[names[position++]] = arg.value
+                } else {
+                    issue(line, "extra argument to '$callee' is ignored")
+                }
+            } else if (arg.name in names) {
+                result[arg.name] = arg.value
+            } else if (arg.name != "\$fa" && arg.name != "\$fs") {
+                issue(line, "argument '${arg.name}' of '$callee' is ignored")
+            }
+        }
+        return result
+    }
+
+    /** The facet count for a primitive, from its `$fn` argument or the top-level default. */
+    private fun facets(args: Map<String, ScadExpr>): String? {
+        val fn = args["\$fn"] ?: return defaultFacets?.takeIf { it > 0 }?.toString()
+        return intExpr(fn)
+    }
+
+    private fun centered(args: Map<String, ScadExpr>): String {
+        val center = args["center"] ?: return "false"
+        return when (val c = constant(center)) {
+            is Boolean -> c.toString()
+            else -> expr(center)
+        }
+    }
+
+    private fun cube(stmt: ScadStmt.Instance): Geometry {
+        val args = bind("cube", stmt.args, listOf("size", "center"), stmt.line)
+        val (x, y, z) = components(args["size"], 3, "1.0")
+        val anchor =
+            when (val center = centered(args)) {
+                "true" -> "\"center\""
+                "false" -> "\"min_corner\""
+                else -> "if ($center) \"center\" else \"min_corner\""
+            }
+        return Geometry("cuboid($x, $y, $z, $anchor)", false)
+    }
+
+    private fun sphere(stmt: ScadStmt.Instance): Geometry {
+        val args = bind("sphere", stmt.args, listOf("r", "d", "\$fn"), stmt.line)
+        val r = radius(args["r"], args["d"]) ?: "1.0"
+        val fn = facets(args)
+        return Geometry(if (fn != null) "ovoid($r, $fn)" else "ovoid($r)", false)
+    }
+
+    private fun cylinder(stmt: ScadStmt.Instance): Geometry {
+        val args =
+            bind(
+                "cylinder",
+                stmt.args,
+                listOf("h", "r1", "r2", "center", "r", "d", "d1", "d2", "\$fn"),
+                stmt.line,
+            )
+        val h = args["h"]?.let { expr(it) } ?: "1.0"
+        val r = radius(args["r"], args["d"]) ?: "1.0"
+        val r1 = radius(args["r1"], args["d1"]) ?: r
+        val r2 = radius(args["r2"], args["d2"]) ?: r
+        val fn = facets(args)
+        val base = if (fn != null) "cylinder($h, $r1, $r2, $fn)" else "cylinder($h, $r1, $r2)"
+        // Simplex cylinders extend down from the origin; OpenSCAD cylinders extend up.
+        val lift =
+            when (val center = centered(args)) {
+                "false" -> h
+                "true" -> "${paren(h)} / 2.0"
+                else -> "if ($center) ${paren(h)} / 2.0 else $h"
+            }
+        return Geometry("$base->move(0.0, 0.0, $lift)", false)
+    }
+
+    private fun square(stmt: ScadStmt.Instance): Geometry {
+        val args = bind("square", stmt.args, listOf("size", "center"), stmt.line)
+        val (x, y) = components(args["size"], 2, "1.0")
+        val base = "rectangle($x, $y)"
+        return when (val center = centered(args)) {
+            "false" -> Geometry(base, true)
+            "true" -> Geometry("$base->move(-${paren(x)} / 2.0, -${paren(y)} / 2.0)", true)
+            else ->
+                Geometry(
+                    "$base->move(if ($center) -${paren(x)} / 2.0 else 0.0, if ($center) -${paren(y)} / 2.0 else 0.0)",
+                    true,
+                )
+        }
+    }
+
+    private fun circle(stmt: ScadStmt.Instance): Geometry {
+        val args = bind("circle", stmt.args, listOf("r", "d", "\$fn"), stmt.line)
+        val r = radius(args["r"], args["d"]) ?: "1.0"
+        val fn = facets(args)
+        return Geometry(if (fn != null) "circle($r, $fn)" else "circle($r)", true)
+    }
+
+    private fun polygon(stmt: ScadStmt.Instance): Geometry? {
+        val args = bind("polygon", stmt.args, listOf("points", "paths", "convexity"), stmt.line)
+        if (args["paths"] != null) {
+            issue(stmt.line, "polygon paths can't be translated")
+            return null
+        }
+        val points = args["points"] ?: return null
+        val vertices =
+            if (points is ScadExpr.Vector) {
+                "[" + points.elements.joinToString(", ") { p ->
+                    val (x, y) = components(p, 2, "0.0")
+                    "v2($x, $y)"
+                } + "]"
+            } else {
+                "for p in ${paren(expr(points))} { v2(p[0], p[1]) }"
+            }
+        return Geometry("polygon_to_slice(polygon($vertices))", true)
+    }
+
+    private fun radius(r: ScadExpr?, d: ScadExpr?): String? =
+        when {
+            r != null -> expr(r)
+            d != null -> "${wrap(d)} / 2.0"
+            else -> null
+        }
+
+    /**
+     * Split a vector argument into its components. Literal vectors are split directly,
+     * scalars are repeated, and other vectors are subscripted.
+     */
+    private fun components(e: ScadExpr?, count: Int, default: String): List<String> {
+        if (e == null) {
+            return List(count) { default }
+        }
+        if (e is ScadExpr.Vector) {
+            return List(count) { idx -> e.elements.getOrNull(idx)?.let { expr(it) } ?: "0.0" }
+        }
+        return if (typeOf(e).startsWith("[")) {
+            val target = wrap(e)
+            List(count) { idx -> "$target[$idx]" }
+        } else {
+            val scalar = expr(e)
+            List(count) { scalar }
+        }
+    }
+
+    private fun translate(stmt: ScadStmt.Instance): Geometry? {
+        val child = children(stmt.children, stmt.line) ?: return null
+        val args = bind("translate", stmt.args, listOf("v"), stmt.line)
+        val v = components(args["v"], if (child.flat) 2 else 3, "0.0")
+        return Geometry("${child.target}->move(${v.joinToString(", ")})", child.flat)
+    }
+
+    private fun rotate(stmt: ScadStmt.Instance): Geometry? {
+        val child = children(stmt.children, stmt.line) ?: return null
+        val args = bind("rotate", stmt.args, listOf("a", "v"), stmt.line)
+        val a = args["a"] ?: return child
+        val axis = args["v"]
+        if (axis != null) {
+            val method =
+                when (constant(axis)) {
+                    listOf(1.0, 0.0, 0.0) -> "rotx"
+                    listOf(0.0, 1.0, 0.0) -> "roty"
+                    listOf(0.0, 0.0, 1.0) -> "rotz"
+                    else -> {
+                        issue(stmt.line, "rotation around an arbitrary axis can't be translated")
+                        return child
+                    }
+                }
+            if (child.flat && method != "rotz") {
+                issue(stmt.line, "a 2D shape can only be rotated around the z axis")
+                return child
+            }
+            return Geometry("${child.target}->${if (child.flat) "rotate" else method}(${expr(a)})", child.flat)
+        }
+        if (child.flat) {
+            val angle =
+                if (a is ScadExpr.Vector) {
+                    components(a, 3, "0.0")[2]
+                } else {
+                    expr(a)
+                }
+            return Geometry("${child.target}->rotate($angle)", true)
+        }
+        return if (a is ScadExpr.Vector || typeOf(a).startsWith("[")) {
+            Geometry("${child.target}->rotate(${components(a, 3, "0.0").joinToString(", ")})", false)
+        } else {
+            Geometry("${child.target}->rotz(${expr(a)})", false)
+        }
+    }
+
+    private fun scale(stmt: ScadStmt.Instance): Geometry? {
+        val child = children(stmt.children, stmt.line) ?: return null
+        val args = bind("scale", stmt.args, listOf("v"), stmt.line)
+        val v = components(args["v"], if (child.flat) 2 else 3, "1.0")
+        return Geometry("${child.target}->scale(${v.joinToString(", ")})", child.flat)
+    }
+
+    private fun mirror(stmt: ScadStmt.Instance): Geometry? {
+        val child = children(stmt.children, stmt.line) ?: return null
+        val args = bind("mirror", stmt.args, listOf("v"), stmt.line)
+        val v = components(args["v"] ?: return child, if (child.flat) 2 else 3, "0.0")
+        val norm = if (child.flat) "v2(${v.joinToString(", ")})" else "v3(${v.joinToString(", ")})"
+        return Geometry("${child.target}->mirror($norm)", child.flat)
+    }
+
+    private fun childList(stmt: ScadStmt.Instance): List<Geometry> {
+        val saved = scope
+        val result = ArrayList<Geometry>()
+        for (child in stmt.children) {
+            if (child is ScadStmt.Assign) {
+                issue(child.line, "assignments inside '${stmt.name}' can't be translated")
+                continue
+            }
+            geometry(child)?.let { result.add(it) }
+        }
+        scope = saved
+        checkDimensions(result, stmt.line)
+        return result
+    }
+
+    private fun difference(stmt: ScadStmt.Instance): Geometry? {
+        val parts = childList(stmt)
+        if (parts.size <= 1) {
+            return parts.firstOrNull()
+        }
+        return Geometry(parts.joinToString(" - ") { it.target }, parts[0].flat, false)
+    }
+
+    private fun intersection(stmt: ScadStmt.Instance): Geometry? {
+        val parts = childList(stmt)
+        if (parts.isEmpty()) {
+            return null
+        }
+        return Geometry(
+            parts[0].target + parts.drop(1).joinToString("") { "->intersect(${it.text})" },
+            parts[0].flat,
+        )
+    }
+
+    private fun hull(stmt: ScadStmt.Instance): Geometry? {
+        val parts = childList(stmt)
+        if (parts.isEmpty()) {
+            return null
+        }
+        val flat = parts[0].flat
+        val list = parts.joinToString(", ") { it.text }
+        return Geometry(if (flat) "batch_hull([$list])" else "hull_all([$list])", flat)
+    }
+
+    private fun linearExtrude(stmt: ScadStmt.Instance): Geometry? {
+        val child = children(stmt.children, stmt.line) ?: return null
+        val args =
+            bind(
+                "linear_extrude",
+                stmt.args,
+                listOf("height", "center", "convexity", "twist", "slices", "scale"),
+                stmt.line,
+            )
+        if (!child.flat) {
+            issue(stmt.line, "linear_extrude of 3D geometry can't be translated")
+            return child
+        }
+        val h = args["height"]?.let { expr(it) } ?: "100.0"
+        // OpenSCAD's slices count the layers, and extrude counts the divisions between them.
+        val steps =
+            args["slices"]?.let { s ->
+                val c = constant(s)
+                if (c is Double) maxOf(c.toInt() - 1, 0).toString() else "${intExpr(s)} - 1"
+            } ?: "0"
+        val twist = args["twist"]
+        val scale = args["scale"]
+        var result =
+            if (twist != null || scale != null) {
+                val (sx, sy) = components(scale, 2, "1.0")
+                // OpenSCAD twists clockwise, and extrude twists counterclockwise.
+                val t = twist?.let { "-${paren(expr(it))}" } ?: "0.0"
+                "${child.target}->extrude($h, $steps, $t, v2($sx, $sy))"
+            } else {
+                "${child.target}->extrude($h, $steps)"
+            }
+        when (val center = centered(args)) {
+            "false" -> {}
+            "true" -> result = "$result->move(0.0, 0.0, -${paren(h)} / 2.0)"
+            else -> result = "$result->move(0.0, 0.0, if ($center) -${paren(h)} / 2.0 else 0.0)"
+        }
+        return Geometry(result, false)
+    }
+
+    private fun rotateExtrude(stmt: ScadStmt.Instance): Geometry? {
+        val child = children(stmt.children, stmt.line) ?: return null
+        val args = bind("rotate_extrude", stmt.args, listOf("angle", "convexity", "\$fn"), stmt.line)
+        if (!child.flat) {
+            issue(stmt.line, "rotate_extrude of 3D geometry can't be translated")
+            return child
+        }
+        val segments = facets(args) ?: "32"
+        val angle = args["angle"]
+        return if (angle != null) {
+            Geometry("${child.target}->revolve($segments, ${expr(angle)})", false)
+        } else {
+            Geometry("${child.target}->revolve($segments)", false)
+        }
+    }
+
+    /**
+     * Translate a `for` statement. Each loop variable becomes a Simplex `for` loop;
+     * the vector of results is unioned.
+     */
+    private fun forLoop(stmt: ScadStmt.Instance): Geometry? {
+        val saved = scope
+        val loops = ArrayList<Pair<String, String>>()
+        for (arg in stmt.args) {
+            val variable = arg.name
+            if (variable == null) {
+                issue(stmt.line, "a 'for' without a loop variable can't be translated")
+                return null
+            }
+            val source = loopSource(variable, arg.value, stmt.line) ?: return null
+            loops.add(source)
+            val type = typeOf(arg.value)
+            scope = scope + (variable to (if (arg.value is ScadExpr.Range) "Float" else elementType(type)))
+        }
+        val body = children(stmt.children, stmt.line)
+        scope = saved
+        if (body == null || loops.isEmpty()) {
+            return body
+        }
+        if (body.flat) {
+            issue(stmt.line, "a 'for' over 2D geometry can't be translated")
+            return null
+        }
+        var text = body.text
+        for ((header, prefix) in loops.reversed()) {
+            text = "union($header { $prefix$text })"
+        }
+        return Geometry(text, false)
+    }
+
+    /**
+     * The loop header for a loop variable, and the text that has to precede the body
+     * of the loop.
+     */
+    private fun loopSource(variable: String, source: ScadExpr, line: Int): Pair<String, String>? {
+        val v = name(variable)
+        if (source !is ScadExpr.Range) {
+            return Pair("for $v in ${expr(source)}", "")
+        }
+        val start = constant(source.start) as? Double
+        val step = source.step?.let { constant(it) as? Double } ?: if (source.step == null) 1.0 else null
+        val end = constant(source.end) as? Double
+        if (start != null && step != null && end != null) {
+            if (step == 0.0 || (end - start) / step > MAX_EXPANDED_RANGE) {
+                issue(line, "range is too large to translate")
+                return null
+            }
+            val values = ArrayList<String>()
+            var x = start
+            while ((step > 0 && x <= end + 1e-9) || (step < 0 && x >= end - 1e-9)) {
+                values.add(number(x))
+                x += step
+            }
+            return Pair("for $v in [${values.joinToString(", ")}]", "")
+        }
+        if (source.step != null) {
+            issue(line, "a range with a computed step can't be translated")
+            return null
+        }
+        // Simplex's Int->to is an inclusive range, like OpenSCAD's.
+        return Pair(
+            "for ${v}_i in ${intExpr(source.start)}->to(${intExpr(source.end)})",
+            "let $v = ${v}_i->float() ",
+        )
+    }
+
+    // ---------------------------------------------------------------------
+    // Expressions
+    // ---------------------------------------------------------------------
+
+    private fun expr(e: ScadExpr): String =
+        when (e) {
+            is ScadExpr.Num -> number(e.value)
+            is ScadExpr.Str -> "\"" + e.value.replace("\\", "\\\\").replace("\"", "\\\"").replace("\n", "\\n") + "\""
+            is ScadExpr.Bool -> e.value.toString()
+            is ScadExpr.Undef -> untranslated(e.line, "undef")
+            is ScadExpr.Var -> variable(e)
+            is ScadExpr.Vector -> "[${e.elements.joinToString(", ") { expr(it) }}]"
+            is ScadExpr.Range -> {
+                val values = constant(e)
+                if (values is List<*>) {
+                    "[${values.joinToString(", ") { number(it as Double) }}]"
+                } else {
+                    untranslated(e.line, "a computed range outside of 'for'")
+                }
+            }
+            is ScadExpr.Index -> {
+                val index = e.index
+                if (index is ScadExpr.Num && index.value == Math.floor(index.value)) {
+                    "${wrap(e.target)}[${index.value.toInt()}]"
+                } else {
+                    "${wrap(e.target)}[${wrap(index)}->truncate()]"
+                }
+            }
+            is ScadExpr.Member ->
+                when (e.name) {
+                    "x" -> "${wrap(e.target)}[0]"
+                    "y" -> "${wrap(e.target)}[1]"
+                    "z" -> "${wrap(e.target)}[2]"
+                    else -> untranslated(e.line, "member '.${e.name}'")
+                }
+            is ScadExpr.Call -> call(e)
+            is ScadExpr.Unary ->
+                if (e.op == "!") {
+                    "not ${wrap(e.operand)}"
+                } else {
+                    "-${wrap(e.operand)}"
+                }
+            is ScadExpr.Binary -> {
+                val op =
+                    when (e.op) {
+                        "&&" -> "and"
+                        "||" -> "or"
+                        else -> e.op
+                    }
+                "${wrap(e.left)} $op ${wrap(e.right)}"
+            }
+            is ScadExpr.Ternary -> "if (${expr(e.cond)}) ${expr(e.ifTrue)} else ${expr(e.ifFalse)}"
+            is ScadExpr.Unsupported -> untranslated(e.line, e.description)
+        }
+
+    /** Translate an expression, parenthesizing it if it's not atomic. */
+    private fun wrap(e: ScadExpr): String =
+        when (e) {
+            is ScadExpr.Num,
+            is ScadExpr.Str,
+            is ScadExpr.Bool,
+            is ScadExpr.Var,
+            is ScadExpr.Vector,
+            is ScadExpr.Index,
+            is ScadExpr.Member -> expr(e)
+            is ScadExpr.Call -> if (e.name in functions) expr(e) else "(${expr(e)})"
+            else -> "(${expr(e)})"
+        }
+
+    /** Parenthesize translated text unless it's a name or a literal. */
+    private fun paren(text: String): String =
+        if (text.matches(SIMPLE)) text else "($text)"
+
+    private fun intExpr(e: ScadExpr): String {
+        val c = constant(e)
+        return if (c is Double) {
+            c.toInt().toString()
+        } else {
+            "${wrap(e)}->truncate()"
+        }
+    }
+
+    private fun variable(e: ScadExpr.Var): String =
+        when {
+            e.name == "PI" -> "pi"
+            e.name == "\$fn" && defaultFacets != null -> number(defaultFacets!!.toDouble())
+            e.name.startsWith("$") -> untranslated(e.line, "special variable '${e.name}'")
+            else -> name(e.name)
+        }
+
+    private fun call(e: ScadExpr.Call): String {
+        val def = functions[e.name]
+        if (def != null) {
+            return "${name(def.name)}(${callArgs(def.name, def.params, e.args, e.line)})"
+        }
+        val args = e.args.map { it.value }
+        return when {
+            e.name == "sqrt" && args.size == 1 -> "${wrap(args[0])}->sqrt()"
+            e.name == "pow" && args.size == 2 -> "${wrap(args[0])} ^ ${wrap(args[1])}"
+            e.name == "abs" && args.size == 1 -> {
+                val x = wrap(args[0])
+                "if ($x < 0.0) -$x else $x"
+            }
+            (e.name == "min" || e.name == "max") && args.size == 2 -> {
+                val l = wrap(args[0])
+                val r = wrap(args[1])
+                "if ($l ${if (e.name == "min") "<" else ">"} $r) $l else $r"
+            }
+            else -> untranslated(e.line, "function '${e.name}'")
+        }
+    }
+
+    private fun number(d: Double): String = d.toString()
+
+    /** Rename identifiers that are keywords in Simplex. */
+    private fun name(n: String): String = if (n in KEYWORDS) "${n}_" else n
+
+    // ---------------------------------------------------------------------
+    // Analysis
+    // ---------------------------------------------------------------------
+
+    /** Infer the Simplex type of an expression. */
+    private fun typeOf(e: ScadExpr?, seen: Set<String> = emptySet()): String =
+        when (e) {
+            null -> "Float"
+            is ScadExpr.Vector -> "[${typeOf(e.elements.firstOrNull(), seen)}]"
+            is ScadExpr.Range -> "[Float]"
+            is ScadExpr.Bool -> "Boolean"
+            is ScadExpr.Str -> "String"
+            is ScadExpr.Var -> scope[e.name] ?: "Float"
+            is ScadExpr.Index -> elementType(typeOf(e.target, seen))
+            is ScadExpr.Unary -> if (e.op == "!") "Boolean" else typeOf(e.operand, seen)
+            is ScadExpr.Binary ->
+                when (e.op) {
+                    "&&", "||", "==", "!=", "<", "<=", ">", ">=" -> "Boolean"
+                    else -> {
+                        val l = typeOf(e.left, seen)
+                        if (l.startsWith("[")) l else typeOf(e.right, seen)
+                    }
+                }
+            is ScadExpr.Ternary -> typeOf(e.ifTrue, seen)
+            is ScadExpr.Call -> {
+                val def = functions[e.name]
+                if (def != null && e.name !in seen) {
+                    val saved = scope
+                    scope = scope + def.params.map { it.name to paramType(it, listOf(def.body)) }
+                    val result = typeOf(def.body, seen + e.name)
+                    scope = saved
+                    result
+                } else {
+                    "Float"
+                }
+            }
+            else -> "Float"
+        }
+
+    private fun elementType(type: String): String =
+        if (type.startsWith("[") && type.endsWith("]")) type.substring(1, type.length - 1) else "Float"
+
+    /** Check whether an expression subscripts a variable, which must therefore be a vector. */
+    private fun usesAsVector(name: String, e: ScadExpr): Boolean {
+        var found = false
+        visitExpr(e) { sub ->
+            val target =
+                when (sub) {
+                    is ScadExpr.Index -> sub.target
+                    is ScadExpr.Member -> sub.target
+                    else -> null
+                }
+            if (target is ScadExpr.Var && target.name == name) {
+                found = true
+            }
+        }
+        return found
+    }
+
+    /** Check whether a module produces 2D geometry. */
+    private fun isFlat(module: String): Boolean {
+        flatModules[module]?.let { return it }
+        // Guard against recursion while the answer is being computed.
+        flatModules[module] = false
+        val result = modules[module]?.let { flatness(it.body) } ?: false
+        flatModules[module] = result
+        return result
+    }
+
+    private fun flatness(stmts: List<ScadStmt>): Boolean? {
+        for (stmt in stmts) {
+            val result =
+                when (stmt) {
+                    is ScadStmt.Instance ->
+                        when (stmt.name) {
+                            "square", "circle", "polygon", "text" -> true
+                            "cube", "sphere", "cylinder", "polyhedron", "linear_extrude", "rotate_extrude" -> false
+                            else ->
+                                if (stmt.name in modules) {
+                                    isFlat(stmt.name)
+                                } else {
+                                    flatness(stmt.children)
+                                }
+                        }
+                    is ScadStmt.If -> flatness(stmt.then) ?: stmt.otherwise?.let { flatness(it) }
+                    else -> null
+                }
+            if (result != null) {
+                return result
+            }
+        }
+        return null
+    }
+
+    /**
+     * Evaluate an expression whose value is known at translation time: a Double, a
+     * Boolean, or a list of values. Returns null if the value isn't constant.
+     */
+    private fun constant(e: ScadExpr): Any? =
+        when (e) {
+            is ScadExpr.Num -> e.value
+            is ScadExpr.Bool -> e.value
+            is ScadExpr.Var -> constants[e.name]
+            is ScadExpr.Vector -> e.elements.map { constant(it) ?: return null }
+            is ScadExpr.Range -> {
+                val start = constant(e.start) as? Double
+                val step = if (e.step == null) 1.0 else constant(e.step) as? Double
+                val end = constant(e.end) as? Double
+                if (start == null || step == null || end == null || step == 0.0 ||
+                    (end - start) / step > MAX_EXPANDED_RANGE) {
+                    null
+                } else {
+                    generateSequence(start) { it + step }
+                        .takeWhile { if (step > 0) it <= end + 1e-9 else it >= end - 1e-9 }
+                        .toList()
+                }
+            }
+            is ScadExpr.Unary -> {
+                val v = constant(e.operand)
+                when {
+                    e.op == "-" && v is Double -> -v
+                    e.op == "!" && v is Boolean -> !v
+                    else -> null
+                }
+            }
+            is ScadExpr.Binary -> {
+                val l = constant(e.left)
+                val r = constant(e.right)
+                if (l is Double && r is Double) {
+                    when (e.op) {
+                        "+" -> l + r
+                        "-" -> l - r
+                        "*" -> l * r
+                        "/" -> l / r
+                        "%" -> l % r
+                        "^" -> Math.pow(l, r)
+                        "<" -> l < r
+                        "<=" -> l <= r
+                        ">" -> l > r
+                        ">=" -> l >= r
+                        "==" -> l == r
+                        "!=" -> l != r
+                        else -> null
+                    }
+                } else if (l is Boolean && r is Boolean) {
+                    when (e.op) {
+                        "&&" -> l && r
+                        "||" -> l || r
+                        "==" -> l == r
+                        "!=" -> l != r
+                        else -> null
+                    }
+                } else {
+                    null
+                }
+            }
+            is ScadExpr.Ternary ->
+                when (constant(e.cond)) {
+                    true -> constant(e.ifTrue)
+                    false -> constant(e.ifFalse)
+                    else -> null
+                }
+            else -> null
+        }
+
+    companion object {
+        private const val MAX_EXPANDED_RANGE = 10000
+
+        private val SIMPLE = Regex("[A-Za-z_][A-Za-z_0-9]*|[0-9.]+(E-?[0-9]+)?")
+
+        private val KEYWORDS =
+            setOf(
+                "and", "as", "data", "elif", "else", "false", "for", "fun", "if", "import", "in",
+                "lambda", "let", "meth", "namespace", "not", "or", "produce", "true",
+                "while", "with",
+            )
+
+        /** Visit every expression in a list of statements. */
+        fun visit(stmts: List<ScadStmt>, f: (ScadExpr) -> Unit) {
+            for (stmt in stmts) {
+                when (stmt) {
+                    is ScadStmt.Assign -> visitExpr(stmt.value, f)
+                    is ScadStmt.ModuleDef -> visit(stmt.body, f)
+                    is ScadStmt.FunctionDef -> visitExpr(stmt.body, f)
+                    is ScadStmt.Instance -> {
+                        stmt.args.forEach { visitExpr(it.value, f) }
+                        visit(stmt.children, f)
+                    }
+                    is ScadStmt.If -> {
+                        visitExpr(stmt.cond, f)
+                        visit(stmt.then, f)
+                        stmt.otherwise?.let { visit(it, f) }
+                    }
+                    is ScadStmt.Use -> {}
+                }
+            }
+        }
+
+        fun visitExpr(e: ScadExpr, f: (ScadExpr) -> Unit) {
+            f(e)
+            when (e) {
+                is ScadExpr.Vector -> e.elements.forEach { visitExpr(it, f) }
+                is ScadExpr.Range -> {
+                    visitExpr(e.start, f)
+                    e.step?.let { visitExpr(it, f) }
+                    visitExpr(e.end, f)
+                }
+                is ScadExpr.Index -> {
+                    visitExpr(e.target, f)
+                    visitExpr(e.index, f)
+                }
+                is ScadExpr.Member -> visitExpr(e.target, f)
+                is ScadExpr.Call -> e.args.forEach { visitExpr(it.value, f) }
+                is ScadExpr.Unary -> visitExpr(e.operand, f)
+                is ScadExpr.Binary -> {
+                    visitExpr(e.left, f)
+                    visitExpr(e.right, f)
+                }
+                is ScadExpr.Ternary -> {
+                    visitExpr(e.cond, f)
+                    visitExpr(e.ifTrue, f)
+                    visitExpr(e.ifFalse, f)
+                }
+                else -> {}
+            }
+        }
+
+        /**
+         * Translate OpenSCAD source into Simplex source.
+         *
+         * @return the Simplex source, and the issues found during translation.
+         */
+        fun translate(filename: String, text: String): Pair<String, List<Issue>> {
+            val translator = ScadTranslator()
+            val result = translator.translate(ScadParser.parse(filename, text), filename)
+            return Pair(result, translator.issues)
+        }
+    }
+}
@@ -67,9 +67,9 @@ class ExecutionTest {
         }
 
         fun run() {
-            val cmd = Simplex()
+            val cmd = simplexCommand()
             val tmpDir = Files.createTempDirectory("test-$name")
-            val out = cmd.test("--prefix=$tmpDir/$name-out", "--verbosity=2", program().toString())
+            val out = cmd.test("run", "--prefix=$tmpDir/$name-out", "--verbosity=2", program().toString())
             val exp = expected()
             val act = actual(tmpDir)
             val stdout = Path("$prefix/$name/stdout.txt").readText()
@@ -0,0 +1,88 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.ast
+
+import java.nio.file.Files
+import kotlin.io.path.Path
+import kotlin.io.path.readText
+import kotlin.test.Test
+import kotlin.test.assertEquals
+import kotlin.test.assertNotEquals
+import kotlin.test.assertTrue
+import org.antlr.v4.runtime.CharStreams
+import org.goodmath.simplex.parser.SimplexParseListener
+import org.goodmath.simplex.runtime.Env
+import org.goodmath.simplex.runtime.RootEnv
+import org.goodmath.simplex.runtime.values.primitives.IntegerValue
+
+/** Tests of the root variable `time`, and of animating products. */
+class AnimateTest {
+    private fun parse(program: String) =
+        SimplexParseListener().parse("test", CharStreams.fromString(program.trimIndent())) { _, _, _ -> }
+
+    @Test
+    fun testFramesSeeTime() {
+        try {
+            val model =
+                parse(
+                    """
+                    produce("bar") {
+                      print(["t=", time])
+                      cuboid(1.0 + time, 1.0, 1.0)
+                    }
+                    """
+                )
+            val output = ArrayList<String>()
+            val dir = Files.createTempDirectory("animate")
+            model.animate("bar", 2, "$dir/out", "stl", 100, 100, { _, msg, _ -> output.add(msg.toString()) })
+            assertTrue(output.any { it.contains("t=0.0") })
+            assertTrue(output.any { it.contains("t=1.0") })
+            val first = Path("$dir/out-bar-0000.stl").readText()
+            val second = Path("$dir/out-bar-0001.stl").readText()
+            assertNotEquals(first, second)
+        } finally {
+            RootEnv.reset()
+        }
+    }
+
+    @Test
+    fun testModelCanDefineTime() {
+        try {
+            val model =
+                parse(
+                    """
+                    let time = 5
+
+                    fun later(): Int {
+                      time + 1
+                    }
+
+                    produce("p") {
+                      later()
+                    }
+                    """
+                )
+            Env.createRootEnv()
+            model.analyze()
+            val env = Env(model.defs, RootEnv)
+            env.installDefinitionValues()
+            val result = model.products[0].evaluate(env)
+            assertEquals(6, (result[0] as IntegerValue).i)
+        } finally {
+            RootEnv.reset()
+        }
+    }
+}
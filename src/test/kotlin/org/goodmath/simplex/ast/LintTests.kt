@@ -0,0 +1,300 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.ast
+
+import kotlin.test.Test
+import kotlin.test.assertEquals
+import kotlin.test.assertFailsWith
+import kotlin.test.assertTrue
+import org.antlr.v4.runtime.CharStreams
+import org.goodmath.simplex.parser.SimplexParseListener
+import org.goodmath.simplex.runtime.Env
+import org.goodmath.simplex.runtime.RootEnv
+import org.goodmath.simplex.runtime.SimplexAnalysisError
+import org.goodmath.simplex.runtime.SimplexWarning
+
+/** Tests of the analyzer's warnings. */
+class LintTests {
+    private fun warnings(program: String): List<SimplexWarning> {
+        try {
+            val model =
+                SimplexParseListener().parse("test", CharStreams.fromString(program.trimIndent())) { _, _, _ -> }
+            Env.createRootEnv()
+            return model.analyze()
+        } finally {
+            RootEnv.reset()
+        }
+    }
+
+    private fun List<SimplexWarning>.of(category: String) = filter { it.category == category }
+
+    @Test
+    fun testUnused() {
+        val ws =
+            warnings(
+                """
+                let unused_top = 3
+                let used_top = 4
+
+                fun f(a: Int, b: Int, _c: Int): Int {
+                  let tmp = a * 2
+                  let _ignored = 7
+                  a + used_top
+                }
+
+                produce("p") {
+                  cylinder(f(1, 2, 3), 1.0)
+                }
+                """
+            )
+            .of(Lint.UNUSED)
+        assertEquals(
+            listOf(
+                "Variable unused_top is never used",
+                "Parameter b is never used",
+                "Variable tmp is never used",
+            ),
+            ws.map { it.detail },
+        )
+        assertEquals(listOf(1, 4, 5), ws.map { it.location!!.line })
+    }
+
+    @Test
+    fun testShadowing() {
+        val ws =
+            warnings(
+                """
+                let size = 3.0
+
+                fun f(size: Float): Float {
+                  let x = 2.0
+                  for x in [1.0, 2.0] { x * size }
+                  x
+                }
+
+                produce("p") {
+                  cylinder(f(size), 1.0)
+                }
+                """
+            )
+            .of(Lint.SHADOW)
+        assertEquals(listOf(3, 5), ws.map { it.location!!.line })
+        assertTrue(ws.all { it.detail.startsWith("size hides") || it.detail.startsWith("x hides") })
+    }
+
+    @Test
+    fun testLambdaParamsDontShadow() {
+        val ws =
+            warnings(
+                """
+                fun add(a: Int): Int {
+                  let f = lambda(a: Int, b: Int): Int { a + b }
+                  f(a, 8)
+                }
+
+                produce("p") {
+                  add(3)
+                }
+                """
+            )
+        assertEquals(emptyList<SimplexWarning>(), ws.of(Lint.SHADOW))
+    }
+
+    @Test
+    fun testPrecision() {
+        val ws =
+            warnings(
+                """
+                fun half(n: Int): Float {
+                  let h: Float = n / 2
+                  let ok: Float = n * 2
+                  h + ok
+                }
+
+                produce("p") {
+                  cylinder(half(3), 1.0)
+                }
+                """
+            )
+            .of(Lint.PRECISION)
+        assertEquals(1, ws.size)
+        assertEquals(2, ws[0].location!!.line)
+    }
+
+    @Test
+    fun testPrecisionThroughVariables() {
+        val ws =
+            warnings(
+                """
+                let rows = 7 / 2
+
+                fun f(n: Int): Float {
+                  let half = n / 2
+                  let third = half + n / 3
+                  let whole = n * 2
+                  cylinder(half, 1.0)->volume() + cylinder(1.0, whole)->volume() + third->float()
+                }
+
+                produce("p") {
+                  cylinder(rows, f(3))
+                }
+                """
+            )
+            .of(Lint.PRECISION)
+        assertEquals(listOf(7, 11), ws.map { it.location!!.line })
+        assertTrue(ws[0].detail.startsWith("half was computed with an integer division"))
+    }
+
+    @Test
+    fun testPrecisionOfLargeLiterals() {
+        val ws =
+            warnings(
+                """
+                produce("p") {
+                  let near: Float = 16777216
+                  let far: Float = 16777217
+                  cylinder(-20000000, near + far)
+                }
+                """
+            )
+            .of(Lint.PRECISION)
+        assertEquals(listOf(3, 4), ws.map { it.location!!.line })
+        assertEquals("-20000000 is too large", ws[1].detail.substringBefore(" to be"))
+    }
+
+    @Test
+    fun testUnreachable() {
+        val ws =
+            warnings(
+                """
+                fun pick(n: Int): Int {
+                  if (n > 3) 1
+                  elif (false) 2
+                  elif (true) 3
+                  elif (n < 0) 4
+                  else 5
+                }
+
+                produce("p") {
+                  cylinder(1.0, pick(2))
+                }
+                """
+            )
+            .of(Lint.UNREACHABLE)
+        assertEquals(listOf(3, 5, 6), ws.map { it.location!!.line })
+    }
+
+    @Test
+    fun testProductWithoutSolid() {
+        val ws =
+            warnings(
+                """
+                produce("flags") {
+                  1 < 2
+                }
+
+                produce("numbers") {
+                  1 + 2
+                }
+
+                produce("solid") {
+                  cylinder(1.0, 1.0)
+                }
+
+                produce("printed") {
+                  print(["done"])
+                }
+                """
+            )
+        assertEquals(
+            listOf("Product flags doesn't produce anything to export"),
+            ws.of(Lint.NO_SOLID).map { it.detail },
+        )
+    }
+
+    @Test
+    fun testAllow() {
+        val ws =
+            warnings(
+                """
+                @allow(unused, shadow)
+                fun f(a: Int, b: Int): Int {
+                  let a = 2
+                  let tmp = 3
+                  a
+                }
+
+                fun g(b: Int): Int {
+                  3
+                }
+
+                @allow(no_solid)
+                produce("numbers") {
+                  f(1, 2) + g(3) > 0
+                }
+                """
+            )
+        assertEquals(listOf("Parameter b is never used"), ws.map { it.detail })
+        assertEquals(8, ws[0].location!!.line)
+    }
+
+    @Test
+    fun testAllowOnStatement() {
+        val ws =
+            warnings(
+                """
+                fun f(n: Int): Float {
+                  @allow(precision)
+                  let h: Float = n / 2
+                  @allow(unused) let tmp = 3
+                  let other: Float = n / 3
+                  @allow(precision) cylinder(n / 4, h)->volume() + other
+                }
+
+                produce("p") {
+                  cylinder(f(3), 1.0)
+                }
+                """
+            )
+        assertEquals(listOf(Lint.PRECISION), ws.map { it.category })
+        assertEquals(5, ws[0].location!!.line)
+    }
+
+    @Test
+    fun testOnlyAllowOnStatements() {
+        assertFailsWith<SimplexAnalysisError> {
+            warnings(
+                """
+                fun f(n: Int): Int {
+                  @deprecated("no") n + 1
+                }
+                """
+            )
+        }
+    }
+
+    @Test
+    fun testUnknownAllowCategory() {
+        assertFailsWith<SimplexAnalysisError> {
+            warnings(
+                """
+                @allow(everything)
+                fun f(): Int { 1 }
+                """
+            )
+        }
+    }
+}
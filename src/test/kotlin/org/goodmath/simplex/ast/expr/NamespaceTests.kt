@@ -0,0 +1,232 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.ast.expr
+
+import kotlin.test.Test
+import kotlin.test.assertEquals
+import kotlin.test.assertFailsWith
+import org.antlr.v4.runtime.CharStreams
+import org.goodmath.simplex.ast.Location
+import org.goodmath.simplex.parser.SimplexParseListener
+import org.goodmath.simplex.runtime.Env
+import org.goodmath.simplex.runtime.RootEnv
+import org.goodmath.simplex.runtime.SimplexAnalysisError
+import org.goodmath.simplex.runtime.SimplexUndefinedMethodError
+import org.goodmath.simplex.runtime.SimplexUndefinedVariableError
+import org.goodmath.simplex.runtime.values.Value
+import org.goodmath.simplex.runtime.values.primitives.FloatValue
+import org.goodmath.simplex.runtime.values.primitives.IntegerValue
+
+/** Tests of namespaces, and of local definitions inside of functions. */
+class NamespaceTests {
+    private val program =
+        """
+        let scale = 2.0
+
+        namespace gears {
+          let module = 1.5
+
+          fun pitch_radius(teeth: Float): Float {
+            module * teeth / 2.0 * scale
+          }
+
+          fun outer_radius(teeth: Float): Float {
+            pitch_radius(teeth) + module
+          }
+        }
+
+        fun gear_size(): Float {
+          gears::outer_radius(10.0)
+        }
+
+        fun pattern(n: Int): Int {
+          data Pair {
+            a: Int,
+            b: Int
+          }
+
+          meth Pair->sum(): Int {
+            self.a + self.b + n
+          }
+
+          fun twice(x: Int): Int {
+            x * n / 5
+          }
+
+          #Pair(twice(3), 4)->sum()
+        }
+
+        fun run_pattern(): Int {
+          pattern(10)
+        }
+
+        produce("p") {
+          gear_size()
+        }
+        """
+            .trimIndent()
+
+    private fun call(env: Env, name: String): Value {
+        val loc = Location("test", 100, 0)
+        return FunCallExpr(VarRefExpr(name, loc), emptyList(), loc).evaluateIn(env)
+    }
+
+    @Test
+    fun testNamespacesAndLocalDefinitions() {
+        try {
+            val model = SimplexParseListener().parse("test", CharStreams.fromString(program)) { _, _, _ -> }
+            Env.createRootEnv()
+            model.analyze()
+            val env = Env(model.defs, RootEnv)
+            env.installDefinitionValues()
+
+            // 1.5 * 10 / 2 * 2 + 1.5
+            assertEquals(16.5, (call(env, "gear_size") as FloatValue).d, 1e-9)
+            // twice(3) = 6; 6 + 4 + 10
+            assertEquals(20, (call(env, "run_pattern") as IntegerValue).i)
+        } finally {
+            RootEnv.reset()
+        }
+    }
+
+    private fun analyze(program: String) {
+        try {
+            val model =
+                SimplexParseListener().parse("test", CharStreams.fromString(program.trimIndent())) { _, _, _ -> }
+            Env.createRootEnv()
+            model.analyze()
+        } finally {
+            RootEnv.reset()
+        }
+    }
+
+    @Test
+    fun testDuplicateLocalDataTypesAreRejected() {
+        val e =
+            assertFailsWith<SimplexAnalysisError> {
+                analyze(
+                    """
+                    fun first(): Int {
+                      data Size {
+                        n: Int
+                      }
+                      #Size(1).n
+                    }
+
+                    fun second(): Float {
+                      data Size {
+                        x: Float
+                      }
+                      #Size(1.0).x
+                    }
+
+                    produce("p") {
+                      first()
+                    }
+                    """
+                )
+            }
+        assertEquals("Data type Size is already defined at test:2", e.detail)
+    }
+
+    @Test
+    fun testLocalFunctionsCantUseLets() {
+        // g is called before k is bound, so it can't use k.
+        assertFailsWith<SimplexUndefinedVariableError> {
+            analyze(
+                """
+                fun f(): Int {
+                  fun g(): Int {
+                    k + 1
+                  }
+
+                  let r = g()
+                  let k = 2
+                  r
+                }
+
+                produce("p") {
+                  f()
+                }
+                """
+            )
+        }
+    }
+
+    @Test
+    fun testLocalMethodsStayLocal() {
+        // Inside the function, the local method can be used.
+        analyze(
+            """
+            fun doubled(n: Int): Int {
+              meth Int->twice(): Int {
+                self * 2
+              }
+              n->twice()
+            }
+
+            produce("p") {
+              doubled(3)
+            }
+            """
+        )
+        // Outside of it, it doesn't exist.
+        assertFailsWith<SimplexUndefinedMethodError> {
+            analyze(
+                """
+                fun doubled(n: Int): Int {
+                  meth Int->twice(): Int {
+                    self * 2
+                  }
+                  n->twice()
+                }
+
+                fun tripled(n: Int): Int {
+                  n->twice() + n
+                }
+
+                produce("p") {
+                  doubled(3) + tripled(3)
+                }
+                """
+            )
+        }
+    }
+
+    @Test
+    fun testNestedNamespacesAreRejected() {
+        val nested =
+            """
+            namespace a {
+              namespace b {
+                let x = 1
+              }
+            }
+
+            produce("p") {
+              1
+            }
+            """
+                .trimIndent()
+        try {
+            val model = SimplexParseListener().parse("test", CharStreams.fromString(nested)) { _, _, _ -> }
+            Env.createRootEnv()
+            assertFailsWith<SimplexAnalysisError> { model.analyze() }
+        } finally {
+            RootEnv.reset()
+        }
+    }
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.ast.expr
+
+import kotlin.test.Test
+import kotlin.test.assertEquals
+import kotlin.test.assertFailsWith
+import org.antlr.v4.runtime.CharStreams
+import org.goodmath.simplex.ast.Location
+import org.goodmath.simplex.ast.types.Type
+import org.goodmath.simplex.parser.SimplexParseListener
+import org.goodmath.simplex.runtime.Env
+import org.goodmath.simplex.runtime.RootEnv
+import org.goodmath.simplex.runtime.SimplexTypeError
+import org.goodmath.simplex.runtime.values.Value
+import org.goodmath.simplex.runtime.values.primitives.BooleanValue
+import org.goodmath.simplex.runtime.values.primitives.IntegerValue
+import org.goodmath.simplex.runtime.values.primitives.SetValue
+import org.goodmath.simplex.runtime.values.primitives.VectorValue
+
+/** Tests of set literals and the set methods. */
+class SetTests {
+    private val program =
+        """
+        data Hole {
+          x: Float,
+          d: Float
+        }
+
+        meth Hole->eq(other: Hole): Boolean {
+          self.d == other.d
+        }
+
+        fun sizes(): {|Int|} {
+          {| 3, 5, 3, 7 |}->add(5)->add(9)->remove(7)
+        }
+
+        fun drills(): Int {
+          {| #Hole(1.0, 3.0), #Hole(2.0, 3.0), #Hole(4.0, 5.0) |}->size()
+        }
+
+        fun common(): [Int] {
+          {| 1, 2, 3, 4 |}->intersect({| 3, 4, 5 |})->union({| 8 |})->to_vector()
+        }
+
+        fun rest(): Int {
+          {| 1, 2, 3, 4 |}->difference({| 2, 3 |})->size()
+        }
+
+        data Slot {
+          w: Float
+        }
+
+        fun slots(): Int {
+          meth Slot->eq(other: Slot): Boolean {
+            self.w == other.w
+          }
+
+          {| #Slot(2.0), #Slot(2.0), #Slot(3.0) |}->size()
+        }
+
+        fun has(): Boolean {
+          {| "m3", "m4" |}->contains("m4")
+        }
+
+        produce("p") {
+          sizes()
+        }
+        """
+            .trimIndent()
+
+    private fun call(env: Env, name: String): Value {
+        val loc = Location("test", 100, 0)
+        return FunCallExpr(VarRefExpr(name, loc), emptyList(), loc).evaluateIn(env)
+    }
+
+    @Test
+    fun testSets() {
+        try {
+            val model = SimplexParseListener().parse("test", CharStreams.fromString(program)) { _, _, _ -> }
+            val env = Env(model.defs, Env.createRootEnv())
+            env.installStaticDefinitions()
+            env.installDefinitionValues()
+
+            val sizes = call(env, "sizes") as SetValue
+            assertEquals(listOf(3, 5, 9), sizes.elements.map { (it as IntegerValue).i })
+            assertEquals(Type.set(Type.IntType), sizes.valueType.asType)
+            // Holes are the same if they have the same diameter.
+            assertEquals(2, (call(env, "drills") as IntegerValue).i)
+            val common = call(env, "common") as VectorValue
+            assertEquals(listOf(3, 4, 8), common.elements.map { (it as IntegerValue).i })
+            assertEquals(2, (call(env, "rest") as IntegerValue).i)
+            assertEquals(true, (call(env, "has") as BooleanValue).b)
+            // A locally declared eq method is used to compare elements.
+            assertEquals(2, (call(env, "slots") as IntegerValue).i)
+        } finally {
+            RootEnv.reset()
+        }
+    }
+
+    @Test
+    fun testSetOfUnregisteredType() {
+        assertFailsWith<SimplexTypeError> { Type.set(Type.simple("NotYetDeclared")) }
+    }
+}
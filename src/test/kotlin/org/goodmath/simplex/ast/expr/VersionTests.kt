@@ -0,0 +1,175 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.ast.expr
+
+import kotlin.test.Test
+import kotlin.test.assertEquals
+import kotlin.test.assertFailsWith
+import kotlin.test.assertTrue
+import org.antlr.v4.runtime.CharStreams
+import org.goodmath.simplex.ast.def.FunctionDefinition
+import org.goodmath.simplex.ast.types.Type
+import org.goodmath.simplex.parser.LanguageVersion
+import org.goodmath.simplex.parser.SimplexParseListener
+import org.goodmath.simplex.runtime.Env
+import org.goodmath.simplex.runtime.RootEnv
+import org.goodmath.simplex.runtime.SimplexAnalysisError
+
+/** Tests of version headers and deprecation warnings. */
+class VersionTests {
+    private fun parse(program: String) =
+        SimplexParseListener().parse("test", CharStreams.fromString(program.trimIndent())) { _, _, _ -> }
+
+    @Test
+    fun testOldVersionSyntax() {
+        try {
+            val model =
+                parse(
+                    """
+                    simplex "0.1"
+
+                    fun cone(radius <Float> height <Float>): CSG {
+                      cylinder(height, radius, 0.1)
+                    }
+
+                    produce("p") {
+                      cone(1.0, 2.0)
+                    }
+                    """
+                )
+            assertEquals(LanguageVersion.V0_1, model.languageVersion)
+            val cone = model.defs[0] as FunctionDefinition
+            assertEquals(listOf("radius", "height"), cone.params.map { it.name })
+            assertEquals(Type.simple("Solid"), cone.returnType)
+            Env.createRootEnv()
+            model.analyze()
+        } finally {
+            RootEnv.reset()
+        }
+    }
+
+    @Test
+    fun testOldSyntaxNeedsHeader() {
+        val program =
+            """
+            fun cone(radius <Float> height <Float>): Solid {
+              cylinder(height, radius, 0.1)
+            }
+
+            produce("p") {
+              cone(1.0, 2.0)
+            }
+            """
+        val e = assertFailsWith<SimplexAnalysisError> { parse(program) }
+        assertTrue(e.detail.contains("simplex \"0.1\""))
+        assertFailsWith<SimplexAnalysisError> { parse("simplex \"9.9\"\n$program") }
+    }
+
+    @Test
+    fun testSimplexIsAName() {
+        try {
+            val model =
+                parse(
+                    """
+                    simplex "0.2"
+
+                    let simplex = 3.0
+
+                    fun scale(simplex: Float): Float {
+                      simplex * 2.0
+                    }
+
+                    produce("simplex") {
+                      cylinder(scale(simplex), 1.0)
+                    }
+                    """
+                )
+            assertEquals(LanguageVersion.V0_2, model.languageVersion)
+            assertEquals(listOf("simplex", "scale"), model.defs.map { it.name })
+            Env.createRootEnv()
+            model.analyze()
+        } finally {
+            RootEnv.reset()
+        }
+        val product = "produce(\"p\") { cylinder(1.0, 1.0) }"
+        assertEquals(LanguageVersion.current, parse("let simplex = 1\n$product").languageVersion)
+        val e = assertFailsWith<SimplexAnalysisError> { parse("version \"0.1\"\n$product") }
+        assertEquals(1, e.location?.line)
+    }
+
+    @Test
+    fun testDeprecationWarnings() {
+        try {
+            val model =
+                parse(
+                    """
+                    @deprecated("use grow")
+                    fun enlarge(x: Float): Float {
+                      x * 2.0
+                    }
+
+                    fun grow(x: Float): Float {
+                      x * 2.0
+                    }
+
+                    fun sizes(): Float {
+                      grow(enlarge(1.0)) + grow(1.0)
+                    }
+
+                    fun spin(s: Solid): Solid {
+                      s->rot(0.0, 0.0, 90.0)
+                    }
+
+                    produce("p") {
+                      cylinder(sizes(), 1.0)
+                    }
+                    """
+                )
+            Env.createRootEnv()
+            val warnings = model.analyze()
+            assertEquals(
+                listOf("enlarge is deprecated: use grow", "rot is deprecated: use rotate"),
+                warnings.map { it.detail },
+            )
+            assertEquals(11, warnings[0].location?.line)
+        } finally {
+            RootEnv.reset()
+        }
+    }
+
+    @Test
+    fun testDeprecatedParameterList() {
+        try {
+            val model =
+                parse(
+                    """
+                    produce("p") {
+                      cuboid(1.0, 1.0, 1.0, "center") + cuboid(1.0, 2.0, 3.0, false)
+                    }
+                    """
+                )
+            Env.createRootEnv()
+            val warnings = model.analyze()
+            // Only the call that uses the centered flag is deprecated.
+            assertEquals(
+                listOf("cuboid is deprecated: use an anchor, \"center\" or \"min_corner\", instead of centered"),
+                warnings.map { it.detail },
+            )
+        } finally {
+            RootEnv.reset()
+        }
+    }
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.build
+
+import java.nio.file.Files
+import kotlin.io.path.Path
+import kotlin.io.path.createDirectories
+import kotlin.io.path.writeText
+import kotlin.test.Test
+import kotlin.test.assertEquals
+import kotlin.test.assertFailsWith
+import kotlin.test.assertNull
+import org.goodmath.simplex.runtime.SimplexConfigError
+import org.goodmath.simplex.runtime.values.manifold.Quality
+
+/** Tests of reading the build configuration from simplex.toml. */
+class BuildConfigTest {
+    private val project =
+        """
+        # The build configuration for the test project.
+        [build]
+        models = ["parts/*.s3d"]
+        output_dir = "out"
+        naming = "{model}/{product}-{variant}.{ext}"
+        products = ["body", "lid"]
+        formats = ["stl"]
+        default_profile = "draft"
+
+        [build.product.lid]
+        formats = ["stl", "3mf"]
+
+        [build.profiles.draft]
+        quality = "draft"
+
+        [build.profiles.release]
+        quality = "fine"
+        formats = [
+          "stl",
+          "png",  # for the catalog
+        ]
+        warnings_as_errors = true
+        tolerance = 0.001
+        """
+            .trimIndent()
+
+    @Test
+    fun testTomlSyntax() {
+        val config =
+            BuildConfig.parse(
+                "simplex.toml",
+                """
+                [build]
+                formats = ['stl']
+                product = { lid = { formats = ["3mf"] } }
+                profiles.release.tolerance = 1_000
+                """
+                    .trimIndent(),
+                Path("/project"),
+            )
+        assertEquals(listOf("3mf"), config.settingsFor(null).formatsFor("lid"))
+        assertEquals(1000.0, config.settingsFor("release").tolerance)
+
+        val e =
+            assertFailsWith<SimplexConfigError> {
+                BuildConfig.parse("simplex.toml", "[build]\nnaming = \"a\"\nnaming = \"b\"", Path("/project"))
+            }
+        assertEquals(3, e.location?.line)
+        val unterminated =
+            assertFailsWith<SimplexConfigError> {
+                BuildConfig.parse("simplex.toml", "[build]\n\nmodels = [\"a", Path("/project"))
+            }
+        assertEquals(3, unterminated.location?.line)
+    }
+
+    @Test
+    fun testSettingsAndProfiles() {
+        val config = BuildConfig.parse("simplex.toml", project, Path("/project"))
+        assertEquals(listOf("parts/*.s3d"), config.models)
+        assertEquals("draft", config.defaultProfile)
+
+        val base = config.settingsFor(null)
+        assertNull(base.quality)
+        assertEquals(listOf("body", "lid"), base.products)
+        assertEquals(listOf("stl"), base.formatsFor("body"))
+        assertEquals(listOf("stl", "3mf"), base.formatsFor("lid"))
+
+        val release = config.settingsFor("release")
+        assertEquals(Quality.Fine, release.quality)
+        assertEquals("out", release.outputDir)
+        assertEquals(listOf("stl", "png"), release.formatsFor("body"))
+        assertEquals(listOf("stl", "3mf"), release.formatsFor("lid"))
+        assertEquals(true, release.warningsAsErrors)
+        assertEquals(0.001, release.tolerance)
+        assertEquals("hinge/lid-release.drawing.svg", release.outputName("hinge", "lid", "release", "drawing.svg"))
+
+        assertEquals(Quality.Draft, config.settingsFor("draft").quality)
+        assertFailsWith<SimplexConfigError> { config.settingsFor("nightly") }
+    }
+
+    @Test
+    fun testDefaults() {
+        val config = BuildConfig.parse("simplex.toml", "[build]\n", Path("/project"))
+        val settings = config.settingsFor(null)
+        assertEquals(listOf("*.s3d"), config.models)
+        assertEquals(listOf("stl"), settings.formatsFor("anything"))
+        assertEquals("model-p.stl", settings.outputName("model", "p", "default", "stl"))
+    }
+
+    @Test
+    fun testErrors() {
+        fun check(text: String, line: Int) {
+            val e = assertFailsWith<SimplexConfigError> { BuildConfig.parse("simplex.toml", text, Path("/project")) }
+            assertEquals(line, e.location?.line)
+        }
+        check("[build]\noutput = \"out\"", 2)
+        check("[build]\nformats = [\"stl\", \"step\"]", 2)
+        check("[build]\nquality = \"ultra\"", 2)
+        check("[build]\ntolerance = -1", 2)
+        check("[build]\nnaming = \"{model}.{ext}\"", 2)
+        check("[build]\nnaming = \"{product}-{date}.{ext}\"", 2)
+        check("[build]\ndefault_profile = \"release\"", 2)
+        check("[build]\n\n[build.profiles.draft]\nmodels = [\"a.s3d\"]", 4)
+        check("[package]\nname = \"x\"", 1)
+    }
+
+    @Test
+    fun testModelFiles() {
+        val dir = Files.createTempDirectory("simplex-build")
+        dir.resolve("parts").createDirectories()
+        dir.resolve("parts/b.s3d").writeText("")
+        dir.resolve("parts/a.s3d").writeText("")
+        dir.resolve("parts/notes.txt").writeText("")
+        dir.resolve("top.s3d").writeText("")
+        dir.resolve(BuildConfig.FILE_NAME).writeText(project)
+        val config = BuildConfig.load(dir.resolve(BuildConfig.FILE_NAME))
+        assertEquals(
+            listOf(dir.resolve("parts/a.s3d"), dir.resolve("parts/b.s3d")),
+            config.modelFiles().map { it.toAbsolutePath() },
+        )
+        assertEquals(dir.resolve(BuildConfig.FILE_NAME), BuildConfig.find(dir.resolve("parts")))
+    }
+
+    @Test
+    fun testModelNames() {
+        val config = BuildConfig.parse("simplex.toml", project, Path("/project"))
+        assertEquals("parts/hinge", config.modelName(Path("/project/parts/hinge.s3d")))
+        assertEquals("top", config.modelName(Path("/project/top.s3d")))
+        assertEquals("other", config.modelName(Path("/elsewhere/other.s3d")))
+        assertEquals(
+            listOf("a/part", "b/part"),
+            config.modelNames(listOf(Path("/project/a/part.s3d"), Path("/project/b/part.s3d"))).values.toList(),
+        )
+        assertFailsWith<SimplexConfigError> {
+            config.modelNames(listOf(Path("/project/part.s3d"), Path("/elsewhere/part.s3d")))
+        }
+    }
+}
@@ -0,0 +1,37 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.kernel
+
+import java.io.ByteArrayInputStream
+import java.util.Base64
+import javax.imageio.ImageIO
+import kotlin.test.Test
+import kotlin.test.assertEquals
+import kotlin.test.assertTrue
+import org.goodmath.simplex.runtime.values.manifold.Solid
+
+class DisplayDataTest {
+    @Test
+    fun testSolidHasImageFallback() {
+        val data = DisplayData.of(Solid.cuboid(1.0, 2.0, 3.0, true))
+        val png = data["image/png"]!!
+        val image = ImageIO.read(ByteArrayInputStream(Base64.getDecoder().decode(png)))
+        assertEquals(600, image.width)
+        assertEquals(400, image.height)
+        // The viewer shows the same image until three.js has loaded.
+        assertTrue(data["text/html"]!!.contains("data:image/png;base64,$png"))
+    }
+}
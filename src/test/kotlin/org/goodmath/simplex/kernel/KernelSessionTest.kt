@@ -0,0 +1,70 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.kernel
+
+import kotlin.test.Test
+import kotlin.test.assertEquals
+import kotlin.test.assertFailsWith
+import kotlin.test.assertNull
+import org.goodmath.simplex.runtime.RootEnv
+import org.goodmath.simplex.runtime.SimplexError
+
+class KernelSessionTest {
+    @Test
+    fun testDefinitionsPersistAcrossCells() {
+        synchronized(RootEnv) {
+            val session = KernelSession()
+            val output = ArrayList<String>()
+            assertNull(session.execute("let size = 4\nfun area(x: Int): Int { x * x }", "In[1]") {
+                output.add(it)
+            })
+            val v = session.execute("print([\"size = \", size])\narea(size)", "In[2]") {
+                output.add(it)
+            }
+            assertEquals("16", v?.let { DisplayData.text(it) })
+            assertEquals(listOf("size = 4"), output)
+
+            // Redefining a name replaces it for later cells.
+            session.execute("let size = 5", "In[3]") {}
+            assertEquals("25", session.execute("area(size)", "In[4]") {}?.let { DisplayData.text(it) })
+        }
+    }
+
+    @Test
+    fun testInvalidRedefinitionKeepsDataType() {
+        synchronized(RootEnv) {
+            val session = KernelSession()
+            session.execute("data Peg { d: Float }\nfun width(p: Peg): Float { p.d }", "In[1]") {}
+            assertFailsWith<SimplexError> {
+                session.execute("data Peg { d: Float }\nfun bad(): Int { undefined_thing }", "In[2]") {}
+            }
+            // The cell with the error didn't replace the original definition.
+            assertEquals("3.0", session.execute("width(#Peg(3.0))", "In[3]") {}?.let { DisplayData.text(it) })
+        }
+    }
+
+    @Test
+    fun testIsComplete() {
+        assertEquals("complete", KernelSession.isComplete("fun f(): Int { 1 }").status)
+        assertEquals(
+            KernelSession.Completeness("incomplete", "    "),
+            KernelSession.isComplete("fun f(): Int {\n"),
+        )
+        assertEquals("incomplete", KernelSession.isComplete("print([\"a ( b").status)
+        assertEquals("complete", KernelSession.isComplete("// an open ( in a comment\n1").status)
+        assertEquals("invalid", KernelSession.isComplete("1 + 2)").status)
+    }
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.lsp
+
+import kotlin.test.Test
+import kotlin.test.assertEquals
+import kotlin.test.assertFailsWith
+import kotlin.test.assertNull
+import kotlin.test.assertTrue
+import org.eclipse.lsp4j.Position
+import org.eclipse.lsp4j.Range
+import org.goodmath.simplex.runtime.RootEnv
+import org.goodmath.simplex.runtime.SimplexEvaluationError
+
+class ModelSessionTest {
+    private val source = """
+        |let base = 3
+        |
+        |fun twice(x: Int): Int {
+        |   x * 2
+        |}
+        |
+        |produce("p") {
+        |   print(["twice = ", twice(base)])
+        |   twice(base) + 1
+        |}
+        |""".trimMargin()
+
+    @Test
+    fun testEvaluateExpression() {
+        synchronized(RootEnv) {
+            val session = ModelSession.load("file:///tmp/session.s3d", source)
+            val result = session.evaluateExpression("twice(base) * 10")
+            assertEquals("Int", result.type)
+            assertEquals("60", result.text)
+            assertNull(result.mesh)
+
+            // Evaluating again reuses the loaded definitions.
+            assertEquals("8", session.evaluateExpression("twice(4)").text)
+        }
+    }
+
+    @Test
+    fun testMethodsSurviveReactivation() {
+        synchronized(RootEnv) {
+            val session =
+                ModelSession.load(
+                    "file:///tmp/session.s3d",
+                    "meth Int->tripled(): Int {\n  self * 3\n}\n\nproduce(\"p\") {\n  2->tripled()\n}\n",
+                )
+            assertEquals("6", session.evaluateExpression("2->tripled()").text)
+            assertEquals("12", session.evaluateExpression("4->tripled()").text)
+        }
+    }
+
+    @Test
+    fun testEvaluateRange() {
+        synchronized(RootEnv) {
+            val session = ModelSession.load("file:///tmp/session.s3d", source)
+            // "twice(base) + 1", in the product.
+            assertEquals("7", session.evaluateRange(Range(Position(8, 3), Position(8, 18))).text)
+            // "x * 2", in the body of twice, where x has no value.
+            val e =
+                assertFailsWith<SimplexEvaluationError> {
+                    session.evaluateRange(Range(Position(3, 3), Position(3, 8)))
+                }
+            assertTrue(e.detail.contains("inside of function twice"))
+        }
+    }
+
+    @Test
+    fun testRenderProductWithoutSolids() {
+        synchronized(RootEnv) {
+            val session = ModelSession.load("file:///tmp/session.s3d", source)
+            val result = session.renderProduct("p", "mesh")
+            assertEquals(0, result.bodies)
+            assertNull(result.mesh)
+            assertEquals(listOf("twice = 6"), result.output)
+            assertEquals(listOf("twice = 6", "7"), result.text)
+        }
+    }
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.lsp
+
+import kotlin.test.Test
+import kotlin.test.assertEquals
+import kotlin.test.assertNotNull
+import kotlin.test.assertTrue
+import org.eclipse.lsp4j.TextEdit
+
+class QuickFixesTest {
+    val source = """
+        |fun half(x: Float): Float {
+        |   x / 2.0
+        |}
+        |
+        |produce("p") {
+        |   let a = half(3)
+        |   helper(a, 2)
+        |}
+        |""".trimMargin()
+
+    fun apply(analysis: DocumentAnalysis, edit: TextEdit): String {
+        val start = analysis.offsetOf(edit.range.start)
+        val end = analysis.offsetOf(edit.range.end)
+        return analysis.text.substring(0, start) + edit.newText + analysis.text.substring(end)
+    }
+
+    fun fix(analysis: DocumentAnalysis, titlePrefix: String): QuickFix {
+        val result = analysis.quickFixes.firstOrNull { it.title.startsWith(titlePrefix) }
+        assertNotNull(result, "No fix starting with '$titlePrefix' in ${analysis.quickFixes.map { it.title }}")
+        return result
+    }
+
+    @Test
+    fun testDeclareLetType() {
+        val analysis = DocumentAnalysis.analyze("file:///tmp/quickfix.s3d", source)
+        val f = fix(analysis, "Declare type of 'a'")
+        assertTrue(apply(analysis, f.edits.single()).contains("let a: Float = half(3)"))
+    }
+
+    @Test
+    fun testConvertIntArgument() {
+        val analysis = DocumentAnalysis.analyze("file:///tmp/quickfix.s3d", source)
+        val f = fix(analysis, "Convert argument to Float")
+        assertTrue(apply(analysis, f.edits.single()).contains("let a = half(3->float())"))
+        assertNotNull(f.diagnostic)
+    }
+
+    @Test
+    fun testCreateFunctionStub() {
+        val analysis = DocumentAnalysis.analyze("file:///tmp/quickfix.s3d", source)
+        val f = fix(analysis, "Create function 'helper'")
+        val fixed = apply(analysis, f.edits.single())
+        assertTrue(fixed.contains("fun helper(a: Float, p2: Int): None {"))
+        // The stub should make the undefined function error go away.
+        val reanalyzed = DocumentAnalysis.analyze("file:///tmp/quickfix.s3d", fixed)
+        assertEquals(emptyList(), reanalyzed.errors.map { it.message })
+    }
+
+    @Test
+    fun testCreateMethodStub() {
+        val withCall = "produce(\"p\") {\n  3->triple(2.0)\n}\n"
+        val analysis = DocumentAnalysis.analyze("file:///tmp/quickfix.s3d", withCall)
+        val f = fix(analysis, "Create method 'Int->triple'")
+        val fixed = apply(analysis, f.edits.single())
+        assertTrue(fixed.contains("meth Int->triple(p1: Float): None {"))
+        val reanalyzed = DocumentAnalysis.analyze("file:///tmp/quickfix.s3d", fixed)
+        assertEquals(emptyList(), reanalyzed.errors.map { it.message })
+        // The stub's method is discarded with the analysis that defined it, so
+        // the original document still gets the fix.
+        val again = DocumentAnalysis.analyze("file:///tmp/quickfix.s3d", withCall)
+        fix(again, "Create method 'Int->triple'")
+    }
+
+    @Test
+    fun testChangeReturnType() {
+        val stub = "fun area(r: Float): None {\n  r * r * 3.14\n}\n\nproduce(\"p\") {\n  area(2.0)\n}\n"
+        val analysis = DocumentAnalysis.analyze("file:///tmp/quickfix.s3d", stub)
+        val f = fix(analysis, "Change return type of 'area' to Float")
+        assertNotNull(f.diagnostic)
+        val fixed = apply(analysis, f.edits.single())
+        assertTrue(fixed.contains("fun area(r: Float): Float {"))
+        val reanalyzed = DocumentAnalysis.analyze("file:///tmp/quickfix.s3d", fixed)
+        assertEquals(emptyList(), reanalyzed.errors.map { it.message })
+    }
+
+    @Test
+    fun testImportForUnknownScope() {
+        val analysis = DocumentAnalysis.analyze(
+            "file:///tmp/quickfix.s3d",
+            "produce(\"p\") {\n  shapes::cube\n}\n")
+        val f = fix(analysis, "Import \"shapes.s3d\" as shapes")
+        assertEquals("import \"shapes.s3d\" as shapes\n", f.edits.single().newText)
+        assertEquals(0, f.edits.single().range.start.line)
+    }
+
+    @Test
+    fun testExpressionEnd() {
+        val text = "f(a + g(b, c), \"x,y\")"
+        assertEquals(13, QuickFixes.expressionEnd(text, 2))
+        assertEquals(20, QuickFixes.expressionEnd(text, 15))
+    }
+}
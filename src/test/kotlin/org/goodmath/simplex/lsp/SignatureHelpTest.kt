@@ -0,0 +1,97 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.lsp
+
+import kotlin.test.Test
+import kotlin.test.assertEquals
+import kotlin.test.assertNotNull
+import kotlin.test.assertNull
+import org.eclipse.lsp4j.Position
+import org.eclipse.lsp4j.Range
+
+class SignatureHelpTest {
+    @Test
+    fun testFindEnclosingCall() {
+        val text = "let x = cylinder(10.0, f([1, 2], \"a,b\"), "
+        val call = CallSignatures.findEnclosingCall(text, text.length)
+        assertNotNull(call)
+        assertEquals("cylinder", call.name)
+        assertEquals(2, call.activeParam)
+
+        val inner = CallSignatures.findEnclosingCall(text, text.indexOf("2]"))
+        assertNotNull(inner)
+        assertEquals("f", inner.name)
+        assertEquals(0, inner.activeParam)
+
+        assertNull(CallSignatures.findEnclosingCall("fun foo(x: Int", 14))
+        assertEquals(true, CallSignatures.findEnclosingCall("s->move(1.0, ", 13)?.isMethod)
+    }
+
+    @Test
+    fun testBuiltinSignatures() {
+        val text = "produce(\"p\") {\n  cylinder(10.0, 2.0, "
+        val help = CallSignatures.signatureHelp(text, text.length, null)
+        assertNotNull(help)
+        // Three parameter lists, and each of them with an anchor.
+        assertEquals(6, help.signatures.size)
+        assertEquals(2, help.activeParameter)
+        // The two-parameter version doesn't have room for a third argument.
+        assertEquals(1, help.activeSignature)
+        assertEquals("cylinder(height: Float, radiusLow: Float, radiusHigh: Float): Solid",
+            help.signatures[1].label)
+    }
+
+    @Test
+    fun testInlayHints() {
+        val source = """
+            |fun scaled(size: Float, factor: Float): Float {
+            |   size * factor
+            |}
+            |
+            |produce("p") {
+            |   let a = scaled(2.0, 3.0)
+            |   a
+            |}
+            |""".trimMargin()
+        val analysis = DocumentAnalysis.analyze("file:///tmp/hints.s3d", source)
+        val hints = InlayHints.hints(analysis, Range(Position(0, 0), Position(100, 0)))
+        val labels = hints.map { it.label.left }
+        assertEquals(listOf(": Float", "size:", "factor:"), labels)
+    }
+
+    @Test
+    fun testInlayHintsForOverloadsWithTheSameArity() {
+        val source = """
+            |produce("p") {
+            |   let a = ovoid(2.0, 16)
+            |   let b = ovoid(2.0, "bottom")
+            |   let c = cylinder(10.0, 2.0, "bottom")
+            |   let d = cylinder(10.0, 2.0, 3.0)
+            |   a
+            |}
+            |""".trimMargin()
+        val analysis = DocumentAnalysis.analyze("file:///tmp/hints.s3d", source)
+        val hints = InlayHints.hints(analysis, Range(Position(0, 0), Position(100, 0)))
+        val labels = hints.map { it.label.left }
+        assertEquals(
+            listOf(
+                ": Solid", "radius:", "segments:",
+                ": Solid", "radius:", "anchor:",
+                ": Solid", "height:", "radiusLow:", "anchor:",
+                ": Solid", "height:", "radiusLow:", "radiusHigh:"),
+            labels)
+    }
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import kotlin.test.Test
+import kotlin.test.assertEquals
+import kotlin.test.assertFailsWith
+import kotlin.test.assertTrue
+import org.goodmath.simplex.runtime.SimplexEvaluationError
+import org.goodmath.simplex.runtime.values.primitives.Vec3
+
+class AssemblyTest {
+    private fun box(low: Vec3, size: Vec3): Solid = Solid.cuboid(size, false).move(low)
+
+    private val base = Part("base", box(Vec3(0.0, 0.0, 0.0), Vec3(10.0, 10.0, 1.0)))
+    private val lid = Part("lid", box(Vec3(0.0, 0.0, 1.0), Vec3(10.0, 10.0, 1.0)))
+
+    /**
+     * The lid lies on the base, and opens about the y axis along its edge at x=0. At
+     * -90 degrees it's standing up, and at -180 it lies flat on the other side of
+     * the hinge.
+     */
+    private val hinge =
+        RevoluteJoint("hinge", "base", "lid", Vec3(0.0, 0.0, 1.0), Vec3(0.0, 1.0, 0.0), -180.0, 0.0)
+
+    @Test
+    fun testCleanHinge() {
+        val assembly = Assembly(listOf(base, lid), listOf(hinge))
+        assertEquals(emptyList<String>(), assembly.sweepCheck(8, 1e-6).map { it.toString() })
+    }
+
+    @Test
+    fun testRevoluteCollisionInPartOfRange() {
+        // A post beside the hinge, which the lid only reaches once it's past upright.
+        val post = Part("post", box(Vec3(-3.0, 0.0, 0.0), Vec3(1.0, 10.0, 20.0)))
+        val assembly = Assembly(listOf(base, lid, post), listOf(hinge))
+        val collisions = assembly.sweepCheck(4, 1e-6)
+        assertEquals(listOf(-180.0, -135.0), collisions.map { it.value })
+        assertTrue(collisions.all { it.joint == "hinge" && it.moving == "lid" && it.other == "post" })
+        // Lying flat, the lid passes through a 1x10x1 block of the post.
+        assertEquals(10.0, collisions[0].volume, 1e-4)
+    }
+
+    @Test
+    fun testPrismaticCollision() {
+        val stop = Part("stop", box(Vec3(5.0, 0.0, 0.0), Vec3(2.0, 2.0, 2.0)))
+        val slider = Part("slider", box(Vec3(0.0, 0.0, 0.0), Vec3(2.0, 2.0, 2.0)))
+        val slide = PrismaticJoint("slide", "stop", "slider", Vec3(1.0, 0.0, 0.0), 0.0, 6.0)
+        val collisions = Assembly(listOf(stop, slider), listOf(slide)).sweepCheck(6, 1e-6)
+        // At 3 the slider only touches the stop, which isn't a collision.
+        assertEquals(listOf(4.0, 5.0, 6.0), collisions.map { it.value })
+        assertEquals(listOf(4.0, 8.0, 4.0), collisions.map { Math.round(it.volume * 1e4) / 1e4 })
+    }
+
+    @Test
+    fun testSweepEdgeCases() {
+        val stop = Part("stop", box(Vec3(5.0, 0.0, 0.0), Vec3(2.0, 2.0, 2.0)))
+        val slider = Part("slider", box(Vec3(0.0, 0.0, 0.0), Vec3(2.0, 2.0, 2.0)))
+        val free = PrismaticJoint("slide", "stop", "slider", Vec3(1.0, 0.0, 0.0), 0.0, 6.0)
+        val assembly = Assembly(listOf(stop, slider), listOf(free))
+        assertFailsWith<SimplexEvaluationError> { assembly.sweepCheck(0, 1e-6) }
+        assertFailsWith<SimplexEvaluationError> { assembly.sweepCheck(-1, 1e-6) }
+
+        // A joint that can't move is checked once, at its only value.
+        val fixed = PrismaticJoint("fixed", "stop", "slider", Vec3(1.0, 0.0, 0.0), 4.0, 4.0)
+        val collisions = Assembly(listOf(stop, slider), listOf(fixed)).sweepCheck(5, 1e-6)
+        assertEquals(listOf(4.0), collisions.map { it.value })
+    }
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import kotlin.test.Test
+import kotlin.test.assertEquals
+import kotlin.test.assertFailsWith
+import org.goodmath.simplex.runtime.SimplexEvaluationError
+
+class Code128Test {
+    @Test
+    fun testEncodeText() {
+        val values = Code128.encode("PJJ123C")
+        assertEquals(listOf(Code128.START_B, 48, 42, 42, 17, 18, 19, 35), values)
+        assertEquals(55, Code128.checksum(values))
+    }
+
+    @Test
+    fun testEncodeDigits() {
+        assertEquals(listOf(Code128.START_C, 12, 34, 56), Code128.encode("123456"))
+        // A long run of digits in the middle switches to code set C and back.
+        assertEquals(
+            listOf(Code128.START_B, 33, Code128.CODE_C, 12, 34, 56, Code128.CODE_B, 34),
+            Code128.encode("A123456B"),
+        )
+        // An odd digit is left over in code set B.
+        assertEquals(listOf(Code128.START_C, 12, 34, Code128.CODE_B, 21), Code128.encode("12345"))
+    }
+
+    @Test
+    fun testWidths() {
+        val widths = Code128.widths("PJJ123C")
+        // Start, seven characters, and the checksum are 11 modules each, and the stop
+        // pattern is 13.
+        assertEquals(9 * 11 + 13, widths.sum())
+        // Bars and spaces alternate, starting and ending with a bar.
+        assertEquals(1, widths.size % 2)
+    }
+
+    @Test
+    fun testInvalidText() {
+        assertFailsWith<SimplexEvaluationError> { Code128.encode("") }
+        assertFailsWith<SimplexEvaluationError> { Code128.encode("tab\there") }
+    }
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import java.util.Locale
+import kotlin.test.Test
+import kotlin.test.assertContains
+import kotlin.test.assertEquals
+import kotlin.test.assertFailsWith
+import kotlin.test.assertTrue
+import org.goodmath.simplex.runtime.SimplexEvaluationError
+import org.goodmath.simplex.runtime.values.primitives.Vec3
+
+class DrawingTest {
+    private fun lines(view: DrawingRenderer.View, hidden: Boolean) =
+        view.marks.filterIsInstance<DrawingRenderer.Mark.Line>().filter { it.hidden == hidden }
+
+    @Test
+    fun testCubeHasNoHiddenLines() {
+        val cube = Solid.cuboid(10.0, 10.0, 10.0, true)
+        val front = DrawingRenderer(Drawing(cube, listOf("front"), emptyList())).view("front")
+        assertTrue(lines(front, false).isNotEmpty())
+        assertTrue(lines(front, true).isEmpty())
+        // The outline of the front view is the 10x10 square.
+        assertEquals(-5.0, front.geometry[0], 1e-6)
+        assertEquals(5.0, front.geometry[2], 1e-6)
+    }
+
+    @Test
+    fun testHoleIsHidden() {
+        // A hole through the cube along the x axis can't be seen from the front.
+        val hole = Solid.cylinder(20.0, 2.0).move(0.0, 0.0, -10.0).rotate(0.0, 90.0, 0.0)
+        val body = Solid.cuboid(10.0, 10.0, 10.0, true) - hole
+        val renderer = DrawingRenderer(Drawing(body, listOf("front", "right"), emptyList()))
+        assertTrue(lines(renderer.view("front"), true).isNotEmpty())
+        // From the right, it's a circle that can be seen.
+        assertTrue(lines(renderer.view("right"), true).isEmpty())
+    }
+
+    @Test
+    fun testDefaultDimensionLabelIgnoresLocale() {
+        val saved = Locale.getDefault()
+        Locale.setDefault(Locale.GERMANY)
+        try {
+            val dimension = DimensionValueType.providesFunctions.first { it.name == "dimension" }
+            val dim = dimension.execute(listOf(Vec3(0.0, 0.0, 0.0), Vec3(2.5, 0.0, 0.0))) as Dimension
+            assertEquals("2.50", dim.label)
+        } finally {
+            Locale.setDefault(saved)
+        }
+    }
+
+    @Test
+    fun testDimensionsAndSections() {
+        val cube = Solid.cuboid(10.0, 10.0, 10.0, true)
+        val dim = Dimension(Vec3(-5.0, -5.0, -5.0), Vec3(5.0, -5.0, -5.0), "10.00")
+        val drawing =
+            Drawing(cube, listOf("front", "top", "right", "iso"), listOf(dim))
+                .section(Vec3(0.0, 0.0, 1.0), 0.0)
+        val renderer = DrawingRenderer(drawing)
+        val labels = { view: DrawingRenderer.View ->
+            view.marks.filterIsInstance<DrawingRenderer.Mark.Label>().map { it.text }
+        }
+        // The dimension runs along x, so it's in the front and top views, but not the right.
+        assertContains(labels(renderer.view("front")), "10.00")
+        assertContains(labels(renderer.view("top")), "10.00")
+        assertTrue("10.00" !in labels(renderer.view("right")))
+
+        val section = renderer.section(drawing.sections.first())
+        assertEquals(1, section.marks.filterIsInstance<DrawingRenderer.Mark.Area>().size)
+        assertContains(labels(section), "SECTION A-A")
+
+        val svg = drawing.svg()
+        assertContains(svg, "<svg")
+        assertContains(svg, "SECTION A-A")
+        val pdf = String(drawing.pdf(), Charsets.ISO_8859_1)
+        assertTrue(pdf.startsWith("%PDF-1.4"))
+        assertTrue(pdf.trimEnd().endsWith("%%EOF"))
+    }
+
+    @Test
+    fun testUnknownView() {
+        assertFailsWith<SimplexEvaluationError> {
+            Drawing(Solid.cuboid(1.0, 1.0, 1.0, true), listOf("sideways"), emptyList())
+        }
+    }
+}
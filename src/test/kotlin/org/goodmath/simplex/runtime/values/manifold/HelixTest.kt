@@ -0,0 +1,92 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import kotlin.math.PI
+import kotlin.math.hypot
+import kotlin.test.Test
+import kotlin.test.assertEquals
+import kotlin.test.assertFailsWith
+import kotlin.test.assertTrue
+import org.goodmath.simplex.runtime.SimplexEvaluationError
+
+class HelixTest {
+    @Test
+    fun testPath() {
+        val path = Helix.path(10.0, 4.0, 2.0, 0.0, 8)
+        assertEquals(17, path.size)
+        assertEquals(10.0, path.first().x, 1e-9)
+        assertEquals(0.0, path.first().z, 1e-9)
+        // A quarter turn in, counterclockwise from +x.
+        assertEquals(10.0, path[2].y, 1e-9)
+        assertEquals(1.0, path[2].z, 1e-9)
+        assertEquals(8.0, path.last().z, 1e-9)
+        assertTrue(path.all { kotlin.math.abs(hypot(it.x, it.y) - 10.0) < 1e-9 })
+
+        // Winding clockwise, and tapering in to a radius of 5.
+        val cw = Helix.path(10.0, 4.0, -1.0, -5.0, 8)
+        assertEquals(-8.75, cw[2].y, 1e-9)
+        assertEquals(5.0, cw.last().x, 1e-9)
+        assertEquals(4.0, cw.last().z, 1e-9)
+    }
+
+    @Test
+    fun testConvexPieces() {
+        // An L shape has vertices at x = 0, 1 and 3, so it's cut into two strips.
+        val l = Slice.rectangle(3.0, 1.0) + Slice.rectangle(1.0, 3.0)
+        val pieces = Helix.convexPieces(l)
+        assertEquals(2, pieces.size)
+        val area = pieces.sumOf { piece ->
+            piece.indices.sumOf { i ->
+                val a = piece[i]
+                val b = piece[(i + 1) % piece.size]
+                a.x * b.y - b.x * a.y
+            } / 2.0
+        }
+        assertEquals(5.0, area, 1e-6)
+    }
+
+    @Test
+    fun testSweep() {
+        val spring = Helix.sweep(Slice.rectangle(1.0, 1.0).translate(-0.5, -0.5), 10.0, 3.0, 2.0, 0.0, 64)
+        assertEquals(1, spring.numComponents())
+        // The volume is close to the profile's area times the length of the helix.
+        val length = 2.0 * hypot(2.0 * PI * 10.0, 3.0)
+        assertEquals(length, spring.volume().d, length * 0.01)
+        val box = spring.boundingBox()
+        assertEquals(-0.5, box.low.z, 1e-4)
+        assertEquals(6.5, box.high.z, 1e-4)
+    }
+
+    @Test
+    fun testRevolveDirection() {
+        val square = Slice.rectangle(1.0, 1.0).translate(1.0, 0.0)
+        val ccw = square.revolve(16, 90.0f).boundingBox()
+        assertTrue(ccw.low.y > -1e-4)
+        val cw = square.revolve(16, -90.0f).boundingBox()
+        assertTrue(cw.high.y < 1e-4)
+        assertFailsWith<SimplexEvaluationError> { square.revolve(16, 0.0f) }
+    }
+
+    @Test
+    fun testInvalidHelix() {
+        assertFailsWith<SimplexEvaluationError> { Helix.path(10.0, 1.0, 0.0, 0.0) }
+        assertFailsWith<SimplexEvaluationError> { Helix.path(10.0, 1.0, 1.0, -11.0) }
+        assertFailsWith<SimplexEvaluationError> {
+            Helix.sweep(Slice.circle(2.0, 8), 1.0, 5.0, 1.0, 0.0)
+        }
+    }
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import java.io.ByteArrayInputStream
+import java.nio.file.Files
+import java.nio.file.Path
+import kotlin.test.Test
+import kotlin.test.assertEquals
+import kotlin.test.assertTrue
+import org.antlr.v4.runtime.CharStreams
+import org.goodmath.simplex.parser.SimplexParseListener
+import org.goodmath.simplex.runtime.RootEnv
+import org.goodmath.simplex.runtime.values.primitives.Vec2
+
+class ImageTracerTest {
+    private fun bitmap(vararg rows: String): Bitmap {
+        val gray = rows.joinToString("").map { if (it == '#') 0.0 else 1.0 }.toDoubleArray()
+        return Bitmap(rows[0].length, rows.size, gray, 1.0)
+    }
+
+    private fun signedArea(poly: List<Vec2>): Double =
+        poly.indices.sumOf { i ->
+            val a = poly[i]
+            val b = poly[(i + 1) % poly.size]
+            a.x * b.y - b.x * a.y
+        } / 2.0
+
+    @Test
+    fun testTraceWithHole() {
+        val contours = ImageTracer.trace(
+            bitmap(".....", ".###.", ".#.#.", ".###.", "....."),
+            0.5,
+        )
+        assertEquals(2, contours.size)
+        // Only the corners are kept, and the hole runs the other way around.
+        assertTrue(contours.all { it.size == 4 })
+        assertEquals(listOf(-1.0, 9.0), contours.map { signedArea(it) }.sorted())
+    }
+
+    @Test
+    fun testTraceDiagonalPixelsSeparately() {
+        val contours = ImageTracer.trace(bitmap("#.", ".#"), 0.5)
+        assertEquals(2, contours.size)
+        assertTrue(contours.all { signedArea(it) == 1.0 })
+        // The image is kept the right way up: the top left pixel is at the top.
+        val topLeft = contours.first { c -> c.all { it.x <= 1.0 } }
+        assertTrue(topLeft.all { it.y >= 1.0 })
+    }
+
+    @Test
+    fun testThreshold() {
+        val gray = Bitmap(3, 1, doubleArrayOf(0.2, 0.5, 0.8), 1.0)
+        assertEquals(1.0, ImageTracer.trace(gray, 0.3).sumOf { signedArea(it) })
+        assertEquals(3.0, ImageTracer.trace(gray, 0.9).sumOf { signedArea(it) })
+    }
+
+    @Test
+    fun testReadPlainPgm() {
+        val pgm = "P2\n# a comment\n3 2\n255\n0 128 255\n255 0 0\n"
+        val bitmap = ImageTracer.readPgm(ByteArrayInputStream(pgm.toByteArray()))
+        assertEquals(3, bitmap.width)
+        assertEquals(2, bitmap.height)
+        assertEquals(0.0, bitmap.at(0, 0))
+        assertEquals(128.0 / 255.0, bitmap.at(1, 0))
+        assertEquals(1.0, bitmap.at(0, 1))
+    }
+
+    @Test
+    fun testReadBinaryPgm() {
+        val header = "P5 2 2 255\n".toByteArray()
+        val pixels = byteArrayOf(0, 255.toByte(), 255.toByte(), 0)
+        val bitmap = ImageTracer.readPgm(ByteArrayInputStream(header + pixels))
+        assertEquals(2, bitmap.width)
+        assertEquals(1.0, bitmap.at(1, 0))
+        assertEquals(0.0, bitmap.at(1, 1))
+        assertEquals(2, ImageTracer.trace(bitmap, 0.5).size)
+    }
+
+    @Test
+    fun testImagePathsAreRelativeToTheModel() {
+        val dir = Files.createTempDirectory("simplex-images")
+        try {
+            val parser = SimplexParseListener()
+            parser.importRoot = dir
+            parser.parse(
+                "model.s3d",
+                CharStreams.fromString("produce(\"p\") { trace_image(\"logo.pgm\", 0.5, 0.0) }"),
+            ) { _, _, _ -> }
+            assertEquals(dir.resolve("logo.pgm"), RootEnv.resolvePath("logo.pgm"))
+            assertEquals(Path.of("/images/logo.pgm"), RootEnv.resolvePath("/images/logo.pgm"))
+        } finally {
+            RootEnv.reset()
+        }
+        assertEquals(Path.of("logo.pgm"), RootEnv.resolvePath("logo.pgm"))
+    }
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import kotlin.test.Test
+import kotlin.test.assertEquals
+import kotlin.test.assertTrue
+
+class MeshRendererTest {
+    private val vertices =
+        doubleArrayOf(0.0, 0.0, 0.0, 10.0, 0.0, 0.0, 0.0, 10.0, 0.0, 0.0, 0.0, 10.0)
+
+    // A tetrahedron, with its triangles wound counter-clockwise seen from outside.
+    private val tetrahedron = MeshData(vertices, intArrayOf(0, 2, 1, 0, 1, 3, 0, 3, 2, 1, 2, 3))
+
+    private fun drawnPixels(mesh: MeshData, renderer: MeshRenderer): Int {
+        val image = renderer.render(mesh)
+        assertEquals(renderer.width, image.width)
+        assertEquals(renderer.height, image.height)
+        var count = 0
+        for (y in 0 until image.height) {
+            for (x in 0 until image.width) {
+                if (image.getRGB(x, y) and 0xffffff != MeshRenderer.BACKGROUND) {
+                    count++
+                }
+            }
+        }
+        return count
+    }
+
+    @Test
+    fun testRenderTetrahedron() {
+        val renderer = MeshRenderer.framing(tetrahedron, 64, 48)
+        val drawn = drawnPixels(tetrahedron, renderer)
+        assertTrue(drawn > 64 * 48 / 10, "expected the tetrahedron to cover part of the image, got $drawn")
+        assertTrue(drawn < 64 * 48, "expected some background to be visible")
+    }
+
+    @Test
+    fun testBackFacesAreCulled() {
+        // The sloped face of the tetrahedron faces the camera; wound the other way,
+        // it faces away.
+        val front = MeshData(vertices, intArrayOf(1, 2, 3))
+        val back = MeshData(vertices, intArrayOf(1, 3, 2))
+        val renderer = MeshRenderer.framing(tetrahedron, 64, 48)
+        assertTrue(drawnPixels(front, renderer) > 0)
+        assertEquals(0, drawnPixels(back, renderer))
+    }
+}
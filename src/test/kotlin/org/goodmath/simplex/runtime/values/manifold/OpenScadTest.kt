@@ -0,0 +1,139 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import java.nio.file.NoSuchFileException
+import java.nio.file.Path
+import kotlin.math.sqrt
+import kotlin.test.Test
+import kotlin.test.assertEquals
+import kotlin.test.assertFailsWith
+import kotlin.test.assertTrue
+import org.goodmath.simplex.parser.SimplexParseListener
+import org.goodmath.simplex.runtime.Env
+import org.goodmath.simplex.runtime.RootEnv
+import org.goodmath.simplex.runtime.SimplexUndefinedVariableError
+import org.goodmath.simplex.runtime.values.primitives.FloatValue
+import org.goodmath.simplex.runtime.values.primitives.FunctionValue
+import org.goodmath.simplex.runtime.values.primitives.IntegerValue
+import org.goodmath.simplex.runtime.values.primitives.Vec2
+import org.goodmath.simplex.runtime.values.primitives.Vec3
+
+class OpenScadTest {
+    private fun assertClose(expected: Vec3, actual: Vec3) {
+        assertEquals(expected.x, actual.x, 1e-12)
+        assertEquals(expected.y, actual.y, 1e-12)
+        assertEquals(expected.z, actual.z, 1e-12)
+    }
+
+    @Test
+    fun testFragments() {
+        // Reference values from OpenSCAD, with the default $fa=12 and $fs=2.
+        assertEquals(30, OpenScad.fragments(10.0, 0))
+        assertEquals(16, OpenScad.fragments(5.0, 0))
+        assertEquals(5, OpenScad.fragments(1.0, 0))
+        assertEquals(64, OpenScad.fragments(1.0, 64))
+        assertEquals(3, OpenScad.fragments(1.0, 2))
+        assertEquals(3, OpenScad.fragments(1e-9, 10))
+    }
+
+    @Test
+    fun testCirclePoints() {
+        // Vertices on the axes are exact.
+        assertEquals(
+            listOf(Vec2(2.0, 0.0), Vec2(0.0, 2.0), Vec2(-2.0, 0.0), Vec2(0.0, -2.0)).map { Pair(it.x, it.y) },
+            OpenScad.circlePoints(2.0, 4).map { Pair(it.x, it.y) },
+        )
+        assertEquals(0.5, OpenScad.circlePoints(1.0, 6)[1].x)
+    }
+
+    @Test
+    fun testSpherePoints() {
+        // OpenSCAD's sphere(r=1, $fn=6): three rings of six points, at 30, 90, and 150
+        // degrees from the top.
+        val points = OpenScad.spherePoints(1.0, 6)
+        assertEquals(18, points.size)
+        assertClose(Vec3(0.5, 0.0, sqrt(3.0) / 2.0), points[0])
+        assertClose(Vec3(0.25, sqrt(3.0) / 4.0, sqrt(3.0) / 2.0), points[1])
+        assertClose(Vec3(1.0, 0.0, 0.0), points[6])
+        assertClose(Vec3(0.5, 0.0, -sqrt(3.0) / 2.0), points[12])
+        assertTrue(points.all { p -> kotlin.math.abs(p.x * p.x + p.y * p.y + p.z * p.z - 1.0) < 1e-12 })
+        // The default resolution for r=10 is 30 fragments, in 15 rings.
+        assertEquals(450, OpenScad.spherePoints(10.0, 0).size)
+    }
+
+    @Test
+    fun testCylinderPoints() {
+        val cone = OpenScad.cylinderPoints(10.0, 2.0, 0.0, true, 8)
+        assertEquals(9, cone.size)
+        assertClose(Vec3(2.0, 0.0, -5.0), cone[0])
+        assertClose(Vec3(0.0, 0.0, 5.0), cone[8])
+        val cylinder = OpenScad.cylinderPoints(4.0, 1.0, 3.0, false, 0)
+        // The fragments come from the larger radius.
+        assertEquals(2 * OpenScad.fragments(3.0, 0), cylinder.size)
+        assertEquals(0.0, cylinder.first().z)
+        assertEquals(4.0, cylinder.last().z)
+    }
+
+    @Test
+    fun testLibraryLoadsFromClasspath() {
+        try {
+            SimplexParseListener().parseLibraryFile("scad", Path.of("openscad.s3d")) { _, _, _ -> }
+            val names = RootEnv.getScope("scad").defs.keys
+            assertTrue(
+                names.containsAll(
+                    listOf("cube", "sphere", "cylinder", "circle", "square", "linear_extrude", "rotate_extrude", "rotate")
+                )
+            )
+        } finally {
+            RootEnv.reset()
+        }
+    }
+
+    @Test
+    fun testOnlyBundledNamesFallBackToClasspath() {
+        try {
+            // A missing file in a directory isn't a bundled library, even with the same name...
+            assertFailsWith<NoSuchFileException> {
+                SimplexParseListener().parseLibraryFile("scad", Path.of("no-such-dir", "openscad.s3d")) { _, _, _ -> }
+            }
+            // ...and neither is a missing file with some other name.
+            assertFailsWith<NoSuchFileException> {
+                SimplexParseListener().parseLibraryFile("other", Path.of("no-such-library.s3d")) { _, _, _ -> }
+            }
+        } finally {
+            RootEnv.reset()
+        }
+    }
+
+    @Test
+    fun testBuiltinsArePrivateToLibrary() {
+        try {
+            SimplexParseListener().parseLibraryFile("scad", Path.of("openscad.s3d")) { _, _, _ -> }
+            Env.createRootEnv()
+            // The library can call its builtins...
+            val sphere = RootEnv.getValueOfScopedName("scad", "sphere") as FunctionValue
+            val ball = sphere.applyTo(listOf(FloatValue(1.0), IntegerValue(6))) as Solid
+            assertEquals(18, ball.manifold.numVert().toInt())
+            // ...but models can't.
+            for (f in OpenScad.builtins) {
+                assertFailsWith<SimplexUndefinedVariableError> { RootEnv.getDeclaredTypeOf(f.name) }
+            }
+        } finally {
+            RootEnv.reset()
+        }
+    }
+}
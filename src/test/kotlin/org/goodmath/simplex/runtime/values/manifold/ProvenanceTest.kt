@@ -0,0 +1,86 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import kotlin.test.Test
+import kotlin.test.assertEquals
+import kotlin.test.assertTrue
+import org.antlr.v4.runtime.CharStreams
+import org.goodmath.simplex.ast.Location
+import org.goodmath.simplex.ast.expr.FunCallExpr
+import org.goodmath.simplex.ast.expr.VarRefExpr
+import org.goodmath.simplex.parser.SimplexParseListener
+import org.goodmath.simplex.runtime.Env
+import org.goodmath.simplex.runtime.RootEnv
+
+class ProvenanceTest {
+    private val program =
+        """
+        fun body(): Solid {
+          cuboid(10.0, 10.0, 10.0) -
+            cylinder(20.0, 2.0)->move(0.0, 0.0, 10.0)
+        }
+
+        produce("body") {
+          body()
+        }
+        """
+            .trimIndent()
+
+    @Test
+    fun testFacesFromLine() {
+        try {
+            val model = SimplexParseListener().parse("test", CharStreams.fromString(program)) { _, _, _ -> }
+            val env = Env(model.defs, Env.createRootEnv())
+            env.installStaticDefinitions()
+            env.installDefinitionValues()
+            val loc = Location("test", 100, 0)
+            val body = FunCallExpr(VarRefExpr("body", loc), emptyList(), loc).evaluateIn(env) as Solid
+
+            val box = Provenance.facesFrom(body, "test", 2)
+            val hole = Provenance.facesFrom(body, "test", 3)
+            assertTrue(box.isNotEmpty())
+            assertTrue(hole.isNotEmpty())
+            // Every triangle came from one of the two primitives.
+            assertEquals(body.manifold.numTri().toInt(), box.size + hole.size)
+            assertTrue(box.intersect(hole.toSet()).isEmpty())
+            // The same line of a different file didn't create anything.
+            assertTrue(Provenance.facesFrom(body, "other", 2).isEmpty())
+
+            val runs = Provenance.runs(body)
+            assertTrue(runs.all { it.source?.file == "test" })
+        } finally {
+            RootEnv.reset()
+        }
+    }
+
+    @Test
+    fun testFacesFromSolid() {
+        try {
+            val loc = Location("test", 1, 0)
+            val block = Provenance.tag(Solid.cuboid(10.0, 10.0, 10.0, true), loc) as Solid
+            val hole = Provenance.tag(Solid.cylinder(20.0, 2.0).move(0.0, 0.0, -10.0), loc) as Solid
+            val body = block - hole
+            assertEquals(
+                Provenance.facesFrom(body, hole).size + Provenance.facesFrom(body, block).size,
+                body.manifold.numTri().toInt(),
+            )
+            assertTrue(Provenance.facesFrom(body, hole).isNotEmpty())
+        } finally {
+            RootEnv.reset()
+        }
+    }
+}
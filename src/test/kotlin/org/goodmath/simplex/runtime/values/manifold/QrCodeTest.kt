@@ -0,0 +1,76 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import kotlin.test.Test
+import kotlin.test.assertContentEquals
+import kotlin.test.assertEquals
+import kotlin.test.assertFailsWith
+import kotlin.test.assertTrue
+import org.goodmath.simplex.runtime.SimplexEvaluationError
+
+class QrCodeTest {
+    @Test
+    fun testReedSolomon() {
+        // The data codewords of "HELLO WORLD" in a version 1-M symbol, and their
+        // error correction codewords.
+        val data = intArrayOf(32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17)
+        assertContentEquals(
+            intArrayOf(196, 35, 39, 119, 235, 215, 231, 226, 93, 23),
+            QrCode.reedSolomonRemainder(data, 10),
+        )
+    }
+
+    @Test
+    fun testFormatAndVersionBits() {
+        assertEquals(0b111011111000100, QrCode.formatBits(QrCode.Ecc.L, 0))
+        assertEquals(0b101010000010010, QrCode.formatBits(QrCode.Ecc.M, 0))
+        assertEquals(0b011010101011111, QrCode.formatBits(QrCode.Ecc.Q, 0))
+        assertEquals(0b001011010001001, QrCode.formatBits(QrCode.Ecc.H, 0))
+        assertEquals(0b000111110010010100, QrCode.versionBits(7))
+    }
+
+    @Test
+    fun testCapacity() {
+        assertEquals(listOf(19, 16, 13, 9), QrCode.Ecc.entries.map { QrCode.dataCodewords(1, it) })
+        assertEquals(listOf(2956, 2334, 1666, 1276), QrCode.Ecc.entries.map { QrCode.dataCodewords(40, it) })
+        assertEquals(listOf(6, 34, 60, 86, 112, 138), QrCode.alignmentPositions(32))
+    }
+
+    @Test
+    fun testEncode() {
+        val code = QrCode.encode("PART-00123", QrCode.eccOf("m"))
+        assertEquals(1, code.version)
+        assertEquals(21, code.size)
+        // The three finder patterns have dark corners and a light ring.
+        for ((x, y) in listOf(0 to 0, code.size - 7 to 0, 0 to code.size - 7)) {
+            assertTrue(code.isDark(x, y))
+            assertTrue(code.isDark(x + 6, y + 6))
+            assertTrue(!code.isDark(x + 1, y + 1))
+            assertTrue(code.isDark(x + 3, y + 3))
+        }
+        // The dark module next to the bottom left finder.
+        assertTrue(code.isDark(8, code.size - 8))
+        // Higher error correction needs a larger symbol.
+        assertEquals(2, QrCode.encode("PART-00123", QrCode.Ecc.H).version)
+        assertEquals(5, QrCode.encode("x".repeat(100), QrCode.Ecc.L).version)
+    }
+
+    @Test
+    fun testInvalidEcc() {
+        assertFailsWith<SimplexEvaluationError> { QrCode.eccOf("X") }
+    }
+}
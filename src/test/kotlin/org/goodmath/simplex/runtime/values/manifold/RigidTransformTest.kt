@@ -0,0 +1,60 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import kotlin.test.Test
+import kotlin.test.assertTrue
+import org.goodmath.simplex.runtime.values.primitives.Vec3
+
+class RigidTransformTest {
+    private fun assertClose(expected: Vec3, actual: Vec3) {
+        assertTrue(
+            (expected - actual).magnitude() < 1e-9,
+            "expected $expected, got $actual",
+        )
+    }
+
+    @Test
+    fun testRotationAboutOffsetAxis() {
+        val hinge = RigidTransform.rotation(Vec3(1.0, 0.0, 0.0), Vec3(0.0, 0.0, 1.0), 90.0)
+        assertClose(Vec3(1.0, 1.0, 0.0), hinge.apply(Vec3(2.0, 0.0, 0.0)))
+        // Points on the axis don't move.
+        assertClose(Vec3(1.0, 0.0, 5.0), hinge.apply(Vec3(1.0, 0.0, 5.0)))
+    }
+
+    @Test
+    fun testCompose() {
+        val slide = RigidTransform.translation(Vec3(0.0, 0.0, 3.0))
+        val turn = RigidTransform.rotation(Vec3(1.0, 0.0, 0.0), 90.0)
+        // Turn first, then slide.
+        assertClose(Vec3(0.0, 0.0, 4.0), slide.compose(turn).apply(Vec3(0.0, 1.0, 0.0)))
+        assertTrue(RigidTransform.identity.isIdentity())
+    }
+
+    @Test
+    fun testEulerAnglesRoundTrip() {
+        for (angles in listOf(Vec3(10.0, 20.0, 30.0), Vec3(-45.0, 60.0, 120.0), Vec3(0.0, 0.0, -90.0))) {
+            val t = RigidTransform.euler(angles)
+            val recovered = t.eulerAngles()
+            assertClose(angles, recovered)
+        }
+        // At 90 degrees about Y, the X and Z rotations can't be told apart, but the
+        // recovered angles still have to produce the same rotation.
+        val locked = RigidTransform.euler(Vec3(30.0, 90.0, 0.0))
+        val p = Vec3(1.0, 2.0, 3.0)
+        assertClose(locked.apply(p), RigidTransform.euler(locked.eulerAngles()).apply(p))
+    }
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import java.nio.file.Files
+import java.util.zip.ZipFile
+import kotlin.test.Test
+import kotlin.test.assertContains
+import kotlin.test.assertEquals
+import kotlin.test.assertFailsWith
+import org.goodmath.simplex.runtime.SimplexEvaluationError
+import org.goodmath.simplex.runtime.values.primitives.IntegerValue
+import org.goodmath.simplex.runtime.values.primitives.StringValue
+
+class SlicerVolumeTest {
+    @Test
+    fun testSettings() {
+        val modifier =
+            SlicerVolume(SlicerRole.Modifier, Solid.cuboid(5.0, 5.0, 5.0, true))
+                .withSetting("infill", IntegerValue(40))
+                .withSetting("walls", IntegerValue(3))
+                .withSetting("layer_height", StringValue("0.1"))
+        assertEquals(
+            mapOf("fill_density" to "40%", "perimeters" to "3", "layer_height" to "0.1"),
+            modifier.settings,
+        )
+        val blocker = SlicerVolume(SlicerRole.SupportBlocker, Solid.cuboid(5.0, 5.0, 5.0, true))
+        assertFailsWith<SimplexEvaluationError> { blocker.withSetting("infill", IntegerValue(10)) }
+    }
+
+    @Test
+    fun testConfigRanges() {
+        val body = Solid.cuboid(10.0, 10.0, 10.0, true)
+        val modifier =
+            SlicerVolume(SlicerRole.Modifier, Solid.cuboid(5.0, 5.0, 5.0, true))
+                .withSetting("infill", IntegerValue(40))
+        val blocker = SlicerVolume(SlicerRole.SupportBlocker, Solid.cuboid(2.0, 2.0, 2.0, true))
+        val meshes = listOf(body, modifier.solid, blocker.solid).map { MeshData.of(it) }
+        val config = SlicerVolume.configXml("box", meshes, listOf(modifier, blocker))
+
+        // A cube has 12 triangles, so the volumes get consecutive runs of 12.
+        assertContains(config, "<volume firstid=\"0\" lastid=\"11\">")
+        assertContains(config, "<volume firstid=\"12\" lastid=\"23\">")
+        assertContains(config, "<volume firstid=\"24\" lastid=\"35\">")
+        assertContains(config, "key=\"volume_type\" value=\"ModelPart\"")
+        assertContains(config, "key=\"volume_type\" value=\"ModifierVolume\"")
+        assertContains(config, "key=\"volume_type\" value=\"SupportBlocker\"")
+        assertContains(config, "key=\"fill_density\" value=\"40%\"")
+
+        val model = SlicerVolume.modelXml(meshes)
+        assertEquals(meshes.sumOf { it.vertexCount }, Regex("<vertex ").findAll(model).count())
+        assertEquals(36, Regex("<triangle ").findAll(model).count())
+    }
+
+    @Test
+    fun testExport() {
+        val dir = Files.createTempDirectory("slicer")
+        val path = dir.resolve("box.3mf").toString()
+        val body = Solid.cuboid(10.0, 10.0, 10.0, true)
+        val enforcer = SlicerVolume(SlicerRole.SupportEnforcer, Solid.cuboid(2.0, 2.0, 2.0, true))
+        SlicerVolume.export3mf(path, "box", body, listOf(enforcer))
+        ZipFile(path).use { zip ->
+            val names = zip.entries().toList().map { it.name }.toSet()
+            assertEquals(
+                setOf(
+                    "[Content_Types].xml",
+                    "_rels/.rels",
+                    "3D/3dmodel.model",
+                    "Metadata/Slic3r_PE_model.config",
+                ),
+                names,
+            )
+        }
+    }
+}
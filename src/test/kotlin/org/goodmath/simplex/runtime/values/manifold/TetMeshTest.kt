@@ -0,0 +1,155 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import kotlin.math.abs
+import kotlin.math.sqrt
+import kotlin.test.Test
+import kotlin.test.assertEquals
+import kotlin.test.assertFailsWith
+import kotlin.test.assertTrue
+import org.goodmath.simplex.runtime.SimplexEvaluationError
+
+class TetMeshTest {
+    // A 10x10x10 cube, with vertex i at (x, y, z) = the bits of i, scaled by 10.
+    private val cubeVertices = DoubleArray(24) { idx -> if ((idx / 3) shr (idx % 3) and 1 == 1) 10.0 else 0.0 }
+    private val cubeTriangles =
+        intArrayOf(
+            0, 2, 1, 1, 2, 3, 4, 5, 6, 5, 7, 6, 0, 1, 4, 1, 5, 4,
+            2, 6, 3, 3, 6, 7, 0, 4, 2, 2, 4, 6, 1, 3, 5, 3, 7, 5,
+        )
+    private val cube = MeshData(cubeVertices, cubeTriangles)
+
+    // The cube, with a 2x2x2 cubic hole in the middle: the inside surface is wound the
+    // other way, so that it faces into the hole.
+    private val hollowCube =
+        MeshData(
+            cubeVertices + DoubleArray(24) { 4.0 + cubeVertices[it] / 5.0 },
+            cubeTriangles +
+                IntArray(cubeTriangles.size) { cubeTriangles[it - it % 3 + (3 - it % 3) % 3] + 8 },
+        )
+
+    private val singleTet =
+        TetMesh(doubleArrayOf(0.0, 0.0, 0.0, 1.0, 0.0, 0.0, 0.0, 1.0, 0.0, 0.0, 0.0, 1.0), intArrayOf(0, 1, 2, 3))
+
+    private fun assertMeshOf(mesh: TetMesh, volume: Double, maxVolume: Double, quality: Double) {
+        assertTrue(abs(mesh.volume() - volume) < 0.01, "mesh volume ${mesh.volume()} should be $volume")
+        for (t in 0 until mesh.tetCount) {
+            assertTrue(mesh.tetVolume(t) > 0.0, "tetrahedron $t is inverted")
+            assertTrue(mesh.tetVolume(t) <= maxVolume, "tetrahedron $t is too large")
+        }
+        assertTrue(mesh.worstQuality() <= quality, "worst quality ${mesh.worstQuality()} is over $quality")
+        for (i in 0 until mesh.nodeCount) {
+            val p = mesh.node(i)
+            for (c in listOf(p.x, p.y, p.z)) {
+                assertTrue(c > -1e-4 && c < 10.0 + 1e-4, "node $i is outside of the solid")
+            }
+        }
+    }
+
+    @Test
+    fun testTetrahedralizeCube() {
+        assertMeshOf(Tetrahedralizer(cube, 10.0).tetrahedralize(), 1000.0, 10.0, 2.0)
+        assertMeshOf(Tetrahedralizer(cube, 3.0, 1.5).tetrahedralize(), 1000.0, 3.0, 1.5)
+    }
+
+    @Test
+    fun testTetrahedralizeHollowCube() {
+        val mesh = Tetrahedralizer(hollowCube, 5.0).tetrahedralize()
+        assertMeshOf(mesh, 992.0, 5.0, 2.0)
+        // Both the outside of the cube and the inside of the hole are on the boundary.
+        assertEquals(6 * 10.0 * 10.0 + 6 * 2.0 * 2.0, boundaryArea(mesh), 1e-3)
+    }
+
+    @Test
+    fun testMeshFitsSurface() {
+        val cylinder = MeshData.of(Solid.cylinder(10.0, 3.0, 2.0, 24))
+        for (surface in listOf(cube, hollowCube, cylinder)) {
+            val mesh = Tetrahedralizer(surface, 4.0).tetrahedralize()
+            val volume = Tetrahedralizer.meshVolume(surface)
+            assertEquals(volume, mesh.volume(), volume * 1e-6)
+            // Every vertex of the surface is a node, exactly where it is.
+            val nodes = (0 until mesh.nodeCount).map { mesh.node(it) }.toSet()
+            for (v in 0 until surface.vertexCount) {
+                assertTrue(surface.vertex(v) in nodes, "vertex ${surface.vertex(v)} isn't a node")
+            }
+        }
+    }
+
+    @Test
+    fun testBadParameters() {
+        assertFailsWith<SimplexEvaluationError> { Tetrahedralizer(cube, 0.0).tetrahedralize() }
+        assertFailsWith<SimplexEvaluationError> { Tetrahedralizer(cube, 10.0, 0.5).tetrahedralize() }
+        assertFailsWith<SimplexEvaluationError> { Tetrahedralizer(cube, 1e-6).tetrahedralize() }
+    }
+
+    @Test
+    fun testBoundary() {
+        assertEquals(4, singleTet.boundary.size)
+        // Every boundary face faces away from the node that isn't on it.
+        for (face in singleTet.boundary) {
+            val n = singleTet.faceNodes(face)
+            val opposite = (0 until 4).first { it !in n }
+            assertTrue(TetMesh.signedVolume(singleTet.nodes, n[0], n[1], n[2], opposite) < 0.0)
+        }
+        assertEquals(1.0 / 6.0, singleTet.volume(), 1e-12)
+    }
+
+    @Test
+    fun testMsh() {
+        val msh = singleTet.toMsh()
+        assertTrue(msh.startsWith("\$MeshFormat\n2.2 0 8\n\$EndMeshFormat\n"))
+        assertTrue(msh.contains("\$Nodes\n4\n1 0.0 0.0 0.0\n2 1.0 0.0 0.0\n"))
+        // Four boundary triangles, and then the tetrahedron.
+        assertTrue(msh.contains("\$Elements\n5\n1 2 2 1 1 "))
+        assertTrue(msh.contains("5 4 2 2 1 1 2 3 4\n\$EndElements\n"))
+    }
+
+    @Test
+    fun testVtu() {
+        val vtu = singleTet.toVtu()
+        assertTrue(vtu.contains("<Piece NumberOfPoints=\"4\" NumberOfCells=\"1\">"))
+        assertTrue(vtu.contains("Name=\"connectivity\" format=\"ascii\">\n     0 1 2 3\n"))
+        assertTrue(vtu.contains("Name=\"offsets\" format=\"ascii\">\n     4\n"))
+        assertTrue(vtu.contains("Name=\"types\" format=\"ascii\">\n     10\n"))
+    }
+
+    @Test
+    fun testInp() {
+        val inp = singleTet.toInp("part")
+        assertTrue(inp.startsWith("*HEADING\npart: "))
+        assertTrue(inp.contains("*NODE\n1, 0.0, 0.0, 0.0\n"))
+        assertTrue(inp.contains("*ELEMENT, TYPE=C3D4, ELSET=VOLUME\n1, 1, 2, 3, 4\n"))
+        assertTrue(inp.contains("*NSET, NSET=BOUNDARY\n1, 2, 3, 4\n"))
+        val faces = inp.substringAfter("*SURFACE, NAME=BOUNDARY, TYPE=ELEMENT\n").lines().filter { it.isNotEmpty() }
+        assertEquals(setOf("1, S1", "1, S2", "1, S3", "1, S4"), faces.toSet())
+    }
+
+    private fun boundaryArea(mesh: TetMesh): Double =
+        mesh.boundary.sumOf { face ->
+            val (a, b, c) = mesh.faceNodes(face).map { mesh.node(it) }
+            val ux = b.x - a.x
+            val uy = b.y - a.y
+            val uz = b.z - a.z
+            val vx = c.x - a.x
+            val vy = c.y - a.y
+            val vz = c.z - a.z
+            val nx = uy * vz - uz * vy
+            val ny = uz * vx - ux * vz
+            val nz = ux * vy - uy * vx
+            sqrt(nx * nx + ny * ny + nz * nz) / 2.0
+        }
+}
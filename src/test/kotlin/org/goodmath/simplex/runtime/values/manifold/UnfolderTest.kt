@@ -0,0 +1,102 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.manifold
+
+import kotlin.math.abs
+import kotlin.math.sqrt
+import kotlin.test.Test
+import kotlin.test.assertEquals
+import kotlin.test.assertFalse
+import kotlin.test.assertTrue
+import org.goodmath.simplex.runtime.values.primitives.Vec2
+
+class UnfolderTest {
+    // A 10x10x10 cube, with vertex i at (x, y, z) = the bits of i, scaled by 10.
+    private val cube =
+        MeshData(
+            DoubleArray(24) { idx -> if ((idx / 3) shr (idx % 3) and 1 == 1) 10.0 else 0.0 },
+            intArrayOf(
+                0, 2, 1, 1, 2, 3, 4, 5, 6, 5, 7, 6, 0, 1, 4, 1, 5, 4,
+                2, 6, 3, 3, 6, 7, 0, 4, 2, 2, 4, 6, 1, 3, 5, 3, 7, 5,
+            ),
+        )
+
+    private val tetrahedron =
+        MeshData(
+            doubleArrayOf(0.0, 0.0, 0.0, 10.0, 0.0, 0.0, 0.0, 10.0, 0.0, 0.0, 0.0, 10.0),
+            intArrayOf(0, 2, 1, 0, 1, 3, 0, 3, 2, 1, 2, 3),
+        )
+
+    private fun signedArea(poly: List<Vec2>): Double =
+        poly.indices.sumOf { i ->
+            val a = poly[i]
+            val b = poly[(i + 1) % poly.size]
+            a.x * b.y - b.x * a.y
+        } / 2.0
+
+    private fun assertNoOverlaps(net: Unfolder.Net) {
+        val polys = net.polygons
+        for (i in polys.indices) {
+            for (j in i + 1 until polys.size) {
+                assertFalse(Unfolder.overlaps(polys[i], polys[j], 1e-6), "polygons $i and $j overlap")
+            }
+        }
+    }
+
+    @Test
+    fun testUnfoldCube() {
+        val nets = Unfolder(cube).unfold()
+        assertEquals(1, nets.size)
+        val net = nets[0]
+        // The two triangles of each side are merged into a single face.
+        assertEquals(6, net.faceCount)
+        // A cube has 12 edges: 5 are folds between faces, and the other 7 are cut
+        // and get a tab.
+        assertEquals(7, net.tabs.size)
+        assertEquals(12, net.folds.size)
+        // Laying the faces out flat preserves their area and their orientation.
+        assertTrue(net.faces.all { signedArea(it) > 0.0 })
+        assertEquals(600.0, net.faces.sumOf { signedArea(it) }, 1e-6)
+        assertTrue(net.tabs.all { signedArea(it) > 0.0 })
+        assertNoOverlaps(net)
+    }
+
+    @Test
+    fun testUnfoldTetrahedron() {
+        val nets = Unfolder(tetrahedron).unfold()
+        assertEquals(1, nets.size)
+        val net = nets[0]
+        assertEquals(4, net.faceCount)
+        assertEquals(3, net.tabs.size)
+        val slanted = sqrt(3.0) / 4.0 * 200.0
+        assertEquals(150.0 + slanted, net.faces.sumOf { signedArea(it) }, 1e-6)
+        assertNoOverlaps(net)
+        // The fold lines are all edges of the tetrahedron.
+        for (fold in net.folds) {
+            val len = (fold.to - fold.from).magnitude()
+            assertTrue(abs(len - 10.0) < 1e-6 || abs(len - sqrt(200.0)) < 1e-6)
+        }
+    }
+
+    @Test
+    fun testOverlaps() {
+        val a = listOf(Vec2(0.0, 0.0), Vec2(1.0, 0.0), Vec2(0.0, 1.0))
+        val touching = listOf(Vec2(1.0, 0.0), Vec2(0.0, 1.0), Vec2(1.0, 1.0))
+        val crossing = listOf(Vec2(0.2, 0.2), Vec2(2.0, 0.2), Vec2(0.2, 2.0))
+        assertFalse(Unfolder.overlaps(a, touching, 1e-9))
+        assertTrue(Unfolder.overlaps(a, crossing, 1e-9))
+    }
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.solid
+
+import kotlin.test.assertEquals
+import kotlin.test.assertFailsWith
+import kotlin.test.assertNull
+import org.goodmath.simplex.runtime.SimplexEvaluationError
+import org.goodmath.simplex.runtime.values.FunctionSignature
+import org.goodmath.simplex.runtime.values.Param
+import org.goodmath.simplex.runtime.values.Value
+import org.goodmath.simplex.runtime.values.manifold.Anchor
+import org.goodmath.simplex.runtime.values.manifold.Slice
+import org.goodmath.simplex.runtime.values.manifold.SliceValueType
+import org.goodmath.simplex.runtime.values.manifold.Solid
+import org.goodmath.simplex.runtime.values.manifold.SolidValueType
+import org.goodmath.simplex.runtime.values.primitives.FloatValue
+import org.goodmath.simplex.runtime.values.primitives.IntegerValue
+import org.goodmath.simplex.runtime.values.primitives.StringValue
+import org.goodmath.simplex.runtime.values.primitives.StringValueType
+import org.goodmath.simplex.runtime.values.primitives.Vec3
+import org.junit.jupiter.api.Test
+
+class AnchorTest {
+    private fun solid(name: String, vararg args: Value): Solid =
+        SolidValueType.providesFunctions.first { it.name == name }.execute(args.toList()) as Solid
+
+    private fun slice(name: String, vararg args: Value): Slice =
+        SliceValueType.providesFunctions.first { it.name == name }.execute(args.toList()) as Slice
+
+    private fun assertBounds(low: Vec3, high: Vec3, s: Solid) {
+        val box = s.boundingBox()
+        assertEquals(low.x, box.low.x, 1e-4)
+        assertEquals(low.y, box.low.y, 1e-4)
+        assertEquals(low.z, box.low.z, 1e-4)
+        assertEquals(high.x, box.high.x, 1e-4)
+        assertEquals(high.y, box.high.y, 1e-4)
+        assertEquals(high.z, box.high.z, 1e-4)
+    }
+
+    private fun assertBounds(minX: Double, minY: Double, maxX: Double, maxY: Double, s: Slice) {
+        val points = s.toPoints()
+        assertEquals(minX, points.minOf { it.x }, 1e-4)
+        assertEquals(minY, points.minOf { it.y }, 1e-4)
+        assertEquals(maxX, points.maxOf { it.x }, 1e-4)
+        assertEquals(maxY, points.maxOf { it.y }, 1e-4)
+    }
+
+    /**
+     * Check a solid with the given extents, created with each anchor. The extents
+     * are the size of the bounding box, so they're the same for every anchor.
+     */
+    private fun checkSolidAnchors(x: Double, y: Double, z: Double, create: (String) -> Solid) {
+        assertBounds(Vec3(-x / 2, -y / 2, -z / 2), Vec3(x / 2, y / 2, z / 2), create("center"))
+        assertBounds(Vec3(-x / 2, -y / 2, 0.0), Vec3(x / 2, y / 2, z), create("bottom"))
+        assertBounds(Vec3(-x / 2, -y / 2, -z), Vec3(x / 2, y / 2, 0.0), create("top"))
+        assertBounds(Vec3(0.0, 0.0, 0.0), Vec3(x, y, z), create("min_corner"))
+    }
+
+    private fun checkSliceAnchors(x: Double, y: Double, create: (String) -> Slice) {
+        assertBounds(-x / 2, -y / 2, x / 2, y / 2, create("center"))
+        assertBounds(-x / 2, 0.0, x / 2, y, create("bottom"))
+        assertBounds(-x / 2, -y, x / 2, 0.0, create("top"))
+        assertBounds(0.0, 0.0, x, y, create("min_corner"))
+    }
+
+    @Test
+    fun testSolidDefaults() {
+        assertBounds(Vec3(-1.0, -2.0, -3.0), Vec3(1.0, 2.0, 3.0),
+            solid("cuboid", FloatValue(2.0), FloatValue(4.0), FloatValue(6.0)))
+        assertBounds(Vec3(-2.0, -2.0, -2.0), Vec3(2.0, 2.0, 2.0),
+            solid("ovoid", FloatValue(2.0), IntegerValue(16)))
+        // The default cylinder hangs down from the origin, with its top face centered on it.
+        assertBounds(Vec3(-1.0, -1.0, -5.0), Vec3(1.0, 1.0, 0.0),
+            solid("cylinder", FloatValue(5.0), FloatValue(1.0), FloatValue(1.0), IntegerValue(4)))
+    }
+
+    @Test
+    fun testSolidAnchors() {
+        checkSolidAnchors(2.0, 4.0, 6.0) {
+            solid("cuboid", FloatValue(2.0), FloatValue(4.0), FloatValue(6.0), StringValue(it))
+        }
+        checkSolidAnchors(4.0, 4.0, 4.0) { solid("ovoid", FloatValue(2.0), IntegerValue(16), StringValue(it)) }
+        checkSolidAnchors(4.0, 6.0, 8.0) {
+            solid("ovoid", FloatValue(2.0), FloatValue(3.0), FloatValue(4.0), IntegerValue(16), StringValue(it))
+        }
+        // With four facets, the vertices of the cylinder are on the axes, so its bounding
+        // box is exactly as wide as its diameter.
+        checkSolidAnchors(2.0, 2.0, 5.0) {
+            solid("cylinder", FloatValue(5.0), FloatValue(1.0), FloatValue(1.0), IntegerValue(4), StringValue(it))
+        }
+        val tet = solid("tetrahedron", FloatValue(2.0)).boundingBox()
+        checkSolidAnchors(tet.high.x - tet.low.x, tet.high.y - tet.low.y, tet.high.z - tet.low.z) {
+            solid("tetrahedron", FloatValue(2.0), StringValue(it))
+        }
+    }
+
+    @Test
+    fun testCylinderAnchorsAreOnItsAxis() {
+        // A three-sided cylinder has a vertex on the +x axis, and its opposite side at x = -0.5,
+        // so centering its bounding box would move its axis off of the origin.
+        val c = solid("cylinder", FloatValue(5.0), FloatValue(1.0), FloatValue(1.0), IntegerValue(3), StringValue("center"))
+        assertEquals(1.0, c.boundingBox().high.x, 1e-4)
+        assertEquals(-0.5, c.boundingBox().low.x, 1e-4)
+        assertEquals(-2.5, c.boundingBox().low.z, 1e-4)
+    }
+
+    @Test
+    fun testSliceDefaults() {
+        assertBounds(0.0, 0.0, 3.0, 2.0, slice("rectangle", FloatValue(3.0), FloatValue(2.0)))
+        assertBounds(-1.0, -1.0, 1.0, 1.0, slice("circle", FloatValue(1.0), IntegerValue(4)))
+        assertBounds(-2.0, 0.0, 2.0, 3.0, slice("triangle", FloatValue(4.0), FloatValue(3.0)))
+    }
+
+    @Test
+    fun testSliceAnchors() {
+        checkSliceAnchors(3.0, 2.0) { slice("rectangle", FloatValue(3.0), FloatValue(2.0), StringValue(it)) }
+        checkSliceAnchors(2.0, 2.0) { slice("circle", FloatValue(1.0), IntegerValue(4), StringValue(it)) }
+        checkSliceAnchors(4.0, 2.0) {
+            slice("oval", FloatValue(2.0), FloatValue(1.0), IntegerValue(4), StringValue(it))
+        }
+        checkSliceAnchors(4.0, 3.0) { slice("triangle", FloatValue(4.0), FloatValue(3.0), StringValue(it)) }
+    }
+
+    @Test
+    fun testSplitUsesSignature() {
+        val signature =
+            FunctionSignature.multi(
+                Anchor.withAnchors(listOf(listOf(Param("name", StringValueType.asType)))),
+                SliceValueType.asType,
+            )
+        // With one argument, the string is the constructor's own parameter.
+        val (params, anchor) = Anchor.split(listOf(StringValue("top")), signature)
+        assertEquals(1, params.size)
+        assertNull(anchor)
+        // With two, the last one is the anchor.
+        val (anchoredParams, anchored) = Anchor.split(listOf(StringValue("x"), StringValue("top")), signature)
+        assertEquals(1, anchoredParams.size)
+        assertEquals(Anchor.Top, anchored)
+    }
+
+    @Test
+    fun testUnknownAnchor() {
+        assertFailsWith<SimplexEvaluationError> {
+            solid("cuboid", FloatValue(1.0), FloatValue(1.0), FloatValue(1.0), StringValue("middle"))
+        }
+    }
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.solid
+
+import kotlin.test.assertEquals
+import kotlin.test.assertFailsWith
+import org.goodmath.simplex.runtime.SimplexEvaluationError
+import org.goodmath.simplex.runtime.values.manifold.Solid
+import org.goodmath.simplex.runtime.values.primitives.Vec3
+import org.junit.jupiter.api.Test
+
+class ComponentsTest {
+    private val small = Solid.cuboid(1.0, 2.0, 2.0, false)
+    private val large = Solid.cuboid(2.0, 2.0, 2.0, false).move(10.0, 0.0, 0.0)
+
+    @Test
+    fun testComposeAndDecompose() {
+        val both = Solid.compose(listOf(small, large))
+        assertEquals(2, both.numComponents())
+        assertEquals(1, small.numComponents())
+        assertEquals(12.0, both.volume().d, 1e-4)
+
+        val parts = both.decompose()
+        assertEquals(2, parts.size)
+        val volumes = parts.map { it.volume().d }.sorted()
+        assertEquals(4.0, volumes[0], 1e-4)
+        assertEquals(8.0, volumes[1], 1e-4)
+    }
+
+    @Test
+    fun testTouchingSolidsAreSeparateComponents() {
+        // The cubes share a face, but composing them doesn't join them.
+        val touching = Solid.compose(listOf(small, Solid.cuboid(1.0, 2.0, 2.0, false).move(1.0, 0.0, 0.0)))
+        assertEquals(2, touching.numComponents())
+        assertEquals(touching.decompose().size, touching.numComponents())
+    }
+
+    @Test
+    fun testHullAll() {
+        // The boxes have the same 2x2 cross section, so their hull is the box
+        // that runs from one to the other.
+        val hull = Solid.hullAll(listOf(small, large))
+        assertEquals(1, hull.numComponents())
+        assertEquals(12.0 * 2.0 * 2.0, hull.volume().d, 1e-4)
+    }
+
+    @Test
+    fun testHullPoints() {
+        val tetra =
+            Solid.hullPoints(
+                listOf(Vec3(0.0, 0.0, 0.0), Vec3(1.0, 0.0, 0.0), Vec3(0.0, 1.0, 0.0), Vec3(0.0, 0.0, 1.0))
+            )
+        assertEquals(1.0 / 6.0, tetra.volume().d, 1e-4)
+
+        // Interior points don't change the hull.
+        val cube =
+            Solid.hullPoints(
+                listOf(0.0, 2.0).flatMap { x ->
+                    listOf(0.0, 2.0).flatMap { y -> listOf(0.0, 2.0).map { z -> Vec3(x, y, z) } }
+                } + Vec3(1.0, 1.0, 1.0)
+            )
+        assertEquals(8.0, cube.volume().d, 1e-4)
+
+        assertFailsWith<SimplexEvaluationError> {
+            Solid.hullPoints(listOf(Vec3(0.0, 0.0, 0.0), Vec3(1.0, 0.0, 0.0), Vec3(0.0, 1.0, 0.0)))
+        }
+    }
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.solid
+
+import kotlin.math.PI
+import kotlin.test.assertEquals
+import kotlin.test.assertFailsWith
+import org.goodmath.simplex.runtime.SimplexEvaluationError
+import org.goodmath.simplex.runtime.values.manifold.Slice
+import org.goodmath.simplex.runtime.values.manifold.Solid
+import org.goodmath.simplex.runtime.values.primitives.Vec3
+import org.junit.jupiter.api.Test
+
+class PrimitivesTest {
+    private fun assertBounds(low: Vec3, high: Vec3, s: Solid) {
+        val box = s.boundingBox()
+        assertEquals(low.x, box.low.x, 1e-4)
+        assertEquals(low.y, box.low.y, 1e-4)
+        assertEquals(low.z, box.low.z, 1e-4)
+        assertEquals(high.x, box.high.x, 1e-4)
+        assertEquals(high.y, box.high.y, 1e-4)
+        assertEquals(high.z, box.high.z, 1e-4)
+    }
+
+    @Test
+    fun testTorus() {
+        val torus = Solid.torus(5.0, 1.0, 64)
+        assertBounds(Vec3(-6.0, -6.0, -1.0), Vec3(6.0, 6.0, 1.0), torus)
+        // The volume of a torus is 2 pi^2 R r^2; the faceted one is a little smaller.
+        assertEquals(2.0 * PI * PI * 5.0, torus.volume().d, 0.5)
+        assertFailsWith<SimplexEvaluationError> { Solid.torus(1.0, 2.0, 0) }
+    }
+
+    @Test
+    fun testCapsule() {
+        assertBounds(Vec3(-1.0, -1.0, -5.0), Vec3(1.0, 1.0, 5.0), Solid.capsule(10.0, 1.0, 16))
+        assertFailsWith<SimplexEvaluationError> { Solid.capsule(1.0, 1.0, 0) }
+    }
+
+    @Test
+    fun testPrism() {
+        val prism = Solid.prism(4, 1.0, 3.0)
+        assertBounds(Vec3(-1.0, -1.0, 0.0), Vec3(1.0, 1.0, 3.0), prism)
+        // A square with a circumradius of 1 has an area of 2.
+        assertEquals(6.0, prism.volume().d, 1e-4)
+    }
+
+    @Test
+    fun testPyramid() {
+        val pyramid = Solid.pyramid(Slice.rectangle(2.0, 2.0).translate(-1.0, -1.0), 3.0)
+        assertBounds(Vec3(-1.0, -1.0, 0.0), Vec3(1.0, 1.0, 3.0), pyramid)
+        assertEquals(4.0, pyramid.volume().d, 1e-4)
+    }
+
+    @Test
+    fun testWedge() {
+        val wedge = Solid.wedge(2.0, 3.0, 4.0)
+        assertBounds(Vec3(0.0, 0.0, 0.0), Vec3(2.0, 3.0, 4.0), wedge)
+        assertEquals(12.0, wedge.volume().d, 1e-4)
+    }
+
+    @Test
+    fun testRoundedCuboid() {
+        val box = Solid.roundedCuboid(Vec3(4.0, 6.0, 8.0), 1.0, 16)
+        assertBounds(Vec3(-2.0, -3.0, -4.0), Vec3(2.0, 3.0, 4.0), box)
+        assertFailsWith<SimplexEvaluationError> { Solid.roundedCuboid(Vec3(1.0, 6.0, 8.0), 1.0, 16) }
+        assertFailsWith<SimplexEvaluationError> { Solid.roundedCuboid(Vec3(4.0, 6.0, 8.0), -1.0, 16) }
+        // With no rounding, it's a plain cuboid.
+        val plain = Solid.roundedCuboid(Vec3(4.0, 6.0, 8.0), 0.0, 16)
+        assertBounds(Vec3(-2.0, -3.0, -4.0), Vec3(2.0, 3.0, 4.0), plain)
+        assertEquals(4.0 * 6.0 * 8.0, plain.volume().d, 1e-6)
+    }
+
+    @Test
+    fun testRegularPolygon() {
+        val hex = Slice.regularPolygon(6, 2.0)
+        val points = hex.toPoints()
+        assertEquals(6, points.size)
+        assertEquals(2.0, points.maxOf { it.x }, 1e-4)
+        assertEquals(-2.0, points.minOf { it.x }, 1e-4)
+        assertFailsWith<SimplexEvaluationError> { Slice.regularPolygon(2, 1.0) }
+    }
+}
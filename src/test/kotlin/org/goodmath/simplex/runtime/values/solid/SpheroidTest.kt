@@ -0,0 +1,51 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.solid
+
+import kotlin.math.PI
+import kotlin.test.assertEquals
+import kotlin.test.assertFailsWith
+import org.goodmath.simplex.runtime.SimplexEvaluationError
+import org.goodmath.simplex.runtime.values.manifold.Solid
+import org.junit.jupiter.api.Test
+
+class SpheroidTest {
+    @Test
+    fun testRadii() {
+        // Each radius is the extent along its own axis, whichever of them is largest.
+        for ((x, y, z) in listOf(Triple(2.0, 3.0, 4.0), Triple(4.0, 3.0, 2.0), Triple(3.0, 4.0, 2.0))) {
+            val box = Solid.spheroid(x, y, z, 16).boundingBox()
+            assertEquals(-x, box.low.x, 1e-4)
+            assertEquals(x, box.high.x, 1e-4)
+            assertEquals(-y, box.low.y, 1e-4)
+            assertEquals(y, box.high.y, 1e-4)
+            assertEquals(-z, box.low.z, 1e-4)
+            assertEquals(z, box.high.z, 1e-4)
+        }
+    }
+
+    @Test
+    fun testZeroRadii() {
+        assertFailsWith<SimplexEvaluationError> { Solid.spheroid(0.0, 0.0, 0.0, 16) }
+    }
+
+    @Test
+    fun testVolume() {
+        val ovoid = Solid.spheroid(2.0, 3.0, 4.0, 128)
+        val expected = 4.0 / 3.0 * PI * 2.0 * 3.0 * 4.0
+        assertEquals(expected, ovoid.volume().d, expected * 0.01)
+    }
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.runtime.values.solid
+
+import kotlin.test.assertEquals
+import kotlin.test.assertFailsWith
+import kotlin.test.assertTrue
+import org.antlr.v4.runtime.CharStreams
+import org.goodmath.simplex.parser.SimplexParseListener
+import org.goodmath.simplex.runtime.SimplexAnalysisError
+import org.goodmath.simplex.runtime.values.manifold.MeshData
+import org.goodmath.simplex.runtime.values.manifold.Solid
+import org.goodmath.simplex.runtime.values.manifold.Tolerance
+import org.junit.jupiter.api.Test
+
+class ToleranceTest {
+    private fun parse(program: String) =
+        SimplexParseListener().parse("test", CharStreams.fromString(program.trimIndent())) { _, _, _ -> }
+
+    @Test
+    fun testDegenerateTriangles() {
+        val mesh =
+            MeshData(
+                doubleArrayOf(
+                    0.0, 0.0, 0.0,
+                    1.0, 0.0, 0.0,
+                    0.0, 1.0, 0.0,
+                    // A sliver, 1e-6 high.
+                    2.0, 1e-6, 0.0,
+                ),
+                intArrayOf(
+                    0, 1, 2,
+                    0, 1, 3,
+                    // Collapsed to a point.
+                    2, 2, 2,
+                ),
+            )
+        assertEquals(2, Tolerance.degenerateTriangles(mesh, 1e-4))
+        assertEquals(1, Tolerance.degenerateTriangles(mesh, 1e-7))
+    }
+
+    @Test
+    fun testSolidTolerance() {
+        val cube = Solid.cuboid(10.0, 10.0, 10.0, true)
+        assertEquals(0, cube.degenerateTriangles())
+        val coarse = cube.setTolerance(0.01)
+        assertTrue(coarse.tolerance() >= 0.01)
+        assertEquals(0, coarse.simplify().degenerateTriangles())
+    }
+
+    @Test
+    fun testDefaultTolerance() {
+        val cube = Solid.cuboid(10.0, 10.0, 10.0, true)
+        val union = Tolerance.withDefault(0.05) { cube + cube.move(10.0, 0.0, 0.0) }
+        assertTrue(union.tolerance() >= 0.05)
+        assertEquals(0.0, Tolerance.default)
+    }
+
+    @Test
+    fun testToleranceAnnotation() {
+        val model =
+            parse(
+                """
+                @tolerance(0.001)
+                produce("fine") {
+                  cylinder(1.0, 1.0)
+                }
+
+                produce("default") {
+                  cylinder(1.0, 1.0)
+                }
+                """
+            )
+        assertEquals(listOf(0.001, null), model.products.map { it.tolerance })
+        assertFailsWith<SimplexAnalysisError> {
+            parse(
+                """
+                @tolerance(0.001)
+                fun f(): Int { 1 }
+                """
+            )
+        }
+        assertFailsWith<SimplexAnalysisError> { parse("@tolerance(0)\nproduce(\"p\") { 1 }") }
+    }
+}
@@ -0,0 +1,184 @@
+/*
+ * Copyright 2024 Mark C. Chu-Carroll
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package org.goodmath.simplex.scad
+
+import kotlin.math.PI
+import kotlin.math.sin
+import kotlin.test.Test
+import kotlin.test.assertEquals
+import kotlin.test.assertFailsWith
+import kotlin.test.assertTrue
+import org.antlr.v4.runtime.CharStreams
+import org.goodmath.simplex.parser.SimplexParseListener
+import org.goodmath.simplex.runtime.Env
+import org.goodmath.simplex.runtime.RootEnv
+import org.goodmath.simplex.runtime.SimplexError
+import org.goodmath.simplex.runtime.values.manifold.OpenScad
+import org.goodmath.simplex.runtime.values.manifold.Slice
+import org.goodmath.simplex.runtime.values.manifold.Solid
+import org.goodmath.simplex.runtime.values.primitives.Vec2
+
+class ScadTranslatorTest {
+    private fun translate(scad: String): Pair<String, List<ScadTranslator.Issue>> {
+        val result = ScadTranslator.translate("test.scad", scad.trimIndent())
+        // Whatever the translator produces has to be valid Simplex syntax.
+        SimplexParseListener().parse("test.s3d", CharStreams.fromString(result.first)) { _, _, _ -> }
+        return result
+    }
+
+    /** Analyze and evaluate a translated model, and get the solid of its main product. */
+    private fun evaluate(text: String): Solid {
+        try {
+            val model = SimplexParseListener().parse("test.s3d", CharStreams.fromString(text)) { _, _, _ -> }
+            Env.createRootEnv()
+            model.analyze()
+            val env = Env(model.defs, RootEnv)
+            env.installDefinitionValues()
+            val product = model.products.first { it.name == "main" }
+            return product.combineSolids(product.evaluate(env))!!
+        } finally {
+            RootEnv.reset()
+        }
+    }
+
+    private fun assertSameBounds(expected: Solid, actual: Solid) {
+        val e = expected.boundingBox()
+        val a = actual.boundingBox()
+        for ((x, y) in listOf(e.low.x to a.low.x, e.low.y to a.low.y, e.low.z to a.low.z,
+                e.high.x to a.high.x, e.high.y to a.high.y, e.high.z to a.high.z)) {
+            assertEquals(x, y, 1e-6)
+        }
+    }
+
+    @Test
+    fun testModulesAndDifference() {
+        val (text, issues) =
+            translate(
+                """
+                module post(h = 10, r = 2) {
+                    translate([0, 0, 1]) cylinder(h = h, r = r, ${'$'}fn = 16);
+                }
+                difference() {
+                    cube([20, 20, 5]);
+                    post(r = 3);
+                }
+                """
+            )
+        assertEquals(
+            """
+            // Translated from test.scad by simplex import-scad.
+
+            fun post(h: Float, r: Float): Solid {
+                cylinder(h, r, r, 16)->move(0.0, 0.0, h)->move(0.0, 0.0, 1.0)
+            }
+
+            produce("main") {
+                cuboid(20.0, 20.0, 5.0, "min_corner") - post(10.0, 3.0)
+            }
+
+            """.trimIndent(),
+            text,
+        )
+        assertEquals(emptyList(), issues)
+
+        // The post is centered on a corner of the cube, so a quarter of it is cut out,
+        // from z = 1 up to the top of the cube.
+        val solid = evaluate(text)
+        assertSameBounds(Solid.cuboid(20.0, 20.0, 5.0, false), solid)
+        val quarterArea = 0.5 * 16 * 3.0 * 3.0 * sin(2 * PI / 16) / 4.0
+        assertEquals(20.0 * 20.0 * 5.0 - quarterArea * 4.0, solid.volume().d, 1e-3)
+    }
+
+    @Test
+    fun testTwistedScaledExtrude() {
+        val (text, issues) =
+            translate(
+                """
+                linear_extrude(height = 10, twist = 45, slices = 8, scale = 0.5) square([4, 2]);
+                """
+            )
+        assertEquals(emptyList(), issues)
+        val expected =
+            OpenScad.linearExtrude(Slice.rectangle(4.0, 2.0), 10.0, false, 45.0, 8, Vec2(0.5, 0.5), 0)
+        val solid = evaluate(text)
+        // The slice is off center, so twisting it the wrong way would change its bounds.
+        assertSameBounds(expected, solid)
+        assertEquals(expected.volume().d, solid.volume().d, 1e-6)
+    }
+
+    @Test
+    fun testTransformsAndLoops() {
+        val (text, issues) =
+            translate(
+                """
+                n = 3;
+                intersection() {
+                    rotate([0, 90, 0]) scale(2) sphere(d = 4);
+                    for (i = [0:n-1]) rotate(i * 30) cube(1, center = true);
+                }
+                """
+            )
+        assertEquals(
+            """
+            // Translated from test.scad by simplex import-scad.
+
+            let n = 3.0
+
+            produce("main") {
+                ovoid(4.0 / 2.0)->scale(2.0, 2.0, 2.0)->rotate(0.0, 90.0, 0.0)->intersect(union(for i in [0.0, 1.0, 2.0] { cuboid(1.0, 1.0, 1.0, "center")->rotz(i * 30.0) }))
+            }
+
+            """.trimIndent(),
+            text,
+        )
+        assertEquals(emptyList(), issues)
+    }
+
+    @Test
+    fun testUntranslatableConstructs() {
+        val (text, issues) =
+            translate(
+                """
+                module frame() {
+                    children();
+                }
+                x = sin(30);
+                linear_extrude(height = 2) square([4, 2], center = true);
+                """
+            )
+        assertEquals(setOf(1, 2, 4), issues.map { it.line }.toSet())
+        assertTrue(text.contains("let x = 0.0 /* untranslated: function 'sin' */"))
+        assertTrue(text.contains("rectangle(4.0, 2.0)->move(-4.0 / 2.0, -2.0 / 2.0)->extrude(2.0, 0)"))
+    }
+
+    @Test
+    fun testConstantConditions() {
+        val (text, _) =
+            translate(
+                """
+                show_lid = false;
+                if (show_lid) cube(1); else sphere(1);
+                """
+            )
+        assertTrue(text.contains("    ovoid(1.0)\n"))
+    }
+
+    @Test
+    fun testSyntaxError() {
+        val e = assertFailsWith<SimplexError> { ScadTranslator.translate("bad.scad", "cube(1\n") }
+        assertEquals(SimplexError.Kind.Parser, e.kind)
+    }
+}